@@ -13,6 +13,7 @@ require (
 	golang.org/x/crypto v0.17.0
 	golang.org/x/mod v0.24.0
 	golang.org/x/tools v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/postgres v1.5.11
 	gorm.io/gorm v1.26.1
 )
@@ -2,6 +2,10 @@ package main
 
 import (
 	"deva/src/config"
+	"deva/src/middlewares"
+	ci "deva/src/modules/ci/services"
+	deployments "deva/src/modules/deployments/services"
+	plans "deva/src/modules/plans/services"
 	"deva/src/routes"
 	"deva/src/services"
 	"github.com/gofiber/fiber/v2"
@@ -18,7 +22,10 @@ func main() {
 	} else {
 		log.Println("✅ .env file loaded successfully")
 	}
-	app := fiber.New()
+	// Request bodies are streamed so OSV archives for the vulnerability database do not have to
+	// fit in memory; every other route keeps the default body limit
+	app := fiber.New(fiber.Config{StreamRequestBody: true, DisablePreParseMultipartForm: true})
+	app.Use(middlewares.BodyLimit(fiber.DefaultBodyLimit, "POST /api/v1/vulnerability-database"))
 
 	// CORS config
 	app.Use(cors.New(cors.Config{
@@ -53,8 +60,18 @@ func main() {
 
 	// Connect to db
 	config.ConnectDatabase()
+	// Fail deployments interrupted by a previous shutdown
+	deployments.RecoverInterruptedDeployments()
+	// Fail pipelines interrupted by a previous shutdown
+	ci.RecoverInterruptedPipelines()
+	// Expire pipeline artifacts and trim the CI cache
+	ci.StartCIStoreCleanup()
+	// Start deployments scheduled for later
+	deployments.StartDeploymentScheduler()
 	// Connect to redis
 	config.ConnectRedis()
+	// Reconcile daily deployment counters into usage metrics
+	plans.StartDeploymentUsageReconciler()
 	// Register other routes
 	routes.RegisterRoutes(app)
 	err := app.Listen(":2350")
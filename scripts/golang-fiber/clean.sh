@@ -66,5 +66,11 @@ if [ -d "$WORKDIR" ]; then
   rm -rf "$WORKDIR"
 fi
 
+# --- Step 4: Remove the job's Docker context ---
+if [ -n "$CONTEXT_NAME" ] && docker context inspect "$CONTEXT_NAME" > /dev/null 2>&1; then
+  echo "🔌 Removing Docker context $CONTEXT_NAME..." >&2
+  docker context rm -f "$CONTEXT_NAME" > /dev/null 2>&1 || true
+fi
+
 sleep 1
 exit 0
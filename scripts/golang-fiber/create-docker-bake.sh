@@ -26,10 +26,13 @@ fi
 : "${FRAMEWORK:?FRAMEWORK environment variable not set}"
 : "${APP_VERSION:?APP_VERSION environment variable not set}"
 : "${WITH_DB:?WITH_DB environment variable not set}"
-: "${DB_PASS:?DB_PASS environment variable not set}"
 : "${DB_NAME:?DB_NAME environment variable not set}"
 : "${DB_USER:?DB_USER environment variable not set}"
 
+if [ "$WITH_DB" = "true" ]; then
+  : "${DB_PASS:?DB_PASS environment variable not set}"
+fi
+
 # Ensure output directory exists
 mkdir -p "$(dirname "$OUTPUT_FILE")"
 
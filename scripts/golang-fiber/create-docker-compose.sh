@@ -26,12 +26,15 @@ fi
 : "${APP_NAME:?APP_NAME environment variable not set}"
 : "${DB_NAME:?DB_NAME environment variable not set}"
 : "${DB_USER:?DB_USER environment variable not set}"
-: "${DB_PASS:?DB_PASS environment variable not set}"
 : "${DB_PORT:?DB_PORT environment variable not set}"
 : "${APP_PORT:?APP_PORT environment variable not set}"
 : "${FRAMEWORK:?FRAMEWORK environment variable not set}"
 : "${APP_VERSION:?APP_VERSION environment variable not set}"
 
+if [ "$WITH_DB" = "true" ]; then
+  : "${DB_PASS:?DB_PASS environment variable not set}"
+fi
+
 # --- Ensure output directory exists ---
 mkdir -p "$WORKDIR"
 
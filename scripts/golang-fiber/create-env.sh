@@ -13,12 +13,16 @@ set -e
 : "${WITH_DB:?WITH_DB is required}"
 : "${RUN_WITH_DOCKER_COMPOSE:?RUN_WITH_DOCKER_COMPOSE is required}"
 : "${ENV:?ENV is required}"
-: "${DB_PASS:?DB_PASS is required}"
 : "${DB_NAME:?DB_NAME is required}"
 : "${DB_USER:?DB_USER is required}"
 : "${DB_PORT:?DB_PORT is required}"
 : "${APP_PORT:?APP_PORT is required}"
 
+# Database credentials are only needed when a database is included
+if [ "$WITH_DB" = "true" ]; then
+  : "${DB_PASS:?DB_PASS is required}"
+fi
+
 APP_NAME="${PROJECT_NAME}"
 GO_TAR="go${GO_VERSION}.linux-amd64.tar.gz"
 IMAGE_NAME=${APP_NAME}:${APP_VERSION}
@@ -32,14 +32,16 @@ fi
 
 # Change to project directory
 cd "${BASE_DIR}/public/${PROJECT_NAME}" >/dev/null 2>&1
+# DOCKER_HOST (tcp://host:port) must not shadow the context, keep it for the context endpoint
+REMOTE_DOCKER_HOST="$DOCKER_HOST"
 unset DOCKER_HOST
-# Docker context setup (quiet mode)
-if ! docker context inspect "$CONTEXT_NAME" >/dev/null 2>&1; then
-  docker context create "$CONTEXT_NAME" \
-    --docker "host=tcp://${DOCKER_HOST}:443,ca=${TLSCACERT_PATH},cert=${TLSCERT_PATH},key=${TLSKEY_PATH}" >/dev/null 2>&1
-fi
+# Docker context setup (quiet mode), recreated so it always points at this job's certificates
+docker context rm -f "$CONTEXT_NAME" >/dev/null 2>&1 || true
+docker context create "$CONTEXT_NAME" \
+  --docker "host=${REMOTE_DOCKER_HOST},ca=${TLSCACERT_PATH},cert=${TLSCERT_PATH},key=${TLSKEY_PATH}" >/dev/null 2>&1
 
-docker context use "$CONTEXT_NAME" >/dev/null 2>&1
+# Select the context for this process only: "docker context use" would switch every job on the host
+export DOCKER_CONTEXT="$CONTEXT_NAME"
 
 # Execute commands based on RUN_WITH_DOCKER_COMPOSE
 if [ "$RUN_WITH_DOCKER_COMPOSE" == "true" ]; then
@@ -2,6 +2,7 @@ package config
 
 import (
 	apiKeys "deva/src/modules/apiKeys/models"
+	badges "deva/src/modules/badges/models"
 	billing "deva/src/modules/billing/model"
 	captcha "deva/src/modules/captcha/models"
 	ci "deva/src/modules/ci/models"
@@ -18,6 +19,7 @@ import (
 	templates "deva/src/modules/templates/models"
 	users "deva/src/modules/users/models"
 	verifications "deva/src/modules/verifications/models"
+	vulnerabilities "deva/src/modules/vulnerabilities/models"
 	webhooks "deva/src/modules/webhooks/models"
 	"deva/src/services"
 	"fmt"
@@ -103,17 +105,29 @@ func runMigrations(db *gorm.DB) error {
 		projects.MigrateProjects,
 		projects.MigrateProjectDeployment,
 		templates.MigrateProjectTemplates,
+		templates.MigrateTemplateParameters,
 		projects.MigrateProjectConfigs,
 		projects.MigrateProjectFiles,
 		ci.MigrateCIPipelines,
+		ci.MigratePipelineCells,
 		ci.MigratePipelineSteps,
+		ci.MigrateCICacheEntries,
+		ci.MigrateCIArtifacts,
 		deployments.MigrateDeployments,
 		deployments.MigrateDeploymentTargets,
+		deployments.MigrateFreezeWindows,
+		deployments.MigrateApprovalPolicies,
+		deployments.MigrateDeploymentApprovals,
+		vulnerabilities.MigrateVulnerabilityScans,
+		vulnerabilities.MigrateVulnerabilityDatabaseImports,
 		github.MigrateGitHubIntegrations,
 		logs.MigrateActivityLogs,
 		apiKeys.MigrateAPIKeys,
 		notifications.MigrateNotifications,
 		webhooks.MigrateWebhooks,
+		webhooks.MigrateInboundWebhooks,
+		webhooks.MigrateWebhookDeliveries,
+		badges.MigrateProjectBadges,
 		secrets.MigrateSecrets,
 		templates.MigrateUsageMetrics,
 		verifications.MigrateVerificationCode,
@@ -160,6 +174,10 @@ func SeedForNewSystem(db *gorm.DB) error {
 		return fmt.Errorf("seeding root user failed: %w", err)
 	}
 
+	if err := seedTemplates(db); err != nil {
+		return fmt.Errorf("seeding templates failed: %w", err)
+	}
+
 	log.Println("✅ System seeding completed successfully")
 	return nil
 }
@@ -293,3 +311,51 @@ func seedRootUser(db *gorm.DB) error {
 
 	return nil
 }
+
+func seedTemplates(db *gorm.DB) error {
+	log.Println("🔹 Seeding templates...")
+	var root users.User
+	if err := db.Where("name = ?", "root").First(&root).Error; err != nil {
+		return err
+	}
+
+	fiberTemplate := templates.ProjectTemplate{
+		Name:        "golang-fiber",
+		Description: "Go web service built with Fiber, Docker and optional database",
+		Language:    "golang",
+		IsOfficial:  true,
+		UpdatedBy:   root.ID,
+	}
+	if err := db.FirstOrCreate(&fiberTemplate, templates.ProjectTemplate{Name: fiberTemplate.Name}).Error; err != nil {
+		return err
+	}
+
+	withDB := `{"WITH_DB": "true"}`
+	parameters := []templates.TemplateParameter{
+		{Name: "LANGUAGE", Label: "Language", Type: "enum", EnumChoices: `["golang"]`, Default: "golang", Required: true},
+		{Name: "FRAMEWORK", Label: "Framework", Type: "enum", EnumChoices: `["fiber"]`, Default: "fiber", Required: true},
+		{Name: "ENV", Label: "Environment", Type: "enum", EnumChoices: `["dev", "prod"]`, Default: "dev", Required: true},
+		{Name: "GO_VERSION", Label: "Go version", Type: "string", Default: "1.24.2", Required: true},
+		{Name: "AIR_VERSION", Label: "Air version", Type: "string", Default: "latest", Required: true, VisibleWhen: `{"ENV": "dev"}`},
+		{Name: "APP_VERSION", Label: "Application version", Type: "string", Default: "1.0.0", Required: true},
+		{Name: "APP_PORT", Label: "Application port", Type: "number", Default: "8080", Required: true},
+		{Name: "RUN_WITH_DOCKER_COMPOSE", Label: "Run with Docker Compose", Type: "boolean", Default: "true", Required: true},
+		{Name: "WITH_DB", Label: "Include a database", Type: "boolean", Default: "false", Required: true},
+		{Name: "DB_TYPE", Label: "Database", Type: "enum", EnumChoices: `["mysql", "postgres", "mongodb"]`, Default: "postgres", Required: true, VisibleWhen: withDB},
+		{Name: "DB_VERSION", Label: "Database version", Type: "string", Default: "16", Required: true, VisibleWhen: withDB},
+		{Name: "DB_PORT", Label: "Database port", Type: "number", Default: "5432", Required: true, VisibleWhen: withDB},
+		{Name: "DB_NAME", Label: "Database name", Type: "string", Default: "app", Required: true, VisibleWhen: withDB},
+		{Name: "DB_USER", Label: "Database user", Type: "string", Default: "app", Required: true, VisibleWhen: withDB},
+		{Name: "DB_PASS", Label: "Database password", Type: "string", Required: true, VisibleWhen: withDB},
+	}
+
+	for i, param := range parameters {
+		param.TemplateID = fiberTemplate.ID
+		param.Position = i
+		param.UpdatedBy = root.ID
+		if err := db.FirstOrCreate(&param, templates.TemplateParameter{TemplateID: param.TemplateID, Name: param.Name}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package functions
+
+import (
+	"bufio"
+	"context"
+	"deva/src/lib/docker"
+	"deva/src/lib/interfaces"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+const (
+	dockerBuildTimeout = 30 * time.Minute
+	// cliErrorLines is how much of the stderr of a failed docker command its error keeps
+	cliErrorLines = 20
+)
+
+// dockerBuildAndRun builds the generated project on the remote daemon through the Engine API
+// and starts it as a single container, replacing docker-build.sh and docker-run.sh.
+func dockerBuildAndRun(projectName string, env map[string]string, remote interfaces.RemoteBuildConfig) func(sc *interfaces.SafeConn) error {
+	return func(sc *interfaces.SafeConn) error {
+		client, err := newDockerClient(remote)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dockerBuildTimeout)
+		defer cancel()
+
+		if _, err := client.Ping(ctx); err != nil {
+			return err
+		}
+
+		imageName := fmt.Sprintf("%s-%s:%s", projectName, env["FRAMEWORK"], env["APP_VERSION"])
+		containerName := fmt.Sprintf("%s-%s", projectName, env["FRAMEWORK"])
+
+		projectPath := remote.ProjectPath
+		if projectPath == "" {
+			projectPath = "public/" + projectName
+		}
+
+		buildContext, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(docker.TarDirectory(projectPath, writer))
+		}()
+		defer buildContext.Close()
+
+		_, err = client.ImageBuild(ctx, buildContext, docker.BuildOptions{
+			Tags:   []string{imageName},
+			Labels: map[string]string{"deva.project": projectName},
+		}, func(msg docker.BuildMessage) {
+			if line := strings.TrimRight(msg.Stream, "\n"); line != "" {
+				sc.SafeWrite(websocket.TextMessage, []byte(line))
+			} else if msg.Status != "" {
+				sc.SafeWrite(websocket.TextMessage, []byte(strings.TrimSpace(msg.Status+" "+msg.Progress)))
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		// A container left over from a previous run of the same project would block the name
+		if err := client.ContainerRemove(ctx, containerName, true, false); err != nil && !docker.IsNotFound(err) {
+			return err
+		}
+
+		port := env["APP_PORT"] + "/tcp"
+		created, err := client.ContainerCreate(ctx, containerName, docker.ContainerConfig{
+			Image:        imageName,
+			Labels:       map[string]string{"deva.project": projectName},
+			ExposedPorts: map[string]struct{}{port: {}},
+			HostConfig: &docker.HostConfig{
+				PortBindings:  map[string][]docker.PortBinding{port: {{HostPort: env["APP_PORT"]}}},
+				RestartPolicy: &docker.RestartPolicy{Name: "unless-stopped"},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		for _, warning := range created.Warnings {
+			sc.SafeWrite(websocket.TextMessage, []byte("⚠️ "+warning))
+		}
+
+		return client.ContainerStart(ctx, created.ID)
+	}
+}
+
+// dockerComposeUp builds the images of docker-bake.hcl and starts docker-compose.yml on the
+// remote daemon, replacing docker-compose-up.sh. The CLI reaches the daemon through DOCKER_HOST
+// and the job's certificates, so nothing changes for other jobs on the host.
+func dockerComposeUp(projectName string, remote interfaces.RemoteBuildConfig) func(sc *interfaces.SafeConn) error {
+	return func(sc *interfaces.SafeConn) error {
+		projectPath := remote.ProjectPath
+		if projectPath == "" {
+			projectPath = "public/" + projectName
+		}
+		env, err := composeEnv(projectPath, remote)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dockerBuildTimeout)
+		defer cancel()
+
+		compose := []string{"docker", "compose", "up", "-d"}
+		if exec.CommandContext(ctx, "docker", "compose", "version").Run() != nil {
+			compose = []string{"docker-compose", "up", "-d"}
+		}
+		for _, args := range [][]string{{"docker", "buildx", "bake", "--load"}, compose} {
+			if err := runDockerCLI(ctx, sc, projectPath, env, args); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// runDockerCLI runs a docker command, streaming its output line by line. A failure returns a
+// *docker.CLIError with the last lines of stderr.
+func runDockerCLI(ctx context.Context, sc *interfaces.SafeConn, dir string, env, args []string) error {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", strings.Join(args, " "), err)
+	}
+
+	var tail []string
+	var wait sync.WaitGroup
+	stream := func(r io.Reader, keep bool) {
+		defer wait.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		// Whatever cannot be read as lines is still drained, or the command would block
+		defer io.Copy(io.Discard, r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			sc.SafeWrite(websocket.TextMessage, []byte(line))
+			if keep {
+				if tail = append(tail, line); len(tail) > cliErrorLines {
+					tail = tail[1:]
+				}
+			}
+		}
+	}
+	wait.Add(2)
+	go stream(stdout, false)
+	go stream(stderr, true)
+	wait.Wait()
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		exitCode := -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+		return &docker.CLIError{Command: strings.Join(args, " "), ExitCode: exitCode, Stderr: strings.Join(tail, "\n")}
+	}
+	return nil
+}
+
+// composeEnv is the environment of the docker CLI: the project .env, which docker-bake.hcl reads,
+// and the address and certificates of the remote daemon
+func composeEnv(projectPath string, remote interfaces.RemoteBuildConfig) ([]string, error) {
+	env := []string{"PATH=" + os.Getenv("PATH"), "HOME=" + os.Getenv("HOME")}
+	content, err := os.ReadFile(filepath.Join(projectPath, ".env"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the project .env: %w", err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if key, _, ok := strings.Cut(line, "="); ok && key != "" && !strings.HasPrefix(line, "#") {
+			env = append(env, line)
+		}
+	}
+	// Later entries win, so the .env cannot point the CLI elsewhere
+	return append(env,
+		"DOCKER_HOST="+remote.DockerHost,
+		"DOCKER_TLS_VERIFY=1",
+		"DOCKER_CERT_PATH="+filepath.Dir(remote.TLSCACertPath),
+	), nil
+}
+
+func newDockerClient(remote interfaces.RemoteBuildConfig) (*docker.Client, error) {
+	tlsConfig, err := docker.TLSConfigFromFiles(remote.TLSCACertPath, remote.TLSCertPath, remote.TLSKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return docker.NewClient(remote.DockerHost, tlsConfig)
+}
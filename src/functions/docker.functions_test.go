@@ -0,0 +1,46 @@
+package functions
+
+import (
+	"context"
+	"deva/src/lib/docker"
+	"deva/src/lib/interfaces"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRunDockerCLI(t *testing.T) {
+	env := []string{"PATH=" + os.Getenv("PATH")}
+	tests := []struct {
+		name         string
+		script       string
+		wantExitCode int
+		wantStderr   string
+	}{
+		{"success", "echo built", 0, ""},
+		{"failure", "echo building; echo 'no such service: web' >&2; exit 3", 3, "no such service: web"},
+		{"failure without stderr", "exit 1", 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runDockerCLI(context.Background(), &interfaces.SafeConn{}, t.TempDir(), env, []string{"sh", "-c", tt.script})
+			if tt.wantExitCode == 0 {
+				if err != nil {
+					t.Fatalf("runDockerCLI() error = %v", err)
+				}
+				return
+			}
+			var cliErr *docker.CLIError
+			if !errors.As(err, &cliErr) {
+				t.Fatalf("runDockerCLI() error = %v, want a *docker.CLIError", err)
+			}
+			if cliErr.ExitCode != tt.wantExitCode || cliErr.Stderr != tt.wantStderr {
+				t.Errorf("CLIError = %+v", cliErr)
+			}
+			if tt.wantStderr != "" && !strings.Contains(cliErr.Error(), tt.wantStderr) {
+				t.Errorf("Error() = %q, want it to include stderr", cliErr.Error())
+			}
+		})
+	}
+}
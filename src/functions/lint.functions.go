@@ -0,0 +1,54 @@
+package functions
+
+import (
+	"deva/src/lib/interfaces"
+	"deva/src/lib/lint"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+var findingIcons = map[string]string{
+	lint.SeverityError:   "❌",
+	lint.SeverityWarning: "⚠️",
+	lint.SeverityInfo:    "ℹ️",
+}
+
+// lintDockerFiles reports the lint findings of the generated Dockerfiles and compose file.
+// Findings are advisory and do not stop the workflow.
+func lintDockerFiles(projectName string, env map[string]string) func(sc *interfaces.SafeConn) error {
+	return func(sc *interfaces.SafeConn) error {
+		workspace := filepath.Join("public", projectName)
+		entries, err := os.ReadDir(workspace)
+		if err != nil {
+			return err
+		}
+		var paths []string
+		for _, entry := range entries {
+			if !entry.IsDir() && lint.Supports(entry.Name()) {
+				paths = append(paths, entry.Name())
+			}
+		}
+		sort.Strings(paths)
+
+		opts := lint.OptionsFromEnv(env)
+		for _, path := range paths {
+			content, err := os.ReadFile(filepath.Join(workspace, path))
+			if err != nil {
+				return err
+			}
+			findings := lint.File(path, string(content), opts)
+			summary := lint.Summarize(findings)
+			sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("🔍 %s: %d error(s), %d warning(s), %d info",
+				path, summary[lint.SeverityError], summary[lint.SeverityWarning], summary[lint.SeverityInfo])))
+			for _, finding := range findings {
+				sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("   %s %s:%d [%s] %s",
+					findingIcons[finding.Severity], path, finding.Line, finding.Rule, finding.Message)))
+			}
+		}
+		return nil
+	}
+}
@@ -5,43 +5,78 @@ import (
 	"deva/src/utils"
 	"fmt"
 	"github.com/gofiber/websocket/v2"
+	"regexp"
 	"strings"
 
 	"time"
 )
 
-func RunProjectWorkflow(c *websocket.Conn, projectName string, env map[string]string) error {
-	sc := &interfaces.SafeConn{Conn: c}
+// frameworkPattern matches the script directories under scripts/
+var frameworkPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// RunProjectWorkflow generates and builds a project with the scripts of framework. beforeExport
+// steps run right before the workspace is archived, so files they write are part of the exported
+// project.
+func RunProjectWorkflow(sc *interfaces.SafeConn, projectName, framework string, env map[string]string, remote interfaces.RemoteBuildConfig, beforeExport []interfaces.WorkflowStep) error {
+	if !frameworkPattern.MatchString(framework) {
+		sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("❌ Unsupported framework %q", framework)))
+		return fmt.Errorf("invalid framework %q", framework)
+	}
+	// Jobs run concurrently, so the framework goes to make on the command line rather than
+	// into the shared Makefile
+	makeTarget := func(target string) string {
+		return fmt.Sprintf("make FRAMEWORK=%s %s", framework, target)
+	}
+
+	if serviceErr := validateCertPaths(remote); serviceErr != nil {
+		sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("❌ %s", serviceErr.Message)))
+		return fmt.Errorf("%s: %w", serviceErr.Message, serviceErr.Err)
+	}
 
 	baseEnv := map[string]string{
 		"PROJECT_NAME":   projectName,
 		"BASE_DIR":       "/app",
-		"DOCKER_HOST":    "docker-server.tail59bd3a.ts.net",
-		"TLSCACERT_PATH": "/app/store/secrets/ca.pem",
-		"TLSCERT_PATH":   "/app/store/secrets/cert.pem",
-		"TLSKEY_PATH":    "/app/store/secrets/key.pem",
-		"CONTEXT_NAME":   "docker-server",
+		"DOCKER_HOST":    remote.DockerHost,
+		"TLSCACERT_PATH": remote.TLSCACertPath,
+		"TLSCERT_PATH":   remote.TLSCertPath,
+		"TLSKEY_PATH":    remote.TLSKeyPath,
+		"CONTEXT_NAME":   "deva-" + projectName,
 	}
 
 	for k, v := range env {
+		if _, reserved := baseEnv[k]; reserved {
+			continue
+		}
 		baseEnv[k] = v
 	}
 
 	steps := []interfaces.WorkflowStep{
-		{Name: "environment file", Command: "make create-env", Action: "creating", EnvVars: baseEnv},
-		{Name: "Dockerfile", Command: "make create-dockerfile", Action: "creating", EnvVars: baseEnv},
-		{Name: "docker-compose.yml", Command: "make create-docker-compose", Action: "creating", EnvVars: baseEnv},
-		{Name: "entrypoint.sh", Command: "make create-entrypoint", Action: "creating", EnvVars: baseEnv},
-		{Name: "docker-bake.hcl", Command: "make create-docker-bake", Action: "creating", EnvVars: baseEnv},
-		{Name: "runtime.go", Command: "make create-main", Action: "creating", EnvVars: baseEnv},
-		{Name: "Golang", Command: "make install-go", Action: "installing", EnvVars: baseEnv},
-		{Name: "Go modules", Command: "make init-go-modules", Action: "initializing", EnvVars: baseEnv},
-		{Name: "Air live reload", Command: "make install-air", Action: "installing", EnvVars: baseEnv},
-		{Name: "Air configuration", Command: "make air-init", Action: "initializing", EnvVars: baseEnv},
-		{Name: "Docker Compose", Command: "make docker-compose-up", Action: "starting", EnvVars: baseEnv},
-		{Name: "Project", Command: "make clean", Action: "exporting", EnvVars: baseEnv},
+		{Name: "environment file", Command: makeTarget("create-env"), Action: "creating", EnvVars: baseEnv},
+		{Name: "Dockerfile", Command: makeTarget("create-dockerfile"), Action: "creating", EnvVars: baseEnv},
+		{Name: "docker-compose.yml", Command: makeTarget("create-docker-compose"), Action: "creating", EnvVars: baseEnv},
+		{Name: "Dockerfile and compose file", Action: "linting", EnvVars: baseEnv, Run: lintDockerFiles(projectName, baseEnv)},
+		{Name: "entrypoint.sh", Command: makeTarget("create-entrypoint"), Action: "creating", EnvVars: baseEnv},
+		{Name: "docker-bake.hcl", Command: makeTarget("create-docker-bake"), Action: "creating", EnvVars: baseEnv},
+		{Name: "runtime.go", Command: makeTarget("create-main"), Action: "creating", EnvVars: baseEnv},
+		{Name: "Golang", Command: makeTarget("install-go"), Action: "installing", EnvVars: baseEnv},
+		{Name: "Go modules", Command: makeTarget("init-go-modules"), Action: "initializing", EnvVars: baseEnv},
+		{Name: "Air live reload", Command: makeTarget("install-air"), Action: "installing", EnvVars: baseEnv},
+		{Name: "Air configuration", Command: makeTarget("air-init"), Action: "initializing", EnvVars: baseEnv},
+		{Name: "Docker Compose", Command: makeTarget("docker-compose-up"), Action: "starting", EnvVars: baseEnv},
+		{Name: "Project", Command: makeTarget("clean"), Action: "exporting", EnvVars: baseEnv},
+	}
+
+	// Standalone containers are built and started through the Engine API; compose projects run
+	// the docker CLI directly, streaming its output and returning its stderr when it fails
+	if baseEnv["RUN_WITH_DOCKER_COMPOSE"] != "true" {
+		steps[len(steps)-2] = interfaces.WorkflowStep{Name: "Docker container", Action: "starting", EnvVars: baseEnv, Run: dockerBuildAndRun(projectName, baseEnv, remote)}
+	} else {
+		steps[len(steps)-2] = interfaces.WorkflowStep{Name: "Docker Compose", Action: "starting", EnvVars: baseEnv, Run: dockerComposeUp(projectName, remote)}
 	}
 
+	exportStep := steps[len(steps)-1]
+	steps = append(append(steps[:len(steps)-1], beforeExport...), exportStep)
+
 	totalSteps := len(steps)
 	startTime := time.Now()
 
@@ -52,7 +87,13 @@ func RunProjectWorkflow(c *websocket.Conn, projectName string, env map[string]st
 		stepNumber := i + 1
 		sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("[Step %d/%d] %s %s...", stepNumber, totalSteps, strings.Title(step.Action), step.Name)))
 
-		if err := utils.ExecWithAnimation(sc, step.Name, step.Command, step.Action, step.EnvVars); err != nil {
+		var err error
+		if step.Run != nil {
+			err = utils.RunWithStatus(sc, step.Name, step.Action, step.Run)
+		} else {
+			err = utils.ExecWithAnimation(sc, step.Name, step.Command, step.Action, step.EnvVars)
+		}
+		if err != nil {
 			sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("❌ Error during %s: %v", step.Name, err)))
 			return fmt.Errorf("steps %d (%s) failed: %w", stepNumber, step.Name, err)
 		}
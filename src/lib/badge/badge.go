@@ -0,0 +1,94 @@
+// Package badge renders flat status badges, like the ones shown in repository READMEs
+package badge
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// Badge colors
+const (
+	ColorSuccess  = "#4c1"
+	ColorFailure  = "#e05d44"
+	ColorProgress = "#dfb317"
+	ColorWaiting  = "#007ec6"
+	ColorInactive = "#9f9f9f"
+	labelColor    = "#555"
+)
+
+const (
+	// maxTextLength bounds the label and the message, in characters
+	maxTextLength = 40
+	textPadding   = 5
+)
+
+// Render returns the SVG of a badge with a label on the left and a colored message on the right
+func Render(label, message, color string) []byte {
+	label, message = truncate(label), truncate(message)
+	labelWidth := textWidth(label) + 2*textPadding
+	messageWidth := textWidth(message) + 2*textPadding
+	width := labelWidth + messageWidth
+	title := escape(label + ": " + message)
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s">`, width, title)
+	fmt.Fprintf(&svg, `<title>%s</title>`, title)
+	svg.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&svg, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, width)
+	fmt.Fprintf(&svg, `<g clip-path="url(#r)"><rect width="%d" height="20" fill="%s"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`,
+		labelWidth, labelColor, labelWidth, messageWidth, escape(color), width)
+	svg.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	writeText(&svg, float64(labelWidth)/2, label)
+	writeText(&svg, float64(labelWidth)+float64(messageWidth)/2, message)
+	svg.WriteString(`</g></svg>`)
+	return svg.Bytes()
+}
+
+// Helper Functions
+func writeText(svg *bytes.Buffer, x float64, text string) {
+	// The shadow is drawn one pixel lower, under the text
+	fmt.Fprintf(svg, `<text x="%.1f" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%.1f" y="14">%s</text>`,
+		x, escape(text), x, escape(text))
+}
+
+// textWidth estimates the width of text in 11px Verdana
+func textWidth(text string) int {
+	var width float64
+	for _, r := range text {
+		switch {
+		case r == ' ':
+			width += 3.9
+		case r == 'i' || r == 'l' || r == 'j' || r == '.' || r == ',' || r == ':' || r == ';' || r == '\'' || r == '|' || r == '!':
+			width += 3.4
+		case r == 'f' || r == 't' || r == 'r' || r == 'I' || r == '(' || r == ')' || r == '[' || r == ']' || r == '/' || r == '-':
+			width += 4.6
+		case r == 'm' || r == 'w' || r == 'M' || r == 'W':
+			width += 10.5
+		case r >= 'A' && r <= 'Z':
+			width += 7.6
+		case r >= '0' && r <= '9':
+			width += 7.0
+		case r >= 'a' && r <= 'z':
+			width += 6.6
+		default:
+			width += 7.5
+		}
+	}
+	return int(math.Ceil(width))
+}
+
+func truncate(text string) string {
+	if utf8.RuneCountInString(text) <= maxTextLength {
+		return text
+	}
+	return string([]rune(text)[:maxTextLength-1]) + "…"
+}
+
+func escape(text string) string {
+	var escaped bytes.Buffer
+	_ = xml.EscapeText(&escaped, []byte(text))
+	return escaped.String()
+}
@@ -0,0 +1,195 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultUnixSocket is the local Docker daemon socket
+const DefaultUnixSocket = "unix:///var/run/docker.sock"
+
+// Client talks to the Docker Engine HTTP API over a unix socket or TCP (optionally with TLS)
+type Client struct {
+	baseURL    string
+	host       string
+	apiVersion string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for host, which is either "unix:///path/to/docker.sock" or
+// "tcp://host:port". When tlsConfig is nil, TCP connections are made over plain HTTP.
+func NewClient(host string, tlsConfig *tls.Config) (*Client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	var baseURL string
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		baseURL = "http://docker"
+	case "tcp", "http", "https":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid docker host %q: missing address", host)
+		}
+		transport.DialContext = (&net.Dialer{Timeout: 10 * time.Second}).DialContext
+		if tlsConfig != nil || u.Scheme == "https" {
+			transport.TLSClientConfig = tlsConfig
+			baseURL = "https://" + u.Host
+		} else {
+			baseURL = "http://" + u.Host
+		}
+	default:
+		return nil, fmt.Errorf("unsupported docker host scheme %q", u.Scheme)
+	}
+
+	return &Client{
+		baseURL:    baseURL,
+		host:       host,
+		httpClient: &http.Client{Transport: transport},
+	}, nil
+}
+
+// NewClientWithHTTPClient creates a client for an HTTP base URL using a custom http.Client,
+// e.g. to talk to a fake Engine API server started with httptest.
+func NewClientWithHTTPClient(baseURL string, httpClient *http.Client) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		host:       baseURL,
+		httpClient: httpClient,
+	}
+}
+
+// WithAPIVersion pins requests to an Engine API version such as "1.43".
+// Without it requests are unversioned and the daemon uses its latest version.
+func (c *Client) WithAPIVersion(version string) *Client {
+	c.apiVersion = strings.TrimPrefix(version, "v")
+	return c
+}
+
+// Host returns the daemon address the client was created for
+func (c *Client) Host() string {
+	return c.host
+}
+
+// TLSConfigFromPEM builds a mutual TLS configuration from PEM encoded material
+func TLSConfigFromPEM(caCert, cert, key []byte) (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("invalid CA certificate")
+	}
+
+	keyPair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %w", err)
+	}
+
+	return &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{keyPair},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// TLSConfigFromFiles builds a mutual TLS configuration from PEM files on disk
+func TLSConfigFromFiles(caPath, certPath, keyPath string) (*tls.Config, error) {
+	caCert, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	cert, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client certificate: %w", err)
+	}
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client key: %w", err)
+	}
+	return TLSConfigFromPEM(caCert, cert, key)
+}
+
+// do sends a request and turns non-2xx responses into an *APIError.
+// The caller owns the returned response body.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader, headers map[string]string) (*http.Response, error) {
+	endpoint := c.baseURL
+	if c.apiVersion != "" {
+		endpoint += "/v" + c.apiVersion
+	}
+	endpoint += path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &ConnectionError{Host: c.host, Err: err}
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, newAPIError(method, path, resp)
+	}
+	return resp, nil
+}
+
+// doJSON sends in as JSON (when not nil) and decodes the response into out (when not nil)
+func (c *Client) doJSON(ctx context.Context, method, path string, query url.Values, in, out interface{}) (int, error) {
+	var body io.Reader
+	headers := map[string]string{}
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(payload)
+		headers["Content-Type"] = "application/json"
+	}
+
+	resp, err := c.do(ctx, method, path, query, body, headers)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotModified {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
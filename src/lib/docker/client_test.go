@@ -0,0 +1,180 @@
+package docker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPKI is a CA with a server certificate for 127.0.0.1 and a client certificate
+type testPKI struct {
+	caPEM                     []byte
+	server                    tls.Certificate
+	clientCert, clientKey     []byte
+	strangerCert, strangerKey []byte
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	caKey, caTemplate := newKey(t), &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "deva test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage, signer *x509.Certificate, signerKey *ecdsa.PrivateKey) ([]byte, []byte) {
+		key := newKey(t)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "deva test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		if signer == nil {
+			signer, signerKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+
+	pki := &testPKI{caPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})}
+	serverCert, serverKey := issue(2, x509.ExtKeyUsageServerAuth, ca, caKey)
+	if pki.server, err = tls.X509KeyPair(serverCert, serverKey); err != nil {
+		t.Fatal(err)
+	}
+	pki.clientCert, pki.clientKey = issue(3, x509.ExtKeyUsageClientAuth, ca, caKey)
+	pki.strangerCert, pki.strangerKey = issue(4, x509.ExtKeyUsageClientAuth, nil, nil)
+	return pki
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// tlsEngine serves /_ping over mutual TLS, like a daemon started with --tlsverify
+func tlsEngine(t *testing.T, pki *testPKI) string {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pki.caPEM)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_ping" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Api-Version", "1.45")
+		w.Write([]byte("OK"))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pki.server},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return "tcp://" + strings.TrimPrefix(server.URL, "https://")
+}
+
+func TestNewClientTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	host := tlsEngine(t, pki)
+
+	tests := []struct {
+		name      string
+		cert, key []byte
+		wantErr   bool
+	}{
+		{"certificate of the CA", pki.clientCert, pki.clientKey, false},
+		{"self-signed certificate", pki.strangerCert, pki.strangerKey, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := TLSConfigFromPEM(pki.caPEM, tt.cert, tt.key)
+			if err != nil {
+				t.Fatalf("TLSConfigFromPEM() error = %v", err)
+			}
+			client, err := NewClient(host, tlsConfig)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			version, err := client.Ping(context.Background())
+			if tt.wantErr {
+				var connErr *ConnectionError
+				if !errors.As(err, &connErr) {
+					t.Fatalf("Ping() error = %v, want a *ConnectionError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Ping() error = %v", err)
+			}
+			if version != "1.45" {
+				t.Errorf("Ping() = %q, want %q", version, "1.45")
+			}
+		})
+	}
+}
+
+func TestTLSConfigFromPEMRejectsInvalidMaterial(t *testing.T) {
+	pki := newTestPKI(t)
+	tests := []struct {
+		name          string
+		ca, cert, key []byte
+	}{
+		{"no CA", nil, pki.clientCert, pki.clientKey},
+		{"key of another certificate", pki.caPEM, pki.clientCert, pki.strangerKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := TLSConfigFromPEM(tt.ca, tt.cert, tt.key); err == nil {
+				t.Error("TLSConfigFromPEM() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestNewClientRejectsHosts(t *testing.T) {
+	for _, host := range []string{"ssh://docker.local", "tcp://", "npipe:////./pipe/docker_engine"} {
+		if _, err := NewClient(host, nil); err == nil {
+			t.Errorf("NewClient(%q) error = nil, want an error", host)
+		}
+	}
+}
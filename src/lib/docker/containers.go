@@ -0,0 +1,234 @@
+package docker
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// PortBinding maps a container port to a host address
+type PortBinding struct {
+	HostIP   string `json:"HostIp,omitempty"`
+	HostPort string `json:"HostPort"`
+}
+
+// RestartPolicy of a container
+type RestartPolicy struct {
+	Name              string `json:"Name"`
+	MaximumRetryCount int    `json:"MaximumRetryCount,omitempty"`
+}
+
+// HostConfig is the host-dependent configuration of a container
+type HostConfig struct {
+	PortBindings  map[string][]PortBinding `json:"PortBindings,omitempty"`
+	RestartPolicy *RestartPolicy           `json:"RestartPolicy,omitempty"`
+	NetworkMode   string                   `json:"NetworkMode,omitempty"`
+	Binds         []string                 `json:"Binds,omitempty"`
+	CapDrop       []string                 `json:"CapDrop,omitempty"`
+	SecurityOpt   []string                 `json:"SecurityOpt,omitempty"`
+	Init          bool                     `json:"Init,omitempty"`
+}
+
+// ContainerConfig is the body of POST /containers/create
+type ContainerConfig struct {
+	Image        string              `json:"Image"`
+	User         string              `json:"User,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Tty          bool                `json:"Tty,omitempty"`
+	HostConfig   *HostConfig         `json:"HostConfig,omitempty"`
+}
+
+// ContainerCreated is the response of POST /containers/create
+type ContainerCreated struct {
+	ID       string   `json:"Id"`
+	Warnings []string `json:"Warnings"`
+}
+
+// ContainerState is the runtime state of a container
+type ContainerState struct {
+	Status     string `json:"Status"`
+	Running    bool   `json:"Running"`
+	ExitCode   int    `json:"ExitCode"`
+	Error      string `json:"Error"`
+	StartedAt  string `json:"StartedAt"`
+	FinishedAt string `json:"FinishedAt"`
+	Health     *struct {
+		Status        string `json:"Status"`
+		FailingStreak int    `json:"FailingStreak"`
+	} `json:"Health,omitempty"`
+}
+
+// ContainerInfo is the subset of GET /containers/{id}/json used by Deva
+type ContainerInfo struct {
+	ID              string          `json:"Id"`
+	Name            string          `json:"Name"`
+	Image           string          `json:"Image"`
+	State           ContainerState  `json:"State"`
+	Config          ContainerConfig `json:"Config"`
+	NetworkSettings struct {
+		Ports map[string][]PortBinding `json:"Ports"`
+	} `json:"NetworkSettings"`
+}
+
+// LogsOptions configures GET /containers/{id}/logs
+type LogsOptions struct {
+	Follow     bool
+	Timestamps bool
+	Tail       string
+	Since      string
+}
+
+// ContainerCreate creates a container with the given name (empty for a generated name)
+func (c *Client) ContainerCreate(ctx context.Context, name string, config ContainerConfig) (*ContainerCreated, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+
+	var created ContainerCreated
+	if _, err := c.doJSON(ctx, http.MethodPost, "/containers/create", query, config, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ContainerStart starts a container. Starting a running container is not an error.
+func (c *Client) ContainerStart(ctx context.Context, id string) error {
+	_, err := c.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/start", nil, nil, nil)
+	return err
+}
+
+// ContainerStop stops a container, killing it after timeout. Stopping a stopped container is not an error.
+func (c *Client) ContainerStop(ctx context.Context, id string, timeoutSeconds int) error {
+	query := url.Values{"t": {strconv.Itoa(timeoutSeconds)}}
+	_, err := c.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/stop", query, nil, nil)
+	return err
+}
+
+// ContainerWait blocks until a container stops and returns its exit code
+func (c *Client) ContainerWait(ctx context.Context, id string) (int, error) {
+	var result struct {
+		StatusCode int `json:"StatusCode"`
+		Error      *struct {
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}
+	query := url.Values{"condition": {"not-running"}}
+	if _, err := c.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/wait", query, nil, &result); err != nil {
+		return 0, err
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return result.StatusCode, fmt.Errorf("waiting for container %s failed: %s", id, result.Error.Message)
+	}
+	return result.StatusCode, nil
+}
+
+// ContainerRemove deletes a container
+func (c *Client) ContainerRemove(ctx context.Context, id string, force, removeVolumes bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	if removeVolumes {
+		query.Set("v", "1")
+	}
+	_, err := c.doJSON(ctx, http.MethodDelete, "/containers/"+url.PathEscape(id), query, nil, nil)
+	return err
+}
+
+// ContainerInspect returns low-level information about a container
+func (c *Client) ContainerInspect(ctx context.Context, id string) (*ContainerInfo, error) {
+	var info ContainerInfo
+	if _, err := c.doJSON(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/json", nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ContainerPutArchive extracts a tar stream into a directory of a container
+func (c *Client) ContainerPutArchive(ctx context.Context, id, path string, content io.Reader) error {
+	query := url.Values{"path": {path}}
+	resp, err := c.do(ctx, http.MethodPut, "/containers/"+url.PathEscape(id)+"/archive", query, content, map[string]string{
+		"Content-Type": "application/x-tar",
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// ContainerLogs copies the logs of a container to stdout and stderr. For containers without a
+// TTY the multiplexed stream is split into its stdout and stderr parts.
+func (c *Client) ContainerLogs(ctx context.Context, id string, opts LogsOptions, stdout, stderr io.Writer) error {
+	info, err := c.ContainerInspect(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}}
+	if opts.Follow {
+		query.Set("follow", "1")
+	}
+	if opts.Timestamps {
+		query.Set("timestamps", "1")
+	}
+	if opts.Tail != "" {
+		query.Set("tail", opts.Tail)
+	}
+	if opts.Since != "" {
+		query.Set("since", opts.Since)
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/logs", query, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if info.Config.Tty {
+		_, err = io.Copy(stdout, resp.Body)
+		return err
+	}
+	return demuxStream(resp.Body, stdout, stderr)
+}
+
+// demuxStream splits a multiplexed attach/logs stream. Each frame starts with an 8 byte
+// header: stream type (1 = stdout, 2 = stderr), three padding bytes, big-endian size.
+func demuxStream(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		var dst io.Writer
+		switch header[0] {
+		case 0, 1:
+			dst = stdout
+		case 2:
+			dst = stderr
+		default:
+			return fmt.Errorf("unknown stream type %d in log stream", header[0])
+		}
+		if dst == nil {
+			dst = io.Discard
+		}
+
+		if _, err := io.CopyN(dst, r, size); err != nil {
+			return err
+		}
+	}
+}
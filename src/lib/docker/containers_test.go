@@ -0,0 +1,154 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lifecycleEngine fakes the container endpoints of the Engine API for a single container
+type lifecycleEngine struct {
+	mu       sync.Mutex
+	calls    []string
+	created  ContainerConfig
+	running  bool
+	exitCode int
+}
+
+func (e *lifecycleEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v1.43")
+	e.calls = append(e.calls, r.Method+" "+path)
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.Method == http.MethodPost && path == "/containers/create":
+		if r.URL.Query().Get("name") == "taken" {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message":"Conflict. The container name \"/taken\" is already in use"}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&e.created)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"c0ffee","Warnings":["memory limit ignored"]}`))
+	case path == "/containers/c0ffee/start":
+		e.running = true
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/containers/c0ffee/wait":
+		e.running = false
+		json.NewEncoder(w).Encode(map[string]int{"StatusCode": e.exitCode})
+	case path == "/containers/c0ffee/json":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Id":    "c0ffee",
+			"State": map[string]interface{}{"Running": e.running, "ExitCode": e.exitCode},
+			"NetworkSettings": map[string]interface{}{
+				"Ports": map[string]interface{}{"8080/tcp": []map[string]string{{"HostIp": "0.0.0.0", "HostPort": "49153"}}},
+			},
+		})
+	case r.Method == http.MethodDelete && path == "/containers/c0ffee":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"No such container"}`))
+	}
+}
+
+func newLifecycleClient(t *testing.T, engine *lifecycleEngine) *Client {
+	t.Helper()
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+	return NewClientWithHTTPClient(server.URL, server.Client()).WithAPIVersion("1.43")
+}
+
+func TestContainerLifecycle(t *testing.T) {
+	engine := &lifecycleEngine{exitCode: 3}
+	client := newLifecycleClient(t, engine)
+	ctx := context.Background()
+
+	created, err := client.ContainerCreate(ctx, "app", ContainerConfig{
+		Image:        "app:1.0",
+		User:         "1000:1000",
+		ExposedPorts: map[string]struct{}{"8080/tcp": {}},
+		HostConfig: &HostConfig{
+			PortBindings: map[string][]PortBinding{"8080/tcp": {{}}},
+			CapDrop:      []string{"ALL"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ContainerCreate() error = %v", err)
+	}
+	if created.ID != "c0ffee" || len(created.Warnings) != 1 {
+		t.Errorf("ContainerCreate() = %+v", created)
+	}
+	if engine.created.User != "1000:1000" || engine.created.HostConfig == nil || engine.created.HostConfig.CapDrop[0] != "ALL" {
+		t.Errorf("created config = %+v", engine.created)
+	}
+
+	if err := client.ContainerStart(ctx, created.ID); err != nil {
+		t.Fatalf("ContainerStart() error = %v", err)
+	}
+	info, err := client.ContainerInspect(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("ContainerInspect() error = %v", err)
+	}
+	if !info.State.Running {
+		t.Error("container is not running after ContainerStart()")
+	}
+	if bindings := info.NetworkSettings.Ports["8080/tcp"]; len(bindings) != 1 || bindings[0].HostPort != "49153" {
+		t.Errorf("published ports = %+v", info.NetworkSettings.Ports)
+	}
+
+	exitCode, err := client.ContainerWait(ctx, created.ID)
+	if err != nil || exitCode != 3 {
+		t.Errorf("ContainerWait() = %d, %v, want 3, nil", exitCode, err)
+	}
+	if err := client.ContainerRemove(ctx, created.ID, true, true); err != nil {
+		t.Fatalf("ContainerRemove() error = %v", err)
+	}
+
+	want := []string{
+		"POST /containers/create",
+		"POST /containers/c0ffee/start",
+		"GET /containers/c0ffee/json",
+		"POST /containers/c0ffee/wait",
+		"DELETE /containers/c0ffee",
+	}
+	if strings.Join(engine.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls = %q, want %q", engine.calls, want)
+	}
+}
+
+func TestContainerErrors(t *testing.T) {
+	client := newLifecycleClient(t, &lifecycleEngine{})
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		call  func() error
+		check func(error) bool
+	}{
+		{"name in use", func() error {
+			_, err := client.ContainerCreate(ctx, "taken", ContainerConfig{Image: "app:1.0"})
+			return err
+		}, IsConflict},
+		{"missing container", func() error {
+			_, err := client.ContainerInspect(ctx, "missing")
+			return err
+		}, IsNotFound},
+		{"start of a missing container", func() error {
+			return client.ContainerStart(ctx, "missing")
+		}, IsNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !tt.check(err) {
+				t.Errorf("error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned when the Engine API answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker %s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// ConnectionError is returned when the daemon cannot be reached
+type ConnectionError struct {
+	Host string
+	Err  error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("cannot connect to docker daemon at %s: %v", e.Host, e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// BuildError is returned when an image build reports an error in its progress stream
+type BuildError struct {
+	Code    int
+	Message string
+}
+
+func (e *BuildError) Error() string {
+	return fmt.Sprintf("image build failed: %s", e.Message)
+}
+
+// PullError is returned when an image pull reports an error in its progress stream
+type PullError struct {
+	Ref     string
+	Code    int
+	Message string
+}
+
+func (e *PullError) Error() string {
+	return fmt.Sprintf("image pull of %s failed: %s", e.Ref, e.Message)
+}
+
+// CLIError is returned when a docker CLI command, such as docker compose, exits with an error.
+// Stderr holds the end of what the command wrote to stderr.
+type CLIError struct {
+	Command  string
+	ExitCode int
+	Stderr   string
+}
+
+func (e *CLIError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s exited with code %d", e.Command, e.ExitCode)
+	}
+	return fmt.Sprintf("%s exited with code %d: %s", e.Command, e.ExitCode, e.Stderr)
+}
+
+// IsNotFound reports whether err is an API error for a missing object
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is an API error for a conflicting object (e.g. name in use)
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// Helper Functions
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+func newAPIError(method, path string, resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	message := strings.TrimSpace(string(body))
+	var payload struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Message != "" {
+		message = payload.Message
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     method,
+		Path:       path,
+		Message:    message,
+	}
+}
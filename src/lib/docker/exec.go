@@ -0,0 +1,50 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ExecConfig is the body of POST /containers/{id}/exec
+type ExecConfig struct {
+	Cmd          []string `json:"Cmd"`
+	Env          []string `json:"Env,omitempty"`
+	AttachStdout bool     `json:"AttachStdout"`
+	AttachStderr bool     `json:"AttachStderr"`
+}
+
+// ContainerExec runs a command in a running container, copies its output to stdout and
+// stderr (either may be nil) and returns its exit code
+func (c *Client) ContainerExec(ctx context.Context, id string, cmd []string, stdout, stderr io.Writer) (int, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	config := ExecConfig{Cmd: cmd, AttachStdout: true, AttachStderr: true}
+	if _, err := c.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/exec", nil, config, &created); err != nil {
+		return 0, err
+	}
+
+	start := strings.NewReader(`{"Detach": false, "Tty": false}`)
+	resp, err := c.do(ctx, http.MethodPost, "/exec/"+url.PathEscape(created.ID)+"/start", nil, start, map[string]string{
+		"Content-Type": "application/json",
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = demuxStream(resp.Body, stdout, stderr)
+	resp.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	var inspect struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	if _, err := c.doJSON(ctx, http.MethodGet, "/exec/"+url.PathEscape(created.ID)+"/json", nil, nil, &inspect); err != nil {
+		return 0, err
+	}
+	return inspect.ExitCode, nil
+}
@@ -0,0 +1,196 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// BuildOptions configures an image build
+type BuildOptions struct {
+	Tags       []string
+	Dockerfile string
+	BuildArgs  map[string]string
+	Labels     map[string]string
+	Platform   string
+	NoCache    bool
+	Pull       bool
+}
+
+// BuildMessage is one line of the JSON progress stream of POST /build
+type BuildMessage struct {
+	Stream      string `json:"stream,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Progress    string `json:"progress,omitempty"`
+	ID          string `json:"id,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ErrorDetail *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errorDetail,omitempty"`
+	Aux *struct {
+		ID string `json:"ID"`
+	} `json:"aux,omitempty"`
+}
+
+// BuildResult describes a finished image build
+type BuildResult struct {
+	ImageID string
+}
+
+// ImageInfo is the subset of GET /images/{name}/json used by Deva
+type ImageInfo struct {
+	ID          string   `json:"Id"`
+	RepoTags    []string `json:"RepoTags"`
+	RepoDigests []string `json:"RepoDigests"`
+	Created     string   `json:"Created"`
+	Size        int64    `json:"Size"`
+}
+
+// ImageBuild builds an image from a tar build context. Every progress message is passed to
+// onProgress (when not nil) as it is streamed by the daemon.
+func (c *Client) ImageBuild(ctx context.Context, buildContext io.Reader, opts BuildOptions, onProgress func(BuildMessage)) (*BuildResult, error) {
+	query := url.Values{}
+	for _, tag := range opts.Tags {
+		query.Add("t", tag)
+	}
+	if opts.Dockerfile != "" {
+		query.Set("dockerfile", opts.Dockerfile)
+	}
+	if opts.Platform != "" {
+		query.Set("platform", opts.Platform)
+	}
+	if opts.NoCache {
+		query.Set("nocache", "1")
+	}
+	if opts.Pull {
+		query.Set("pull", "1")
+	}
+	query.Set("rm", "1")
+	query.Set("forcerm", "1")
+	if len(opts.BuildArgs) > 0 {
+		encoded, err := json.Marshal(opts.BuildArgs)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("buildargs", string(encoded))
+	}
+	if len(opts.Labels) > 0 {
+		encoded, err := json.Marshal(opts.Labels)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("labels", string(encoded))
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/build", query, buildContext, map[string]string{
+		"Content-Type": "application/x-tar",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &BuildResult{}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg BuildMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("failed to read build progress: %w", err)
+		}
+
+		if onProgress != nil {
+			onProgress(msg)
+		}
+		if msg.ErrorDetail != nil {
+			return nil, &BuildError{Code: msg.ErrorDetail.Code, Message: msg.ErrorDetail.Message}
+		}
+		if msg.Error != "" {
+			return nil, &BuildError{Message: msg.Error}
+		}
+		if msg.Aux != nil && msg.Aux.ID != "" {
+			result.ImageID = msg.Aux.ID
+		}
+	}
+
+	if result.ImageID == "" && len(opts.Tags) > 0 {
+		// Older daemons do not send the aux message, look the image up by tag instead
+		info, err := c.ImageInspect(ctx, opts.Tags[0])
+		if err != nil {
+			return nil, err
+		}
+		result.ImageID = info.ID
+	}
+	return result, nil
+}
+
+// ImagePull pulls an image reference ("name" or "name:tag") from its registry
+func (c *Client) ImagePull(ctx context.Context, ref string) error {
+	query := url.Values{"fromImage": {ref}}
+	if !strings.Contains(ref[strings.LastIndex(ref, "/")+1:], ":") {
+		query.Set("tag", "latest")
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/images/create", query, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The pull only finishes once the progress stream is drained
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg BuildMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to read pull progress: %w", err)
+		}
+		if msg.ErrorDetail != nil {
+			return &PullError{Ref: ref, Code: msg.ErrorDetail.Code, Message: msg.ErrorDetail.Message}
+		}
+		if msg.Error != "" {
+			return &PullError{Ref: ref, Message: msg.Error}
+		}
+	}
+}
+
+// ImageInspect returns low-level information about an image
+func (c *Client) ImageInspect(ctx context.Context, name string) (*ImageInfo, error) {
+	var info ImageInfo
+	if _, err := c.doJSON(ctx, http.MethodGet, "/images/"+url.PathEscape(name)+"/json", nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ImageTag adds a repository:tag reference to an image
+func (c *Client) ImageTag(ctx context.Context, source, repo, tag string) error {
+	query := url.Values{"repo": {repo}, "tag": {tag}}
+	_, err := c.doJSON(ctx, http.MethodPost, "/images/"+url.PathEscape(source)+"/tag", query, nil, nil)
+	return err
+}
+
+// ImageRemove deletes an image
+func (c *Client) ImageRemove(ctx context.Context, name string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	_, err := c.doJSON(ctx, http.MethodDelete, "/images/"+url.PathEscape(name), query, nil, nil)
+	return err
+}
@@ -0,0 +1,159 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeEngine serves /images/create with the given progress stream and records the pull query
+func fakeEngine(t *testing.T, status int, stream string) (*Client, *http.Request) {
+	t.Helper()
+	received := &http.Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1.43/images/create" {
+			http.NotFound(w, r)
+			return
+		}
+		*received = *r.Clone(context.Background())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, stream)
+	}))
+	t.Cleanup(server.Close)
+	return NewClientWithHTTPClient(server.URL, server.Client()).WithAPIVersion("1.43"), received
+}
+
+func TestImagePull(t *testing.T) {
+	client, received := fakeEngine(t, http.StatusOK, `{"status":"Pulling from library/alpine","id":"3.20"}
+{"status":"Download complete","id":"c6a83fedfae6"}
+{"status":"Status: Downloaded newer image for alpine:3.20"}
+`)
+
+	if err := client.ImagePull(context.Background(), "alpine:3.20"); err != nil {
+		t.Fatalf("ImagePull() error = %v", err)
+	}
+	if got := received.URL.Query().Get("fromImage"); got != "alpine:3.20" {
+		t.Errorf("fromImage = %q, want %q", got, "alpine:3.20")
+	}
+	if got := received.URL.Query().Get("tag"); got != "" {
+		t.Errorf("tag = %q, want none for a tagged reference", got)
+	}
+}
+
+func TestImagePullDefaultsToLatest(t *testing.T) {
+	client, received := fakeEngine(t, http.StatusOK, `{"status":"Status: Image is up to date for registry.local:5000/app:latest"}`)
+
+	if err := client.ImagePull(context.Background(), "registry.local:5000/app"); err != nil {
+		t.Fatalf("ImagePull() error = %v", err)
+	}
+	if got := received.URL.Query().Get("tag"); got != "latest" {
+		t.Errorf("tag = %q, want %q", got, "latest")
+	}
+}
+
+func TestImagePullStreamError(t *testing.T) {
+	client, _ := fakeEngine(t, http.StatusOK, `{"status":"Pulling from library/missing"}
+{"errorDetail":{"code":1,"message":"manifest unknown"},"error":"manifest unknown"}
+`)
+
+	err := client.ImagePull(context.Background(), "missing:1.0")
+	var pullErr *PullError
+	if !errors.As(err, &pullErr) {
+		t.Fatalf("ImagePull() error = %v, want a *PullError", err)
+	}
+	if pullErr.Ref != "missing:1.0" || pullErr.Code != 1 || pullErr.Message != "manifest unknown" {
+		t.Errorf("PullError = %+v", pullErr)
+	}
+}
+
+func TestImagePullAPIError(t *testing.T) {
+	client, _ := fakeEngine(t, http.StatusNotFound, `{"message":"pull access denied for private/app"}`)
+
+	err := client.ImagePull(context.Background(), "private/app:1.0")
+	if !IsNotFound(err) {
+		t.Fatalf("ImagePull() error = %v, want a not found API error", err)
+	}
+	var pullErr *PullError
+	if errors.As(err, &pullErr) {
+		t.Errorf("ImagePull() error = %v, want an API error rather than a pull error", err)
+	}
+}
+
+// buildEngine serves POST /build with the given progress stream and records the build context
+func buildEngine(t *testing.T, stream string) (*Client, *[]byte) {
+	t.Helper()
+	received := new([]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1.43/build" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/x-tar" || r.URL.Query().Get("t") != "app:1.0" {
+			http.Error(w, `{"message":"bad build request"}`, http.StatusBadRequest)
+			return
+		}
+		*received, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, stream)
+	}))
+	t.Cleanup(server.Close)
+	return NewClientWithHTTPClient(server.URL, server.Client()).WithAPIVersion("1.43"), received
+}
+
+func TestImageBuild(t *testing.T) {
+	client, received := buildEngine(t, `{"stream":"Step 1/2 : FROM golang:1.24\n"}
+{"stream":"Step 2/2 : RUN go build\n"}
+{"aux":{"ID":"sha256:abc123"}}
+{"stream":"Successfully built abc123\n"}
+`)
+
+	var progress []string
+	result, err := client.ImageBuild(context.Background(), strings.NewReader("tar"), BuildOptions{Tags: []string{"app:1.0"}}, func(msg BuildMessage) {
+		if msg.Stream != "" {
+			progress = append(progress, strings.TrimSpace(msg.Stream))
+		}
+	})
+	if err != nil {
+		t.Fatalf("ImageBuild() error = %v", err)
+	}
+	if result.ImageID != "sha256:abc123" {
+		t.Errorf("ImageID = %q, want %q", result.ImageID, "sha256:abc123")
+	}
+	if len(progress) != 3 || progress[0] != "Step 1/2 : FROM golang:1.24" {
+		t.Errorf("progress = %q, want every stream line in order", progress)
+	}
+	if string(*received) != "tar" {
+		t.Errorf("build context = %q, want %q", *received, "tar")
+	}
+}
+
+func TestImageBuildStreamError(t *testing.T) {
+	tests := []struct {
+		name     string
+		stream   string
+		wantCode int
+	}{
+		{"error detail", `{"stream":"Step 1/1 : RUN false\n"}
+{"errorDetail":{"code":1,"message":"The command '/bin/sh -c false' returned a non-zero code: 1"},"error":"The command '/bin/sh -c false' returned a non-zero code: 1"}
+`, 1},
+		{"bare error", `{"error":"failed to read dockerfile"}`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := buildEngine(t, tt.stream)
+			_, err := client.ImageBuild(context.Background(), strings.NewReader("tar"), BuildOptions{Tags: []string{"app:1.0"}}, nil)
+			var buildErr *BuildError
+			if !errors.As(err, &buildErr) {
+				t.Fatalf("ImageBuild() error = %v, want a *BuildError", err)
+			}
+			if buildErr.Code != tt.wantCode || buildErr.Message == "" {
+				t.Errorf("BuildError = %+v", buildErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// NetworkConfig is the body of POST /networks/create
+type NetworkConfig struct {
+	Name   string            `json:"Name"`
+	Driver string            `json:"Driver,omitempty"`
+	Labels map[string]string `json:"Labels,omitempty"`
+}
+
+// NetworkInfo is the subset of GET /networks/{id} used by Deva
+type NetworkInfo struct {
+	ID     string            `json:"Id"`
+	Name   string            `json:"Name"`
+	Driver string            `json:"Driver"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// NetworkInspect returns a network by name or ID
+func (c *Client) NetworkInspect(ctx context.Context, id string) (*NetworkInfo, error) {
+	var info NetworkInfo
+	if _, err := c.doJSON(ctx, http.MethodGet, "/networks/"+url.PathEscape(id), nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// NetworkCreate creates a network and returns its ID
+func (c *Client) NetworkCreate(ctx context.Context, config NetworkConfig) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if _, err := c.doJSON(ctx, http.MethodPost, "/networks/create", nil, config, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// VersionInfo is the response of GET /version
+type VersionInfo struct {
+	Version       string `json:"Version"`
+	APIVersion    string `json:"ApiVersion"`
+	MinAPIVersion string `json:"MinAPIVersion"`
+	GitCommit     string `json:"GitCommit"`
+	GoVersion     string `json:"GoVersion"`
+	Os            string `json:"Os"`
+	Arch          string `json:"Arch"`
+	KernelVersion string `json:"KernelVersion"`
+}
+
+// Ping checks that the daemon is reachable and returns its API version
+func (c *Client) Ping(ctx context.Context) (string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/_ping", nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if strings.TrimSpace(string(body)) != "OK" {
+		return "", &APIError{StatusCode: resp.StatusCode, Method: http.MethodGet, Path: "/_ping", Message: "unexpected ping response"}
+	}
+	return resp.Header.Get("Api-Version"), nil
+}
+
+// Version returns version information of the daemon
+func (c *Client) Version(ctx context.Context) (*VersionInfo, error) {
+	var info VersionInfo
+	if _, err := c.doJSON(ctx, http.MethodGet, "/version", nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// SystemInfo is the subset of GET /info used to describe a daemon
+type SystemInfo struct {
+	ServerVersion   string `json:"ServerVersion"`
+	OperatingSystem string `json:"OperatingSystem"`
+	OSType          string `json:"OSType"`
+	Architecture    string `json:"Architecture"`
+	NCPU            int    `json:"NCPU"`
+	MemTotal        int64  `json:"MemTotal"`
+	Driver          string `json:"Driver"`
+	CgroupVersion   string `json:"CgroupVersion"`
+	DefaultRuntime  string `json:"DefaultRuntime"`
+	Runtimes        map[string]struct {
+		Path string `json:"path"`
+	} `json:"Runtimes"`
+	Swarm struct {
+		LocalNodeState string `json:"LocalNodeState"`
+	} `json:"Swarm"`
+}
+
+// Info returns system-wide information of the daemon
+func (c *Client) Info(ctx context.Context) (*SystemInfo, error) {
+	var info SystemInfo
+	if _, err := c.doJSON(ctx, http.MethodGet, "/info", nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
@@ -1,6 +1,9 @@
 package dto
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"time"
+)
 
 type RegisterRequest struct {
 	Name     string    `json:"name" validate:"required,min=2"`
@@ -45,9 +48,97 @@ type RenewPasswordRequest struct {
 }
 
 type CreateFiberRequest struct {
-	ProjectName string            `json:"project_name"`
-	UserID      uuid.UUID         `json:"user_id"`
-	Env         map[string]string `json:"env"`
+	ProjectName    string              `json:"project_name"`
+	UserID         uuid.UUID           `json:"-"`
+	TeamID         uuid.UUID           `json:"team_id"`
+	TemplateID     uuid.UUID           `json:"template_id"`
+	DeployTargetID uuid.UUID           `json:"deploy_target_id"`
+	Env            map[string]string   `json:"env"`
+	CITool         string              `json:"ci_tool"`
+	Kubernetes     *KubernetesOptions  `json:"kubernetes"`
+	Helm           *HelmOptions        `json:"helm"`
+	HealthCheck    *HealthCheckOptions `json:"health_check"`
+}
+
+type KubernetesOptions struct {
+	Namespace   string                 `json:"namespace"`
+	Image       string                 `json:"image"`
+	Replicas    int32                  `json:"replicas"`
+	Resources   KubernetesResources    `json:"resources"`
+	Probes      KubernetesProbes       `json:"probes"`
+	Ingress     *KubernetesIngress     `json:"ingress"`
+	Autoscaling *KubernetesAutoscaling `json:"autoscaling"`
+}
+
+type KubernetesResources struct {
+	CPURequest    string `json:"cpu_request"`
+	CPULimit      string `json:"cpu_limit"`
+	MemoryRequest string `json:"memory_request"`
+	MemoryLimit   string `json:"memory_limit"`
+}
+
+type KubernetesProbes struct {
+	Disabled            bool   `json:"disabled"`
+	Path                string `json:"path"`
+	InitialDelaySeconds int32  `json:"initial_delay_seconds"`
+	PeriodSeconds       int32  `json:"period_seconds"`
+}
+
+type KubernetesIngress struct {
+	Host      string `json:"host"`
+	ClassName string `json:"class_name"`
+	TLSSecret string `json:"tls_secret"`
+}
+
+type KubernetesAutoscaling struct {
+	MinReplicas          int32 `json:"min_replicas"`
+	MaxReplicas          int32 `json:"max_replicas"`
+	TargetCPUUtilization int32 `json:"target_cpu_utilization"`
+}
+
+type HelmOptions struct {
+	Environments []string `json:"environments"`
+}
+
+// HealthCheckOptions configures the post-deploy health verification of a project. Zero values
+// are replaced by defaults.
+type HealthCheckOptions struct {
+	Disabled            bool   `json:"disabled"`
+	Type                string `json:"type"` // "http" or "tcp"
+	Port                int    `json:"port"` // Defaults to APP_PORT
+	Path                string `json:"path"`
+	ExpectedStatus      int    `json:"expected_status"` // 0 accepts any 2xx or 3xx
+	InitialDelaySeconds int    `json:"initial_delay_seconds"`
+	IntervalSeconds     int    `json:"interval_seconds"`
+	TimeoutSeconds      int    `json:"timeout_seconds"`
+	Retries             int    `json:"retries"`           // Probes before giving up
+	SuccessThreshold    int    `json:"success_threshold"` // Consecutive successes to pass
+	FailureThreshold    int    `json:"failure_threshold"` // Consecutive failures to fail
+}
+
+// CreateDeploymentTargetRequest registers a Docker host (TLS client certificate) or a Kubernetes
+// API server (bearer token or client certificate). Host is the API server URL for kubernetes.
+type CreateDeploymentTargetRequest struct {
+	Name   string    `json:"name" validate:"required"`
+	Type   string    `json:"type" validate:"required,oneof=docker kubernetes"`
+	Host   string    `json:"host" validate:"required"`
+	TeamID uuid.UUID `json:"team_id"`
+	CACert string    `json:"ca_cert" validate:"required"`
+	Cert   string    `json:"cert"`
+	Key    string    `json:"key"`
+	Token  string    `json:"token"`
+}
+
+// UpdateDeploymentTargetRequest changes a deployment target. Empty fields are left unchanged;
+// credentials are replaced as a whole when any of them is set.
+type UpdateDeploymentTargetRequest struct {
+	Name   string     `json:"name"`
+	Host   string     `json:"host"`
+	TeamID *uuid.UUID `json:"team_id"`
+	CACert string     `json:"ca_cert"`
+	Cert   string     `json:"cert"`
+	Key    string     `json:"key"`
+	Token  string     `json:"token"`
 }
 
 type ChangePasswordRequest struct {
@@ -55,3 +146,117 @@ type ChangePasswordRequest struct {
 	NewPassword string    `json:"new_password" validate:"required,min=8"`
 	UserID      uuid.UUID `json:"user_id"`
 }
+
+type CreateDeploymentRequest struct {
+	TargetID       uuid.UUID           `json:"target_id"`
+	Strategy       string              `json:"strategy"`        // "recreate" (default), "blue-green" or "canary"
+	CanaryPercent  int                 `json:"canary_percent"`  // Share of traffic sent to a canary, 1-99
+	CanaryDuration int                 `json:"canary_duration"` // Seconds a canary is observed before promotion
+	HealthCheck    *HealthCheckOptions `json:"health_check"`    // Overrides the health check of the project
+	Environment    string              `json:"environment"`     // Selects the approval policy, default "production"
+	Ref            string              `json:"ref"`             // Branch or tag being deployed, shown on status badges
+	ScheduledAt    *time.Time          `json:"scheduled_at"`    // Queues the deployment until this time
+	OverrideFreeze bool                `json:"override_freeze"` // Deploys through a freeze window (admins only)
+	OverrideReason string              `json:"override_reason"`
+}
+
+// CreateApprovalPolicyRequest gates deployments of a project or team to an environment behind approvals
+type CreateApprovalPolicyRequest struct {
+	ProjectID         uuid.UUID `json:"project_id"`
+	TeamID            uuid.UUID `json:"team_id"`
+	Environment       string    `json:"environment"`   // default "production"
+	ApproverRole      string    `json:"approver_role"` // A role name or a team member role
+	RequiredApprovals int       `json:"required_approvals"`
+	TimeoutMinutes    int       `json:"timeout_minutes"`
+}
+
+type ApprovalDecisionRequest struct {
+	Comment string `json:"comment"`
+}
+
+// CreateFreezeWindowRequest declares a freeze window for a project or a team. A window is either
+// one period (starts_at to ends_at) or repeats weekly on days between start_time and end_time.
+type CreateFreezeWindowRequest struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	TeamID    uuid.UUID `json:"team_id"`
+	Name      string    `json:"name" validate:"required"`
+	Reason    string    `json:"reason"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Days      []string  `json:"days"`       // e.g. ["sat", "sun"]
+	StartTime string    `json:"start_time"` // "HH:MM"
+	EndTime   string    `json:"end_time"`   // "HH:MM"
+	Timezone  string    `json:"timezone"`   // IANA name, default UTC
+}
+
+type RollbackDeploymentRequest struct {
+	Reason         string `json:"reason"`
+	Strategy       string `json:"strategy"`
+	OverrideFreeze bool   `json:"override_freeze"` // Rolls back through a freeze window (admins only)
+	OverrideReason string `json:"override_reason"`
+}
+
+// LintDockerFilesRequest lints Dockerfiles and compose files, recognized by their path. Env
+// resolves ${VAR} references; app_port defaults to APP_PORT from env.
+type LintDockerFilesRequest struct {
+	Files   []LintFile        `json:"files"`
+	AppPort string            `json:"app_port"`
+	Env     map[string]string `json:"env"`
+}
+
+type LintFile struct {
+	Path    string `json:"path"` // e.g. "Dockerfile", "Dockerfile.postgres", "docker-compose.yml"
+	Content string `json:"content"`
+}
+
+// AnalyzeGoModulesRequest analyzes a go.mod, with its go.sum when given. check_upgrades asks the
+// configured module proxy for newer versions; include_indirect also checks // indirect ones.
+type AnalyzeGoModulesRequest struct {
+	GoMod           string `json:"go_mod"`
+	GoSum           string `json:"go_sum"`
+	CheckUpgrades   bool   `json:"check_upgrades"`
+	IncludeIndirect bool   `json:"include_indirect"`
+}
+
+// UpgradeGoModulesRequest builds an updated go.mod. Level caps the upgrades ("patch", "minor" or
+// "major", defaults to "minor"); modules limits them to the listed paths. save stores the result as
+// the project go.mod.
+type UpgradeGoModulesRequest struct {
+	Level           string   `json:"level"`
+	Modules         []string `json:"modules"`
+	IncludeIndirect bool     `json:"include_indirect"`
+	Save            bool     `json:"save"`
+}
+
+// TriggerPipelineRequest runs the pipeline of a project. Ref (a branch or tag) and commit_sha select
+// what is checked out from the project repository; projects without one run their exported
+// workspace and only record commit_sha.
+type TriggerPipelineRequest struct {
+	Ref       string `json:"ref"`
+	CommitSHA string `json:"commit_sha"`
+}
+
+// SetProjectRepositoryRequest points the pipelines of a project at a git repository. An empty
+// repo_url removes it.
+type SetProjectRepositoryRequest struct {
+	RepoURL string `json:"repo_url"`
+}
+
+// GitWebhookRule maps pushes to an action. Event is "push" (branches) or "tag"; filters are glob
+// patterns on the branch or tag name and match everything when empty. Action is "pipeline" or
+// "deploy"; deploys use environment (default "staging") and target_id (default the project target).
+type GitWebhookRule struct {
+	Event       string    `json:"event"`
+	Filters     []string  `json:"filters"`
+	Action      string    `json:"action"`
+	Environment string    `json:"environment"`
+	TargetID    uuid.UUID `json:"target_id"`
+}
+
+// ConfigureGitWebhookRequest creates or updates the inbound Git webhook of a project. Omitted rules
+// and is_active keep their current value; rotate_secret issues a new secret.
+type ConfigureGitWebhookRequest struct {
+	Rules        *[]GitWebhookRule `json:"rules"`
+	IsActive     *bool             `json:"is_active"`
+	RotateSecret bool              `json:"rotate_secret"`
+}
@@ -0,0 +1,183 @@
+package githooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Providers whose webhook deliveries are understood
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+	ProviderGitea  = "gitea"
+)
+
+// Events a push delivery maps to
+const (
+	EventPush = "push"
+	EventTag  = "tag"
+)
+
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+var (
+	// ErrUnknownProvider is returned for requests without the event header of a known provider
+	ErrUnknownProvider = errors.New("not a GitHub, GitLab or Gitea webhook delivery")
+	// ErrInvalidSignature is returned when the signature or token does not match the secret
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Delivery identifies a webhook request by its headers
+type Delivery struct {
+	Provider string
+	// Event is the raw event name of the provider, e.g. "push" or "Tag Push Hook"
+	Event string
+	// ID is the delivery ID of the provider, when it sends one
+	ID string
+}
+
+// Push is a branch or tag push, in the same shape for every provider
+type Push struct {
+	// Event is EventPush for branches and EventTag for tags
+	Event string
+	// Ref is the full ref, e.g. refs/heads/main
+	Ref string
+	// Name is the branch or tag name
+	Name      string
+	CommitSHA string
+	// Deleted is set when the push removed the branch or tag
+	Deleted    bool
+	Repository string
+	Pusher     string
+}
+
+// Detect reads the provider, event and delivery ID from the request headers. Gitea is checked
+// first because it also sends GitHub headers.
+func Detect(header func(string) string) (Delivery, error) {
+	switch {
+	case header("X-Gitea-Event") != "":
+		return Delivery{Provider: ProviderGitea, Event: header("X-Gitea-Event"), ID: header("X-Gitea-Delivery")}, nil
+	case header("X-Forgejo-Event") != "":
+		return Delivery{Provider: ProviderGitea, Event: header("X-Forgejo-Event"), ID: header("X-Forgejo-Delivery")}, nil
+	case header("X-GitHub-Event") != "":
+		return Delivery{Provider: ProviderGitHub, Event: header("X-GitHub-Event"), ID: header("X-GitHub-Delivery")}, nil
+	case header("X-Gitlab-Event") != "":
+		id := header("X-Gitlab-Event-UUID")
+		if id == "" {
+			id = header("X-Gitlab-Webhook-UUID")
+		}
+		return Delivery{Provider: ProviderGitLab, Event: header("X-Gitlab-Event"), ID: id}, nil
+	}
+	return Delivery{}, ErrUnknownProvider
+}
+
+// Verify checks a delivery against the webhook secret: an HMAC-SHA256 of the body for GitHub and
+// Gitea, the X-Gitlab-Token header for GitLab
+func Verify(d Delivery, header func(string) string, body []byte, secret string) error {
+	if secret == "" {
+		return ErrInvalidSignature
+	}
+	if d.Provider == ProviderGitLab {
+		if subtle.ConstantTimeCompare([]byte(header("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	var signature string
+	for _, name := range []string{"X-Gitea-Signature", "X-Forgejo-Signature", "X-Hub-Signature-256"} {
+		if signature = header(name); signature != "" {
+			break
+		}
+	}
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	received, err := hex.DecodeString(signature)
+	if err != nil || len(received) == 0 {
+		return ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(received, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// IsPing reports whether the delivery is the test event providers send when a webhook is added
+func (d Delivery) IsPing() bool {
+	return (d.Provider == ProviderGitHub && d.Event == "ping") ||
+		(d.Provider == ProviderGitLab && d.Event == "Test Hook")
+}
+
+// IsPush reports whether the delivery is a branch or tag push
+func (d Delivery) IsPush() bool {
+	switch d.Provider {
+	case ProviderGitLab:
+		return d.Event == "Push Hook" || d.Event == "Tag Push Hook"
+	default:
+		return d.Event == "push"
+	}
+}
+
+// ParsePush reads a push delivery. Tags are told apart by their ref, which every provider sends.
+func ParsePush(d Delivery, body []byte) (*Push, error) {
+	if !d.IsPush() {
+		return nil, fmt.Errorf("%s event %q is not a push", d.Provider, d.Event)
+	}
+
+	var payload struct {
+		Ref         string  `json:"ref"`
+		After       string  `json:"after"`
+		CheckoutSHA *string `json:"checkout_sha"`
+		Deleted     bool    `json:"deleted"`
+		Repository  struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		Project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+		Pusher struct {
+			Name     string `json:"name"`
+			Login    string `json:"login"`
+			Username string `json:"username"`
+		} `json:"pusher"`
+		UserUsername string `json:"user_username"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid push payload: %w", err)
+	}
+
+	push := &Push{Ref: payload.Ref, CommitSHA: payload.After, Deleted: payload.Deleted}
+	switch {
+	case strings.HasPrefix(payload.Ref, "refs/heads/"):
+		push.Event, push.Name = EventPush, strings.TrimPrefix(payload.Ref, "refs/heads/")
+	case strings.HasPrefix(payload.Ref, "refs/tags/"):
+		push.Event, push.Name = EventTag, strings.TrimPrefix(payload.Ref, "refs/tags/")
+	default:
+		return nil, fmt.Errorf("push to unsupported ref %q", payload.Ref)
+	}
+	if payload.CheckoutSHA != nil && *payload.CheckoutSHA != "" {
+		push.CommitSHA = *payload.CheckoutSHA
+	}
+	if push.CommitSHA == "" || push.CommitSHA == zeroSHA {
+		push.Deleted = true
+	}
+
+	push.Repository = payload.Repository.FullName
+	if payload.Project.PathWithNamespace != "" {
+		push.Repository = payload.Project.PathWithNamespace
+	}
+	for _, name := range []string{payload.Pusher.Login, payload.Pusher.Username, payload.Pusher.Name, payload.UserUsername} {
+		if name != "" {
+			push.Pusher = name
+			break
+		}
+	}
+	return push, nil
+}
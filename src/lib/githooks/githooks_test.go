@@ -0,0 +1,178 @@
+package githooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func headers(values map[string]string) func(string) string {
+	return func(name string) string { return values[name] }
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    Delivery
+		wantErr error
+	}{
+		{"github", map[string]string{"X-GitHub-Event": "push", "X-GitHub-Delivery": "d1"}, Delivery{ProviderGitHub, "push", "d1"}, nil},
+		{"gitea sends GitHub headers too", map[string]string{"X-GitHub-Event": "push", "X-Gitea-Event": "push", "X-Gitea-Delivery": "d2"}, Delivery{ProviderGitea, "push", "d2"}, nil},
+		{"forgejo", map[string]string{"X-Forgejo-Event": "push", "X-Forgejo-Delivery": "d3"}, Delivery{ProviderGitea, "push", "d3"}, nil},
+		{"gitlab", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Event-UUID": "d4"}, Delivery{ProviderGitLab, "Push Hook", "d4"}, nil},
+		{"gitlab webhook uuid", map[string]string{"X-Gitlab-Event": "Tag Push Hook", "X-Gitlab-Webhook-UUID": "d5"}, Delivery{ProviderGitLab, "Tag Push Hook", "d5"}, nil},
+		{"unknown", map[string]string{"X-Event": "push"}, Delivery{}, ErrUnknownProvider},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Detect(headers(tt.headers))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Detect() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Detect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	const secret = "s3cret"
+	github := Delivery{Provider: ProviderGitHub, Event: "push"}
+	gitea := Delivery{Provider: ProviderGitea, Event: "push"}
+	gitlab := Delivery{Provider: ProviderGitLab, Event: "Push Hook"}
+
+	tests := []struct {
+		name     string
+		delivery Delivery
+		headers  map[string]string
+		secret   string
+		wantErr  bool
+	}{
+		{"github signature", github, map[string]string{"X-Hub-Signature-256": "sha256=" + sign(secret, body)}, secret, false},
+		{"gitea signature", gitea, map[string]string{"X-Gitea-Signature": sign(secret, body)}, secret, false},
+		{"forgejo signature", gitea, map[string]string{"X-Forgejo-Signature": sign(secret, body)}, secret, false},
+		{"gitlab token", gitlab, map[string]string{"X-Gitlab-Token": secret}, secret, false},
+		{"wrong secret", github, map[string]string{"X-Hub-Signature-256": "sha256=" + sign("other", body)}, secret, true},
+		{"signature of another body", github, map[string]string{"X-Hub-Signature-256": "sha256=" + sign(secret, []byte("{}"))}, secret, true},
+		{"missing signature", github, map[string]string{}, secret, true},
+		{"malformed signature", github, map[string]string{"X-Hub-Signature-256": "sha256=zz"}, secret, true},
+		{"SHA-1 signature only", github, map[string]string{"X-Hub-Signature": "sha1=" + sign(secret, body)}, secret, true},
+		{"wrong gitlab token", gitlab, map[string]string{"X-Gitlab-Token": "guess"}, secret, true},
+		{"missing gitlab token", gitlab, map[string]string{}, secret, true},
+		{"no secret configured", gitlab, map[string]string{"X-Gitlab-Token": ""}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.delivery, headers(tt.headers), body, tt.secret)
+			if tt.wantErr != errors.Is(err, ErrInvalidSignature) || (!tt.wantErr && err != nil) {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeliveryKinds(t *testing.T) {
+	tests := []struct {
+		delivery Delivery
+		ping     bool
+		push     bool
+	}{
+		{Delivery{Provider: ProviderGitHub, Event: "ping"}, true, false},
+		{Delivery{Provider: ProviderGitHub, Event: "push"}, false, true},
+		{Delivery{Provider: ProviderGitHub, Event: "pull_request"}, false, false},
+		{Delivery{Provider: ProviderGitLab, Event: "Test Hook"}, true, false},
+		{Delivery{Provider: ProviderGitLab, Event: "Tag Push Hook"}, false, true},
+		{Delivery{Provider: ProviderGitLab, Event: "push"}, false, false},
+		{Delivery{Provider: ProviderGitea, Event: "push"}, false, true},
+	}
+	for _, tt := range tests {
+		if got := tt.delivery.IsPing(); got != tt.ping {
+			t.Errorf("%+v IsPing() = %v, want %v", tt.delivery, got, tt.ping)
+		}
+		if got := tt.delivery.IsPush(); got != tt.push {
+			t.Errorf("%+v IsPush() = %v, want %v", tt.delivery, got, tt.push)
+		}
+	}
+}
+
+func TestParsePush(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name     string
+		delivery Delivery
+		body     string
+		want     Push
+		wantErr  bool
+	}{
+		{
+			name:     "github branch",
+			delivery: Delivery{Provider: ProviderGitHub, Event: "push"},
+			body:     `{"ref":"refs/heads/feature/login","after":"` + sha + `","repository":{"full_name":"acme/api"},"pusher":{"name":"octocat"}}`,
+			want:     Push{Event: EventPush, Ref: "refs/heads/feature/login", Name: "feature/login", CommitSHA: sha, Repository: "acme/api", Pusher: "octocat"},
+		},
+		{
+			name:     "github branch deletion",
+			delivery: Delivery{Provider: ProviderGitHub, Event: "push"},
+			body:     `{"ref":"refs/heads/old","after":"0000000000000000000000000000000000000000","deleted":true}`,
+			want:     Push{Event: EventPush, Ref: "refs/heads/old", Name: "old", CommitSHA: "0000000000000000000000000000000000000000", Deleted: true},
+		},
+		{
+			name:     "gitlab tag",
+			delivery: Delivery{Provider: ProviderGitLab, Event: "Tag Push Hook"},
+			body:     `{"ref":"refs/tags/v1.0.0","after":"aaaa","checkout_sha":"` + sha + `","project":{"path_with_namespace":"acme/api"},"user_username":"dev"}`,
+			want:     Push{Event: EventTag, Ref: "refs/tags/v1.0.0", Name: "v1.0.0", CommitSHA: sha, Repository: "acme/api", Pusher: "dev"},
+		},
+		{
+			name:     "gitlab tag deletion",
+			delivery: Delivery{Provider: ProviderGitLab, Event: "Tag Push Hook"},
+			body:     `{"ref":"refs/tags/v1.0.0","after":"0000000000000000000000000000000000000000","checkout_sha":null}`,
+			want:     Push{Event: EventTag, Ref: "refs/tags/v1.0.0", Name: "v1.0.0", CommitSHA: "0000000000000000000000000000000000000000", Deleted: true},
+		},
+		{
+			name:     "gitea",
+			delivery: Delivery{Provider: ProviderGitea, Event: "push"},
+			body:     `{"ref":"refs/heads/main","after":"` + sha + `","repository":{"full_name":"acme/api"},"pusher":{"login":"gitea-user","username":"gitea-user"}}`,
+			want:     Push{Event: EventPush, Ref: "refs/heads/main", Name: "main", CommitSHA: sha, Repository: "acme/api", Pusher: "gitea-user"},
+		},
+		{
+			name:     "not a push",
+			delivery: Delivery{Provider: ProviderGitHub, Event: "pull_request"},
+			body:     `{"ref":"refs/heads/main"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "unsupported ref",
+			delivery: Delivery{Provider: ProviderGitHub, Event: "push"},
+			body:     `{"ref":"refs/pull/1/head","after":"` + sha + `"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "malformed payload",
+			delivery: Delivery{Provider: ProviderGitHub, Event: "push"},
+			body:     `{"ref":`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePush(tt.delivery, []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePush() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("ParsePush() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
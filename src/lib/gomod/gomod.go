@@ -0,0 +1,187 @@
+package gomod
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"golang.org/x/mod/modfile"
+	"sort"
+	"strings"
+)
+
+// Requirement is a require directive of a go.mod
+type Requirement struct {
+	Path     string `json:"path"`
+	Version  string `json:"version"`
+	Indirect bool   `json:"indirect"`
+	Line     int    `json:"line"`
+	// Replaced is set when a replace directive swaps the module out
+	Replaced bool `json:"replaced"`
+	// InGoSum is set when go.sum has a checksum for the version; only meaningful with a go.sum
+	InGoSum bool `json:"in_go_sum"`
+}
+
+// Replacement is a replace directive. Local replacements point to a directory instead of a module.
+type Replacement struct {
+	OldPath    string `json:"old_path"`
+	OldVersion string `json:"old_version,omitempty"`
+	NewPath    string `json:"new_path"`
+	NewVersion string `json:"new_version,omitempty"`
+	Local      bool   `json:"local"`
+	Line       int    `json:"line"`
+}
+
+// ModuleVersion is a module at a version, as used by exclude directives
+type ModuleVersion struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+// Manifest is a parsed go.mod with what go.sum tells about it
+type Manifest struct {
+	Module     string
+	GoVersion  string
+	Toolchain  string
+	Requires   []Requirement
+	Replaces   []Replacement
+	Excludes   []ModuleVersion
+	Retracts   []string
+	HasGoSum   bool
+	SumEntries int
+
+	file *modfile.File
+}
+
+// Parse reads a go.mod and, when given, its go.sum
+func Parse(goMod, goSum []byte) (*Manifest, error) {
+	file, err := modfile.Parse("go.mod", goMod, nil)
+	if err != nil {
+		return nil, err
+	}
+	if file.Module == nil {
+		return nil, fmt.Errorf("go.mod has no module directive")
+	}
+
+	manifest := &Manifest{Module: file.Module.Mod.Path, file: file}
+	if file.Go != nil {
+		manifest.GoVersion = file.Go.Version
+	}
+	if file.Toolchain != nil {
+		manifest.Toolchain = file.Toolchain.Name
+	}
+	for _, replace := range file.Replace {
+		manifest.Replaces = append(manifest.Replaces, Replacement{
+			OldPath:    replace.Old.Path,
+			OldVersion: replace.Old.Version,
+			NewPath:    replace.New.Path,
+			NewVersion: replace.New.Version,
+			Local:      replace.New.Version == "",
+			Line:       replace.Syntax.Start.Line,
+		})
+	}
+	for _, exclude := range file.Exclude {
+		manifest.Excludes = append(manifest.Excludes, ModuleVersion{Path: exclude.Mod.Path, Version: exclude.Mod.Version})
+	}
+	for _, retract := range file.Retract {
+		if retract.Low == retract.High {
+			manifest.Retracts = append(manifest.Retracts, retract.Low)
+		} else {
+			manifest.Retracts = append(manifest.Retracts, fmt.Sprintf("[%s, %s]", retract.Low, retract.High))
+		}
+	}
+
+	sums := map[string]bool{}
+	if len(goSum) > 0 {
+		manifest.HasGoSum = true
+		scanner := bufio.NewScanner(bytes.NewReader(goSum))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 3 {
+				continue
+			}
+			manifest.SumEntries++
+			sums[fields[0]+"@"+strings.TrimSuffix(fields[1], "/go.mod")] = true
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read go.sum: %w", err)
+		}
+	}
+
+	for _, require := range file.Require {
+		manifest.Requires = append(manifest.Requires, Requirement{
+			Path:     require.Mod.Path,
+			Version:  require.Mod.Version,
+			Indirect: require.Indirect,
+			Line:     require.Syntax.Start.Line,
+			Replaced: manifest.isReplaced(require.Mod.Path, require.Mod.Version),
+			InGoSum:  sums[require.Mod.Path+"@"+require.Mod.Version],
+		})
+	}
+	sort.SliceStable(manifest.Requires, func(i, j int) bool { return manifest.Requires[i].Path < manifest.Requires[j].Path })
+	return manifest, nil
+}
+
+// Direct returns the requirements the module imports itself
+func (m *Manifest) Direct() []Requirement {
+	return m.filter(false)
+}
+
+// Indirect returns the requirements marked // indirect
+func (m *Manifest) Indirect() []Requirement {
+	return m.filter(true)
+}
+
+// MissingSums lists direct requirements without a go.sum entry, which fail to build
+func (m *Manifest) MissingSums() []string {
+	missing := []string{}
+	if !m.HasGoSum {
+		return missing
+	}
+	for _, require := range m.Direct() {
+		if !require.InGoSum && !require.Replaced {
+			missing = append(missing, require.Path+"@"+require.Version)
+		}
+	}
+	return missing
+}
+
+// WithUpgrades returns the go.mod with the upgraded requirements. go.sum has to be refreshed
+// with go mod tidy afterwards.
+func (m *Manifest) WithUpgrades(upgrades []Upgrade) ([]byte, error) {
+	for _, upgrade := range upgrades {
+		if err := m.file.AddRequire(upgrade.Path, upgrade.Latest); err != nil {
+			return nil, fmt.Errorf("failed to upgrade %s: %w", upgrade.Path, err)
+		}
+	}
+	m.file.Cleanup()
+	return m.file.Format()
+}
+
+// Helper Functions
+func (m *Manifest) filter(indirect bool) []Requirement {
+	requirements := []Requirement{}
+	for _, require := range m.Requires {
+		if require.Indirect == indirect {
+			requirements = append(requirements, require)
+		}
+	}
+	return requirements
+}
+
+func (m *Manifest) isReplaced(path, version string) bool {
+	for _, replace := range m.Replaces {
+		if replace.OldPath == path && (replace.OldVersion == "" || replace.OldVersion == version) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manifest) isExcluded(path, version string) bool {
+	for _, exclude := range m.Excludes {
+		if exclude.Path == path && exclude.Version == version {
+			return true
+		}
+	}
+	return false
+}
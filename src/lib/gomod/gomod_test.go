@@ -0,0 +1,130 @@
+package gomod
+
+import (
+	"strings"
+	"testing"
+)
+
+const testGoMod = `module example.com/shop
+
+go 1.24.2
+
+toolchain go1.24.4
+
+require (
+	github.com/gofiber/fiber/v2 v2.52.5
+	github.com/google/uuid v1.6.0
+	example.com/internal v0.1.0
+	golang.org/x/text v0.14.0 // indirect
+)
+
+replace example.com/internal => ../internal
+
+exclude github.com/google/uuid v1.5.0
+
+retract (
+	v1.0.0
+	[v1.1.0, v1.1.3]
+)
+`
+
+const testGoSum = `github.com/gofiber/fiber/v2 v2.52.5 h1:abc=
+github.com/gofiber/fiber/v2 v2.52.5/go.mod h1:def=
+golang.org/x/text v0.14.0/go.mod h1:ghi=
+not a sum line
+`
+
+func TestParse(t *testing.T) {
+	manifest, err := Parse([]byte(testGoMod), []byte(testGoSum))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if manifest.Module != "example.com/shop" || manifest.GoVersion != "1.24.2" || manifest.Toolchain != "go1.24.4" {
+		t.Errorf("Parse() = %s %s %s", manifest.Module, manifest.GoVersion, manifest.Toolchain)
+	}
+	if !manifest.HasGoSum || manifest.SumEntries != 3 {
+		t.Errorf("HasGoSum = %v, SumEntries = %d, want true, 3", manifest.HasGoSum, manifest.SumEntries)
+	}
+	if len(manifest.Replaces) != 1 || !manifest.Replaces[0].Local || manifest.Replaces[0].Line != 14 {
+		t.Errorf("Replaces = %+v", manifest.Replaces)
+	}
+	if len(manifest.Excludes) != 1 || manifest.Excludes[0].Version != "v1.5.0" {
+		t.Errorf("Excludes = %+v", manifest.Excludes)
+	}
+	if strings.Join(manifest.Retracts, " ") != "v1.0.0 [v1.1.0, v1.1.3]" {
+		t.Errorf("Retracts = %q", manifest.Retracts)
+	}
+
+	tests := []struct {
+		path     string
+		indirect bool
+		replaced bool
+		inGoSum  bool
+	}{
+		{"example.com/internal", false, true, false},
+		{"github.com/gofiber/fiber/v2", false, false, true},
+		{"github.com/google/uuid", false, false, false},
+		{"golang.org/x/text", true, false, true},
+	}
+	if len(manifest.Requires) != len(tests) {
+		t.Fatalf("Requires = %+v", manifest.Requires)
+	}
+	for i, tt := range tests {
+		got := manifest.Requires[i]
+		if got.Path != tt.path || got.Indirect != tt.indirect || got.Replaced != tt.replaced || got.InGoSum != tt.inGoSum {
+			t.Errorf("Requires[%d] = %+v, want %+v", i, got, tt)
+		}
+	}
+
+	if len(manifest.Direct()) != 3 || len(manifest.Indirect()) != 1 {
+		t.Errorf("Direct() = %d, Indirect() = %d, want 3, 1", len(manifest.Direct()), len(manifest.Indirect()))
+	}
+	if missing := manifest.MissingSums(); strings.Join(missing, " ") != "github.com/google/uuid@v1.6.0" {
+		t.Errorf("MissingSums() = %v", missing)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		goMod string
+	}{
+		{"no module", "go 1.24\n"},
+		{"unknown directive", "module example.com/shop\nfrobnicate x\n"},
+		{"bad version", "module example.com/shop\nrequire github.com/google/uuid latest\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.goMod), nil); err == nil {
+				t.Error("Parse() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestMissingSumsWithoutGoSum(t *testing.T) {
+	manifest, err := Parse([]byte(testGoMod), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing := manifest.MissingSums(); len(missing) != 0 {
+		t.Errorf("MissingSums() = %v, want none without a go.sum", missing)
+	}
+}
+
+func TestWithUpgrades(t *testing.T) {
+	manifest, err := Parse([]byte(testGoMod), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgraded, err := manifest.WithUpgrades([]Upgrade{{Path: "github.com/google/uuid", Current: "v1.6.0", Latest: "v1.7.0"}})
+	if err != nil {
+		t.Fatalf("WithUpgrades() error = %v", err)
+	}
+	if !strings.Contains(string(upgraded), "github.com/google/uuid v1.7.0") || strings.Contains(string(upgraded), "uuid v1.6.0") {
+		t.Errorf("WithUpgrades() =\n%s", upgraded)
+	}
+	if _, err := Parse(upgraded, nil); err != nil {
+		t.Errorf("upgraded go.mod does not parse: %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package gomod
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProxy is used when GOPROXY is not set
+const DefaultProxy = "https://proxy.golang.org"
+
+// Upgrade kinds, by the part of the version that changes
+const (
+	UpgradePatch = "patch"
+	UpgradeMinor = "minor"
+	UpgradeMajor = "major"
+)
+
+const (
+	proxyRequestTimeout = 15 * time.Second
+	proxyConcurrency    = 8
+	maxProxyResponse    = 1 << 20
+)
+
+var errModuleNotFound = errors.New("module not found")
+
+// Upgrade is a newer version of a requirement
+type Upgrade struct {
+	Path     string `json:"path"`
+	Current  string `json:"current"`
+	Latest   string `json:"latest"`
+	Kind     string `json:"kind"`
+	Indirect bool   `json:"indirect"`
+}
+
+// ModuleError is a requirement the proxy could not resolve
+type ModuleError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// Proxy resolves module versions through a GOPROXY list: https:// module proxies and file://
+// directories in the module proxy layout
+type Proxy struct {
+	entries    []proxyEntry
+	httpClient *http.Client
+}
+
+type proxyEntry struct {
+	url *url.URL
+	// fallThrough tries the next entry on any error ("|"), not only when the module is missing (",")
+	fallThrough bool
+}
+
+// NewProxy parses a GOPROXY value. "direct" and "off" are skipped since versions are only read
+// from proxies.
+func NewProxy(goproxy string) (*Proxy, error) {
+	if strings.TrimSpace(goproxy) == "" {
+		goproxy = DefaultProxy
+	}
+	proxy := &Proxy{httpClient: &http.Client{Timeout: proxyRequestTimeout}}
+	for goproxy != "" {
+		entry := goproxy
+		fallThrough := false
+		if i := strings.IndexAny(goproxy, ",|"); i >= 0 {
+			entry, fallThrough, goproxy = goproxy[:i], goproxy[i] == '|', goproxy[i+1:]
+		} else {
+			goproxy = ""
+		}
+		entry = strings.TrimSpace(entry)
+		if entry == "" || entry == "direct" || entry == "off" {
+			continue
+		}
+		parsed, err := url.Parse(entry)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http" && parsed.Scheme != "file") {
+			return nil, fmt.Errorf("invalid module proxy %q: use https://, http:// or file://", entry)
+		}
+		proxy.entries = append(proxy.entries, proxyEntry{url: parsed, fallThrough: fallThrough})
+	}
+	if len(proxy.entries) == 0 {
+		return nil, errors.New("GOPROXY has no module proxy")
+	}
+	return proxy, nil
+}
+
+// ProxyFromEnv reads GOPROXY from the environment
+func ProxyFromEnv() (*Proxy, error) {
+	return NewProxy(os.Getenv("GOPROXY"))
+}
+
+// String lists the proxies in order, without credentials
+func (p *Proxy) String() string {
+	urls := make([]string, 0, len(p.entries))
+	for _, entry := range p.entries {
+		urls = append(urls, entry.url.Redacted())
+	}
+	return strings.Join(urls, ",")
+}
+
+// Latest returns the newest version of a module: the highest release, or the highest
+// pre-release when there is no release. Versions retracted by the go.mod of that newest version
+// and excluded versions of the manifest are skipped, and +incompatible versions unless the current
+// version is one. Only the module path itself is looked up: a new major version under path/vN is
+// another module, which needs its imports rewritten, so it is never reported as an upgrade.
+func (p *Proxy) Latest(ctx context.Context, path, current string, manifest *Manifest) (string, error) {
+	escaped, err := module.EscapePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	list, err := p.fetch(ctx, escaped+"/@v/list")
+	if err != nil {
+		return "", err
+	}
+	var releases, prereleases []string
+	for _, version := range strings.Fields(string(list)) {
+		if !semver.IsValid(version) || (manifest != nil && manifest.isExcluded(path, version)) {
+			continue
+		}
+		if strings.HasSuffix(version, "+incompatible") && !strings.HasSuffix(current, "+incompatible") {
+			continue
+		}
+		if semver.Prerelease(version) == "" {
+			releases = append(releases, version)
+		} else {
+			prereleases = append(prereleases, version)
+		}
+	}
+	semver.Sort(releases)
+	semver.Sort(prereleases)
+
+	// Like the go command, retractions come from the go.mod of the newest version
+	var retractions []*modfile.Retract
+	for _, candidates := range [][]string{releases, prereleases} {
+		if len(candidates) > 0 {
+			if retractions, err = p.retractions(ctx, path, escaped, candidates[len(candidates)-1]); err != nil {
+				return "", err
+			}
+			break
+		}
+	}
+	for _, candidates := range [][]string{releases, prereleases} {
+		for i := len(candidates) - 1; i >= 0; i-- {
+			if !isRetracted(retractions, candidates[i]) {
+				return candidates[i], nil
+			}
+		}
+	}
+	if len(releases)+len(prereleases) > 0 {
+		// Everything newer is retracted: stay on the current version
+		return current, nil
+	}
+
+	// Modules without tags only have pseudo-versions, served by @latest
+	info, err := p.fetch(ctx, escaped+"/@latest")
+	if err != nil {
+		return "", err
+	}
+	var latest struct{ Version string }
+	if err := json.Unmarshal(info, &latest); err != nil || !semver.IsValid(latest.Version) {
+		return "", fmt.Errorf("invalid @latest response for %s", path)
+	}
+	return latest.Version, nil
+}
+
+// CheckUpgrades looks up newer versions of the requirements of a manifest. Replaced modules are
+// skipped, indirect ones unless includeIndirect.
+func (p *Proxy) CheckUpgrades(ctx context.Context, manifest *Manifest, includeIndirect bool) ([]Upgrade, []ModuleError) {
+	var (
+		mutex    sync.Mutex
+		wait     sync.WaitGroup
+		upgrades = []Upgrade{}
+		failures = []ModuleError{}
+		slots    = make(chan struct{}, proxyConcurrency)
+	)
+	for _, require := range manifest.Requires {
+		if require.Replaced || (require.Indirect && !includeIndirect) {
+			continue
+		}
+		wait.Add(1)
+		go func(require Requirement) {
+			defer wait.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			latest, err := p.Latest(ctx, require.Path, require.Version, manifest)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				failures = append(failures, ModuleError{Path: require.Path, Error: err.Error()})
+				return
+			}
+			if semver.Compare(latest, require.Version) > 0 {
+				upgrades = append(upgrades, Upgrade{
+					Path:     require.Path,
+					Current:  require.Version,
+					Latest:   latest,
+					Kind:     upgradeKind(require.Version, latest),
+					Indirect: require.Indirect,
+				})
+			}
+		}(require)
+	}
+	wait.Wait()
+
+	sort.Slice(upgrades, func(i, j int) bool { return upgrades[i].Path < upgrades[j].Path })
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Path < failures[j].Path })
+	return upgrades, failures
+}
+
+// Helper Functions
+
+// retractions reads the retract directives of a module version's go.mod. A proxy without the
+// go.mod has nothing to retract.
+func (p *Proxy) retractions(ctx context.Context, path, escaped, version string) ([]*modfile.Retract, error) {
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	goMod, err := p.fetch(ctx, escaped+"/@v/"+escapedVersion+".mod")
+	if errors.Is(err, errModuleNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file, err := modfile.ParseLax(path+"@"+version+"/go.mod", goMod, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid go.mod of %s@%s: %w", path, version, err)
+	}
+	return file.Retract, nil
+}
+
+func isRetracted(retractions []*modfile.Retract, version string) bool {
+	for _, retract := range retractions {
+		if semver.Compare(retract.Low, version) <= 0 && semver.Compare(version, retract.High) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proxy) fetch(ctx context.Context, file string) ([]byte, error) {
+	var lastErr error
+	for i, entry := range p.entries {
+		body, err := p.fetchFrom(ctx, entry.url, file)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		// Like the go command: "," moves on only when the proxy does not have the module
+		if !errors.Is(err, errModuleNotFound) && !entry.fallThrough && i < len(p.entries)-1 {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+func (p *Proxy) fetchFrom(ctx context.Context, base *url.URL, file string) ([]byte, error) {
+	if base.Scheme == "file" {
+		body, err := os.ReadFile(filepath.Join(filepath.FromSlash(base.Path), filepath.FromSlash(file)))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errModuleNotFound
+		}
+		return body, err
+	}
+
+	endpoint := strings.TrimSuffix(base.String(), "/") + "/" + file
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := p.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("module proxy %s: %w", base.Redacted(), err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxProxyResponse))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone:
+		return nil, errModuleNotFound
+	case response.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("module proxy %s answered %d: %s", base.Redacted(), response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func upgradeKind(from, to string) string {
+	switch {
+	case semver.Major(from) != semver.Major(to):
+		return UpgradeMajor
+	case semver.MajorMinor(from) != semver.MajorMinor(to):
+		return UpgradeMinor
+	}
+	return UpgradePatch
+}
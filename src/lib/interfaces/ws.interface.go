@@ -1,6 +1,7 @@
 package interfaces
 
 import (
+	"deva/store"
 	"github.com/gofiber/websocket/v2"
 	"sync"
 )
@@ -8,6 +9,8 @@ import (
 type SafeConn struct {
 	Conn *websocket.Conn
 	Mu   sync.Mutex
+	// Stream, when set, receives every message as a log event for SSE subscribers
+	Stream string
 }
 
 type WorkflowStep struct {
@@ -16,10 +19,18 @@ type WorkflowStep struct {
 	Action   string
 	EnvVars  map[string]string
 	Required bool
+	// Run, when set, is executed in-process instead of Command
+	Run func(sc *SafeConn) error
 }
 
 func (sc *SafeConn) SafeWrite(msgType int, data []byte) error {
 	sc.Mu.Lock()
 	defer sc.Mu.Unlock()
+	if sc.Stream != "" {
+		store.PublishLog(sc.Stream, string(data))
+	}
+	if sc.Conn == nil {
+		return nil
+	}
 	return sc.Conn.WriteMessage(msgType, data)
 }
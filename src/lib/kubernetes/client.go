@@ -0,0 +1,231 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client talks to the Kubernetes API server with a bearer token or a client certificate
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// VersionInfo is the response of GET /version
+type VersionInfo struct {
+	Major      string `json:"major"`
+	Minor      string `json:"minor"`
+	GitVersion string `json:"gitVersion"`
+	Platform   string `json:"platform"`
+	GoVersion  string `json:"goVersion"`
+}
+
+// APIError is returned when the API server answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("kubernetes %s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// ConnectionError is returned when the API server cannot be reached
+type ConnectionError struct {
+	Server string
+	Err    error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("cannot connect to kubernetes API server at %s: %v", e.Server, e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// NewClient creates a client for an https API server URL. token may be empty when tlsConfig
+// carries a client certificate.
+func NewClient(server string, tlsConfig *tls.Config, token string) (*Client, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API server %q: %w", server, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid API server %q: expected https://host[:port]", server)
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(u.Scheme+"://"+u.Host+u.Path, "/"),
+		token:      token,
+		httpClient: &http.Client{Transport: transport},
+	}, nil
+}
+
+// TLSConfigFromPEM builds the TLS configuration of an API server. cert and key are optional.
+func TLSConfigFromPEM(caCert, cert, key []byte) (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("invalid CA certificate")
+	}
+	config := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+
+	if len(cert) > 0 || len(key) > 0 {
+		keyPair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{keyPair}
+	}
+	return config, nil
+}
+
+// Version returns version information of the API server
+func (c *Client) Version(ctx context.Context) (*VersionInfo, error) {
+	var info VersionInfo
+	if err := c.doJSON(ctx, http.MethodGet, "/version", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ServerGroups returns the group versions served by the API server, e.g. "v1", "apps/v1"
+func (c *Client) ServerGroups(ctx context.Context) ([]string, error) {
+	var core struct {
+		Versions []string `json:"versions"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/api", nil, &core); err != nil {
+		return nil, err
+	}
+
+	var groups struct {
+		Groups []struct {
+			Versions []struct {
+				GroupVersion string `json:"groupVersion"`
+			} `json:"versions"`
+		} `json:"groups"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/apis", nil, &groups); err != nil {
+		return nil, err
+	}
+
+	result := append([]string{}, core.Versions...)
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			result = append(result, version.GroupVersion)
+		}
+	}
+	return result, nil
+}
+
+// CanI asks the API server whether the client may perform verb on a resource in namespace
+func (c *Client) CanI(ctx context.Context, namespace, verb, group, resource string) (bool, error) {
+	review := map[string]interface{}{
+		"apiVersion": "authorization.k8s.io/v1",
+		"kind":       "SelfSubjectAccessReview",
+		"spec": map[string]interface{}{
+			"resourceAttributes": map[string]string{
+				"namespace": namespace,
+				"verb":      verb,
+				"group":     group,
+				"resource":  resource,
+			},
+		},
+	}
+	var result struct {
+		Status struct {
+			Allowed bool `json:"allowed"`
+		} `json:"status"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", review, &result); err != nil {
+		return false, err
+	}
+	return result.Status.Allowed, nil
+}
+
+// Helper Functions
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &ConnectionError{Server: c.baseURL, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return newAPIError(method, path, resp)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+		}
+	}
+	return nil
+}
+
+func newAPIError(method, path string, resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	// Errors are metav1.Status objects
+	message := strings.TrimSpace(string(body))
+	var status struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &status); err == nil && status.Message != "" {
+		message = status.Message
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     method,
+		Path:       path,
+		Message:    message,
+	}
+}
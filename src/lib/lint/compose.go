@@ -0,0 +1,163 @@
+package lint
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var yamlLinePattern = regexp.MustCompile(`line (\d+)`)
+
+// Compose lints a docker-compose file. The app is the service named "app" or any service with a
+// build section; the port rule only applies to it.
+func Compose(content string, opts Options) []Finding {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &root); err != nil {
+		line := 0
+		if match := yamlLinePattern.FindStringSubmatch(err.Error()); match != nil {
+			line, _ = strconv.Atoi(match[1])
+		}
+		return []Finding{{Rule: RuleSyntax, Severity: SeverityError, Line: line, Message: "invalid YAML: " + err.Error()}}
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return []Finding{{Rule: RuleSyntax, Severity: SeverityError, Line: 0, Message: "a compose file is a YAML mapping"}}
+	}
+
+	_, services := mappingValue(root.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return []Finding{{Rule: RuleSyntax, Severity: SeverityError, Line: 0, Message: "no services defined"}}
+	}
+
+	var findings []Finding
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		name, service := services.Content[i].Value, services.Content[i+1]
+		if service.Kind != yaml.MappingNode {
+			findings = append(findings, Finding{Rule: RuleSyntax, Severity: SeverityError, Line: services.Content[i].Line,
+				Message: fmt.Sprintf("service %s must be a mapping", name)})
+			continue
+		}
+		findings = append(findings, lintService(name, services.Content[i].Line, service, opts)...)
+	}
+	return sortFindings(findings)
+}
+
+// Helper Functions
+func lintService(name string, line int, service *yaml.Node, opts Options) []Finding {
+	var findings []Finding
+	_, build := mappingValue(service, "build")
+	isApp := name == "app" || build != nil
+
+	// An image next to build names the result of the build, it is not pulled
+	if key, image := mappingValue(service, "image"); image != nil && build == nil {
+		if ref, resolved := interpolate(image.Value, opts.Env); resolved {
+			for _, finding := range checkImage(ref, key.Line, false) {
+				finding.Message = "service " + name + ": " + finding.Message
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	if key, user := mappingValue(service, "user"); user != nil {
+		if value, _ := interpolate(user.Value, opts.Env); isRootUser(value) {
+			findings = append(findings, Finding{Rule: RuleRootUser, Severity: SeverityWarning, Line: key.Line,
+				Message: fmt.Sprintf("service %s runs as root", name)})
+		}
+	}
+	if key, privileged := mappingValue(service, "privileged"); privileged != nil && privileged.Value == "true" {
+		findings = append(findings, Finding{Rule: RulePrivileged, Severity: SeverityError, Line: key.Line,
+			Message: fmt.Sprintf("service %s is privileged and has full access to the host", name)})
+	}
+	if key, mode := mappingValue(service, "network_mode"); mode != nil && mode.Value == "host" {
+		findings = append(findings, Finding{Rule: RuleHostNetwork, Severity: SeverityWarning, Line: key.Line,
+			Message: fmt.Sprintf("service %s shares the host network; publish ports instead", name)})
+	}
+
+	if _, environment := mappingValue(service, "environment"); environment != nil {
+		for _, variable := range environmentVariables(environment) {
+			if isSecretKey(variable.key) && variable.value != "" && !isReference(variable.value) {
+				findings = append(findings, Finding{Rule: RuleSecretInEnv, Severity: SeverityError, Line: variable.line,
+					Message: fmt.Sprintf("service %s: %s is written out in the compose file; use ${%s} from .env or secrets", name, variable.key, variable.key)})
+			}
+		}
+	}
+
+	if !isApp {
+		return findings
+	}
+	if _, healthcheck := mappingValue(service, "healthcheck"); healthcheck == nil {
+		findings = append(findings, Finding{Rule: RuleMissingHealthcheck, Severity: SeverityInfo, Line: line,
+			Message: fmt.Sprintf("service %s has no healthcheck; depends_on cannot wait for it to be ready", name)})
+	}
+	if key, ports := mappingValue(service, "ports"); ports != nil && opts.AppPort != "" {
+		published := containerPorts(ports, opts.Env)
+		matched := false
+		for _, port := range published {
+			matched = matched || portMatches(port, opts.AppPort)
+		}
+		if !matched && len(published) > 0 {
+			findings = append(findings, Finding{Rule: RulePortMismatch, Severity: SeverityWarning, Line: key.Line,
+				Message: fmt.Sprintf("service %s publishes container port %s, not APP_PORT %s", name, strings.Join(published, ", "), opts.AppPort)})
+		}
+	}
+	return findings
+}
+
+// mappingValue returns the key and value nodes of a mapping entry
+func mappingValue(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+type composeVariable struct {
+	key   string
+	value string
+	line  int
+}
+
+// environmentVariables reads the map and the list ("KEY=VALUE") forms of environment
+func environmentVariables(environment *yaml.Node) []composeVariable {
+	var variables []composeVariable
+	switch environment.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(environment.Content); i += 2 {
+			variables = append(variables, composeVariable{environment.Content[i].Value, environment.Content[i+1].Value, environment.Content[i].Line})
+		}
+	case yaml.SequenceNode:
+		for _, item := range environment.Content {
+			key, value, _ := strings.Cut(item.Value, "=")
+			variables = append(variables, composeVariable{key, value, item.Line})
+		}
+	}
+	return variables
+}
+
+// containerPorts returns the container ports of the short ("8080:80") and long (target:) port
+// syntax, skipping ports that depend on unset variables
+func containerPorts(ports *yaml.Node, env map[string]string) []string {
+	var result []string
+	for _, item := range ports.Content {
+		value := item.Value
+		if item.Kind == yaml.MappingNode {
+			if _, target := mappingValue(item, "target"); target != nil {
+				value = target.Value
+			}
+		}
+		resolved, ok := interpolate(value, env)
+		if !ok || resolved == "" {
+			continue
+		}
+		result = append(result, containerPort(resolved))
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,289 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// instruction is one Dockerfile instruction with its continuation lines joined
+type instruction struct {
+	line    int
+	command string
+	args    string
+}
+
+// stage is a FROM section of a Dockerfile
+type stage struct {
+	from        instruction
+	user        *instruction
+	healthcheck *instruction
+	exposes     []instruction
+}
+
+var heredocPattern = regexp.MustCompile(`<<-?\s*["']?([A-Za-z_][A-Za-z0-9_]*)["']?`)
+
+// Dockerfile lints a Dockerfile. The final stage is the image that runs, so the user, healthcheck
+// and port rules only look at it.
+func Dockerfile(content string, opts Options) []Finding {
+	instructions := parseDockerfile(content)
+	var findings []Finding
+	var stages []*stage
+	stageNames := map[string]bool{}
+	args := map[string]string{}
+	for key, value := range opts.Env {
+		args[key] = value
+	}
+
+	for _, inst := range instructions {
+		var current *stage
+		if len(stages) > 0 {
+			current = stages[len(stages)-1]
+		}
+
+		switch inst.command {
+		case "FROM":
+			fields := withoutFlags(strings.Fields(inst.args))
+			if len(fields) == 0 {
+				findings = append(findings, Finding{Rule: RuleSyntax, Severity: SeverityError, Line: inst.line, Message: "FROM needs an image"})
+				continue
+			}
+			stages = append(stages, &stage{from: inst})
+			image, resolved := interpolate(fields[0], args)
+			// Earlier stages and scratch are not pulled
+			if resolved && image != "scratch" && !stageNames[strings.ToLower(image)] {
+				findings = append(findings, checkImage(image, inst.line, true)...)
+			}
+			if len(fields) >= 3 && strings.EqualFold(fields[1], "as") {
+				stageNames[strings.ToLower(fields[2])] = true
+			}
+		case "ARG":
+			for _, pair := range strings.Fields(inst.args) {
+				// Values from the project env act as --build-arg and win over defaults
+				key, value, _ := strings.Cut(pair, "=")
+				if _, set := args[key]; !set {
+					args[key] = strings.Trim(value, `"'`)
+				}
+				if isSecretKey(key) {
+					findings = append(findings, Finding{Rule: RuleSecretInEnv, Severity: SeverityWarning, Line: inst.line,
+						Message: fmt.Sprintf("build arg %s is recorded in the image history; use a secret mount", key)})
+				}
+			}
+		case "ENV":
+			for _, pair := range parseEnv(inst.args) {
+				key, value := pair[0], pair[1]
+				if isSecretKey(key) && value != "" && !isReference(value) {
+					findings = append(findings, Finding{Rule: RuleSecretInEnv, Severity: SeverityError, Line: inst.line,
+						Message: fmt.Sprintf("ENV %s holds a credential baked into the image; pass it at runtime", key)})
+				}
+			}
+		case "USER":
+			if current != nil {
+				current.user = &inst
+			}
+		case "HEALTHCHECK":
+			if current != nil {
+				current.healthcheck = &inst
+			}
+		case "EXPOSE":
+			if current != nil {
+				current.exposes = append(current.exposes, inst)
+			}
+		case "ADD":
+			fields := withoutFlags(strings.Fields(inst.args))
+			if len(fields) >= 2 && !isRemoteSource(fields[0]) && !isArchive(fields[0]) {
+				findings = append(findings, Finding{Rule: RuleAddInsteadOfCopy, Severity: SeverityInfo, Line: inst.line,
+					Message: "use COPY for local files; ADD also unpacks archives and fetches URLs"})
+			}
+		}
+	}
+
+	if len(stages) == 0 {
+		findings = append(findings, Finding{Rule: RuleSyntax, Severity: SeverityError, Line: 0, Message: "no FROM instruction"})
+		return sortFindings(findings)
+	}
+	final := stages[len(stages)-1]
+	findings = append(findings, checkFinalStage(final, opts.AppPort, args)...)
+	return sortFindings(findings)
+}
+
+// BaseImages returns the images the stages of a Dockerfile start FROM, with ARG references resolved
+// like the build does. Earlier stages, scratch and unresolved references are left out.
+func BaseImages(content string, env map[string]string) []string {
+	args := map[string]string{}
+	for key, value := range env {
+		args[key] = value
+	}
+	stageNames := map[string]bool{}
+	seen := map[string]bool{}
+	images := []string{}
+	for _, inst := range parseDockerfile(content) {
+		switch inst.command {
+		case "ARG":
+			for _, pair := range strings.Fields(inst.args) {
+				key, value, _ := strings.Cut(pair, "=")
+				if _, set := args[key]; !set {
+					args[key] = strings.Trim(value, `"'`)
+				}
+			}
+		case "FROM":
+			fields := withoutFlags(strings.Fields(inst.args))
+			if len(fields) == 0 {
+				continue
+			}
+			image, resolved := interpolate(fields[0], args)
+			if resolved && image != "scratch" && !stageNames[strings.ToLower(image)] && !seen[image] {
+				seen[image] = true
+				images = append(images, image)
+			}
+			if len(fields) >= 3 && strings.EqualFold(fields[1], "as") {
+				stageNames[strings.ToLower(fields[2])] = true
+			}
+		}
+	}
+	return images
+}
+
+// Helper Functions
+func checkFinalStage(final *stage, appPort string, args map[string]string) []Finding {
+	var findings []Finding
+	if final.user == nil {
+		findings = append(findings, Finding{Rule: RuleRootUser, Severity: SeverityWarning, Line: final.from.line,
+			Message: "the image runs as root; add a USER with an unprivileged user"})
+	} else if user, _ := interpolate(final.user.args, args); isRootUser(user) {
+		findings = append(findings, Finding{Rule: RuleRootUser, Severity: SeverityWarning, Line: final.user.line,
+			Message: "USER " + final.user.args + " runs the container as root"})
+	}
+
+	switch {
+	case final.healthcheck == nil:
+		findings = append(findings, Finding{Rule: RuleMissingHealthcheck, Severity: SeverityWarning, Line: final.from.line,
+			Message: "no HEALTHCHECK; the engine cannot tell when the app is ready"})
+	case strings.EqualFold(strings.TrimSpace(final.healthcheck.args), "NONE"):
+		findings = append(findings, Finding{Rule: RuleMissingHealthcheck, Severity: SeverityInfo, Line: final.healthcheck.line,
+			Message: "HEALTHCHECK NONE disables the health check of the base image"})
+	}
+
+	if appPort == "" || len(final.exposes) == 0 {
+		return findings
+	}
+	var exposed []string
+	for _, expose := range final.exposes {
+		for _, port := range strings.Fields(expose.args) {
+			port, _ = interpolate(port, args)
+			port = containerPort(port)
+			if portMatches(port, appPort) {
+				return findings
+			}
+			exposed = append(exposed, port)
+		}
+	}
+	return append(findings, Finding{Rule: RulePortMismatch, Severity: SeverityWarning, Line: final.exposes[0].line,
+		Message: fmt.Sprintf("EXPOSE %s does not include APP_PORT %s", strings.Join(exposed, " "), appPort)})
+}
+
+// parseDockerfile splits a Dockerfile into instructions, joining continuation lines and skipping
+// comments, parser directives and heredoc bodies
+func parseDockerfile(content string) []instruction {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	var instructions []instruction
+	var current *instruction
+	heredoc := ""
+
+	for i, raw := range lines {
+		line := strings.TrimSpace(raw)
+		if heredoc != "" {
+			if line == heredoc {
+				heredoc = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") || (line == "" && current == nil) {
+			continue
+		}
+
+		continued := strings.HasSuffix(line, "\\")
+		line = strings.TrimSuffix(line, "\\")
+		if current == nil {
+			command, args, _ := strings.Cut(line, " ")
+			current = &instruction{line: i + 1, command: strings.ToUpper(command), args: strings.TrimSpace(args)}
+		} else if line != "" {
+			current.args = strings.TrimSpace(current.args + " " + line)
+		}
+		if match := heredocPattern.FindStringSubmatch(line); match != nil {
+			heredoc = match[1]
+		}
+		if !continued {
+			instructions = append(instructions, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		instructions = append(instructions, *current)
+	}
+	return instructions
+}
+
+// parseEnv reads "ENV KEY=VALUE KEY2=VALUE2" and the legacy "ENV KEY VALUE"
+func parseEnv(args string) [][2]string {
+	fields := splitQuoted(args)
+	if len(fields) > 0 && !strings.Contains(fields[0], "=") {
+		return [][2]string{{fields[0], strings.TrimSpace(strings.TrimPrefix(args, fields[0]))}}
+	}
+	env := make([][2]string, 0, len(fields))
+	for _, field := range fields {
+		key, value, _ := strings.Cut(field, "=")
+		env = append(env, [2]string{key, strings.Trim(value, `"'`)})
+	}
+	return env
+}
+
+// splitQuoted splits on spaces outside of quotes
+func splitQuoted(s string) []string {
+	var fields []string
+	var field strings.Builder
+	quote := rune(0)
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			field.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			field.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+func withoutFlags(fields []string) []string {
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "--") {
+		fields = fields[1:]
+	}
+	return fields
+}
+
+func isRemoteSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "git@")
+}
+
+func isArchive(source string) bool {
+	for _, suffix := range []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tar.xz"} {
+		if strings.HasSuffix(source, suffix) {
+			return true
+		}
+	}
+	return false
+}
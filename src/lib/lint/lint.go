@@ -0,0 +1,218 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Finding severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Rules reported by the linters
+const (
+	RuleSyntax             = "syntax"
+	RuleUnpinnedImage      = "unpinned-image"
+	RuleLatestTag          = "latest-tag"
+	RuleDigestPin          = "digest-pin"
+	RuleRootUser           = "root-user"
+	RuleMissingHealthcheck = "missing-healthcheck"
+	RuleSecretInEnv        = "secret-in-env"
+	RulePortMismatch       = "port-mismatch"
+	RuleAddInsteadOfCopy   = "add-instead-of-copy"
+	RulePrivileged         = "privileged"
+	RuleHostNetwork        = "host-network"
+)
+
+// Finding is one problem found in a file. Line is 1-based, 0 when the problem concerns the
+// whole file.
+type Finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Line     int    `json:"line"`
+	Message  string `json:"message"`
+}
+
+// Options carries what the linters know about the project
+type Options struct {
+	// AppPort is the port the app listens on, checked against EXPOSE and published ports
+	AppPort string
+	// Env resolves ${VAR} references, e.g. the project .env
+	Env map[string]string
+}
+
+// secretKeyMarkers identify variables holding credentials, like the project secret detection
+var secretKeyMarkers = []string{"PASS", "SECRET", "TOKEN", "PRIVATE", "API_KEY"}
+
+// Supports reports whether a file is a Dockerfile or a compose file, judging by its name
+func Supports(path string) bool {
+	return IsDockerfile(path) || isComposeFile(path)
+}
+
+// IsDockerfile reports whether a file is a Dockerfile, judging by its name
+func IsDockerfile(path string) bool {
+	name := filepath.Base(path)
+	return name == "Dockerfile" || strings.HasPrefix(name, "Dockerfile.") || strings.HasSuffix(name, ".Dockerfile")
+}
+
+// File lints a Dockerfile or a compose file, judging by its name
+func File(path, content string, opts Options) []Finding {
+	if isComposeFile(path) {
+		return Compose(content, opts)
+	}
+	return Dockerfile(content, opts)
+}
+
+// OptionsFromEnv builds the options for a project env
+func OptionsFromEnv(env map[string]string) Options {
+	return Options{AppPort: env["APP_PORT"], Env: env}
+}
+
+// Summarize counts findings per severity
+func Summarize(findings []Finding) map[string]int {
+	summary := map[string]int{SeverityError: 0, SeverityWarning: 0, SeverityInfo: 0}
+	for _, finding := range findings {
+		summary[finding.Severity]++
+	}
+	return summary
+}
+
+// HasErrors reports whether any finding is an error
+func HasErrors(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitImage splits an image reference into name, tag and digest
+func SplitImage(ref string) (name, tag, digest string) {
+	name = ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	return name, tag, digest
+}
+
+// Helper Functions
+func sortFindings(findings []Finding) []Finding {
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	if findings == nil {
+		return []Finding{}
+	}
+	return findings
+}
+
+func isComposeFile(path string) bool {
+	switch filepath.Base(path) {
+	case "docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml":
+		return true
+	}
+	return false
+}
+
+func isSecretKey(key string) bool {
+	upper := strings.ToUpper(key)
+	for _, marker := range secretKeyMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// interpolate resolves $VAR, ${VAR}, ${VAR:-default} and ${VAR-default}. resolved is false when
+// a variable is neither set nor has a default.
+func interpolate(value string, env map[string]string) (string, bool) {
+	resolved := true
+	expanded := os.Expand(value, func(expression string) string {
+		name, fallback, hasDefault := expression, "", false
+		if i := strings.IndexAny(expression, ":?"); i >= 0 && !strings.HasPrefix(expression[i:], ":-") {
+			// ${VAR:?message} and ${VAR?message} require the variable
+			name = expression[:i]
+		} else if i := strings.Index(expression, ":-"); i >= 0 {
+			name, fallback, hasDefault = expression[:i], expression[i+2:], true
+		} else if i := strings.Index(expression, "-"); i >= 0 {
+			name, fallback, hasDefault = expression[:i], expression[i+1:], true
+		}
+		if v, ok := env[name]; ok && (v != "" || !strings.Contains(expression, ":-")) {
+			return v
+		}
+		if hasDefault {
+			return fallback
+		}
+		resolved = false
+		return ""
+	})
+	return expanded, resolved
+}
+
+// isReference reports whether a value is taken from variables rather than written out
+func isReference(value string) bool {
+	return strings.Contains(value, "$")
+}
+
+// checkImage reports images without a tag or on latest. withDigest also suggests a digest pin.
+func checkImage(ref string, line int, withDigest bool) []Finding {
+	_, tag, digest := SplitImage(ref)
+	switch {
+	case digest != "":
+		return nil
+	case tag == "":
+		return []Finding{{Rule: RuleUnpinnedImage, Severity: SeverityWarning, Line: line,
+			Message: "image " + ref + " has no tag and follows whatever latest points to; pin a version"}}
+	case tag == "latest":
+		return []Finding{{Rule: RuleLatestTag, Severity: SeverityWarning, Line: line,
+			Message: "image " + ref + " uses the latest tag; pin a version"}}
+	case withDigest:
+		return []Finding{{Rule: RuleDigestPin, Severity: SeverityInfo, Line: line,
+			Message: "image " + ref + " is pinned by tag only; add a digest for reproducible builds"}}
+	}
+	return nil
+}
+
+func isRootUser(user string) bool {
+	user = strings.TrimSpace(user)
+	if i := strings.Index(user, ":"); i >= 0 {
+		user = user[:i]
+	}
+	return user == "" || user == "root" || user == "0"
+}
+
+// containerPort returns the container side of a port mapping like "8080", "80:8080",
+// "127.0.0.1:80:8080/tcp" or a range
+func containerPort(mapping string) string {
+	if i := strings.Index(mapping, "/"); i >= 0 {
+		mapping = mapping[:i]
+	}
+	if i := strings.LastIndex(mapping, ":"); i >= 0 {
+		mapping = mapping[i+1:]
+	}
+	return strings.TrimSpace(mapping)
+}
+
+// portMatches reports whether a port or port range covers the app port
+func portMatches(port, appPort string) bool {
+	if port == appPort {
+		return true
+	}
+	low, high, ok := strings.Cut(port, "-")
+	if !ok {
+		return false
+	}
+	from, errFrom := strconv.Atoi(low)
+	to, errTo := strconv.Atoi(high)
+	app, errApp := strconv.Atoi(appPort)
+	return errFrom == nil && errTo == nil && errApp == nil && from <= app && app <= to
+}
@@ -0,0 +1,277 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// rules formats findings as "rule:line" for comparison
+func rules(findings []Finding) string {
+	var out []string
+	for _, f := range findings {
+		out = append(out, fmt.Sprintf("%s:%d", f.Rule, f.Line))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestDockerfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		opts    Options
+		want    string
+	}{
+		{
+			name: "clean multi-stage build",
+			content: `# syntax=docker/dockerfile:1
+ARG GO_VERSION=1.24
+FROM golang:${GO_VERSION}@sha256:abc AS build
+COPY . .
+RUN go build -o /app
+
+FROM gcr.io/distroless/static:nonroot@sha256:def
+COPY --from=build /app /app
+USER 65532:65532
+EXPOSE 8080
+HEALTHCHECK CMD ["/app", "health"]
+`,
+			opts: Options{AppPort: "8080"},
+			want: "",
+		},
+		{
+			name:    "no FROM",
+			content: "RUN echo hi\n",
+			want:    "syntax:0",
+		},
+		{
+			name:    "FROM without an image",
+			content: "FROM\nFROM alpine:3.20@sha256:abc\nUSER app\nHEALTHCHECK NONE\n",
+			want:    "syntax:1 missing-healthcheck:4",
+		},
+		{
+			name:    "unpinned and latest images",
+			content: "FROM golang AS build\nFROM alpine:latest\nUSER app\nHEALTHCHECK CMD true\n",
+			want:    "unpinned-image:1 latest-tag:2",
+		},
+		{
+			name:    "tag without digest",
+			content: "FROM alpine:3.20\nUSER app\nHEALTHCHECK CMD true\n",
+			want:    "digest-pin:1",
+		},
+		{
+			name:    "earlier stage and scratch are not pulled",
+			content: "FROM alpine:3.20@sha256:abc AS base\nFROM base\nFROM scratch\nUSER 1000\nHEALTHCHECK CMD true\n",
+			want:    "",
+		},
+		{
+			name:    "root user",
+			content: "FROM alpine:3.20@sha256:abc\nUSER root:root\nHEALTHCHECK CMD true\n",
+			want:    "root-user:2",
+		},
+		{
+			name:    "user only in the build stage",
+			content: "FROM alpine:3.20@sha256:abc AS build\nUSER app\nFROM alpine:3.20@sha256:abc\nHEALTHCHECK CMD true\n",
+			want:    "root-user:3",
+		},
+		{
+			name:    "secrets",
+			content: "FROM alpine:3.20@sha256:abc\nARG NPM_TOKEN\nENV DB_PASSWORD=hunter2 API_KEY=${API_KEY} LOG_LEVEL=info\nUSER app\nHEALTHCHECK CMD true\n",
+			want:    "secret-in-env:2 secret-in-env:3",
+		},
+		{
+			name:    "port mismatch",
+			content: "FROM alpine:3.20@sha256:abc\nUSER app\nEXPOSE 3000/tcp\nHEALTHCHECK CMD true\n",
+			opts:    Options{AppPort: "8080"},
+			want:    "port-mismatch:3",
+		},
+		{
+			name:    "port from an ARG",
+			content: "FROM alpine:3.20@sha256:abc\nARG APP_PORT=3000\nUSER app\nEXPOSE ${APP_PORT}\nHEALTHCHECK CMD true\n",
+			opts:    Options{AppPort: "8080", Env: map[string]string{"APP_PORT": "8080"}},
+			want:    "",
+		},
+		{
+			name:    "port range",
+			content: "FROM alpine:3.20@sha256:abc\nUSER app\nEXPOSE 8000-8100\nHEALTHCHECK CMD true\n",
+			opts:    Options{AppPort: "8080"},
+			want:    "",
+		},
+		{
+			name:    "ADD of local files",
+			content: "FROM alpine:3.20@sha256:abc\nADD --chown=app . /src\nADD app.tar.gz /opt\nADD https://example.com/x /x\nUSER app\nHEALTHCHECK CMD true\n",
+			want:    "add-instead-of-copy:2",
+		},
+		{
+			name:    "continuation lines and heredocs",
+			content: "FROM alpine:3.20@sha256:abc\nRUN apk add \\\n  curl\nRUN <<EOF\nUSER root\nEOF\nUSER app\nHEALTHCHECK CMD true\n",
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules(Dockerfile(tt.content, tt.opts)); got != tt.want {
+				t.Errorf("Dockerfile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompose(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		opts    Options
+		want    string
+	}{
+		{
+			name: "clean",
+			content: `services:
+  app:
+    build: .
+    image: shop-app
+    user: "1000"
+    ports:
+      - "80:${APP_PORT}"
+    environment:
+      DB_PASSWORD: ${DB_PASSWORD}
+    healthcheck:
+      test: ["CMD", "/app", "health"]
+  db:
+    image: postgres:16
+`,
+			opts: Options{AppPort: "8080", Env: map[string]string{"APP_PORT": "8080"}},
+			want: "",
+		},
+		{
+			name:    "invalid YAML",
+			content: "services:\n  app:\n    image: [x\n",
+			want:    "syntax:2",
+		},
+		{
+			name:    "not a mapping",
+			content: "- app\n",
+			want:    "syntax:0",
+		},
+		{
+			name:    "no services",
+			content: "version: '3'\n",
+			want:    "syntax:0",
+		},
+		{
+			name:    "service is not a mapping",
+			content: "services:\n  app: shop\n",
+			want:    "syntax:2",
+		},
+		{
+			name: "unsafe services",
+			content: `services:
+  cache:
+    image: redis
+    privileged: true
+    network_mode: host
+    user: root
+    environment:
+      - REDIS_PASSWORD=hunter2
+  proxy:
+    image: nginx:latest
+`,
+			want: "unpinned-image:3 privileged:4 host-network:5 root-user:6 secret-in-env:8 latest-tag:10",
+		},
+		{
+			name: "app port and healthcheck",
+			content: `services:
+  app:
+    image: shop:1.0
+    ports:
+      - "127.0.0.1:80:3000/tcp"
+`,
+			opts: Options{AppPort: "8080"},
+			want: "missing-healthcheck:2 port-mismatch:4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules(Compose(tt.content, tt.opts)); got != tt.want {
+				t.Errorf("Compose() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		path     string
+		supports bool
+		compose  bool
+	}{
+		{"Dockerfile", true, false},
+		{"docker/Dockerfile.postgres", true, false},
+		{"api.Dockerfile", true, false},
+		{"docker-compose.yml", true, true},
+		{"deploy/compose.yaml", true, true},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := Supports(tt.path); got != tt.supports {
+			t.Errorf("Supports(%q) = %v, want %v", tt.path, got, tt.supports)
+		}
+		if !tt.supports {
+			continue
+		}
+		// An empty file is a syntax error either way; the message tells which linter ran
+		findings := File(tt.path, "", Options{})
+		if len(findings) != 1 || strings.Contains(findings[0].Message, "FROM") == tt.compose {
+			t.Errorf("File(%q) = %+v", tt.path, findings)
+		}
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		ref, name, tag, digest string
+	}{
+		{"alpine", "alpine", "", ""},
+		{"alpine:3.20", "alpine", "3.20", ""},
+		{"localhost:5000/shop", "localhost:5000/shop", "", ""},
+		{"localhost:5000/shop:1.0@sha256:abc", "localhost:5000/shop", "1.0", "sha256:abc"},
+		{"alpine@sha256:abc", "alpine", "", "sha256:abc"},
+	}
+	for _, tt := range tests {
+		name, tag, digest := SplitImage(tt.ref)
+		if name != tt.name || tag != tt.tag || digest != tt.digest {
+			t.Errorf("SplitImage(%q) = %q, %q, %q", tt.ref, name, tag, digest)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{"TAG": "1.0", "EMPTY": ""}
+	tests := []struct {
+		value        string
+		want         string
+		wantResolved bool
+	}{
+		{"shop:${TAG}", "shop:1.0", true},
+		{"shop:$TAG", "shop:1.0", true},
+		{"shop:${MISSING:-2.0}", "shop:2.0", true},
+		{"shop:${EMPTY:-2.0}", "shop:2.0", true},
+		{"shop:${EMPTY-2.0}", "shop:", true},
+		{"shop:${MISSING}", "shop:", false},
+		{"shop:${MISSING:?required}", "shop:", false},
+	}
+	for _, tt := range tests {
+		got, resolved := interpolate(tt.value, env)
+		if got != tt.want || resolved != tt.wantResolved {
+			t.Errorf("interpolate(%q) = %q, %v, want %q, %v", tt.value, got, resolved, tt.want, tt.wantResolved)
+		}
+	}
+}
+
+func TestBaseImages(t *testing.T) {
+	content := "ARG GO_VERSION=1.23\nFROM golang:${GO_VERSION} AS build\nFROM build\nFROM ${RUNTIME}\nFROM scratch\nFROM golang:${GO_VERSION}\n"
+	got := BaseImages(content, map[string]string{"GO_VERSION": "1.24"})
+	if strings.Join(got, ",") != "golang:1.24" {
+		t.Errorf("BaseImages() = %v, want [golang:1.24]", got)
+	}
+}
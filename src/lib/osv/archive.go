@@ -0,0 +1,111 @@
+package osv
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	maxRecordSize  = 8 * 1024 * 1024
+	maxArchiveSize = 2 * 1024 * 1024 * 1024
+)
+
+// Extract unpacks the OSV records (*.json) of a zip archive, like the all.zip exports of
+// osv-vulnerabilities, or of a .tar.gz into dir. Records are validated and written flat, named
+// by their id, so entry names cannot escape dir. It returns the number of records.
+func Extract(archive io.ReaderAt, size int64, dir string) (int, error) {
+	magic := make([]byte, 4)
+	if _, err := archive.ReadAt(magic, 0); err != nil {
+		return 0, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return extractZip(archive, size, dir)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return extractTarGz(io.NewSectionReader(archive, 0, size), dir)
+	}
+	return 0, errors.New("archive is neither a zip nor a .tar.gz")
+}
+
+// Helper Functions
+func extractZip(archive io.ReaderAt, size int64, dir string) (int, error) {
+	reader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid zip archive: %w", err)
+	}
+	records := 0
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() || path.Ext(file.Name) != ".json" {
+			continue
+		}
+		entry, err := file.Open()
+		if err != nil {
+			return records, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		err = writeRecord(entry, file.Name, dir)
+		entry.Close()
+		if err != nil {
+			return records, err
+		}
+		records++
+	}
+	return records, nil
+}
+
+func extractTarGz(archive io.Reader, dir string) (int, error) {
+	gz, err := gzip.NewReader(io.LimitReader(archive, maxArchiveSize))
+	if err != nil {
+		return 0, fmt.Errorf("invalid gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	records := 0
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("invalid tar archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg || path.Ext(header.Name) != ".json" {
+			continue
+		}
+		if err := writeRecord(reader, header.Name, dir); err != nil {
+			return records, err
+		}
+		records++
+	}
+}
+
+func writeRecord(entry io.Reader, name, dir string) error {
+	content, err := io.ReadAll(io.LimitReader(entry, maxRecordSize+1))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if len(content) > maxRecordSize {
+		return fmt.Errorf("%s is larger than %d MiB", name, maxRecordSize/1024/1024)
+	}
+	vulnerability, err := Parse(content)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if strings.ContainsAny(vulnerability.ID, `/\`) || strings.HasPrefix(vulnerability.ID, ".") {
+		return fmt.Errorf("%s: invalid id %q", name, vulnerability.ID)
+	}
+	return os.WriteFile(filepath.Join(dir, vulnerability.ID+".json"), content, 0644)
+}
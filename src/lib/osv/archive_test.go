@@ -0,0 +1,125 @@
+package osv
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type archiveEntry struct {
+	name    string
+	content string
+	dir     bool
+}
+
+func zipArchive(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		name := entry.name
+		if entry.dir {
+			name += "/"
+		}
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entry.content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzArchive(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if entry.dir {
+			header.Typeflag, header.Size = tar.TypeDir, 0
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		writer.Write([]byte(entry.content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	valid := []archiveEntry{
+		{name: "osv", dir: true},
+		{name: "osv/GO-2024-0001.json", content: `{"id":"GO-2024-0001"}`},
+		{name: "../../escape/GHSA-xxxx.json", content: `{"id":"GHSA-xxxx"}`},
+		{name: "README.md", content: "not a record"},
+	}
+
+	tests := []struct {
+		name        string
+		archive     func(*testing.T, []archiveEntry) []byte
+		entries     []archiveEntry
+		wantRecords int
+		wantFiles   string
+		wantErr     string
+	}{
+		{"zip", zipArchive, valid, 2, "GHSA-xxxx.json GO-2024-0001.json", ""},
+		{"tar.gz", tarGzArchive, valid, 2, "GHSA-xxxx.json GO-2024-0001.json", ""},
+		{"id with a path", zipArchive, []archiveEntry{{name: "x.json", content: `{"id":"../../etc/cron"}`}}, 0, "", "invalid id"},
+		{"dot id", tarGzArchive, []archiveEntry{{name: "x.json", content: `{"id":".hidden"}`}}, 0, "", "invalid id"},
+		{"record without id", zipArchive, []archiveEntry{{name: "x.json", content: `{"summary":"x"}`}}, 0, "", "without id"},
+		{"malformed record", tarGzArchive, []archiveEntry{{name: "x.json", content: `{`}}, 0, "", "x.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := tt.archive(t, tt.entries)
+			dir := filepath.Join(t.TempDir(), "db")
+			records, err := Extract(bytes.NewReader(content), int64(len(content)), dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Extract() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if records != tt.wantRecords {
+				t.Errorf("Extract() = %d records, want %d", records, tt.wantRecords)
+			}
+			files, _ := os.ReadDir(dir)
+			var names []string
+			for _, file := range files {
+				names = append(names, file.Name())
+			}
+			sort.Strings(names)
+			if strings.Join(names, " ") != tt.wantFiles {
+				t.Errorf("extracted %v, want %s", names, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestExtractRejectsOtherFormats(t *testing.T) {
+	for name, content := range map[string][]byte{"plain text": []byte("hello world"), "empty": {}} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Extract(bytes.NewReader(content), int64(len(content)), t.TempDir()); err == nil {
+				t.Error("Extract() error = nil, want an error")
+			}
+		})
+	}
+}
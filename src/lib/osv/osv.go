@@ -0,0 +1,431 @@
+package osv
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/mod/semver"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Ecosystems of the packages that are scanned, as named by OSV
+const (
+	EcosystemGo  = "Go"
+	EcosystemNpm = "npm"
+)
+
+// Severities, from the CVSS v3 score when there is one, otherwise from the database
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+	SeverityUnknown  = "unknown"
+)
+
+var severityRank = map[string]int{SeverityCritical: 4, SeverityHigh: 3, SeverityMedium: 2, SeverityLow: 1, SeverityUnknown: 0}
+
+// Vulnerability is an OSV record, limited to the fields the scanner reads
+type Vulnerability struct {
+	ID               string                 `json:"id"`
+	Modified         time.Time              `json:"modified"`
+	Withdrawn        *time.Time             `json:"withdrawn,omitempty"`
+	Aliases          []string               `json:"aliases"`
+	Summary          string                 `json:"summary"`
+	Details          string                 `json:"details"`
+	Severity         []Score                `json:"severity"`
+	Affected         []Affected             `json:"affected"`
+	References       []Reference            `json:"references"`
+	DatabaseSpecific map[string]interface{} `json:"database_specific"`
+}
+
+// Score is a severity vector, e.g. {"type": "CVSS_V3", "score": "CVSS:3.1/AV:N/..."}
+type Score struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+// Affected is a package with the versions a vulnerability applies to
+type Affected struct {
+	Package          AffectedPackage        `json:"package"`
+	Severity         []Score                `json:"severity"`
+	Ranges           []Range                `json:"ranges"`
+	Versions         []string               `json:"versions"`
+	DatabaseSpecific map[string]interface{} `json:"database_specific"`
+}
+
+type AffectedPackage struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+}
+
+// Range is a list of events; a version is affected from an introduced event until the next fixed
+// or after last_affected event
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+}
+
+type Reference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// Package is a dependency of a project at the version it resolves to
+type Package struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	// Direct is set for dependencies the project declares itself
+	Direct bool `json:"direct"`
+}
+
+// Finding is a vulnerability affecting a package
+type Finding struct {
+	ID        string   `json:"id"`
+	Aliases   []string `json:"aliases"`
+	Summary   string   `json:"summary"`
+	Ecosystem string   `json:"ecosystem"`
+	Package   string   `json:"package"`
+	Version   string   `json:"version"`
+	Direct    bool     `json:"direct"`
+	// FixedVersions is empty when no release fixes the vulnerability yet
+	FixedVersions []string `json:"fixed_versions"`
+	Severity      string   `json:"severity"`
+	Score         float64  `json:"score,omitempty"`
+	URL           string   `json:"url"`
+}
+
+// Database is an OSV snapshot indexed by package
+type Database struct {
+	Records int
+	index   map[string][]*Vulnerability
+	ids     map[string]bool
+}
+
+// Load reads every OSV record (*.json) below the dirs. Withdrawn records are skipped. Missing
+// dirs are empty.
+func Load(dirs ...string) (*Database, error) {
+	db := &Database{index: map[string][]*Vulnerability{}, ids: map[string]bool{}}
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if path == dir && os.IsNotExist(err) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if entry.IsDir() || filepath.Ext(path) != ".json" {
+				return nil
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			vulnerability, err := Parse(content)
+			if err != nil {
+				return fmt.Errorf("%s: %w", filepath.Base(path), err)
+			}
+			db.Add(vulnerability)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// Parse decodes an OSV record
+func Parse(content []byte) (*Vulnerability, error) {
+	var vulnerability Vulnerability
+	if err := json.Unmarshal(content, &vulnerability); err != nil {
+		return nil, err
+	}
+	if vulnerability.ID == "" {
+		return nil, fmt.Errorf("OSV record without id")
+	}
+	return &vulnerability, nil
+}
+
+// Add indexes a record under each package it affects. A record already added, e.g. from an
+// archive of all ecosystems, is skipped.
+func (db *Database) Add(vulnerability *Vulnerability) {
+	if vulnerability.Withdrawn != nil || db.ids[vulnerability.ID] {
+		return
+	}
+	db.ids[vulnerability.ID] = true
+	db.Records++
+	seen := map[string]bool{}
+	for _, affected := range vulnerability.Affected {
+		key := packageKey(affected.Package.Ecosystem, affected.Package.Name)
+		if !seen[key] {
+			seen[key] = true
+			db.index[key] = append(db.index[key], vulnerability)
+		}
+	}
+}
+
+// Query returns the vulnerabilities affecting a package version
+func (db *Database) Query(pkg Package) []Finding {
+	var findings []Finding
+	for _, vulnerability := range db.index[packageKey(pkg.Ecosystem, pkg.Name)] {
+		affected, fixed := false, []string{}
+		var matched []Affected
+		for _, entry := range vulnerability.Affected {
+			if packageKey(entry.Package.Ecosystem, entry.Package.Name) != packageKey(pkg.Ecosystem, pkg.Name) {
+				continue
+			}
+			if isAffected, fixedIn := entry.affects(pkg.Version); isAffected {
+				affected = true
+				matched = append(matched, entry)
+				fixed = append(fixed, fixedIn...)
+			}
+		}
+		if !affected {
+			continue
+		}
+		severity, score := vulnerability.severity(matched)
+		findings = append(findings, Finding{
+			ID:            vulnerability.ID,
+			Aliases:       nonNil(vulnerability.Aliases),
+			Summary:       vulnerability.summary(),
+			Ecosystem:     pkg.Ecosystem,
+			Package:       pkg.Name,
+			Version:       pkg.Version,
+			Direct:        pkg.Direct,
+			FixedVersions: fixedVersions(pkg.Ecosystem, pkg.Version, fixed),
+			Severity:      severity,
+			Score:         score,
+			URL:           vulnerability.url(),
+		})
+	}
+	return findings
+}
+
+// Scan checks packages against the database. Findings are sorted by severity, then package.
+func Scan(db *Database, packages []Package) []Finding {
+	findings := []Finding{}
+	for _, pkg := range packages {
+		findings = append(findings, db.Query(pkg)...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] > severityRank[b.Severity]
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.ID < b.ID
+	})
+	return findings
+}
+
+// Summarize counts findings per severity
+func Summarize(findings []Finding) map[string]int {
+	summary := map[string]int{SeverityCritical: 0, SeverityHigh: 0, SeverityMedium: 0, SeverityLow: 0, SeverityUnknown: 0}
+	for _, finding := range findings {
+		summary[finding.Severity]++
+	}
+	return summary
+}
+
+// Helper Functions
+func packageKey(ecosystem, name string) string {
+	// Ecosystems may carry a release, e.g. "Debian:12"
+	ecosystem, _, _ = strings.Cut(ecosystem, ":")
+	if strings.EqualFold(ecosystem, EcosystemNpm) {
+		name = strings.ToLower(name)
+	}
+	return ecosystem + "/" + name
+}
+
+// affects reports whether a version is affected, with the fixed versions of the matching ranges
+func (a Affected) affects(version string) (bool, []string) {
+	for _, listed := range a.Versions {
+		if strings.TrimPrefix(listed, "v") == strings.TrimPrefix(version, "v") {
+			return true, a.fixedVersions()
+		}
+	}
+	if !semver.IsValid(canonical(version)) {
+		return false, nil
+	}
+	for _, r := range a.Ranges {
+		// GIT ranges are commits, which a lockfile does not tell
+		if r.Type != "SEMVER" && r.Type != "ECOSYSTEM" {
+			continue
+		}
+		if r.contains(version) {
+			return true, r.fixedVersions()
+		}
+	}
+	return false, nil
+}
+
+func (a Affected) fixedVersions() []string {
+	var fixed []string
+	for _, r := range a.Ranges {
+		fixed = append(fixed, r.fixedVersions()...)
+	}
+	return fixed
+}
+
+func (r Range) contains(version string) bool {
+	events := append([]Event(nil), r.Events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return compareVersions(events[i].version(), events[j].version()) < 0
+	})
+	affected := false
+	for _, event := range events {
+		switch {
+		case event.Introduced != "" && compareVersions(version, event.Introduced) >= 0:
+			affected = true
+		case event.Fixed != "" && compareVersions(version, event.Fixed) >= 0:
+			affected = false
+		case event.LastAffected != "" && compareVersions(version, event.LastAffected) > 0:
+			affected = false
+		}
+	}
+	return affected
+}
+
+func (r Range) fixedVersions() []string {
+	var fixed []string
+	for _, event := range r.Events {
+		if event.Fixed != "" {
+			fixed = append(fixed, event.Fixed)
+		}
+	}
+	return fixed
+}
+
+func (e Event) version() string {
+	switch {
+	case e.Introduced != "":
+		return e.Introduced
+	case e.Fixed != "":
+		return e.Fixed
+	}
+	return e.LastAffected
+}
+
+// compareVersions compares semantic versions with or without a "v" prefix; "0" is the lowest
+// version, as used by introduced events
+func compareVersions(a, b string) int {
+	switch {
+	case a == "0" && b == "0":
+		return 0
+	case a == "0":
+		return -1
+	case b == "0":
+		return 1
+	}
+	return semver.Compare(canonical(a), canonical(b))
+}
+
+func canonical(version string) string {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return version
+}
+
+// fixedVersions sorts and deduplicates the fixed versions above the scanned version, written the
+// way the ecosystem does
+func fixedVersions(ecosystem, current string, fixed []string) []string {
+	seen := map[string]bool{}
+	versions := []string{}
+	for _, version := range fixed {
+		if compareVersions(version, current) <= 0 {
+			continue
+		}
+		if ecosystem == EcosystemGo {
+			version = canonical(version)
+		}
+		if !seen[version] {
+			seen[version] = true
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return compareVersions(versions[i], versions[j]) < 0 })
+	return versions
+}
+
+func (v *Vulnerability) severity(matched []Affected) (string, float64) {
+	scores := append([]Score(nil), v.Severity...)
+	for _, affected := range matched {
+		scores = append(scores, affected.Severity...)
+	}
+	best := -1.0
+	for _, score := range scores {
+		if score.Type != "CVSS_V3" {
+			continue
+		}
+		if value, err := CVSS3BaseScore(score.Score); err == nil && value > best {
+			best = value
+		}
+	}
+	if best >= 0 {
+		return CVSSRating(best), best
+	}
+
+	// GitHub advisories state a severity of their own
+	for _, specific := range append([]map[string]interface{}{v.DatabaseSpecific}, databaseSpecific(matched)...) {
+		if severity, ok := specific["severity"].(string); ok {
+			switch strings.ToUpper(severity) {
+			case "CRITICAL":
+				return SeverityCritical, 0
+			case "HIGH":
+				return SeverityHigh, 0
+			case "MODERATE", "MEDIUM":
+				return SeverityMedium, 0
+			case "LOW":
+				return SeverityLow, 0
+			}
+		}
+	}
+	return SeverityUnknown, 0
+}
+
+func databaseSpecific(matched []Affected) []map[string]interface{} {
+	specific := make([]map[string]interface{}, 0, len(matched))
+	for _, affected := range matched {
+		specific = append(specific, affected.DatabaseSpecific)
+	}
+	return specific
+}
+
+func (v *Vulnerability) summary() string {
+	if v.Summary != "" {
+		return v.Summary
+	}
+	details, _, _ := strings.Cut(strings.TrimSpace(v.Details), "\n")
+	return details
+}
+
+func (v *Vulnerability) url() string {
+	for _, reference := range v.References {
+		if reference.Type == "ADVISORY" {
+			return reference.URL
+		}
+	}
+	return "https://osv.dev/vulnerability/" + v.ID
+}
+
+func nonNil(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
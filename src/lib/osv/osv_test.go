@@ -0,0 +1,178 @@
+package osv
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testDatabase(t *testing.T, records ...string) *Database {
+	t.Helper()
+	db, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		vulnerability, err := Parse([]byte(record))
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Add(vulnerability)
+	}
+	return db
+}
+
+func TestQuery(t *testing.T) {
+	db := testDatabase(t,
+		`{"id":"GO-2024-0001","summary":"Request smuggling","affected":[{"package":{"ecosystem":"Go","name":"golang.org/x/net"},
+			"ranges":[{"type":"SEMVER","events":[{"introduced":"0"},{"fixed":"0.23.0"}]}]}],
+			"severity":[{"type":"CVSS_V3","score":"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}]}`,
+		`{"id":"GHSA-two-ranges","details":"First line\nSecond line","affected":[{"package":{"ecosystem":"npm","name":"Lodash"},
+			"ranges":[{"type":"SEMVER","events":[{"introduced":"4.0.0"},{"fixed":"4.17.12"},{"introduced":"4.17.15"},{"fixed":"4.17.21"}]}]}],
+			"database_specific":{"severity":"MODERATE"},"references":[{"type":"ADVISORY","url":"https://github.com/advisories/GHSA-two-ranges"}]}`,
+		`{"id":"GHSA-last-affected","affected":[{"package":{"ecosystem":"npm","name":"minimist"},
+			"ranges":[{"type":"ECOSYSTEM","events":[{"introduced":"1.0.0"},{"last_affected":"1.2.5"}]}]}]}`,
+		`{"id":"GHSA-listed","affected":[{"package":{"ecosystem":"npm","name":"left-pad"},"versions":["1.1.1"],
+			"ranges":[{"type":"GIT","events":[{"introduced":"abc"},{"fixed":"def"}]}]}]}`,
+		`{"id":"GO-withdrawn","withdrawn":"2024-01-01T00:00:00Z","affected":[{"package":{"ecosystem":"Go","name":"golang.org/x/net"},
+			"ranges":[{"type":"SEMVER","events":[{"introduced":"0"}]}]}]}`,
+	)
+	if db.Records != 4 {
+		t.Errorf("Records = %d, want 4 without the withdrawn record", db.Records)
+	}
+
+	tests := []struct {
+		name         string
+		pkg          Package
+		wantIDs      string
+		wantFixed    string
+		wantSeverity string
+	}{
+		{"affected Go module", Package{Ecosystem: EcosystemGo, Name: "golang.org/x/net", Version: "v0.17.0"}, "GO-2024-0001", "v0.23.0", SeverityCritical},
+		{"fixed Go module", Package{Ecosystem: EcosystemGo, Name: "golang.org/x/net", Version: "v0.23.0"}, "", "", ""},
+		{"first range", Package{Ecosystem: EcosystemNpm, Name: "lodash", Version: "4.17.11"}, "GHSA-two-ranges", "4.17.12 4.17.21", SeverityMedium},
+		{"between ranges", Package{Ecosystem: EcosystemNpm, Name: "lodash", Version: "4.17.13"}, "", "", ""},
+		{"second range", Package{Ecosystem: EcosystemNpm, Name: "lodash", Version: "4.17.20"}, "GHSA-two-ranges", "4.17.21", SeverityMedium},
+		{"before introduced", Package{Ecosystem: EcosystemNpm, Name: "lodash", Version: "3.10.1"}, "", "", ""},
+		{"last affected", Package{Ecosystem: EcosystemNpm, Name: "minimist", Version: "1.2.5"}, "GHSA-last-affected", "", SeverityUnknown},
+		{"after last affected", Package{Ecosystem: EcosystemNpm, Name: "minimist", Version: "1.2.6"}, "", "", ""},
+		{"listed version", Package{Ecosystem: EcosystemNpm, Name: "left-pad", Version: "1.1.1"}, "GHSA-listed", "", SeverityUnknown},
+		{"GIT range only", Package{Ecosystem: EcosystemNpm, Name: "left-pad", Version: "1.1.2"}, "", "", ""},
+		{"other ecosystem", Package{Ecosystem: EcosystemGo, Name: "lodash", Version: "4.17.11"}, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := db.Query(tt.pkg)
+			var ids []string
+			for _, finding := range findings {
+				ids = append(ids, finding.ID)
+			}
+			if strings.Join(ids, " ") != tt.wantIDs {
+				t.Fatalf("Query() = %v, want %s", ids, tt.wantIDs)
+			}
+			if len(findings) == 0 {
+				return
+			}
+			if got := strings.Join(findings[0].FixedVersions, " "); got != tt.wantFixed {
+				t.Errorf("FixedVersions = %q, want %q", got, tt.wantFixed)
+			}
+			if findings[0].Severity != tt.wantSeverity {
+				t.Errorf("Severity = %s, want %s", findings[0].Severity, tt.wantSeverity)
+			}
+		})
+	}
+
+	findings := db.Query(Package{Ecosystem: EcosystemNpm, Name: "lodash", Version: "4.17.11"})
+	if findings[0].Summary != "First line" || findings[0].URL != "https://github.com/advisories/GHSA-two-ranges" {
+		t.Errorf("Summary = %q, URL = %q", findings[0].Summary, findings[0].URL)
+	}
+}
+
+func TestScanOrdersBySeverity(t *testing.T) {
+	db := testDatabase(t,
+		`{"id":"LOW-1","database_specific":{"severity":"LOW"},"affected":[{"package":{"ecosystem":"npm","name":"a"},"versions":["1.0.0"]}]}`,
+		`{"id":"HIGH-1","database_specific":{"severity":"HIGH"},"affected":[{"package":{"ecosystem":"npm","name":"b"},"versions":["1.0.0"]}]}`,
+		`{"id":"HIGH-2","database_specific":{"severity":"HIGH"},"affected":[{"package":{"ecosystem":"npm","name":"a"},"versions":["1.0.0"]}]}`,
+	)
+	findings := Scan(db, []Package{
+		{Ecosystem: EcosystemNpm, Name: "a", Version: "1.0.0"},
+		{Ecosystem: EcosystemNpm, Name: "b", Version: "1.0.0"},
+	})
+	var ids []string
+	for _, finding := range findings {
+		ids = append(ids, finding.ID)
+	}
+	if strings.Join(ids, " ") != "HIGH-2 HIGH-1 LOW-1" {
+		t.Errorf("Scan() = %v, want HIGH-2 HIGH-1 LOW-1", ids)
+	}
+	if summary := Summarize(findings); summary[SeverityHigh] != 2 || summary[SeverityLow] != 1 || summary[SeverityCritical] != 0 {
+		t.Errorf("Summarize() = %v", summary)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "Go"), 0755)
+	os.WriteFile(filepath.Join(dir, "Go", "GO-1.json"), []byte(`{"id":"GO-1"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "GO-1.json"), []byte(`{"id":"GO-1"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(`not a record`), 0644)
+
+	db, err := Load(dir, filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if db.Records != 1 {
+		t.Errorf("Records = %d, want 1 for a duplicated record", db.Records)
+	}
+
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{`), 0644)
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Errorf("Load() error = %v, want it to name broken.json", err)
+	}
+}
+
+func TestCVSS3BaseScore(t *testing.T) {
+	tests := []struct {
+		vector  string
+		want    float64
+		wantErr bool
+	}{
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", 9.8, false},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N", 6.1, false},
+		{"CVSS:3.0/AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:N/A:N", 5.5, false},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N", 0, false},
+		{"CVSS:2.0/AV:N/AC:L/Au:N/C:P/I:P/A:P", 0, true},
+		{"CVSS:3.1/AV:N/AC:L", 0, true},
+		{"CVSS:3.1/AV:X/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := CVSS3BaseScore(tt.vector)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CVSS3BaseScore(%q) error = %v, wantErr %v", tt.vector, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CVSS3BaseScore(%q) = %v, want %v", tt.vector, got, tt.want)
+		}
+	}
+}
+
+func TestCVSSRating(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{9.8, SeverityCritical},
+		{9.0, SeverityCritical},
+		{7.5, SeverityHigh},
+		{4.0, SeverityMedium},
+		{0.1, SeverityLow},
+		{0, SeverityUnknown},
+	}
+	for _, tt := range tests {
+		if got := CVSSRating(tt.score); got != tt.want {
+			t.Errorf("CVSSRating(%v) = %s, want %s", tt.score, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package osv
+
+import (
+	"deva/src/lib/gomod"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GoPackages lists the modules a go.mod builds with. Replacements by another module version are
+// followed; local replacements are not published and skipped. The go directive, or toolchain, is
+// checked as the stdlib package.
+func GoPackages(manifest *gomod.Manifest) []Package {
+	var packages []Package
+	for _, require := range manifest.Requires {
+		name, version := require.Path, require.Version
+		if require.Replaced {
+			replacement, ok := replacementOf(manifest, require)
+			if !ok {
+				continue
+			}
+			name, version = replacement.NewPath, replacement.NewVersion
+		}
+		packages = append(packages, Package{Ecosystem: EcosystemGo, Name: name, Version: version, Direct: !require.Indirect})
+	}
+
+	goVersion := manifest.GoVersion
+	if strings.HasPrefix(manifest.Toolchain, "go") {
+		goVersion = strings.TrimPrefix(manifest.Toolchain, "go")
+	}
+	if goVersion != "" {
+		packages = append(packages, Package{Ecosystem: EcosystemGo, Name: "stdlib", Version: goVersion, Direct: true})
+	}
+	return packages
+}
+
+// NpmPackages lists the packages installed by a package-lock.json, lockfile version 1, 2 or 3.
+// Direct packages are the dependencies of the root package.
+func NpmPackages(content []byte) ([]Package, error) {
+	var lockfile struct {
+		Packages     map[string]npmLockPackage    `json:"packages"`
+		Dependencies map[string]npmLockDependency `json:"dependencies"`
+	}
+	if err := json.Unmarshal(content, &lockfile); err != nil {
+		return nil, fmt.Errorf("invalid package-lock.json: %w", err)
+	}
+
+	seen := map[string]bool{}
+	var packages []Package
+	add := func(name, version string, direct bool) {
+		key := name + "@" + version
+		if name == "" || version == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		packages = append(packages, Package{Ecosystem: EcosystemNpm, Name: name, Version: version, Direct: direct})
+	}
+
+	if len(lockfile.Packages) > 0 {
+		root := lockfile.Packages[""]
+		for location, pkg := range lockfile.Packages {
+			if location == "" || pkg.Link {
+				continue
+			}
+			name := pkg.Name
+			if name == "" {
+				name = location[strings.LastIndex(location, "node_modules/")+len("node_modules/"):]
+			}
+			// Only hoisted packages are what the root dependencies resolve to
+			direct := location == "node_modules/"+name && root.declares(name)
+			add(name, pkg.Version, direct)
+		}
+	} else {
+		var walk func(dependencies map[string]npmLockDependency, direct bool)
+		walk = func(dependencies map[string]npmLockDependency, direct bool) {
+			for name, dependency := range dependencies {
+				add(name, dependency.Version, direct)
+				walk(dependency.Dependencies, false)
+			}
+		}
+		walk(lockfile.Dependencies, true)
+	}
+
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		return packages[i].Version < packages[j].Version
+	})
+	return packages, nil
+}
+
+// Helper Functions
+type npmLockPackage struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	Link                 bool              `json:"link"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+type npmLockDependency struct {
+	Version      string                       `json:"version"`
+	Dependencies map[string]npmLockDependency `json:"dependencies"`
+}
+
+func (p npmLockPackage) declares(name string) bool {
+	for _, dependencies := range []map[string]string{p.Dependencies, p.DevDependencies, p.OptionalDependencies} {
+		if _, ok := dependencies[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func replacementOf(manifest *gomod.Manifest, require gomod.Requirement) (gomod.Replacement, bool) {
+	// A replacement of the exact version wins over one of all versions
+	var match *gomod.Replacement
+	for i, replace := range manifest.Replaces {
+		if replace.OldPath != require.Path {
+			continue
+		}
+		if replace.OldVersion == require.Version || (replace.OldVersion == "" && match == nil) {
+			match = &manifest.Replaces[i]
+		}
+	}
+	if match == nil || match.Local {
+		return gomod.Replacement{}, false
+	}
+	return *match, true
+}
@@ -0,0 +1,104 @@
+package osv
+
+import (
+	"deva/src/lib/gomod"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func formatPackages(packages []Package) string {
+	var out []string
+	for _, pkg := range packages {
+		direct := ""
+		if pkg.Direct {
+			direct = "*"
+		}
+		out = append(out, fmt.Sprintf("%s@%s%s", pkg.Name, pkg.Version, direct))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestGoPackages(t *testing.T) {
+	tests := []struct {
+		name  string
+		goMod string
+		want  string
+	}{
+		{
+			name:  "requirements and go version",
+			goMod: "module example.com/shop\ngo 1.22.1\nrequire (\n\tgithub.com/a/b v1.0.0\n\tgithub.com/c/d v0.2.0 // indirect\n)\n",
+			want:  "github.com/a/b@v1.0.0* github.com/c/d@v0.2.0 stdlib@1.22.1*",
+		},
+		{
+			name:  "toolchain wins over go",
+			goMod: "module example.com/shop\ngo 1.22\ntoolchain go1.22.5\n",
+			want:  "stdlib@1.22.5*",
+		},
+		{
+			name:  "replacements",
+			goMod: "module example.com/shop\nrequire (\n\tgithub.com/a/b v1.0.0\n\tgithub.com/c/d v0.2.0\n)\nreplace github.com/a/b => github.com/fork/b v1.0.1\nreplace github.com/c/d => ./local/d\n",
+			want:  "github.com/fork/b@v1.0.1*",
+		},
+		{
+			name:  "exact version replacement wins",
+			goMod: "module example.com/shop\nrequire github.com/a/b v1.0.0\nreplace github.com/a/b => github.com/fork/b v1.0.1\nreplace github.com/a/b v1.0.0 => github.com/fork/b v1.0.2\n",
+			want:  "github.com/fork/b@v1.0.2*",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := gomod.Parse([]byte(tt.goMod), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatPackages(GoPackages(manifest)); got != tt.want {
+				t.Errorf("GoPackages() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNpmPackages(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockfile string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "lockfile v3",
+			lockfile: `{"lockfileVersion":3,"packages":{
+				"":{"name":"shop","dependencies":{"express":"^4.18.0"},"devDependencies":{"jest":"^29.0.0"}},
+				"node_modules/express":{"version":"4.18.2"},
+				"node_modules/jest":{"version":"29.7.0"},
+				"node_modules/debug":{"version":"4.3.4"},
+				"node_modules/express/node_modules/debug":{"version":"2.6.9"},
+				"node_modules/shared":{"version":"1.0.0","link":true}}}`,
+			want: "debug@2.6.9 debug@4.3.4 express@4.18.2* jest@29.7.0*",
+		},
+		{
+			name: "lockfile v1",
+			lockfile: `{"lockfileVersion":1,"dependencies":{
+				"express":{"version":"4.18.2","dependencies":{"debug":{"version":"2.6.9"}}},
+				"debug":{"version":"4.3.4"}}}`,
+			want: "debug@2.6.9 debug@4.3.4* express@4.18.2*",
+		},
+		{
+			name:     "malformed",
+			lockfile: `{"packages":`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packages, err := NpmPackages([]byte(tt.lockfile))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NpmPackages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := formatPackages(packages); got != tt.want {
+				t.Errorf("NpmPackages() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
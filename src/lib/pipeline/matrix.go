@@ -0,0 +1,280 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultMaxParallel bounds the cells of a matrix running at once when it does not set its own
+	DefaultMaxParallel = 4
+	maxMatrixCells     = 24
+	// maxMatrixCombinations bounds the combinations of the axes before exclusions
+	maxMatrixCombinations = 1024
+)
+
+// matrixExpression references a matrix axis, like ${{ matrix.go }}
+var matrixExpression = regexp.MustCompile(`\$\{\{\s*matrix\.([A-Za-z0-9_]*)\s*\}\}`)
+
+// Matrix fans the steps of a pipeline out over every combination of its axes
+type Matrix struct {
+	Axes Axes `yaml:"axes"`
+	// Exclude drops the combinations matching every value of an entry
+	Exclude []map[string]string `yaml:"exclude"`
+	// FailFast cancels the other cells once one fails; it is on unless set to false
+	FailFast *bool `yaml:"fail_fast"`
+	// MaxParallel bounds the cells running at once
+	MaxParallel int `yaml:"max_parallel"`
+}
+
+// Axes are the dimensions of a matrix, in the order of the pipeline file
+type Axes []Axis
+
+// Axis is one dimension of a matrix, like the Go versions to test with
+type Axis struct {
+	Name   string
+	Values []string
+}
+
+// UnmarshalYAML reads the axes from a mapping, keeping their order. A single value is an axis of
+// one value.
+func (a *Axes) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: matrix.axes must be a mapping of axis names to values", value.Line)
+	}
+	axes := make(Axes, 0, len(value.Content)/2)
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key, values := value.Content[i], value.Content[i+1]
+		axis := Axis{Name: key.Value}
+		switch values.Kind {
+		case yaml.ScalarNode:
+			axis.Values = []string{values.Value}
+		case yaml.SequenceNode:
+			for _, item := range values.Content {
+				if item.Kind != yaml.ScalarNode {
+					return fmt.Errorf("line %d: values of axis %q must be strings", item.Line, axis.Name)
+				}
+				axis.Values = append(axis.Values, item.Value)
+			}
+		default:
+			return fmt.Errorf("line %d: axis %q must be a list of values", values.Line, axis.Name)
+		}
+		axes = append(axes, axis)
+	}
+	*a = axes
+	return nil
+}
+
+// Cell is one combination of the matrix values, in the order of the axes
+type Cell []CellValue
+
+// CellValue is the value of one axis in a cell
+type CellValue struct {
+	Axis  string
+	Value string
+}
+
+// Label names a cell after its values, like "1.24.2, amd64"
+func (c Cell) Label() string {
+	values := make([]string, 0, len(c))
+	for _, value := range c {
+		values = append(values, value.Value)
+	}
+	return strings.Join(values, ", ")
+}
+
+// Values maps the axes of a cell to their values
+func (c Cell) Values() map[string]string {
+	values := make(map[string]string, len(c))
+	for _, value := range c {
+		values[value.Axis] = value.Value
+	}
+	return values
+}
+
+// HasMatrix reports whether the pipeline runs as a matrix
+func (d *Definition) HasMatrix() bool {
+	return d.Matrix != nil && len(d.Matrix.Axes) > 0
+}
+
+// Cells lists the combinations of the matrix, without the excluded ones
+func (d *Definition) Cells() []Cell {
+	if !d.HasMatrix() {
+		return nil
+	}
+	cells := []Cell{{}}
+	for _, axis := range d.Matrix.Axes {
+		next := make([]Cell, 0, len(cells)*len(axis.Values))
+		for _, cell := range cells {
+			for _, value := range axis.Values {
+				combined := append(append(Cell{}, cell...), CellValue{Axis: axis.Name, Value: value})
+				next = append(next, combined)
+			}
+		}
+		cells = next
+	}
+
+	kept := cells[:0]
+	for _, cell := range cells {
+		if !d.Matrix.excludes(cell) {
+			kept = append(kept, cell)
+		}
+	}
+	return kept
+}
+
+// FailFast reports whether a failed cell cancels the others
+func (d *Definition) FailFast() bool {
+	return d.Matrix == nil || d.Matrix.FailFast == nil || *d.Matrix.FailFast
+}
+
+// MaxParallel is the number of cells that may run at once
+func (d *Definition) MaxParallel() int {
+	if d.Matrix == nil || d.Matrix.MaxParallel <= 0 {
+		return DefaultMaxParallel
+	}
+	return d.Matrix.MaxParallel
+}
+
+// ForCell returns the definition a cell runs: ${{ matrix.<axis> }} is replaced by the value of the
+// cell in toolchains.go, env and run, and artifacts get the values of the cell in their name so
+// the cells do not overwrite each other's.
+func (d *Definition) ForCell(cell Cell) (*Definition, error) {
+	values := cell.Values()
+	var missing string
+	expand := func(s string) string {
+		return matrixExpression.ReplaceAllStringFunc(s, func(expression string) string {
+			axis := matrixExpression.FindStringSubmatch(expression)[1]
+			value, ok := values[axis]
+			if !ok && missing == "" {
+				missing = axis
+			}
+			return value
+		})
+	}
+	expandEnv := func(env map[string]string) map[string]string {
+		if env == nil {
+			return nil
+		}
+		expanded := make(map[string]string, len(env))
+		for name, value := range env {
+			expanded[name] = expand(value)
+		}
+		return expanded
+	}
+	suffix := ""
+	if len(cell) > 0 {
+		suffix = "-" + artifactName(strings.Join(strings.Split(cell.Label(), ", "), "-"))
+	}
+
+	expanded := *d
+	expanded.Env = expandEnv(d.Env)
+	expanded.Toolchains.Go = strings.TrimPrefix(strings.TrimSpace(expand(d.Toolchains.Go)), "go")
+	expanded.Steps = make([]Step, len(d.Steps))
+	for i, step := range d.Steps {
+		step.Run = expand(step.Run)
+		step.Env = expandEnv(step.Env)
+		if suffix != "" {
+			artifacts := make([]Artifact, len(step.Artifacts))
+			for j, artifact := range step.Artifacts {
+				artifact.Name += suffix
+				if !artifactNamePattern.MatchString(artifact.Name) {
+					return nil, fmt.Errorf("steps[%d]: artifact name %q is too long for the matrix", i, artifact.Name)
+				}
+				artifacts[j] = artifact
+			}
+			step.Artifacts = artifacts
+			downloads := make([]string, len(step.DownloadArtifacts))
+			for j, name := range step.DownloadArtifacts {
+				downloads[j] = name + suffix
+			}
+			step.DownloadArtifacts = downloads
+		}
+		expanded.Steps[i] = step
+	}
+
+	if missing != "" {
+		if len(cell) == 0 {
+			return nil, fmt.Errorf("matrix.%s is used but the pipeline has no matrix", missing)
+		}
+		return nil, fmt.Errorf("matrix.%s is not an axis of the matrix", missing)
+	}
+	if expanded.Toolchains.Go != "" && !goVersionPattern.MatchString(expanded.Toolchains.Go) {
+		if len(cell) > 0 {
+			return nil, fmt.Errorf("toolchains.go: %q of cell %s is not a Go release like 1.24.2", expanded.Toolchains.Go, cell.Label())
+		}
+		return nil, fmt.Errorf("toolchains.go: %q is not a Go release like 1.24.2", expanded.Toolchains.Go)
+	}
+	return &expanded, nil
+}
+
+// Helper Functions
+func (m *Matrix) validate() error {
+	combinations := 1
+	axes := map[string]map[string]bool{}
+	for _, axis := range m.Axes {
+		if !envNamePattern.MatchString(axis.Name) {
+			return fmt.Errorf("matrix.axes: invalid axis name %q", axis.Name)
+		}
+		if axes[axis.Name] != nil {
+			return fmt.Errorf("matrix.axes: axis %q is listed twice", axis.Name)
+		}
+		if len(axis.Values) == 0 {
+			return fmt.Errorf("matrix.axes.%s: no values", axis.Name)
+		}
+		values := map[string]bool{}
+		for _, value := range axis.Values {
+			if strings.TrimSpace(value) == "" {
+				return fmt.Errorf("matrix.axes.%s: values must not be empty", axis.Name)
+			}
+			if values[value] {
+				return fmt.Errorf("matrix.axes.%s: value %q is listed twice", axis.Name, value)
+			}
+			values[value] = true
+		}
+		axes[axis.Name] = values
+
+		combinations *= len(axis.Values)
+		if combinations > maxMatrixCombinations {
+			return fmt.Errorf("matrix has more than %d combinations", maxMatrixCombinations)
+		}
+	}
+
+	for i, exclude := range m.Exclude {
+		if len(exclude) == 0 {
+			return fmt.Errorf("matrix.exclude[%d]: no values", i)
+		}
+		for axis, value := range exclude {
+			if axes[axis] == nil {
+				return fmt.Errorf("matrix.exclude[%d]: %q is not an axis", i, axis)
+			}
+			if !axes[axis][value] {
+				return fmt.Errorf("matrix.exclude[%d]: %q is not a value of axis %s", i, value, axis)
+			}
+		}
+	}
+	if m.MaxParallel < 0 {
+		return fmt.Errorf("matrix.max_parallel must not be negative")
+	}
+	return nil
+}
+
+func (m *Matrix) excludes(cell Cell) bool {
+	values := cell.Values()
+	for _, exclude := range m.Exclude {
+		matches := true
+		for axis, value := range exclude {
+			if values[axis] != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
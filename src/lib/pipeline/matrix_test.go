@@ -0,0 +1,182 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+func cellLabels(cells []Cell) string {
+	labels := make([]string, 0, len(cells))
+	for _, cell := range cells {
+		labels = append(labels, "("+cell.Label()+")")
+	}
+	return strings.Join(labels, " ")
+}
+
+func TestCells(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "no matrix",
+			content: "steps:\n  - run: go test ./...\n",
+			want:    "",
+		},
+		{
+			name:    "axes in file order",
+			content: "matrix:\n  axes:\n    os: [linux, darwin]\n    go: ['1.23.8', '1.24.2']\nsteps:\n  - run: go test ./...\n",
+			want:    "(linux, 1.23.8) (linux, 1.24.2) (darwin, 1.23.8) (darwin, 1.24.2)",
+		},
+		{
+			name:    "single value",
+			content: "matrix:\n  axes:\n    go: 1.24.2\n    arch: [amd64, arm64]\nsteps:\n  - run: go test ./...\n",
+			want:    "(1.24.2, amd64) (1.24.2, arm64)",
+		},
+		{
+			name: "exclusions",
+			content: `matrix:
+  axes:
+    os: [linux, darwin]
+    arch: [amd64, arm64]
+    go: ['1.23.8', '1.24.2']
+  exclude:
+    - {os: darwin, arch: amd64}
+    - {go: '1.23.8', arch: arm64}
+steps:
+  - run: go test ./...
+`,
+			want: "(linux, amd64, 1.23.8) (linux, amd64, 1.24.2) (linux, arm64, 1.24.2) (darwin, arm64, 1.24.2)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, err := Parse([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := cellLabels(def.Cells()); got != tt.want {
+				t.Errorf("Cells() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsMatrix(t *testing.T) {
+	steps := "steps:\n  - run: go test ./...\n"
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"axes not a mapping", "matrix:\n  axes: [go]\n" + steps, "must be a mapping"},
+		{"nested values", "matrix:\n  axes:\n    go: [[1]]\n" + steps, "must be strings"},
+		{"invalid axis name", "matrix:\n  axes:\n    go-version: ['1.24.2']\n" + steps, "invalid axis name"},
+		{"axis listed twice", "matrix:\n  axes:\n    go: ['1.24.2']\n    go: ['1.23.8']\n" + steps, "go"},
+		{"no values", "matrix:\n  axes:\n    go: []\n" + steps, "no values"},
+		{"empty value", "matrix:\n  axes:\n    go: ['']\n" + steps, "must not be empty"},
+		{"value listed twice", "matrix:\n  axes:\n    go: [a, a]\n" + steps, "listed twice"},
+		{"exclude of an unknown axis", "matrix:\n  axes:\n    go: [a]\n  exclude:\n    - {os: linux}\n" + steps, "is not an axis"},
+		{"exclude of an unknown value", "matrix:\n  axes:\n    go: [a]\n  exclude:\n    - {go: b}\n" + steps, "is not a value"},
+		{"empty exclude", "matrix:\n  axes:\n    go: [a]\n  exclude:\n    - {}\n" + steps, "no values"},
+		{"everything excluded", "matrix:\n  axes:\n    go: [a]\n  exclude:\n    - {go: a}\n" + steps, "leaves no cell"},
+		{"too many cells", "matrix:\n  axes:\n    a: [1, 2, 3, 4, 5]\n    b: [1, 2, 3, 4, 5]\n" + steps, "at most 24"},
+		{"too many combinations", "matrix:\n  axes:\n    a: [1,2,3,4,5,6,7,8,9,10,11]\n    b: [1,2,3,4,5,6,7,8,9,10,11]\n    c: [1,2,3,4,5,6,7,8,9,10,11]\n" + steps, "combinations"},
+		{"negative max_parallel", "matrix:\n  axes:\n    go: [a]\n  max_parallel: -1\n" + steps, "max_parallel"},
+		{"unknown axis in run", "matrix:\n  axes:\n    go: [a]\nsteps:\n  - run: echo ${{ matrix.os }}\n", "matrix.os is not an axis"},
+		{"matrix expression without matrix", "steps:\n  - run: echo ${{ matrix.go }}\n", "has no matrix"},
+		{"cell with a bad Go version", "matrix:\n  axes:\n    go: ['1.24.2', stable]\ntoolchains:\n  go: ${{ matrix.go }}\n" + steps, "of cell stable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestForCell(t *testing.T) {
+	def, err := Parse([]byte(`matrix:
+  axes:
+    go: ['1.23.8', '1.24.2']
+    os: [linux]
+toolchains:
+  go: ${{ matrix.go }}
+env:
+  GOOS: ${{matrix.os}}
+steps:
+  - name: test
+    run: go test ./... > report-${{ matrix.go }}.txt
+    env:
+      LABEL: go${{ matrix.go }}
+    artifacts: [report-*.txt]
+  - name: publish
+    run: ls
+    download_artifacts: [test]
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		cell         Cell
+		wantGo       string
+		wantRun      string
+		wantArtifact string
+	}{
+		{def.Cells()[0], "1.23.8", "go test ./... > report-1.23.8.txt", "test-1.23.8-linux"},
+		{def.Cells()[1], "1.24.2", "go test ./... > report-1.24.2.txt", "test-1.24.2-linux"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cell.Label(), func(t *testing.T) {
+			expanded, err := def.ForCell(tt.cell)
+			if err != nil {
+				t.Fatalf("ForCell() error = %v", err)
+			}
+			if expanded.Toolchains.Go != tt.wantGo || expanded.Env["GOOS"] != "linux" {
+				t.Errorf("go = %q, GOOS = %q", expanded.Toolchains.Go, expanded.Env["GOOS"])
+			}
+			test, publish := expanded.Steps[0], expanded.Steps[1]
+			if test.Run != tt.wantRun || test.Env["LABEL"] != "go"+tt.wantGo {
+				t.Errorf("run = %q, LABEL = %q", test.Run, test.Env["LABEL"])
+			}
+			if test.Artifacts[0].Name != tt.wantArtifact || publish.DownloadArtifacts[0] != tt.wantArtifact {
+				t.Errorf("artifact = %q, download = %q, want %q", test.Artifacts[0].Name, publish.DownloadArtifacts[0], tt.wantArtifact)
+			}
+		})
+	}
+
+	// The cells expand copies; the parsed definition keeps its expressions
+	if !strings.Contains(def.Steps[0].Run, "${{ matrix.go }}") || def.Steps[0].Artifacts[0].Name != "test" {
+		t.Errorf("ForCell() changed the definition: %+v", def.Steps[0])
+	}
+}
+
+func TestFailFastAndMaxParallel(t *testing.T) {
+	steps := "steps:\n  - run: go test ./...\n"
+	tests := []struct {
+		name            string
+		content         string
+		wantFailFast    bool
+		wantMaxParallel int
+	}{
+		{"no matrix", steps, true, DefaultMaxParallel},
+		{"defaults", "matrix:\n  axes:\n    go: [a, b]\n" + steps, true, DefaultMaxParallel},
+		{"fail_fast off", "matrix:\n  axes:\n    go: [a, b]\n  fail_fast: false\n" + steps, false, DefaultMaxParallel},
+		{"max_parallel", "matrix:\n  axes:\n    go: [a, b]\n  fail_fast: true\n  max_parallel: 1\n" + steps, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, err := Parse([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if def.FailFast() != tt.wantFailFast || def.MaxParallel() != tt.wantMaxParallel {
+				t.Errorf("FailFast() = %v, MaxParallel() = %d, want %v, %d", def.FailFast(), def.MaxParallel(), tt.wantFailFast, tt.wantMaxParallel)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is where the pipeline definition lives in a repository or workspace
+const DefaultPath = ".deva/pipeline.yml"
+
+const (
+	// DefaultTimeout bounds a pipeline that does not set its own timeout
+	DefaultTimeout = 30 * time.Minute
+	// MaxTimeout bounds every pipeline and step timeout
+	MaxTimeout = 2 * time.Hour
+	// MaxRetention bounds how long an artifact may be kept
+	MaxRetention = 90 * 24 * time.Hour
+	maxSteps     = 50
+)
+
+// Artifact upload conditions
+const (
+	WhenOnSuccess = "on_success"
+	WhenAlways    = "always"
+)
+
+// ReservedEnvPrefix starts the names of the variables set by the runner itself
+const ReservedEnvPrefix = "DEVA_"
+
+var (
+	envNamePattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	artifactNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+	goVersionPattern    = regexp.MustCompile(`^1\.[0-9]+(\.[0-9]+|(rc|beta)[0-9]+)$`)
+)
+
+// Definition is a parsed pipeline file
+type Definition struct {
+	// Env is set for every step
+	Env map[string]string `yaml:"env"`
+	// Secrets names the project secrets exposed to every step
+	Secrets []string `yaml:"secrets"`
+	Timeout Duration `yaml:"timeout"`
+	// Toolchains are provisioned from the CI cache before the steps run
+	Toolchains Toolchains `yaml:"toolchains"`
+	// Cache restores dependency caches before the steps and saves them after a successful run
+	Cache Cache `yaml:"cache"`
+	// Matrix runs the steps once per combination of its values
+	Matrix *Matrix `yaml:"matrix"`
+	Steps  []Step  `yaml:"steps"`
+}
+
+// Toolchains selects the toolchains put on the PATH of every step
+type Toolchains struct {
+	// Go is a Go release, like "1.24.2"
+	Go string `yaml:"go"`
+}
+
+// Cache selects the dependency caches of a pipeline
+type Cache struct {
+	// GoModules caches GOMODCACHE, keyed by the go.sum files of the workspace
+	GoModules bool `yaml:"go_modules"`
+}
+
+// Step is one shell script of a pipeline, run in the workspace
+type Step struct {
+	Name string            `yaml:"name"`
+	Run  string            `yaml:"run"`
+	Env  map[string]string `yaml:"env"`
+	// Secrets are added to the secrets of the pipeline
+	Secrets []string `yaml:"secrets"`
+	// WorkingDirectory is relative to the workspace root
+	WorkingDirectory string   `yaml:"working_directory"`
+	Timeout          Duration `yaml:"timeout"`
+	// ContinueOnError lets the pipeline go on when the step fails; it still counts as failed
+	ContinueOnError bool `yaml:"continue_on_error"`
+	// Artifacts are named sets of workspace files uploaded after the step
+	Artifacts []Artifact `yaml:"artifacts"`
+	// DownloadArtifacts names artifacts of earlier steps to extract into the workspace first
+	DownloadArtifacts []string `yaml:"download_artifacts"`
+}
+
+// Artifact is a named set of workspace files kept after a step. A plain string is a path of an
+// artifact named after the step.
+type Artifact struct {
+	Name string `yaml:"name"`
+	// Paths are workspace paths or glob patterns
+	Paths []string `yaml:"paths"`
+	// When is "on_success" (default) or "always", to keep reports of failed steps too
+	When string `yaml:"when"`
+	// Retention overrides how long the artifact is kept
+	Retention Duration `yaml:"retention"`
+}
+
+// UnmarshalYAML accepts an artifact as a mapping or as a single path
+func (a *Artifact) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var path string
+		if err := value.Decode(&path); err != nil {
+			return err
+		}
+		*a = Artifact{Paths: []string{path}}
+		return nil
+	}
+	type plain Artifact
+	return value.Decode((*plain)(a))
+}
+
+// Duration is a time.Duration written like "10m" or "1h30m", or a number of days like "7d"
+type Duration time.Duration
+
+// UnmarshalYAML parses a Go duration string or a number of days
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var raw string
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	raw = strings.TrimSpace(raw)
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			*d = Duration(time.Duration(n) * 24 * time.Hour)
+			return nil
+		}
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", value.Line, raw)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Parse reads and validates a pipeline file. Steps without a name are called "step <n>".
+func Parse(data []byte) (*Definition, error) {
+	var def Definition
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&def); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("pipeline file is empty")
+		}
+		return nil, err
+	}
+	if err := def.validate(); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// PipelineTimeout is the timeout of the whole pipeline
+func (d *Definition) PipelineTimeout() time.Duration {
+	if d.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return time.Duration(d.Timeout)
+}
+
+// StepTimeout is the timeout of a step, bounded by the pipeline timeout
+func (d *Definition) StepTimeout(step Step) time.Duration {
+	if step.Timeout <= 0 || time.Duration(step.Timeout) > d.PipelineTimeout() {
+		return d.PipelineTimeout()
+	}
+	return time.Duration(step.Timeout)
+}
+
+// StepSecrets lists the secrets of the pipeline and the step, without duplicates
+func (d *Definition) StepSecrets(step Step) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, name := range append(append([]string{}, d.Secrets...), step.Secrets...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// AllSecrets lists every secret the pipeline uses
+func (d *Definition) AllSecrets() []string {
+	all := Step{}
+	for _, step := range d.Steps {
+		all.Secrets = append(all.Secrets, step.Secrets...)
+	}
+	return d.StepSecrets(all)
+}
+
+// CleanRelativePath normalizes a slash separated path that must stay inside the workspace
+func CleanRelativePath(p string) (string, error) {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return "", errors.New("path is empty")
+	}
+	if strings.HasPrefix(p, "/") || strings.Contains(p, "\\") {
+		return "", fmt.Errorf("path %q must be relative to the workspace", p)
+	}
+	cleaned := path.Clean(p)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("path %q leaves the workspace", p)
+	}
+	return cleaned, nil
+}
+
+// Helper Functions
+func (d *Definition) validate() error {
+	if len(d.Steps) == 0 {
+		return errors.New("pipeline has no steps")
+	}
+	if len(d.Steps) > maxSteps {
+		return fmt.Errorf("pipeline has %d steps, at most %d are allowed", len(d.Steps), maxSteps)
+	}
+	if time.Duration(d.Timeout) < 0 || time.Duration(d.Timeout) > MaxTimeout {
+		return fmt.Errorf("timeout must be between 0 and %s", MaxTimeout)
+	}
+	if err := validateEnv("env", d.Env); err != nil {
+		return err
+	}
+	if err := validateSecrets("secrets", d.Secrets); err != nil {
+		return err
+	}
+	d.Toolchains.Go = strings.TrimPrefix(strings.TrimSpace(d.Toolchains.Go), "go")
+	if d.Matrix != nil {
+		if err := d.Matrix.validate(); err != nil {
+			return err
+		}
+	}
+
+	names := map[string]bool{}
+	artifacts := map[string]bool{}
+	for i := range d.Steps {
+		step := &d.Steps[i]
+		step.Name = strings.TrimSpace(step.Name)
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step %d", i+1)
+		}
+		if names[step.Name] {
+			return fmt.Errorf("step name %q is used twice", step.Name)
+		}
+		names[step.Name] = true
+
+		field := fmt.Sprintf("steps[%d]", i)
+		if strings.TrimSpace(step.Run) == "" {
+			return fmt.Errorf("%s (%s): run is required", field, step.Name)
+		}
+		if time.Duration(step.Timeout) < 0 || time.Duration(step.Timeout) > MaxTimeout {
+			return fmt.Errorf("%s (%s): timeout must be between 0 and %s", field, step.Name, MaxTimeout)
+		}
+		if err := validateEnv(field+".env", step.Env); err != nil {
+			return err
+		}
+		if err := validateSecrets(field+".secrets", step.Secrets); err != nil {
+			return err
+		}
+		if step.WorkingDirectory != "" {
+			dir, err := CleanRelativePath(step.WorkingDirectory)
+			if err != nil {
+				return fmt.Errorf("%s.working_directory: %w", field, err)
+			}
+			step.WorkingDirectory = dir
+		}
+		for j, name := range step.DownloadArtifacts {
+			if !artifacts[name] {
+				return fmt.Errorf("%s.download_artifacts[%d]: no earlier step uploads artifact %q", field, j, name)
+			}
+		}
+		if err := step.validateArtifacts(field); err != nil {
+			return err
+		}
+		for _, artifact := range step.Artifacts {
+			if artifacts[artifact.Name] {
+				return fmt.Errorf("%s: artifact %q is uploaded twice", field, artifact.Name)
+			}
+			artifacts[artifact.Name] = true
+		}
+	}
+
+	// Every cell must expand to a valid definition; a pipeline without a matrix is one cell
+	cells := d.Cells()
+	if d.HasMatrix() && len(cells) == 0 {
+		return errors.New("matrix.exclude leaves no cell to run")
+	}
+	if len(cells) > maxMatrixCells {
+		return fmt.Errorf("matrix has %d cells, at most %d are allowed", len(cells), maxMatrixCells)
+	}
+	if len(cells) == 0 {
+		cells = []Cell{nil}
+	}
+	for _, cell := range cells {
+		if _, err := d.ForCell(cell); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateArtifacts cleans the artifact paths of a step and gathers its unnamed paths into one
+// artifact named after the step
+func (step *Step) validateArtifacts(field string) error {
+	var artifacts []Artifact
+	unnamed := -1
+	for j, artifact := range step.Artifacts {
+		artifactField := fmt.Sprintf("%s.artifacts[%d]", field, j)
+		if len(artifact.Paths) == 0 {
+			return fmt.Errorf("%s: paths is required", artifactField)
+		}
+		for k, pattern := range artifact.Paths {
+			cleaned, err := CleanRelativePath(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: %w", artifactField, err)
+			}
+			if _, err := path.Match(cleaned, ""); err != nil {
+				return fmt.Errorf("%s: invalid pattern %q", artifactField, pattern)
+			}
+			artifact.Paths[k] = cleaned
+		}
+		switch artifact.When {
+		case "":
+			artifact.When = WhenOnSuccess
+		case WhenOnSuccess, WhenAlways:
+		default:
+			return fmt.Errorf("%s: when must be %q or %q", artifactField, WhenOnSuccess, WhenAlways)
+		}
+		if artifact.Retention < 0 || time.Duration(artifact.Retention) > MaxRetention {
+			return fmt.Errorf("%s: retention must be between 0 and %d days", artifactField, MaxRetention/(24*time.Hour))
+		}
+
+		artifact.Name = strings.TrimSpace(artifact.Name)
+		if artifact.Name == "" {
+			if unnamed >= 0 {
+				artifacts[unnamed].Paths = append(artifacts[unnamed].Paths, artifact.Paths...)
+				continue
+			}
+			unnamed = len(artifacts)
+			artifact.Name = artifactName(step.Name)
+		}
+		if !artifactNamePattern.MatchString(artifact.Name) {
+			return fmt.Errorf("%s: invalid artifact name %q", artifactField, artifact.Name)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	step.Artifacts = artifacts
+	return nil
+}
+
+// artifactName turns a step name into an artifact name
+func artifactName(stepName string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 128 && (r == '.' || r == '_' || r == '-' || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			return r
+		}
+		return '-'
+	}, stepName)
+	name = strings.Trim(name, ".-_")
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	if name == "" {
+		name = "artifact"
+	}
+	return name
+}
+
+func validateEnv(field string, env map[string]string) error {
+	for name := range env {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("%s: invalid variable name %q", field, name)
+		}
+		if strings.HasPrefix(name, ReservedEnvPrefix) {
+			return fmt.Errorf("%s: %s* is reserved for variables set by the runner", field, ReservedEnvPrefix)
+		}
+	}
+	return nil
+}
+
+func validateSecrets(field string, secrets []string) error {
+	for _, name := range secrets {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("%s: invalid secret name %q", field, name)
+		}
+	}
+	return nil
+}
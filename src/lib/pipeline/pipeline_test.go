@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	def, err := Parse([]byte(`
+env:
+  CGO_ENABLED: "0"
+secrets: [REGISTRY_TOKEN]
+timeout: 20m
+toolchains:
+  go: go1.24.2
+cache:
+  go_modules: true
+steps:
+  - name: test
+    run: go test ./...
+    timeout: 1h
+    artifacts:
+      - coverage.out
+      - ./reports/*.xml
+      - name: junit
+        paths: [reports/junit.xml]
+        when: always
+        retention: 7d
+  - run: go build -o bin/app .
+    working_directory: ./cmd/../app
+    secrets: [REGISTRY_TOKEN, SIGNING_KEY]
+    download_artifacts: [test, junit]
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if def.PipelineTimeout() != 20*time.Minute || def.Toolchains.Go != "1.24.2" || !def.Cache.GoModules {
+		t.Errorf("timeout = %s, go = %q, go_modules = %v", def.PipelineTimeout(), def.Toolchains.Go, def.Cache.GoModules)
+	}
+	test, build := def.Steps[0], def.Steps[1]
+	if build.Name != "step 2" || build.WorkingDirectory != "app" {
+		t.Errorf("second step = %q in %q, want \"step 2\" in \"app\"", build.Name, build.WorkingDirectory)
+	}
+	if def.StepTimeout(test) != 20*time.Minute {
+		t.Errorf("StepTimeout() = %s, want the pipeline timeout", def.StepTimeout(test))
+	}
+	if len(test.Artifacts) != 2 {
+		t.Fatalf("artifacts = %+v, want the unnamed paths gathered in one artifact", test.Artifacts)
+	}
+	if a := test.Artifacts[0]; a.Name != "test" || strings.Join(a.Paths, ",") != "coverage.out,reports/*.xml" || a.When != WhenOnSuccess {
+		t.Errorf("unnamed artifact = %+v", a)
+	}
+	if a := test.Artifacts[1]; a.Name != "junit" || a.When != WhenAlways || time.Duration(a.Retention) != 7*24*time.Hour {
+		t.Errorf("named artifact = %+v", a)
+	}
+	if got := strings.Join(def.StepSecrets(build), ","); got != "REGISTRY_TOKEN,SIGNING_KEY" {
+		t.Errorf("StepSecrets() = %s", got)
+	}
+	if got := strings.Join(def.AllSecrets(), ","); got != "REGISTRY_TOKEN,SIGNING_KEY" {
+		t.Errorf("AllSecrets() = %s", got)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"empty", "", "empty"},
+		{"no steps", "env: {}\n", "no steps"},
+		{"unknown field", "steps:\n  - run: make\n    image: golang\n", "image"},
+		{"no run", "steps:\n  - name: test\n", "run is required"},
+		{"duplicate names", "steps:\n  - {name: a, run: x}\n  - {name: a, run: y}\n", "used twice"},
+		{"invalid duration", "timeout: soon\nsteps:\n  - run: x\n", "invalid duration"},
+		{"timeout too long", "timeout: 3h\nsteps:\n  - run: x\n", "timeout"},
+		{"step timeout too long", "steps:\n  - run: x\n    timeout: 3h\n", "timeout"},
+		{"reserved env", "env:\n  DEVA_TOKEN: x\nsteps:\n  - run: x\n", "reserved"},
+		{"invalid env name", "steps:\n  - run: x\n    env:\n      1BAD: x\n", "invalid variable name"},
+		{"invalid secret", "secrets: [a-b]\nsteps:\n  - run: x\n", "invalid secret name"},
+		{"working directory outside", "steps:\n  - run: x\n    working_directory: ../x\n", "leaves the workspace"},
+		{"absolute artifact", "steps:\n  - run: x\n    artifacts: [/etc/passwd]\n", "relative"},
+		{"artifact outside", "steps:\n  - run: x\n    artifacts: [a/../../b]\n", "leaves the workspace"},
+		{"bad artifact pattern", "steps:\n  - run: x\n    artifacts: ['reports/[']\n", "invalid pattern"},
+		{"artifact without paths", "steps:\n  - run: x\n    artifacts:\n      - name: a\n", "paths is required"},
+		{"bad when", "steps:\n  - run: x\n    artifacts:\n      - {paths: [a], when: never}\n", "when must be"},
+		{"retention too long", "steps:\n  - run: x\n    artifacts:\n      - {paths: [a], retention: 100d}\n", "retention"},
+		{"bad artifact name", "steps:\n  - run: x\n    artifacts:\n      - {name: ../a, paths: [a]}\n", "invalid artifact name"},
+		{"artifact uploaded twice", "steps:\n  - {name: a, run: x, artifacts: [{name: r, paths: [a]}]}\n  - {name: b, run: x, artifacts: [{name: r, paths: [b]}]}\n", "uploaded twice"},
+		{"download before upload", "steps:\n  - {name: a, run: x, download_artifacts: [b]}\n  - {name: b, run: x, artifacts: [out]}\n", "no earlier step"},
+		{"bad Go version", "toolchains:\n  go: latest\nsteps:\n  - run: x\n", "not a Go release"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCleanRelativePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"dist", "dist", false},
+		{"./dist/../bin/", "bin", false},
+		{"reports/*.xml", "reports/*.xml", false},
+		{".", ".", false},
+		{"", "", true},
+		{"/tmp", "", true},
+		{`dist\app`, "", true},
+		{"..", "", true},
+		{"a/../../b", "", true},
+	}
+	for _, tt := range tests {
+		got, err := CleanRelativePath(tt.path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("CleanRelativePath(%q) = %q, %v, want %q, wantErr %v", tt.path, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestArtifactName(t *testing.T) {
+	tests := []struct {
+		step string
+		want string
+	}{
+		{"test", "test"},
+		{"Unit tests (race)", "Unit-tests--race"},
+		{"step 2", "step-2"},
+		{"ünïcode", "n-code"},
+		{"!!!", "artifact"},
+		{strings.Repeat("a", 120), strings.Repeat("a", 100)},
+	}
+	for _, tt := range tests {
+		if got := artifactName(tt.step); got != tt.want {
+			t.Errorf("artifactName(%q) = %q, want %q", tt.step, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ToolName is recorded as the creator of the documents
+const ToolName = "deva"
+
+// Render encodes the BOM in a format
+func (b *BOM) Render(format string) ([]byte, error) {
+	switch format {
+	case FormatCycloneDX:
+		return b.CycloneDX()
+	case FormatSPDX:
+		return b.SPDX()
+	}
+	return nil, fmt.Errorf("unknown SBOM format %q: use %s or %s", format, FormatCycloneDX, FormatSPDX)
+}
+
+// CycloneDX encodes the BOM as CycloneDX 1.5 JSON
+func (b *BOM) CycloneDX() ([]byte, error) {
+	type property struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type component struct {
+		BOMRef     string     `json:"bom-ref"`
+		Type       string     `json:"type"`
+		Name       string     `json:"name"`
+		Version    string     `json:"version,omitempty"`
+		PURL       string     `json:"purl,omitempty"`
+		Scope      string     `json:"scope,omitempty"`
+		Properties []property `json:"properties,omitempty"`
+	}
+	type dependency struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn"`
+	}
+
+	root := component{BOMRef: b.ref(b.Root), Type: b.Root.Type, Name: b.Root.Name, Version: b.Root.Version, PURL: b.Root.PURL}
+	components := make([]component, 0, len(b.Components))
+	dependsOn := make([]string, 0, len(b.Components))
+	for _, c := range b.Components {
+		entry := component{BOMRef: b.ref(c), Type: c.Type, Name: c.Name, Version: c.Version, PURL: c.PURL, Scope: "required"}
+		if c.GoSum != "" {
+			entry.Properties = []property{{Name: "go.sum:hash", Value: c.GoSum}}
+		}
+		if !c.Direct {
+			entry.Properties = append(entry.Properties, property{Name: "go.mod:indirect", Value: "true"})
+		}
+		components = append(components, entry)
+		dependsOn = append(dependsOn, entry.BOMRef)
+	}
+
+	document := map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.5",
+		"serialNumber": "urn:uuid:" + b.SerialNumber,
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": b.timestamp(),
+			"tools": map[string]interface{}{
+				"components": []map[string]string{{"type": TypeApplication, "name": ToolName}},
+			},
+			"component": root,
+		},
+		"components":   components,
+		"dependencies": []dependency{{Ref: root.BOMRef, DependsOn: dependsOn}},
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
+
+// SPDX encodes the BOM as SPDX 2.3 JSON
+func (b *BOM) SPDX() ([]byte, error) {
+	type externalRef struct {
+		ReferenceCategory string `json:"referenceCategory"`
+		ReferenceType     string `json:"referenceType"`
+		ReferenceLocator  string `json:"referenceLocator"`
+	}
+	type spdxPackage struct {
+		SPDXID                string        `json:"SPDXID"`
+		Name                  string        `json:"name"`
+		VersionInfo           string        `json:"versionInfo,omitempty"`
+		DownloadLocation      string        `json:"downloadLocation"`
+		FilesAnalyzed         bool          `json:"filesAnalyzed"`
+		LicenseConcluded      string        `json:"licenseConcluded"`
+		LicenseDeclared       string        `json:"licenseDeclared"`
+		CopyrightText         string        `json:"copyrightText"`
+		PrimaryPackagePurpose string        `json:"primaryPackagePurpose"`
+		ExternalRefs          []externalRef `json:"externalRefs,omitempty"`
+	}
+	type relationship struct {
+		SPDXElementID      string `json:"spdxElementId"`
+		RelationshipType   string `json:"relationshipType"`
+		RelatedSPDXElement string `json:"relatedSpdxElement"`
+	}
+
+	toPackage := func(id string, c Component) spdxPackage {
+		pkg := spdxPackage{
+			SPDXID:                id,
+			Name:                  c.Name,
+			VersionInfo:           c.Version,
+			DownloadLocation:      "NOASSERTION",
+			LicenseConcluded:      "NOASSERTION",
+			LicenseDeclared:       "NOASSERTION",
+			CopyrightText:         "NOASSERTION",
+			PrimaryPackagePurpose: strings.ToUpper(c.Type),
+		}
+		if c.PURL != "" {
+			pkg.ExternalRefs = []externalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: c.PURL}}
+		}
+		return pkg
+	}
+
+	rootID := "SPDXRef-Package-root"
+	packages := []spdxPackage{toPackage(rootID, b.Root)}
+	relationships := []relationship{{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: rootID}}
+	for i, c := range b.Components {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		packages = append(packages, toPackage(id, c))
+		relationships = append(relationships, relationship{SPDXElementID: rootID, RelationshipType: "DEPENDS_ON", RelatedSPDXElement: id})
+	}
+
+	document := map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              b.Root.Name,
+		"documentNamespace": strings.TrimSuffix(b.Namespace, "/") + "/" + b.SerialNumber,
+		"creationInfo": map[string]interface{}{
+			"created":  b.timestamp(),
+			"creators": []string{"Tool: " + ToolName},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
+
+// Helper Functions
+func (b *BOM) ref(c Component) string {
+	if c.PURL != "" {
+		return c.PURL
+	}
+	return c.Type + ":" + c.Name + "@" + c.Version
+}
+
+func (b *BOM) timestamp() string {
+	timestamp := b.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	return timestamp.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,181 @@
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"deva/src/lib/gomod"
+	"deva/src/lib/lint"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats of the exported documents
+const (
+	FormatCycloneDX = "cyclonedx"
+	FormatSPDX      = "spdx"
+)
+
+// Component types, as named by CycloneDX
+const (
+	TypeApplication = "application"
+	TypeLibrary     = "library"
+	TypeContainer   = "container"
+)
+
+// Component is a piece of software the project is built from
+type Component struct {
+	Type    string
+	Name    string
+	Version string
+	PURL    string
+	// Direct is set for components the project declares itself
+	Direct bool
+	// GoSum is the h1: hash go.sum records for a module
+	GoSum string
+}
+
+// BOM is a bill of materials, rendered as CycloneDX or SPDX
+type BOM struct {
+	Root       Component
+	Components []Component
+	Timestamp  time.Time
+	// SerialNumber identifies the document, a UUID
+	SerialNumber string
+	// Namespace is the base URI of SPDX document namespaces
+	Namespace string
+}
+
+// Sources are the files a BOM is built from; any of them may be empty
+type Sources struct {
+	GoMod       []byte
+	GoSum       []byte
+	Dockerfiles map[string]string
+	// Env resolves ARG references in the Dockerfiles
+	Env map[string]string
+}
+
+// Build collects the Go modules of go.mod and the base images of the Dockerfiles. The root
+// component is the Go module when there is one.
+func Build(name, version string, sources Sources) (*BOM, error) {
+	bom := &BOM{Root: Component{Type: TypeApplication, Name: name, Version: version}}
+	if len(sources.GoMod) > 0 {
+		manifest, err := gomod.Parse(sources.GoMod, sources.GoSum)
+		if err != nil {
+			return nil, err
+		}
+		bom.Root.Name = manifest.Module
+		bom.Root.PURL = golangPURL(manifest.Module, version)
+		bom.Components = append(bom.Components, goComponents(manifest, sources.GoSum)...)
+	}
+
+	paths := make([]string, 0, len(sources.Dockerfiles))
+	for path := range sources.Dockerfiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	seen := map[string]bool{}
+	for _, path := range paths {
+		for _, image := range lint.BaseImages(sources.Dockerfiles[path], sources.Env) {
+			if !seen[image] {
+				seen[image] = true
+				bom.Components = append(bom.Components, imageComponent(image))
+			}
+		}
+	}
+	return bom, nil
+}
+
+// Helper Functions
+func goComponents(manifest *gomod.Manifest, goSum []byte) []Component {
+	hashes := goSumHashes(goSum)
+	seen := map[string]bool{}
+	components := make([]Component, 0, len(manifest.Requires))
+	for _, require := range manifest.Requires {
+		path, version := require.Path, require.Version
+		// Replacements by another module are what gets built; local directories are part of the project
+		for _, replace := range manifest.Replaces {
+			if replace.OldPath == path && (replace.OldVersion == "" || replace.OldVersion == version) && !replace.Local {
+				path, version = replace.NewPath, replace.NewVersion
+			}
+		}
+		if (require.Replaced && path == require.Path) || seen[path+"@"+version] {
+			continue
+		}
+		seen[path+"@"+version] = true
+		components = append(components, Component{
+			Type:    TypeLibrary,
+			Name:    path,
+			Version: version,
+			PURL:    golangPURL(path, version),
+			Direct:  !require.Indirect,
+			GoSum:   hashes[path+"@"+version],
+		})
+	}
+	return components
+}
+
+// goSumHashes maps module@version to the hash of the module content, not of its go.mod
+func goSumHashes(goSum []byte) map[string]string {
+	hashes := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(goSum))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && !strings.HasSuffix(fields[1], "/go.mod") {
+			hashes[fields[0]+"@"+fields[1]] = fields[2]
+		}
+	}
+	return hashes
+}
+
+func imageComponent(image string) Component {
+	name, tag, digest := lint.SplitImage(image)
+	version := tag
+	if digest != "" {
+		version = digest
+	}
+	if version == "" {
+		version = "latest"
+	}
+	return Component{Type: TypeContainer, Name: name, Version: version, PURL: dockerPURL(name, version), Direct: true}
+}
+
+// golangPURL is pkg:golang/<module path>@<version>
+func golangPURL(path, version string) string {
+	purl := "pkg:golang/" + escapeSegments(path)
+	if version != "" {
+		purl += "@" + escapeVersion(version)
+	}
+	return purl
+}
+
+// dockerPURL is pkg:docker/<namespace>/<name>@<tag or digest>, with the registry as
+// repository_url when it is not Docker Hub
+func dockerPURL(name, version string) string {
+	registry := ""
+	if first, rest, ok := strings.Cut(name, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		registry, name = first, rest
+	}
+	if registry == "" && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	purl := "pkg:docker/" + escapeSegments(name) + "@" + escapeVersion(version)
+	if registry != "" && registry != "docker.io" {
+		purl += "?repository_url=" + url.QueryEscape(registry)
+	}
+	return purl
+}
+
+func escapeSegments(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// escapeVersion percent-encodes a version, including the ":" of digests
+func escapeVersion(version string) string {
+	return strings.ReplaceAll(url.PathEscape(version), ":", "%3A")
+}
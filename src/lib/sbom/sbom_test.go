@@ -0,0 +1,197 @@
+package sbom
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGoMod = `module example.com/shop
+
+go 1.24
+
+require (
+	github.com/gofiber/fiber/v2 v2.52.5
+	github.com/a/b v1.0.0
+	example.com/local v0.0.0
+	golang.org/x/text v0.14.0 // indirect
+)
+
+replace github.com/a/b => github.com/fork/b v1.0.1
+
+replace example.com/local => ../local
+`
+
+const testGoSum = `github.com/gofiber/fiber/v2 v2.52.5 h1:fiber=
+github.com/gofiber/fiber/v2 v2.52.5/go.mod h1:fibermod=
+golang.org/x/text v0.14.0/go.mod h1:textmod=
+`
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name     string
+		sources  Sources
+		wantRoot string
+		want     []string
+	}{
+		{
+			name:     "go module",
+			sources:  Sources{GoMod: []byte(testGoMod), GoSum: []byte(testGoSum)},
+			wantRoot: "pkg:golang/example.com/shop@1.0.0",
+			want: []string{
+				"pkg:golang/github.com/fork/b@v1.0.1 direct",
+				"pkg:golang/github.com/gofiber/fiber/v2@v2.52.5 direct h1:fiber=",
+				"pkg:golang/golang.org/x/text@v0.14.0 indirect",
+			},
+		},
+		{
+			name: "dockerfiles",
+			sources: Sources{
+				Dockerfiles: map[string]string{
+					"Dockerfile":          "ARG GO_VERSION\nFROM golang:${GO_VERSION} AS build\nFROM gcr.io/distroless/static@sha256:abc\n",
+					"Dockerfile.postgres": "FROM postgres\nFROM golang:1.24\n",
+				},
+				Env: map[string]string{"GO_VERSION": "1.24"},
+			},
+			wantRoot: "",
+			want: []string{
+				"pkg:docker/library/golang@1.24 direct",
+				"pkg:docker/distroless/static@sha256%3Aabc?repository_url=gcr.io direct",
+				"pkg:docker/library/postgres@latest direct",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bom, err := Build("shop", "1.0.0", tt.sources)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if bom.Root.PURL != tt.wantRoot {
+				t.Errorf("root purl = %q, want %q", bom.Root.PURL, tt.wantRoot)
+			}
+			var got []string
+			for _, c := range bom.Components {
+				entry := c.PURL + " indirect"
+				if c.Direct {
+					entry = c.PURL + " direct"
+				}
+				if c.GoSum != "" {
+					entry += " " + c.GoSum
+				}
+				got = append(got, entry)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("components =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestBuildRejectsInvalidGoMod(t *testing.T) {
+	if _, err := Build("shop", "1.0.0", Sources{GoMod: []byte("go 1.24\n")}); err == nil {
+		t.Error("Build() error = nil, want an error for a go.mod without module")
+	}
+}
+
+func TestDockerPURL(t *testing.T) {
+	tests := []struct {
+		name, version, want string
+	}{
+		{"alpine", "3.20", "pkg:docker/library/alpine@3.20"},
+		{"bitnami/redis", "7.2", "pkg:docker/bitnami/redis@7.2"},
+		{"docker.io/library/alpine", "3.20", "pkg:docker/library/alpine@3.20"},
+		{"localhost:5000/shop", "1.0", "pkg:docker/shop@1.0?repository_url=localhost%3A5000"},
+		{"ghcr.io/acme/shop", "sha256:abc", "pkg:docker/acme/shop@sha256%3Aabc?repository_url=ghcr.io"},
+	}
+	for _, tt := range tests {
+		if got := dockerPURL(tt.name, tt.version); got != tt.want {
+			t.Errorf("dockerPURL(%q, %q) = %q, want %q", tt.name, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	bom, err := Build("shop", "1.0.0", Sources{GoMod: []byte(testGoMod), GoSum: []byte(testGoSum)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bom.Timestamp = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	bom.SerialNumber = "3e671687-395b-41f5-a30f-a58921a69b79"
+	bom.Namespace = "https://deva.example.com/sbom/"
+
+	tests := []struct {
+		format  string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{FormatCycloneDX, map[string]interface{}{
+			"bomFormat":    "CycloneDX",
+			"specVersion":  "1.5",
+			"serialNumber": "urn:uuid:3e671687-395b-41f5-a30f-a58921a69b79",
+		}, false},
+		{FormatSPDX, map[string]interface{}{
+			"spdxVersion":       "SPDX-2.3",
+			"name":              "example.com/shop",
+			"documentNamespace": "https://deva.example.com/sbom/3e671687-395b-41f5-a30f-a58921a69b79",
+		}, false},
+		{"swid", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			content, err := bom.Render(tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var document map[string]interface{}
+			if err := json.Unmarshal(content, &document); err != nil {
+				t.Fatalf("Render() is not JSON: %v", err)
+			}
+			for key, want := range tt.want {
+				if document[key] != want {
+					t.Errorf("%s = %v, want %v", key, document[key], want)
+				}
+			}
+			if !strings.Contains(string(content), "2026-01-02T03:04:05Z") {
+				t.Error("Render() does not record the timestamp")
+			}
+		})
+	}
+}
+
+func TestSPDXRelationships(t *testing.T) {
+	bom, err := Build("shop", "1.0.0", Sources{GoMod: []byte(testGoMod)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := bom.SPDX()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document struct {
+		Packages      []struct{ SPDXID string }
+		Relationships []struct {
+			SPDXElementID      string `json:"spdxElementId"`
+			RelationshipType   string `json:"relationshipType"`
+			RelatedSPDXElement string `json:"relatedSpdxElement"`
+		}
+	}
+	if err := json.Unmarshal(content, &document); err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Packages) != len(bom.Components)+1 || len(document.Relationships) != len(document.Packages) {
+		t.Fatalf("packages = %d, relationships = %d, components = %d", len(document.Packages), len(document.Relationships), len(bom.Components))
+	}
+	if r := document.Relationships[0]; r.RelationshipType != "DESCRIBES" || r.RelatedSPDXElement != "SPDXRef-Package-root" {
+		t.Errorf("first relationship = %+v", r)
+	}
+	for _, r := range document.Relationships[1:] {
+		if r.SPDXElementID != "SPDXRef-Package-root" || r.RelationshipType != "DEPENDS_ON" {
+			t.Errorf("relationship = %+v", r)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"strings"
+)
+
+// BodyLimit rejects request bodies larger than limit with 413. The server streams request bodies,
+// so this is where every route gets its limit back; the routes listed as "METHOD /path" in
+// streamed read their body themselves and must check its size.
+func BodyLimit(limit int, streamed ...string) fiber.Handler {
+	skip := make(map[string]bool, len(streamed))
+	for _, route := range streamed {
+		skip[strings.ToLower(route)] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		if skip[strings.ToLower(c.Method()+" "+strings.TrimSuffix(c.Path(), "/"))] {
+			return c.Next()
+		}
+
+		length := c.Request().Header.ContentLength()
+		if length > limit {
+			// The unread rest of the body makes the connection unusable
+			c.Context().SetConnectionClose()
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": "Request body too large",
+			})
+		}
+		// Chunked bodies have no length up front: read them here, up to the limit
+		if stream := c.Context().RequestBodyStream(); length < 0 && stream != nil {
+			body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Failed to read the request body",
+				})
+			}
+			if len(body) > limit {
+				c.Context().SetConnectionClose()
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+					"error": "Request body too large",
+				})
+			}
+			c.Request().SetBody(body)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,198 @@
+package badges
+
+import (
+	"crypto/sha256"
+	"deva/src/lib/badge"
+	"deva/src/lib/interfaces"
+	service "deva/src/modules/badges/services"
+	users "deva/src/modules/users/models"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+const (
+	// Badges are cached briefly so READMEs follow new runs; ETags turn revalidations into 304s
+	badgeCacheControl      = "public, max-age=60, must-revalidate"
+	badgeErrorCacheControl = "no-cache"
+)
+
+// IssueBadgeToken is a controller function to create or rotate the badge token of a project
+func IssueBadgeToken(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid project ID", err)
+	}
+
+	response, serviceErr := service.IssueBadgeToken(currentUser.ID, projectID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Badge token issued",
+		},
+		Error: nil,
+	})
+}
+
+// GetBadgeToken is a controller function to check whether a project has a badge token
+func GetBadgeToken(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid project ID", err)
+	}
+
+	response, serviceErr := service.GetBadgeToken(currentUser.ID, projectID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Badge token retrieved",
+		},
+		Error: nil,
+	})
+}
+
+// RevokeBadgeToken is a controller function to delete the badge token of a project
+func RevokeBadgeToken(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid project ID", err)
+	}
+
+	serviceErr := service.RevokeBadgeToken(currentUser.ID, projectID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: nil,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Badge token revoked",
+		},
+		Error: nil,
+	})
+}
+
+// GetPipelineBadge is a controller function to render the pipeline status badge of a project.
+// ?branch= selects the pipelines of a branch or tag.
+func GetPipelineBadge(c *fiber.Ctx) error {
+	svg, serviceErr := service.PipelineBadge(c.Params("token"), c.Query("branch"))
+	if serviceErr != nil {
+		return sendBadge(c, serviceErr.StatusCode, badge.Render("pipeline", serviceErr.Message, badge.ColorInactive))
+	}
+	return sendBadge(c, http.StatusOK, svg)
+}
+
+// GetDeploymentBadge is a controller function to render the deployment status badge of a project.
+// ?branch= and ?environment= select the deployments of a branch or tag and of an environment.
+func GetDeploymentBadge(c *fiber.Ctx) error {
+	svg, serviceErr := service.DeploymentBadge(c.Params("token"), c.Query("branch"), c.Query("environment"))
+	if serviceErr != nil {
+		return sendBadge(c, serviceErr.StatusCode, badge.Render("deployment", serviceErr.Message, badge.ColorInactive))
+	}
+	return sendBadge(c, http.StatusOK, svg)
+}
+
+// Helper Functions
+func invalidIDResponse(c *fiber.Ctx, message string, err error) error {
+	s := err.Error()
+	errStr := &s
+	return c.Status(http.StatusBadRequest).JSON(interfaces.Response{
+		Data: nil,
+		Status: interfaces.Status{
+			Code:    http.StatusBadRequest,
+			Message: message,
+		},
+		Error: errStr,
+	})
+}
+
+// sendBadge sends an SVG badge, or 304 when the client already has it
+func sendBadge(c *fiber.Ctx, status int, svg []byte) error {
+	sum := sha256.Sum256(svg)
+	c.Set(fiber.HeaderContentType, "image/svg+xml; charset=utf-8")
+	c.Set(fiber.HeaderETag, fmt.Sprintf(`"%x"`, sum[:16]))
+	if status != http.StatusOK {
+		c.Set(fiber.HeaderCacheControl, badgeErrorCacheControl)
+		return c.Status(status).Send(svg)
+	}
+	c.Set(fiber.HeaderCacheControl, badgeCacheControl)
+	if c.Fresh() {
+		return c.SendStatus(http.StatusNotModified)
+	}
+	return c.Status(status).Send(svg)
+}
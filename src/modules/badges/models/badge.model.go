@@ -0,0 +1,27 @@
+package badges
+
+import (
+	projects "deva/src/modules/projects/models"
+	users "deva/src/modules/users/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ProjectBadge holds the token that opens the status badges of a project without a session. A
+// project has at most one; rotating it breaks the badge URLs handed out before.
+type ProjectBadge struct {
+	ID            uuid.UUID        `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ProjectID     uuid.UUID        `gorm:"type:uuid;not null;uniqueIndex"`
+	Project       projects.Project `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:ProjectID;references:ID;"`
+	TokenHash     string           `gorm:"not null;uniqueIndex"` // SHA-256 of the token in the badge URLs
+	CreatedBy     uuid.UUID        `gorm:"type:uuid;not null"`
+	UpdatedBy     uuid.UUID        `gorm:"type:uuid;not null"`
+	UpdatedByUser users.User       `gorm:"foreignKey:UpdatedBy;references:ID"`
+	CreatedAt     time.Time        `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time        `gorm:"autoUpdateTime"`
+}
+
+func MigrateProjectBadges(db *gorm.DB) error {
+	return db.AutoMigrate(&ProjectBadge{})
+}
@@ -0,0 +1,270 @@
+package badges
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"deva/src/config"
+	"deva/src/lib/badge"
+	badges "deva/src/modules/badges/models"
+	ciModels "deva/src/modules/ci/models"
+	ci "deva/src/modules/ci/services"
+	deploymentModels "deva/src/modules/deployments/models"
+	deployments "deva/src/modules/deployments/services"
+	"deva/src/utils"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const badgeTokenSize = 32
+
+var (
+	badgeTokenPattern  = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	branchPattern      = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,254}$`)
+	environmentPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+)
+
+// IssueBadgeToken creates the badge token of a project, or replaces it. The token is only
+// returned here, inside the badge URLs.
+func IssueBadgeToken(userID, projectID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	if _, serviceErr := deployments.GetAccessibleProject(userID, projectID); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	projectBadge, serviceErr := findProjectBadge(projectID)
+	if serviceErr != nil && serviceErr.StatusCode != http.StatusNotFound {
+		return nil, serviceErr
+	}
+	if projectBadge == nil {
+		projectBadge = &badges.ProjectBadge{ProjectID: projectID, CreatedBy: userID}
+	}
+
+	tokenBytes := make([]byte, badgeTokenSize)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to generate badge token",
+			Err:        err,
+		}
+	}
+	token := hex.EncodeToString(tokenBytes)
+	projectBadge.TokenHash = hashBadgeToken(token)
+	projectBadge.UpdatedBy = userID
+
+	if err := config.DB.Save(projectBadge).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to save badge token",
+			Err:        err,
+		}
+	}
+
+	response := toBadgeResponse(*projectBadge)
+	pipelineURL := fmt.Sprintf("/api/v1/badges/%s/pipeline.svg", token)
+	deploymentURL := fmt.Sprintf("/api/v1/badges/%s/deployment.svg", token)
+	response["token"] = token
+	response["pipeline_url"] = pipelineURL
+	response["deployment_url"] = deploymentURL
+	response["markdown"] = fmt.Sprintf("![pipeline](%s?branch=main) ![deployment](%s?environment=production)", pipelineURL, deploymentURL)
+	return response, nil
+}
+
+// GetBadgeToken tells whether a project has a badge token, without the token itself
+func GetBadgeToken(userID, projectID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	if _, serviceErr := deployments.GetAccessibleProject(userID, projectID); serviceErr != nil {
+		return nil, serviceErr
+	}
+	projectBadge, serviceErr := findProjectBadge(projectID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	return toBadgeResponse(*projectBadge), nil
+}
+
+// RevokeBadgeToken deletes the badge token of a project; its badges stop rendering
+func RevokeBadgeToken(userID, projectID uuid.UUID) *utils.ServiceError {
+	if _, serviceErr := deployments.GetAccessibleProject(userID, projectID); serviceErr != nil {
+		return serviceErr
+	}
+	projectBadge, serviceErr := findProjectBadge(projectID)
+	if serviceErr != nil {
+		return serviceErr
+	}
+	if err := config.DB.Delete(projectBadge).Error; err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to delete badge token",
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// PipelineBadge renders the status of the latest pipeline of the project owning the token, on a
+// branch or tag when one is given
+func PipelineBadge(token, branch string) ([]byte, *utils.ServiceError) {
+	projectID, serviceErr := resolveBadgeToken(token)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	if serviceErr := validateBadgeFilter("branch", branch, branchPattern); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	query := config.DB.Select("id", "status").Where("project_id = ?", projectID)
+	if branch != "" {
+		query = query.Where("ref = ?", branch)
+	}
+	var pipeline ciModels.CiPipeline
+	if err := query.Order("created_at DESC").First(&pipeline).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return badge.Render("pipeline", "no runs", badge.ColorInactive), nil
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	switch pipeline.Status {
+	case ci.StatusSucceeded:
+		return badge.Render("pipeline", "passing", badge.ColorSuccess), nil
+	case ci.StatusFailed:
+		return badge.Render("pipeline", "failing", badge.ColorFailure), nil
+	case ci.StatusRunning:
+		return badge.Render("pipeline", "running", badge.ColorProgress), nil
+	case ci.StatusPending:
+		return badge.Render("pipeline", "pending", badge.ColorWaiting), nil
+	}
+	return badge.Render("pipeline", pipeline.Status, badge.ColorInactive), nil
+}
+
+// DeploymentBadge renders the status of the latest deployment of the project owning the token,
+// of a branch or tag and to an environment when they are given
+func DeploymentBadge(token, branch, environment string) ([]byte, *utils.ServiceError) {
+	projectID, serviceErr := resolveBadgeToken(token)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	if serviceErr := validateBadgeFilter("branch", branch, branchPattern); serviceErr != nil {
+		return nil, serviceErr
+	}
+	if serviceErr := validateBadgeFilter("environment", environment, environmentPattern); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	label := "deployment"
+	query := config.DB.Select("id", "status").Where("project_id = ?", projectID)
+	if branch != "" {
+		query = query.Where("ref = ?", branch)
+	}
+	if environment != "" {
+		label = environment
+		query = query.Where("environment = ?", environment)
+	}
+	var deployment deploymentModels.Deployment
+	if err := query.Order("created_at DESC").First(&deployment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return badge.Render(label, "not deployed", badge.ColorInactive), nil
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	message := strings.ReplaceAll(deployment.Status, "_", " ")
+	switch deployment.Status {
+	case deployments.StatusSucceeded:
+		return badge.Render(label, "deployed", badge.ColorSuccess), nil
+	case deployments.StatusFailed:
+		return badge.Render(label, message, badge.ColorFailure), nil
+	case deployments.StatusPending, deployments.StatusBuilding, deployments.StatusDeploying:
+		return badge.Render(label, message, badge.ColorProgress), nil
+	case deployments.StatusAwaitingApproval, deployments.StatusScheduled:
+		return badge.Render(label, message, badge.ColorWaiting), nil
+	}
+	return badge.Render(label, message, badge.ColorInactive), nil
+}
+
+// Helper Functions
+func findProjectBadge(projectID uuid.UUID) (*badges.ProjectBadge, *utils.ServiceError) {
+	var projectBadge badges.ProjectBadge
+	if err := config.DB.First(&projectBadge, "project_id = ?", projectID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "badge token not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return &projectBadge, nil
+}
+
+// resolveBadgeToken returns the project of a badge token. Malformed tokens are refused before
+// reaching the database.
+func resolveBadgeToken(token string) (uuid.UUID, *utils.ServiceError) {
+	if !badgeTokenPattern.MatchString(token) {
+		return uuid.Nil, &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "not found",
+			Err:        errors.New("malformed badge token"),
+		}
+	}
+	var projectBadge badges.ProjectBadge
+	if err := config.DB.Select("project_id").First(&projectBadge, "token_hash = ?", hashBadgeToken(token)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return uuid.Nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "not found",
+				Err:        errors.New("unknown badge token"),
+			}
+		}
+		return uuid.Nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "unavailable",
+			Err:        err,
+		}
+	}
+	return projectBadge.ProjectID, nil
+}
+
+func validateBadgeFilter(name, value string, pattern *regexp.Regexp) *utils.ServiceError {
+	if value == "" || pattern.MatchString(value) && !strings.Contains(value, "..") {
+		return nil
+	}
+	return &utils.ServiceError{
+		StatusCode: http.StatusBadRequest,
+		Message:    "invalid " + name,
+		Err:        fmt.Errorf("invalid %s %q", name, value),
+	}
+}
+
+func hashBadgeToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func toBadgeResponse(b badges.ProjectBadge) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         b.ID,
+		"project_id": b.ProjectID,
+		"created_by": b.CreatedBy,
+		"updated_by": b.UpdatedBy,
+		"created_at": b.CreatedAt,
+		"updated_at": b.UpdatedAt,
+	}
+}
@@ -0,0 +1,474 @@
+package ci
+
+import (
+	"deva/src/lib/dto"
+	"deva/src/lib/interfaces"
+	service "deva/src/modules/ci/services"
+	users "deva/src/modules/users/models"
+	"deva/src/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"net/http"
+	"path"
+)
+
+// TriggerProjectPipeline is a controller function to run the pipeline of a project
+func TriggerProjectPipeline(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid project ID", err)
+	}
+
+	// The body is optional: without a ref the default branch or the exported workspace is used
+	var body dto.TriggerPipelineRequest
+	if len(c.Body()) > 0 {
+		if serviceErr := utils.BindJson(c, &body); serviceErr != nil {
+			s := serviceErr.Err.Error()
+			errStr := &s
+			return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+				Data: nil,
+				Status: interfaces.Status{
+					Code:    serviceErr.StatusCode,
+					Message: serviceErr.Message,
+				},
+				Error: errStr,
+			})
+		}
+	}
+
+	response, serviceErr := service.TriggerPipeline(currentUser.ID, projectID, body)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusCreated).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusCreated,
+			Message: "Pipeline triggered",
+		},
+		Error: nil,
+	})
+}
+
+// SetProjectRepository is a controller function to set the repository pipelines of a project check out
+func SetProjectRepository(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid project ID", err)
+	}
+
+	var body dto.SetProjectRepositoryRequest
+	if serviceErr := utils.BindJson(c, &body); serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	response, serviceErr := service.SetProjectRepository(currentUser.ID, projectID, body)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Project repository updated",
+		},
+		Error: nil,
+	})
+}
+
+// ListProjectPipelines is a controller function to list the pipelines of a project
+func ListProjectPipelines(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid project ID", err)
+	}
+
+	response, serviceErr := service.ListProjectPipelines(currentUser.ID, projectID, c.QueryInt("limit", 20), c.QueryInt("offset", 0))
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Pipelines retrieved",
+		},
+		Error: nil,
+	})
+}
+
+// GetPipeline is a controller function to get a pipeline with its steps and logs
+func GetPipeline(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	pipelineID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid pipeline ID", err)
+	}
+
+	response, serviceErr := service.GetPipeline(currentUser.ID, pipelineID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Pipeline retrieved",
+		},
+		Error: nil,
+	})
+}
+
+// CancelPipeline is a controller function to cancel a pending or running pipeline
+func CancelPipeline(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	pipelineID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid pipeline ID", err)
+	}
+
+	response, serviceErr := service.CancelPipeline(currentUser.ID, pipelineID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Pipeline cancelled",
+		},
+		Error: nil,
+	})
+}
+
+// RerunPipeline is a controller function to run a finished pipeline again
+func RerunPipeline(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	pipelineID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid pipeline ID", err)
+	}
+
+	response, serviceErr := service.RerunPipeline(currentUser.ID, pipelineID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusCreated).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusCreated,
+			Message: "Pipeline rerun triggered",
+		},
+		Error: nil,
+	})
+}
+
+// StreamStepLogs is a controller function to follow the log and status of a pipeline step as server-sent events
+func StreamStepLogs(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	pipelineID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid pipeline ID", err)
+	}
+
+	stepID, err := uuid.Parse(c.Params("step_id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid step ID", err)
+	}
+
+	backlog, live, cancel, serviceErr := service.StreamStepEvents(currentUser.ID, pipelineID, stepID, utils.LastEventID(c))
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return utils.StreamEvents(c, backlog, live, cancel)
+}
+
+// ListPipelineArtifacts is a controller function to list the artifacts uploaded by a pipeline
+func ListPipelineArtifacts(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	pipelineID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid pipeline ID", err)
+	}
+
+	response, serviceErr := service.ListPipelineArtifacts(currentUser.ID, pipelineID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Artifacts retrieved",
+		},
+		Error: nil,
+	})
+}
+
+// DownloadPipelineArtifact is a controller function to download a named artifact as a tar.gz archive
+func DownloadPipelineArtifact(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	pipelineID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid pipeline ID", err)
+	}
+
+	name := c.Params("name")
+	archive, serviceErr := service.GetPipelineArtifact(currentUser.ID, pipelineID, name)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Download(archive, name+".tar.gz")
+}
+
+// DownloadPipelineArtifactFile is a controller function to download one file of a named artifact
+func DownloadPipelineArtifactFile(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	pipelineID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid pipeline ID", err)
+	}
+
+	reader, size, serviceErr := service.OpenPipelineArtifactFile(currentUser.ID, pipelineID, c.Params("name"), c.Params("*"))
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	c.Attachment(path.Base(c.Params("*")))
+	return c.SendStream(reader, int(size))
+}
+
+// Helper Functions
+func invalidIDResponse(c *fiber.Ctx, message string, err error) error {
+	s := err.Error()
+	errStr := &s
+	return c.Status(http.StatusBadRequest).JSON(interfaces.Response{
+		Data: nil,
+		Status: interfaces.Status{
+			Code:    http.StatusBadRequest,
+			Message: message,
+		},
+		Error: errStr,
+	})
+}
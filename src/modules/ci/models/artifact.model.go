@@ -0,0 +1,27 @@
+package ci
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// CiArtifact is a named set of files uploaded by a pipeline step, stored as an archive in the
+// content-addressed CI store until it expires
+type CiArtifact struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	PipelineID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_ci_artifact_name"`
+	Pipeline   CiPipeline `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:PipelineID;references:ID"`
+	StepID     uuid.UUID  `gorm:"type:uuid;not null"`
+	ProjectID  uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Name       string     `gorm:"not null;uniqueIndex:idx_ci_artifact_name"`
+	Digest     string     `gorm:"not null;index"`                   // SHA-256 of the archive
+	SizeBytes  int64      `gorm:"not null"`                         // Size of the files, unpacked
+	Files      string     `gorm:"type:jsonb;not null;default:'[]'"` // [{"path": ..., "size": ..., "sha256": ...}]
+	ExpiresAt  time.Time  `gorm:"not null;index"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime"`
+}
+
+func MigrateCIArtifacts(db *gorm.DB) error {
+	return db.AutoMigrate(&CiArtifact{})
+}
@@ -0,0 +1,25 @@
+package ci
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// CiCacheEntry maps a cache key to a blob of the content-addressed CI store. Toolchain entries are
+// shared by every project; dependency caches belong to one.
+type CiCacheEntry struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ProjectID  uuid.UUID `gorm:"type:uuid;default:null;index"`
+	Kind       string    `gorm:"not null"`             // "toolchain", "go-modules"
+	Key        string    `gorm:"not null;uniqueIndex"` // Includes the project of project caches
+	Digest     string    `gorm:"not null;index"`       // SHA-256 of the blob
+	SizeBytes  int64     `gorm:"not null"`             // Disk space used, unpacked toolchains included
+	Hits       int       `gorm:"not null;default:0"`
+	LastUsedAt time.Time `gorm:"not null;index"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func MigrateCICacheEntries(db *gorm.DB) error {
+	return db.AutoMigrate(&CiCacheEntry{})
+}
@@ -13,9 +13,17 @@ type CiPipeline struct {
 	ProjectID     uuid.UUID        `gorm:"type:uuid;not null"`
 	Project       projects.Project `gorm:"foreignKey:ProjectID;references:ID"`
 	Provider      string           `gorm:"not null"`
-	Status        string           `gorm:"not null;default:'pending'"`
+	Status        string           `gorm:"not null;default:'pending'"` // "pending", "running", "succeeded", "failed", "cancelled"
 	CommitSHA     string
 	LogURL        string
+	Trigger       string    `gorm:"not null;default:'manual'"` // "manual", "rerun", "push", "tag"
+	Ref           string    // Branch or tag checked out from the project repository
+	Source        string    // "repository" or "workspace", the exported project archive
+	Definition    string    `gorm:"type:text"` // Pipeline file the run used
+	RerunOfID     uuid.UUID `gorm:"type:uuid;default:null;index"`
+	FailureReason string
+	StartedAt     time.Time
+	FinishedAt    time.Time
 	UpdatedBy     uuid.UUID      `gorm:"type:uuid;not null"`
 	UpdatedByUser users.User     `gorm:"foreignKey:UpdatedBy;references:ID"`
 	CreatedAt     time.Time      `gorm:"autoCreateTime"`
@@ -0,0 +1,27 @@
+package ci
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// PipelineCell is one combination of the matrix of a pipeline. Its steps point to it, and its
+// status sums them up.
+type PipelineCell struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	PipelineID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	CiPipeline CiPipeline `gorm:"foreignKey:PipelineID;references:ID"`
+	Name       string     `gorm:"not null"` // Values of the cell, like "1.24.2, amd64"
+	Position   int        `gorm:"not null;default:0"`
+	Values     string     `gorm:"type:jsonb;not null;default:'{}'"` // {"go": "1.24.2", "goarch": "amd64"}
+	Status     string     `gorm:"not null;default:'pending'"`       // "pending", "running", "succeeded", "failed", "cancelled", "skipped"
+	StartedAt  time.Time
+	FinishedAt time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
+
+func MigratePipelineCells(db *gorm.DB) error {
+	return db.AutoMigrate(&PipelineCell{})
+}
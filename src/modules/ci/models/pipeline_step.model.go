@@ -10,9 +10,14 @@ type PipelineStep struct {
 	ID          uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
 	PipelineID  uuid.UUID  `gorm:"type:uuid;not null"`
 	CiPipeline  CiPipeline `gorm:"foreignKey:PipelineID;references:ID"`
+	CellID      uuid.UUID  `gorm:"type:uuid;default:null;index"` // Matrix cell of the step, if any
 	Name        string     `gorm:"not null"`
-	Status      string     `gorm:"not null;default:'pending'"`
-	Log         string     `gorm:"type:text"`
+	Position    int        `gorm:"not null;default:0"`
+	Status      string     `gorm:"not null;default:'pending'"` // "pending", "running", "succeeded", "failed", "cancelled", "skipped"
+	Command     string     `gorm:"type:text"`
+	ExitCode    *int
+	Artifacts   string `gorm:"type:jsonb;not null;default:'[]'"` // Names of the artifacts the step uploaded
+	Log         string `gorm:"type:text"`
 	StartedAt   time.Time
 	CompletedAt time.Time
 	CreatedAt   time.Time      `gorm:"autoCreateTime"`
@@ -0,0 +1,338 @@
+package ci
+
+import (
+	"deva/src/config"
+	"deva/src/lib/pipeline"
+	ci "deva/src/modules/ci/models"
+	"deva/src/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxPipelineArtifactBytes bounds the artifacts kept for one pipeline
+	maxPipelineArtifactBytes = 1024 * 1024 * 1024
+	// Artifacts without a retention of their own are kept CI_ARTIFACT_RETENTION_DAYS
+	defaultArtifactRetentionDays = 30
+	ciStoreCleanupInterval       = time.Hour
+)
+
+// ListPipelineArtifacts returns the artifacts uploaded by the steps of a pipeline
+func ListPipelineArtifacts(userID, pipelineID uuid.UUID) ([]map[string]interface{}, *utils.ServiceError) {
+	p, serviceErr := GetAccessiblePipeline(userID, pipelineID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	var artifacts []ci.CiArtifact
+	if err := config.DB.Where("pipeline_id = ? AND expires_at > ?", p.ID, time.Now()).
+		Order("created_at ASC").
+		Find(&artifacts).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	response := make([]map[string]interface{}, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		response = append(response, toArtifactResponse(artifact))
+	}
+	return response, nil
+}
+
+// GetPipelineArtifact returns the stored archive of a named artifact of a pipeline
+func GetPipelineArtifact(userID, pipelineID uuid.UUID, name string) (string, *utils.ServiceError) {
+	artifact, serviceErr := getAccessibleArtifact(userID, pipelineID, name)
+	if serviceErr != nil {
+		return "", serviceErr
+	}
+	stored := blobPath(artifact.Digest)
+	if _, err := os.Stat(stored); err != nil {
+		return "", &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "artifact not found",
+			Err:        err,
+		}
+	}
+	return stored, nil
+}
+
+// OpenPipelineArtifactFile returns a reader of one file of a named artifact and its size
+func OpenPipelineArtifactFile(userID, pipelineID uuid.UUID, name, filePath string) (io.ReadCloser, int64, *utils.ServiceError) {
+	artifact, serviceErr := getAccessibleArtifact(userID, pipelineID, name)
+	if serviceErr != nil {
+		return nil, 0, serviceErr
+	}
+	cleaned, err := pipeline.CleanRelativePath(filePath)
+	if err != nil {
+		return nil, 0, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "invalid artifact path",
+			Err:        err,
+		}
+	}
+
+	reader, size, err := openBlobFile(artifact.Digest, cleaned)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, 0, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "artifact file not found",
+				Err:        fmt.Errorf("%s is not in artifact %s: %w", cleaned, artifact.Name, err),
+			}
+		}
+		return nil, 0, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to read artifact",
+			Err:        err,
+		}
+	}
+	return reader, size, nil
+}
+
+// StartCIStoreCleanup deletes expired artifacts every hour, removes the blobs nothing references
+// anymore and trims the cache to its size limit
+func StartCIStoreCleanup() {
+	go func() {
+		ticker := time.NewTicker(ciStoreCleanupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			deleteExpiredArtifacts(time.Now())
+			evictCache()
+			removeUnreferencedBlobs()
+		}
+	}()
+}
+
+// Helper Functions
+func ciDataDir() string {
+	if dir := os.Getenv("CI_DATA_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join("data", "ci")
+}
+
+func artifactRetention(artifact pipeline.Artifact) time.Duration {
+	if artifact.Retention > 0 {
+		return time.Duration(artifact.Retention)
+	}
+	days := defaultArtifactRetentionDays
+	if value, err := strconv.Atoi(os.Getenv("CI_ARTIFACT_RETENTION_DAYS")); err == nil && value > 0 {
+		days = value
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func getAccessibleArtifact(userID, pipelineID uuid.UUID, name string) (*ci.CiArtifact, *utils.ServiceError) {
+	p, serviceErr := GetAccessiblePipeline(userID, pipelineID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	var artifact ci.CiArtifact
+	if err := config.DB.First(&artifact, "pipeline_id = ? AND name = ? AND expires_at > ?", p.ID, name, time.Now()).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "artifact not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return &artifact, nil
+}
+
+// uploadArtifacts stores the artifacts of a step and returns their names. Steps that did not
+// succeed only upload the artifacts marked "always".
+func uploadArtifacts(rc *runContext, step *ci.PipelineStep, def pipeline.Step, succeeded bool, logger *stepLogger) ([]string, error) {
+	names := []string{}
+	for _, artifact := range def.Artifacts {
+		if !succeeded && artifact.When != pipeline.WhenAlways {
+			continue
+		}
+		files, size, err := matchArtifactFiles(rc.workspace, artifact.Paths, logger)
+		if err != nil {
+			return names, err
+		}
+		if len(files) == 0 {
+			logger.Write(fmt.Sprintf("⚠️ Artifact %s has no files", artifact.Name))
+			continue
+		}
+
+		var used int64
+		if err := config.DB.Model(&ci.CiArtifact{}).Where("pipeline_id = ?", rc.pipeline.ID).
+			Select("COALESCE(SUM(size_bytes), 0)").Scan(&used).Error; err != nil {
+			return names, err
+		}
+		if used+size > maxPipelineArtifactBytes {
+			return names, fmt.Errorf("artifacts exceed %s per pipeline", formatBytes(maxPipelineArtifactBytes))
+		}
+
+		var archived []archivedFile
+		digest, _, err := writeBlob(func(w io.Writer) error {
+			archived, err = packFiles(w, rc.workspace, files)
+			return err
+		})
+		if err != nil {
+			return names, err
+		}
+		encoded, err := json.Marshal(archived)
+		if err != nil {
+			return names, err
+		}
+		record := ci.CiArtifact{
+			PipelineID: rc.pipeline.ID,
+			StepID:     step.ID,
+			ProjectID:  rc.project.ID,
+			Name:       artifact.Name,
+			Digest:     digest,
+			SizeBytes:  size,
+			Files:      string(encoded),
+			ExpiresAt:  time.Now().Add(artifactRetention(artifact)),
+		}
+		if err := config.DB.Create(&record).Error; err != nil {
+			return names, fmt.Errorf("failed to record artifact %s: %w", artifact.Name, err)
+		}
+		names = append(names, artifact.Name)
+		logger.Write(fmt.Sprintf("📦 Uploaded artifact %s (%d files, %s), kept until %s", artifact.Name, len(archived),
+			formatBytes(size), record.ExpiresAt.UTC().Format(time.RFC3339)))
+	}
+	return names, nil
+}
+
+// downloadArtifacts extracts artifacts of earlier steps of the pipeline into the workspace, at
+// the paths they were uploaded from
+func downloadArtifacts(rc *runContext, names []string, logger *stepLogger) error {
+	for _, name := range names {
+		var artifact ci.CiArtifact
+		if err := config.DB.First(&artifact, "pipeline_id = ? AND name = ?", rc.pipeline.ID, name).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("artifact %s was not uploaded", name)
+			}
+			return err
+		}
+		if err := unpackBlob(artifact.Digest, rc.workspace, maxPipelineArtifactBytes); err != nil {
+			return fmt.Errorf("failed to download artifact %s: %w", name, err)
+		}
+		logger.Write(fmt.Sprintf("📥 Downloaded artifact %s (%s)", name, formatBytes(artifact.SizeBytes)))
+	}
+	return nil
+}
+
+// matchArtifactFiles lists the regular workspace files matching the artifact patterns. Symbolic
+// links and files outside the workspace are ignored.
+func matchArtifactFiles(workspace string, patterns []string, logger *stepLogger) ([]string, int64, error) {
+	root, err := filepath.EvalSymlinks(workspace)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var files []string
+	var total int64
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(matches) == 0 {
+			logger.Write(fmt.Sprintf("⚠️ No files match artifact path %s", pattern))
+			continue
+		}
+
+		for _, match := range matches {
+			resolved, err := filepath.EvalSymlinks(match)
+			if err != nil || !withinDir(root, resolved) {
+				logger.Write(fmt.Sprintf("⚠️ Skipping %s: it is outside the workspace", pattern))
+				continue
+			}
+			err = filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !entry.Type().IsRegular() {
+					return nil
+				}
+				rel, err := filepath.Rel(root, path)
+				if err != nil || !withinDir(root, path) {
+					return nil
+				}
+				rel = filepath.ToSlash(rel)
+				if seen[rel] {
+					return nil
+				}
+				seen[rel] = true
+
+				info, err := entry.Info()
+				if err != nil {
+					return err
+				}
+				total += info.Size()
+				files = append(files, rel)
+				return nil
+			})
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return files, total, nil
+}
+
+// deleteExpiredArtifacts drops the records of expired artifacts; their blobs go with the next
+// cleanup of unreferenced blobs
+func deleteExpiredArtifacts(now time.Time) {
+	result := config.DB.Where("expires_at <= ?", now).Delete(&ci.CiArtifact{})
+	if result.Error != nil {
+		log.Printf("⚠️ Failed to delete expired artifacts: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("🧹 Deleted %d expired pipeline artifacts", result.RowsAffected)
+	}
+}
+
+func directorySize(dir string) (int64, error) {
+	_, size, err := listFiles(dir)
+	return size, err
+}
+
+func withinDir(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+func toArtifactResponse(a ci.CiArtifact) map[string]interface{} {
+	files := []archivedFile{}
+	if err := json.Unmarshal([]byte(a.Files), &files); err != nil {
+		files = []archivedFile{}
+	}
+	return map[string]interface{}{
+		"name":         a.Name,
+		"pipeline_id":  a.PipelineID,
+		"step_id":      a.StepID,
+		"digest":       "sha256:" + a.Digest,
+		"size":         a.SizeBytes,
+		"files":        files,
+		"download_url": fmt.Sprintf("/api/v1/pipelines/%s/artifacts/%s", a.PipelineID, a.Name),
+		"expires_at":   a.ExpiresAt,
+		"created_at":   a.CreatedAt,
+	}
+}
@@ -0,0 +1,356 @@
+package ci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"deva/src/config"
+	"deva/src/lib/pipeline"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// blobGracePeriod protects blobs that were just written and are not referenced yet
+const blobGracePeriod = time.Hour
+
+// archiveModTime is the modification time of every archived file, so equal files make equal
+// archives and are stored once
+var archiveModTime = time.Unix(0, 0).UTC()
+
+// archivedFile is a file of a cache or artifact archive
+type archivedFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Helper Functions
+func blobsDir() string {
+	// Blobs of the CI cache and of artifacts, named by their SHA-256
+	return filepath.Join(ciDataDir(), "blobs", "sha256")
+}
+
+func blobPath(digest string) string {
+	return filepath.Join(blobsDir(), digest[:2], digest)
+}
+
+// writeBlob stores what write produces under its SHA-256 and returns the digest and the size.
+// Content that is already stored is kept once.
+func writeBlob(write func(io.Writer) error) (string, int64, error) {
+	if err := os.MkdirAll(blobsDir(), 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(blobsDir(), ".upload-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	err = write(io.MultiWriter(tmp, hash, counter))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	target := blobPath(digest)
+	if _, err := os.Stat(target); err == nil {
+		// Refresh it so a concurrent cleanup keeps it until it is referenced
+		now := time.Now()
+		_ = os.Chtimes(target, now, now)
+		return digest, counter.n, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", 0, err
+	}
+	return digest, counter.n, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// packFiles writes a gzipped tar of files, slash separated paths relative to root. Entries are
+// sorted and carry no owner or time, so the archive only depends on the content.
+func packFiles(w io.Writer, root string, files []string) ([]archivedFile, error) {
+	sorted := append([]string{}, files...)
+	sort.Strings(sorted)
+
+	gz, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(gz)
+	archived := make([]archivedFile, 0, len(sorted))
+	for _, rel := range sorted {
+		file, err := packFile(tw, root, rel)
+		if err != nil {
+			return nil, err
+		}
+		archived = append(archived, file)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return archived, gz.Close()
+}
+
+func packFile(tw *tar.Writer, root, rel string) (archivedFile, error) {
+	f, err := os.Open(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return archivedFile{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return archivedFile{}, err
+	}
+
+	mode := int64(0644)
+	if info.Mode().Perm()&0111 != 0 {
+		mode = 0755
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     rel,
+		Mode:     mode,
+		Size:     info.Size(),
+		ModTime:  archiveModTime,
+		Format:   tar.FormatPAX,
+	}); err != nil {
+		return archivedFile{}, err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tw, hash), io.LimitReader(f, info.Size())); err != nil {
+		return archivedFile{}, err
+	}
+	return archivedFile{Path: rel, Size: info.Size(), SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// unpackBlob extracts the regular files of an archive blob into dir, up to maxBytes. Entries that
+// would leave dir are refused.
+func unpackBlob(digest, dir string, maxBytes int64) error {
+	f, err := os.Open(blobPath(digest))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	var total int64
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+		rel, err := pipeline.CleanRelativePath(strings.TrimSuffix(header.Name, "/"))
+		if err != nil {
+			return fmt.Errorf("archive entry %q: %w", header.Name, err)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if header.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		total += header.Size
+		if total > maxBytes {
+			return fmt.Errorf("archive exceeds %d MiB", maxBytes/1024/1024)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		// Files restored over read-only ones, like those of a module cache, replace them
+		_ = os.Remove(target)
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode).Perm()|0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, io.LimitReader(tr, header.Size))
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// openBlobFile returns a reader of one file of an archive blob and its size
+func openBlobFile(digest, rel string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(blobPath(digest))
+	if err != nil {
+		return nil, 0, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			gz.Close()
+			f.Close()
+			if errors.Is(err, io.EOF) {
+				err = fs.ErrNotExist
+			}
+			return nil, 0, err
+		}
+		if header.Typeflag == tar.TypeReg && header.Name == rel {
+			return &blobFileReader{Reader: io.LimitReader(tr, header.Size), closers: []io.Closer{gz, f}}, header.Size, nil
+		}
+	}
+}
+
+type blobFileReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *blobFileReader) Close() error {
+	for _, closer := range r.closers {
+		_ = closer.Close()
+	}
+	return nil
+}
+
+// listFiles returns the regular files under root as slash separated relative paths with their
+// total size. Symbolic links are left out.
+func listFiles(root string) ([]string, int64, error) {
+	var files []string
+	var total int64
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		total += info.Size()
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, nil
+	}
+	return files, total, err
+}
+
+// isBlobReferenced reports whether a cache entry or an artifact still uses a blob
+func isBlobReferenced(digest string) (bool, error) {
+	var count int64
+	err := config.DB.Raw(`SELECT (SELECT COUNT(*) FROM ci_cache_entries WHERE digest = ?) +
+		(SELECT COUNT(*) FROM ci_artifacts WHERE digest = ?)`, digest, digest).Scan(&count).Error
+	return count > 0, err
+}
+
+// removeBlobIfUnused deletes a blob nothing references anymore
+func removeBlobIfUnused(digest string) {
+	referenced, err := isBlobReferenced(digest)
+	if err != nil {
+		log.Printf("⚠️ Failed to check references of blob %s: %v", digest, err)
+		return
+	}
+	if !referenced {
+		if err := os.Remove(blobPath(digest)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("⚠️ Failed to remove blob %s: %v", digest, err)
+		}
+	}
+}
+
+// removeUnreferencedBlobs deletes the blobs and leftover uploads nothing references, except
+// those written during the grace period
+func removeUnreferencedBlobs() {
+	var referenced []string
+	if err := config.DB.Raw("SELECT digest FROM ci_cache_entries UNION SELECT digest FROM ci_artifacts").
+		Scan(&referenced).Error; err != nil {
+		log.Printf("⚠️ Failed to load referenced blobs: %v", err)
+		return
+	}
+	keep := make(map[string]bool, len(referenced))
+	for _, digest := range referenced {
+		keep[digest] = true
+	}
+
+	cutoff := time.Now().Add(-blobGracePeriod)
+	err := filepath.WalkDir(blobsDir(), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if keep[entry.Name()] {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("⚠️ Failed to remove blob %s: %v", entry.Name(), err)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("⚠️ Failed to clean up blobs: %v", err)
+	}
+}
+
+// removeTree deletes a directory even when it contains read-only directories, like a module
+// cache written without -modcacherw
+func removeTree(dir string) {
+	if err := os.RemoveAll(dir); err == nil {
+		return
+	}
+	_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() {
+			_ = os.Chmod(path, 0755)
+		}
+		return nil
+	})
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("⚠️ Failed to remove %s: %v", dir, err)
+	}
+}
@@ -0,0 +1,432 @@
+package ci
+
+import (
+	"context"
+	"crypto/sha256"
+	"deva/src/config"
+	ci "deva/src/modules/ci/models"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache entry kinds
+const (
+	CacheKindToolchain = "toolchain"
+	CacheKindGoModules = "go-modules"
+)
+
+const (
+	// The cache is trimmed to CI_CACHE_MAX_MB, least recently used entries first
+	defaultCacheMaxMB = 10 * 1024
+	// maxCacheEntryBytes bounds one cache entry; larger dependency caches are not saved
+	maxCacheEntryBytes = 4 * 1024 * 1024 * 1024
+	// maxToolchainBytes bounds an unpacked toolchain
+	maxToolchainBytes        = 2 * 1024 * 1024 * 1024
+	defaultGoDownloadURL     = "https://go.dev/dl/"
+	toolchainDownloadTimeout = 10 * time.Minute
+)
+
+var (
+	// cacheMutex guards cacheInUse and serializes evictions
+	cacheMutex sync.Mutex
+	// cacheInUse counts the runs using each cache entry; they are never evicted
+	cacheInUse = map[uuid.UUID]int{}
+	// toolchainLocks makes concurrent pipelines download a toolchain once
+	toolchainLocks sync.Map
+)
+
+// Helper Functions
+func cacheMaxBytes() int64 {
+	maxMB := defaultCacheMaxMB
+	if value, err := strconv.Atoi(os.Getenv("CI_CACHE_MAX_MB")); err == nil && value > 0 {
+		maxMB = value
+	}
+	return int64(maxMB) * 1024 * 1024
+}
+
+func toolchainsDir() string {
+	return filepath.Join(ciDataDir(), "toolchains")
+}
+
+// acquireCacheEntry loads a cache entry and protects it from eviction until release is called
+func acquireCacheEntry(key string) (*ci.CiCacheEntry, func(), error) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	var entry ci.CiCacheEntry
+	if err := config.DB.First(&entry, "key = ?", key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	cacheInUse[entry.ID]++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			cacheMutex.Lock()
+			defer cacheMutex.Unlock()
+			if cacheInUse[entry.ID]--; cacheInUse[entry.ID] <= 0 {
+				delete(cacheInUse, entry.ID)
+			}
+		})
+	}
+	return &entry, release, nil
+}
+
+// touchCacheEntry records a cache hit for the LRU order
+func touchCacheEntry(entry *ci.CiCacheEntry) {
+	if err := config.DB.Model(&ci.CiCacheEntry{}).Where("id = ?", entry.ID).
+		Updates(map[string]interface{}{"hits": gorm.Expr("hits + 1"), "last_used_at": time.Now()}).Error; err != nil {
+		log.Printf("⚠️ Failed to record use of cache %s: %v", entry.Key, err)
+	}
+}
+
+// forgetCacheEntry drops an entry whose files are gone
+func forgetCacheEntry(entry *ci.CiCacheEntry) {
+	if err := config.DB.Delete(&ci.CiCacheEntry{}, "id = ?", entry.ID).Error; err != nil {
+		log.Printf("⚠️ Failed to drop cache %s: %v", entry.Key, err)
+	}
+	if entry.Kind == CacheKindToolchain {
+		removeTree(filepath.Join(toolchainsDir(), entry.Digest))
+	}
+	removeBlobIfUnused(entry.Digest)
+}
+
+// restoreCache unpacks the cache entry of key into dir and reports whether there was one
+func restoreCache(key, dir string, logger *stepLogger) (bool, error) {
+	entry, release, err := acquireCacheEntry(key)
+	if err != nil || entry == nil {
+		return false, err
+	}
+	defer release()
+
+	started := time.Now()
+	if err := unpackBlob(entry.Digest, dir, maxCacheEntryBytes); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			forgetCacheEntry(entry)
+			return false, nil
+		}
+		return false, err
+	}
+	touchCacheEntry(entry)
+	logger.Write(fmt.Sprintf("♻️ Restored %s (%s) in %s", entry.Kind, formatBytes(entry.SizeBytes),
+		time.Since(started).Round(time.Millisecond)))
+	return true, nil
+}
+
+// saveCache stores the files under dir as the cache entry of key, unless it already exists or
+// is too large, then trims the cache
+func saveCache(projectID uuid.UUID, kind, key, dir string, logger *stepLogger) error {
+	var existing int64
+	if err := config.DB.Model(&ci.CiCacheEntry{}).Where("key = ?", key).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		logger.Write(fmt.Sprintf("✔ The %s cache is up to date", kind))
+		return nil
+	}
+
+	files, total, err := listFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		logger.Write(fmt.Sprintf("ℹ️ Nothing to cache for %s", kind))
+		return nil
+	}
+	if total > maxCacheEntryBytes {
+		logger.Write(fmt.Sprintf("⚠️ Not caching %s: %s is over the %s limit", kind, formatBytes(total), formatBytes(maxCacheEntryBytes)))
+		return nil
+	}
+
+	started := time.Now()
+	digest, size, err := writeBlob(func(w io.Writer) error {
+		_, err := packFiles(w, dir, files)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	entry := ci.CiCacheEntry{
+		ProjectID:  projectID,
+		Kind:       kind,
+		Key:        key,
+		Digest:     digest,
+		SizeBytes:  size,
+		LastUsedAt: time.Now(),
+	}
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error; err != nil {
+		return err
+	}
+	logger.Write(fmt.Sprintf("💾 Saved %s (%d files, %s) in %s", kind, len(files), formatBytes(size),
+		time.Since(started).Round(time.Millisecond)))
+	evictCache()
+	return nil
+}
+
+// evictCache drops the least recently used cache entries until the cache fits CI_CACHE_MAX_MB.
+// Blobs are shared, so a blob only counts once and is removed with its last reference.
+func evictCache() {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	var entries []ci.CiCacheEntry
+	if err := config.DB.Order("last_used_at ASC").Find(&entries).Error; err != nil {
+		log.Printf("⚠️ Failed to load the CI cache: %v", err)
+		return
+	}
+	references := map[string]int{}
+	var total int64
+	for _, entry := range entries {
+		if references[entry.Digest] == 0 {
+			total += entry.SizeBytes
+		}
+		references[entry.Digest]++
+	}
+
+	limit := cacheMaxBytes()
+	for i := range entries {
+		if total <= limit {
+			return
+		}
+		entry := &entries[i]
+		if cacheInUse[entry.ID] > 0 {
+			continue
+		}
+		if err := config.DB.Delete(&ci.CiCacheEntry{}, "id = ?", entry.ID).Error; err != nil {
+			log.Printf("⚠️ Failed to evict cache %s: %v", entry.Key, err)
+			continue
+		}
+		if references[entry.Digest]--; references[entry.Digest] == 0 {
+			total -= entry.SizeBytes
+			if entry.Kind == CacheKindToolchain {
+				removeTree(filepath.Join(toolchainsDir(), entry.Digest))
+			}
+			removeBlobIfUnused(entry.Digest)
+		}
+		log.Printf("🧹 Evicted CI cache %s (%s)", entry.Key, formatBytes(entry.SizeBytes))
+	}
+}
+
+// provisionGoToolchain returns the GOROOT of a Go release from the shared cache, downloading and
+// verifying it first when needed. release lets the cache evict it again.
+func provisionGoToolchain(ctx context.Context, version string, logger *stepLogger) (string, func(), error) {
+	archive := fmt.Sprintf("go%s.%s-%s.tar.gz", version, runtime.GOOS, runtime.GOARCH)
+	key := "toolchain/" + archive
+	lock, _ := toolchainLocks.LoadOrStore(key, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	entry, release, err := acquireCacheEntry(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if entry != nil {
+		goroot, err := unpackToolchain(entry.Digest)
+		if err == nil {
+			touchCacheEntry(entry)
+			logger.Write(fmt.Sprintf("♻️ Using cached Go %s", version))
+			return goroot, release, nil
+		}
+		release()
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", nil, err
+		}
+		forgetCacheEntry(entry)
+	}
+
+	logger.Write(fmt.Sprintf("📥 Downloading Go %s (%s)", version, archive))
+	downloadCtx, cancel := context.WithTimeout(ctx, toolchainDownloadTimeout)
+	defer cancel()
+	expected, err := goReleaseChecksum(downloadCtx, archive)
+	if err != nil {
+		return "", nil, err
+	}
+	digest, size, err := writeBlob(func(w io.Writer) error {
+		return download(downloadCtx, goDownloadURL()+archive, w)
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to download %s: %w", archive, err)
+	}
+	if digest != expected {
+		removeBlobIfUnused(digest)
+		return "", nil, fmt.Errorf("checksum mismatch for %s: got %s, want %s", archive, digest, expected)
+	}
+	goroot, err := unpackToolchain(digest)
+	if err != nil {
+		return "", nil, err
+	}
+	unpacked, err := directorySize(filepath.Dir(goroot))
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&ci.CiCacheEntry{
+		Kind:       CacheKindToolchain,
+		Key:        key,
+		Digest:     digest,
+		SizeBytes:  size + unpacked,
+		LastUsedAt: time.Now(),
+	}).Error; err != nil {
+		return "", nil, err
+	}
+	entry, release, err = acquireCacheEntry(key)
+	if err != nil || entry == nil {
+		return "", nil, fmt.Errorf("failed to register Go %s in the cache: %v", version, err)
+	}
+	logger.Write(fmt.Sprintf("✔ Go %s verified and cached (%s)", version, formatBytes(size)))
+	evictCache()
+	return goroot, release, nil
+}
+
+// unpackToolchain unpacks a toolchain archive once into the toolchains directory and returns its
+// root. Archives are unpacked next to their final place and renamed, so a half unpacked toolchain
+// is never used.
+func unpackToolchain(digest string) (string, error) {
+	dir := filepath.Join(toolchainsDir(), digest)
+	goroot := filepath.Join(dir, "go")
+	if info, err := os.Stat(filepath.Join(goroot, "bin", "go")); err == nil && info.Mode().IsRegular() {
+		return goroot, nil
+	}
+	if _, err := os.Stat(blobPath(digest)); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(toolchainsDir(), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(toolchainsDir(), ".unpack-")
+	if err != nil {
+		return "", err
+	}
+	defer removeTree(tmp)
+	if err := unpackBlob(digest, tmp, maxToolchainBytes); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "go", "bin", "go")); err != nil {
+		return "", fmt.Errorf("the archive has no go/bin/go")
+	}
+	removeTree(dir)
+	if err := os.Rename(tmp, dir); err != nil {
+		return "", err
+	}
+	return goroot, nil
+}
+
+func goDownloadURL() string {
+	if base := os.Getenv("CI_GO_DOWNLOAD_URL"); base != "" {
+		return strings.TrimSuffix(base, "/") + "/"
+	}
+	return defaultGoDownloadURL
+}
+
+// goReleaseChecksum looks the SHA-256 of a release archive up in the Go download index
+func goReleaseChecksum(ctx context.Context, archive string) (string, error) {
+	var index strings.Builder
+	if err := download(ctx, goDownloadURL()+"?mode=json&include=all", &index); err != nil {
+		return "", fmt.Errorf("failed to load the Go release index: %w", err)
+	}
+	var releases []struct {
+		Files []struct {
+			Filename string `json:"filename"`
+			SHA256   string `json:"sha256"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(index.String()), &releases); err != nil {
+		return "", fmt.Errorf("invalid Go release index: %w", err)
+	}
+	for _, release := range releases {
+		for _, file := range release.Files {
+			if file.Filename == archive && file.SHA256 != "" {
+				return strings.ToLower(file.SHA256), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s is not a published Go release", archive)
+}
+
+func download(ctx context.Context, url string, w io.Writer) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, response.Status)
+	}
+	_, err = io.Copy(w, response.Body)
+	return err
+}
+
+// goModulesCacheKey identifies the module cache of a workspace by the content of its go.sum and
+// go.work.sum files. It is empty when there are none.
+func goModulesCacheKey(projectID uuid.UUID, workspace string) (string, error) {
+	var sums []string
+	err := filepath.WalkDir(workspace, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			switch entry.Name() {
+			case ".git", "vendor", "node_modules":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() && (entry.Name() == "go.sum" || entry.Name() == "go.work.sum") {
+			sums = append(sums, path)
+		}
+		return nil
+	})
+	if err != nil || len(sums) == 0 {
+		return "", err
+	}
+
+	sort.Strings(sums)
+	hash := sha256.New()
+	for _, path := range sums {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		rel, _ := filepath.Rel(workspace, path)
+		fmt.Fprintf(hash, "%s\x00%d\x00", filepath.ToSlash(rel), len(content))
+		hash.Write(content)
+	}
+	return fmt.Sprintf("%s/%s/%s", CacheKindGoModules, projectID, hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1024*1024*1024:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1024*1024*1024))
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KiB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,437 @@
+package ci
+
+import (
+	"deva/src/config"
+	"deva/src/lib/dto"
+	ci "deva/src/modules/ci/models"
+	deployments "deva/src/modules/deployments/services"
+	projects "deva/src/modules/projects/models"
+	"deva/src/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ProviderDeva marks pipelines run by the built-in runner
+const ProviderDeva = "deva"
+
+// Pipeline and step statuses. Steps that never ran because an earlier one failed or the
+// pipeline was cancelled end as skipped.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusSkipped   = "skipped"
+)
+
+// Pipeline triggers
+const (
+	TriggerManual = "manual"
+	TriggerRerun  = "rerun"
+	TriggerPush   = "push"
+	TriggerTag    = "tag"
+)
+
+// Where a pipeline gets its workspace from
+const (
+	SourceRepository = "repository"
+	SourceWorkspace  = "workspace"
+)
+
+// transitions lists the statuses each non-terminal status may move to
+var transitions = map[string][]string{
+	StatusPending: {StatusRunning, StatusFailed, StatusCancelled, StatusSkipped},
+	StatusRunning: {StatusSucceeded, StatusFailed, StatusCancelled},
+}
+
+var (
+	commitSHAPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,64}$`)
+	refPattern       = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+)
+
+// IsTerminalStatus reports whether a pipeline or step in this status can no longer change
+func IsTerminalStatus(status string) bool {
+	_, ok := transitions[status]
+	return !ok
+}
+
+// CanTransition reports whether a pipeline or step may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TriggerPipeline queues a run of the project pipeline and starts the runner
+func TriggerPipeline(userID, projectID uuid.UUID, request dto.TriggerPipelineRequest) (map[string]interface{}, *utils.ServiceError) {
+	project, serviceErr := deployments.GetAccessibleProject(userID, projectID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	return triggerPipeline(userID, project, TriggerManual, request.Ref, request.CommitSHA)
+}
+
+// TriggerPushPipeline runs the project pipeline for a pushed branch or tag. Pushes always name a
+// ref, so the project needs a repository.
+func TriggerPushPipeline(userID, projectID uuid.UUID, trigger, ref, commitSHA string) (map[string]interface{}, *utils.ServiceError) {
+	if trigger != TriggerPush && trigger != TriggerTag {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("invalid pipeline trigger %q", trigger),
+			Err:        fmt.Errorf("trigger %q is not a push", trigger),
+		}
+	}
+	project, serviceErr := deployments.GetAccessibleProject(userID, projectID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	return triggerPipeline(userID, project, trigger, ref, commitSHA)
+}
+
+// ListProjectPipelines returns the pipelines of a project, newest first
+func ListProjectPipelines(userID, projectID uuid.UUID, limit, offset int) ([]map[string]interface{}, *utils.ServiceError) {
+	if _, serviceErr := deployments.GetAccessibleProject(userID, projectID); serviceErr != nil {
+		return nil, serviceErr
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var pipelines []ci.CiPipeline
+	if err := config.DB.Omit("definition").
+		Where("project_id = ?", projectID).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&pipelines).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	response := make([]map[string]interface{}, 0, len(pipelines))
+	for _, pipeline := range pipelines {
+		response = append(response, toPipelineResponse(pipeline, nil))
+	}
+	return response, nil
+}
+
+// GetPipeline returns a pipeline with its steps and their logs, and its matrix cells if it has any
+func GetPipeline(userID, pipelineID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	pipeline, serviceErr := GetAccessiblePipeline(userID, pipelineID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	var steps []ci.PipelineStep
+	if err := config.DB.Where("pipeline_id = ?", pipeline.ID).Order("position ASC").Find(&steps).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	var cells []ci.PipelineCell
+	if err := config.DB.Where("pipeline_id = ?", pipeline.ID).Order("position ASC").Find(&cells).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	response := toPipelineResponse(*pipeline, steps)
+	response["definition"] = pipeline.Definition
+	if len(cells) > 0 {
+		matrix := make([]map[string]interface{}, 0, len(cells))
+		for _, cell := range cells {
+			matrix = append(matrix, toCellResponse(cell))
+		}
+		response["matrix"] = matrix
+	}
+	return response, nil
+}
+
+// CancelPipeline stops a pipeline that has not finished yet
+func CancelPipeline(userID, pipelineID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	pipeline, serviceErr := GetAccessiblePipeline(userID, pipelineID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	if IsTerminalStatus(pipeline.Status) {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("pipeline already %s", pipeline.Status),
+			Err:        fmt.Errorf("pipeline %s is %s", pipeline.ID, pipeline.Status),
+		}
+	}
+
+	if err := transitionPipeline(pipeline, StatusCancelled); err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    "pipeline could not be cancelled",
+			Err:        err,
+		}
+	}
+	stopPipeline(pipeline.ID)
+
+	return toPipelineResponse(*pipeline, nil), nil
+}
+
+// RerunPipeline runs a finished pipeline again on the same ref and commit, as a new pipeline
+func RerunPipeline(userID, pipelineID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	original, serviceErr := GetAccessiblePipeline(userID, pipelineID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	if !IsTerminalStatus(original.Status) {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("pipeline is still %s", original.Status),
+			Err:        fmt.Errorf("pipeline %s is %s", original.ID, original.Status),
+		}
+	}
+	if original.Provider != ProviderDeva {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("pipelines of %s cannot be rerun here", original.Provider),
+			Err:        fmt.Errorf("pipeline %s has provider %q", original.ID, original.Provider),
+		}
+	}
+
+	project, serviceErr := deployments.GetAccessibleProject(userID, original.ProjectID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	source, serviceErr := pipelineSource(project)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	pipeline := ci.CiPipeline{
+		ProjectID: original.ProjectID,
+		Provider:  ProviderDeva,
+		Status:    StatusPending,
+		Trigger:   TriggerRerun,
+		Ref:       original.Ref,
+		CommitSHA: original.CommitSHA,
+		Source:    source,
+		RerunOfID: original.ID,
+		UpdatedBy: userID,
+	}
+	if serviceErr := createPipelineRecord(&pipeline); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	startPipeline(pipeline.ID)
+	return toPipelineResponse(pipeline, nil), nil
+}
+
+// GetAccessiblePipeline loads a pipeline of a project the user can access
+func GetAccessiblePipeline(userID, pipelineID uuid.UUID) (*ci.CiPipeline, *utils.ServiceError) {
+	var pipeline ci.CiPipeline
+	if err := config.DB.First(&pipeline, "id = ?", pipelineID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "pipeline not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	if _, serviceErr := deployments.GetAccessibleProject(userID, pipeline.ProjectID); serviceErr != nil {
+		if serviceErr.StatusCode == http.StatusNotFound {
+			serviceErr.Message = "pipeline not found"
+		}
+		return nil, serviceErr
+	}
+	return &pipeline, nil
+}
+
+// Helper Functions
+func triggerPipeline(userID uuid.UUID, project *projects.Project, trigger, ref, commitSHA string) (map[string]interface{}, *utils.ServiceError) {
+	ref = strings.TrimSpace(ref)
+	commitSHA = strings.ToLower(strings.TrimSpace(commitSHA))
+	if err := validateRevision(ref, commitSHA); err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    err.Error(),
+			Err:        err,
+		}
+	}
+	source, serviceErr := pipelineSource(project)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	if source == SourceWorkspace && ref != "" {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "ref needs a project repository; this project runs its exported workspace",
+			Err:        fmt.Errorf("project %s has no repo_url", project.ID),
+		}
+	}
+
+	pipeline := ci.CiPipeline{
+		ProjectID: project.ID,
+		Provider:  ProviderDeva,
+		Status:    StatusPending,
+		Trigger:   trigger,
+		Ref:       ref,
+		CommitSHA: commitSHA,
+		Source:    source,
+		UpdatedBy: userID,
+	}
+	if serviceErr := createPipelineRecord(&pipeline); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	startPipeline(pipeline.ID)
+	return toPipelineResponse(pipeline, nil), nil
+}
+
+func validateRevision(ref, commitSHA string) error {
+	if ref != "" && (!refPattern.MatchString(ref) || strings.Contains(ref, "..") || strings.HasSuffix(ref, "/") ||
+		strings.HasSuffix(ref, ".lock")) {
+		return fmt.Errorf("invalid ref %q", ref)
+	}
+	if commitSHA != "" && !commitSHAPattern.MatchString(commitSHA) {
+		return fmt.Errorf("invalid commit_sha %q", commitSHA)
+	}
+	return nil
+}
+
+// pipelineSource picks the project repository when there is one, else the exported workspace
+func pipelineSource(project *projects.Project) (string, *utils.ServiceError) {
+	if strings.TrimSpace(project.RepoURL) != "" {
+		return SourceRepository, nil
+	}
+	if _, err := os.Stat(filepath.Join("public", project.Name+".zip")); err != nil {
+		return "", &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    "project has no repository and no exported workspace to run a pipeline on",
+			Err:        err,
+		}
+	}
+	return SourceWorkspace, nil
+}
+
+func createPipelineRecord(pipeline *ci.CiPipeline) *utils.ServiceError {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(pipeline).Error; err != nil {
+			return err
+		}
+		pipeline.LogURL = fmt.Sprintf("/api/v1/pipelines/%s", pipeline.ID)
+		return tx.Model(pipeline).Update("log_url", pipeline.LogURL).Error
+	})
+	if err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to create pipeline",
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+func toPipelineResponse(p ci.CiPipeline, steps []ci.PipelineStep) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":           p.ID,
+		"project_id":   p.ProjectID,
+		"provider":     p.Provider,
+		"status":       p.Status,
+		"trigger":      p.Trigger,
+		"source":       p.Source,
+		"ref":          p.Ref,
+		"commit_sha":   p.CommitSHA,
+		"log_url":      p.LogURL,
+		"rerun_of":     uuidOrNil(p.RerunOfID),
+		"failure":      p.FailureReason,
+		"triggered_by": p.UpdatedBy,
+		"started_at":   timeOrNil(p.StartedAt),
+		"finished_at":  timeOrNil(p.FinishedAt),
+		"created_at":   p.CreatedAt,
+		"updated_at":   p.UpdatedAt,
+	}
+	if steps != nil {
+		list := make([]map[string]interface{}, 0, len(steps))
+		for _, step := range steps {
+			list = append(list, toStepResponse(step))
+		}
+		response["steps"] = list
+	}
+	return response
+}
+
+func toStepResponse(s ci.PipelineStep) map[string]interface{} {
+	artifacts := []string{}
+	if err := json.Unmarshal([]byte(s.Artifacts), &artifacts); err != nil {
+		artifacts = []string{}
+	}
+	return map[string]interface{}{
+		"id":           s.ID,
+		"cell_id":      uuidOrNil(s.CellID),
+		"name":         s.Name,
+		"position":     s.Position,
+		"status":       s.Status,
+		"command":      s.Command,
+		"exit_code":    s.ExitCode,
+		"artifacts":    artifacts,
+		"log":          s.Log,
+		"started_at":   timeOrNil(s.StartedAt),
+		"completed_at": timeOrNil(s.CompletedAt),
+	}
+}
+
+func toCellResponse(c ci.PipelineCell) map[string]interface{} {
+	values := map[string]string{}
+	if err := json.Unmarshal([]byte(c.Values), &values); err != nil {
+		values = map[string]string{}
+	}
+	return map[string]interface{}{
+		"id":          c.ID,
+		"name":        c.Name,
+		"position":    c.Position,
+		"values":      values,
+		"status":      c.Status,
+		"started_at":  timeOrNil(c.StartedAt),
+		"finished_at": timeOrNil(c.FinishedAt),
+	}
+}
+
+func uuidOrNil(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
+func timeOrNil(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
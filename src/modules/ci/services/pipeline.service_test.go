@@ -0,0 +1,84 @@
+package ci
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusPending, StatusRunning, true},
+		{StatusPending, StatusFailed, true},
+		{StatusPending, StatusCancelled, true},
+		{StatusPending, StatusSkipped, true},
+		{StatusPending, StatusSucceeded, false},
+		{StatusRunning, StatusSucceeded, true},
+		{StatusRunning, StatusFailed, true},
+		{StatusRunning, StatusCancelled, true},
+		{StatusRunning, StatusSkipped, false},
+		{StatusRunning, StatusPending, false},
+		{StatusSucceeded, StatusRunning, false},
+		{StatusFailed, StatusPending, false},
+		{StatusCancelled, StatusRunning, false},
+		{StatusSkipped, StatusRunning, false},
+		{"unknown", StatusRunning, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestIsTerminalStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{StatusPending, false},
+		{StatusRunning, false},
+		{StatusSucceeded, true},
+		{StatusFailed, true},
+		{StatusCancelled, true},
+		{StatusSkipped, true},
+	}
+	for _, tt := range tests {
+		if got := IsTerminalStatus(tt.status); got != tt.want {
+			t.Errorf("IsTerminalStatus(%s) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRevision(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       string
+		commitSHA string
+		wantErr   bool
+	}{
+		{"nothing", "", "", false},
+		{"branch", "main", "", false},
+		{"nested branch", "feature/login-v2", "", false},
+		{"tag", "v1.2.0", "", false},
+		{"short sha", "", "a1b2c3d", false},
+		{"full sha", "main", "0123456789abcdef0123456789abcdef01234567", false},
+		{"option", "--upload-pack=sh", "", true},
+		{"leading dot", ".hidden", "", true},
+		{"parent traversal", "main/../x", "", true},
+		{"trailing slash", "feature/", "", true},
+		{"lock file", "main.lock", "", true},
+		{"whitespace", "main branch", "", true},
+		{"refspec", "main:refs/heads/x", "", true},
+		{"sha too short", "", "a1b2c3", true},
+		{"sha not hex", "", "g1b2c3d4", true},
+		{"sha option", "", "--all", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRevision(tt.ref, tt.commitSHA)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateRevision(%q, %q) error = %v, wantErr %v", tt.ref, tt.commitSHA, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package ci
+
+import (
+	"context"
+	"deva/src/config"
+	"deva/src/lib/dto"
+	deployments "deva/src/modules/deployments/services"
+	projects "deva/src/modules/projects/models"
+	"deva/src/utils"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// repoURLSchemes are the transports checkoutRepository lets git use
+var repoURLSchemes = map[string]bool{"https": true, "ssh": true}
+
+// repoHostLookupTimeout bounds the DNS lookup of a repository host
+const repoHostLookupTimeout = 5 * time.Second
+
+// lookupRepoHost resolves the host of a repository URL
+var lookupRepoHost = net.DefaultResolver.LookupIPAddr
+
+// SetProjectRepository sets the repository pipelines of the project check out. An empty repo_url
+// removes it, and pipelines go back to the exported workspace.
+func SetProjectRepository(userID, projectID uuid.UUID, request dto.SetProjectRepositoryRequest) (map[string]interface{}, *utils.ServiceError) {
+	project, serviceErr := deployments.GetAccessibleProject(userID, projectID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	repoURL := strings.TrimSpace(request.RepoURL)
+	if repoURL != "" {
+		if err := validateRepoURL(context.Background(), repoURL); err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusBadRequest,
+				Message:    err.Error(),
+				Err:        err,
+			}
+		}
+	}
+
+	if err := config.DB.Model(&projects.Project{}).Where("id = ?", project.ID).
+		Updates(map[string]interface{}{"repo_url": repoURL, "updated_by": userID}).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to update project repository",
+			Err:        err,
+		}
+	}
+
+	source := SourceWorkspace
+	if repoURL != "" {
+		source = SourceRepository
+	}
+	return map[string]interface{}{
+		"project_id": project.ID,
+		"repo_url":   redactURL(repoURL),
+		"source":     source,
+	}, nil
+}
+
+// Helper Functions
+
+// validateRepoURL accepts absolute https and ssh URLs. Local paths, file:// and the other git
+// transports are refused, and so are hosts that are or resolve to loopback, private, link-local
+// or unspecified addresses of the API host, which git would otherwise fetch from on the user's
+// behalf. It runs again right before each clone, as the records of the host can change.
+func validateRepoURL(ctx context.Context, repoURL string) error {
+	if strings.ContainsAny(repoURL, " \t\r\n") {
+		return errors.New("repo_url cannot contain whitespace")
+	}
+	parsed, err := url.Parse(repoURL)
+	if err != nil || !parsed.IsAbs() || parsed.Opaque != "" {
+		return fmt.Errorf("repo_url must be an absolute URL such as https://github.com/org/repo.git, got %q", redactURL(repoURL))
+	}
+	if !repoURLSchemes[strings.ToLower(parsed.Scheme)] {
+		return fmt.Errorf("repo_url must use https or ssh, got %q", parsed.Scheme)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return errors.New("repo_url cannot have a query or a fragment")
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if host == "" || strings.TrimPrefix(parsed.Path, "/") == "" {
+		return errors.New("repo_url needs a host and a repository path")
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("repo_url host %s is not allowed", host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if internalIP(ip) {
+			return fmt.Errorf("repo_url host %s is not allowed", host)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, repoHostLookupTimeout)
+	defer cancel()
+	addrs, err := lookupRepoHost(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("repo_url host %s cannot be resolved", host)
+	}
+	for _, addr := range addrs {
+		if internalIP(addr.IP) {
+			return fmt.Errorf("repo_url host %s resolves to %s, which is not allowed", host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// internalIP reports whether ip is a loopback, private, link-local or unspecified address
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
@@ -0,0 +1,1221 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"deva/src/config"
+	"deva/src/lib/pipeline"
+	ci "deva/src/modules/ci/models"
+	deployments "deva/src/modules/deployments/services"
+	projects "deva/src/modules/projects/models"
+	secrets "deva/src/modules/secrets/models"
+	"deva/src/services"
+	"deva/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	checkoutStepName  = "checkout"
+	saveCacheStepName = "save cache"
+	checkoutTimeout   = 10 * time.Minute
+	// stepKillGrace is how long the output of a finished step container may take to drain
+	stepKillGrace    = 10 * time.Second
+	logFlushInterval = time.Second
+	logFlushLines    = 25
+	maxStepLogBytes  = 4 * 1024 * 1024
+	// Pipelines beyond CI_MAX_PARALLEL_PIPELINES wait in pending
+	defaultParallelPipelines = 2
+)
+
+var (
+	runningPipelines = make(map[uuid.UUID]context.CancelFunc)
+	runningMutex     sync.Mutex
+	runnerSlots      chan struct{}
+	runnerSlotsOnce  sync.Once
+
+	errPipelineCancelled = errors.New("pipeline cancelled")
+	// Only these variables of the server environment reach the steps
+	passthroughEnv = []string{"LANG", "TZ", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "GOPROXY", "GOSUMDB"}
+)
+
+// runContext is everything the runner needs to run the steps of one pipeline
+type runContext struct {
+	pipeline   *ci.CiPipeline
+	project    *projects.Project
+	definition *pipeline.Definition
+	workspace  string
+	home       string
+	secrets    map[string]string
+	masker     *strings.Replacer
+	// goroot is the Go toolchain of the pipeline, when it asks for one
+	goroot string
+	// goModCache is restored from the key, or saved under it after a successful run on a miss
+	goModCache    string
+	goModulesKey  string
+	goModulesSave bool
+	// matrix holds the values of the cell the context runs, recorded as cell; nil without a matrix
+	matrix pipeline.Cell
+	cell   *ci.PipelineCell
+	// cells run the steps of a matrix pipeline, each in a workspace and home of its own
+	cells   []*runContext
+	cleanup func()
+}
+
+// RecoverInterruptedPipelines fails pipelines left unfinished by a previous server process
+func RecoverInterruptedPipelines() {
+	var interrupted []ci.CiPipeline
+	if err := config.DB.Select("id", "status").
+		Where("status IN ?", []string{StatusPending, StatusRunning}).
+		Find(&interrupted).Error; err != nil {
+		log.Printf("⚠️ Failed to load interrupted pipelines: %v", err)
+		return
+	}
+
+	for i := range interrupted {
+		p := &interrupted[i]
+		if err := transitionPipeline(p, StatusFailed); err != nil {
+			continue
+		}
+		recordFailure(p.ID, "interrupted by a server restart")
+
+		var steps []ci.PipelineStep
+		if err := config.DB.Omit("log").Where("pipeline_id = ? AND status IN ?", p.ID, []string{StatusPending, StatusRunning}).
+			Find(&steps).Error; err != nil {
+			log.Printf("⚠️ Failed to load the steps of pipeline %s: %v", p.ID, err)
+			continue
+		}
+		for j := range steps {
+			if steps[j].Status == StatusPending {
+				_ = transitionStep(&steps[j], StatusSkipped, nil)
+				continue
+			}
+			removeInterruptedStepContainer(steps[j].ID)
+			appendStepLog(steps[j].ID, "❌ Interrupted by a server restart")
+			_ = transitionStep(&steps[j], StatusFailed, nil)
+		}
+
+		var cells []ci.PipelineCell
+		if err := config.DB.Where("pipeline_id = ? AND status IN ?", p.ID, []string{StatusPending, StatusRunning}).
+			Find(&cells).Error; err != nil {
+			log.Printf("⚠️ Failed to load the matrix cells of pipeline %s: %v", p.ID, err)
+			continue
+		}
+		for j := range cells {
+			if cells[j].Status == StatusPending {
+				_ = transitionCell(&cells[j], StatusSkipped)
+				continue
+			}
+			_ = transitionCell(&cells[j], StatusFailed)
+		}
+	}
+}
+
+// startPipeline runs a pending pipeline in the background once a runner slot is free
+func startPipeline(pipelineID uuid.UUID) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runningMutex.Lock()
+	runningPipelines[pipelineID] = cancel
+	runningMutex.Unlock()
+
+	go func() {
+		defer func() {
+			runningMutex.Lock()
+			delete(runningPipelines, pipelineID)
+			runningMutex.Unlock()
+			cancel()
+		}()
+
+		slots := pipelineSlots()
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		case <-ctx.Done():
+			return
+		}
+		runPipeline(ctx, pipelineID)
+	}()
+}
+
+// stopPipeline aborts the running step of a pipeline
+func stopPipeline(pipelineID uuid.UUID) {
+	runningMutex.Lock()
+	cancel, ok := runningPipelines[pipelineID]
+	runningMutex.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+func runPipeline(ctx context.Context, pipelineID uuid.UUID) {
+	var p ci.CiPipeline
+	if err := config.DB.Omit("definition").First(&p, "id = ?", pipelineID).Error; err != nil {
+		log.Printf("⚠️ Failed to load pipeline %s: %v", pipelineID, err)
+		return
+	}
+	if err := transitionPipeline(&p, StatusRunning); err != nil {
+		if !errors.Is(err, errPipelineCancelled) {
+			log.Printf("⚠️ Failed to start pipeline %s: %v", p.ID, err)
+		}
+		return
+	}
+
+	err := executePipeline(ctx, &p)
+	switch {
+	case err == nil:
+		if err := transitionPipeline(&p, StatusSucceeded); err != nil && !errors.Is(err, errPipelineCancelled) {
+			log.Printf("⚠️ Failed to complete pipeline %s: %v", p.ID, err)
+		}
+	case errors.Is(err, errPipelineCancelled) || errors.Is(ctx.Err(), context.Canceled):
+		// CancelPipeline already recorded the final status
+	default:
+		recordFailure(p.ID, err.Error())
+		if err := transitionPipeline(&p, StatusFailed); err != nil && !errors.Is(err, errPipelineCancelled) {
+			log.Printf("⚠️ Failed to mark pipeline %s as failed: %v", p.ID, err)
+		}
+	}
+}
+
+// executePipeline checks the source out, then runs the steps of its pipeline file in order, once
+// per matrix cell when it has a matrix. A failed step skips the ones after it unless it continues
+// on error.
+func executePipeline(ctx context.Context, p *ci.CiPipeline) error {
+	var project projects.Project
+	if err := config.DB.First(&project, "id = ?", p.ProjectID).Error; err != nil {
+		return fmt.Errorf("failed to load project: %w", err)
+	}
+
+	checkout, err := createSteps(p, []ci.PipelineStep{{Name: checkoutStepName, Command: checkoutCommand(p, &project)}})
+	if err != nil {
+		return err
+	}
+	rc, err := runCheckout(ctx, p, &project, &checkout[0])
+	if err != nil {
+		return err
+	}
+	defer rc.cleanup()
+
+	ctx, cancel := context.WithTimeout(ctx, rc.definition.PipelineTimeout())
+	defer cancel()
+
+	if rc.definition.HasMatrix() {
+		return runMatrix(ctx, rc)
+	}
+
+	steps, err := createSteps(p, planSteps(rc, 1))
+	if err != nil {
+		return err
+	}
+	failed := runSteps(ctx, rc, steps)
+	if failed == nil && rc.goModulesSave {
+		runSaveCache(ctx, rc, len(steps)+1)
+	}
+	return failed
+}
+
+// runSteps runs the steps of a pipeline or of one matrix cell in order and returns why they
+// failed, if they did
+func runSteps(ctx context.Context, rc *runContext, steps []ci.PipelineStep) error {
+	var failed error
+	for i := range steps {
+		if failed != nil || ctx.Err() != nil {
+			_ = transitionStep(&steps[i], StatusSkipped, nil)
+			continue
+		}
+		err := runStep(ctx, rc, &steps[i], rc.definition.Steps[i])
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			failed = ctx.Err()
+			if errors.Is(failed, context.DeadlineExceeded) {
+				failed = fmt.Errorf("timed out after %s", rc.definition.PipelineTimeout())
+			}
+		case rc.definition.Steps[i].ContinueOnError:
+			appendStepLog(steps[i].ID, "↪️ continue_on_error is set, the pipeline goes on")
+		default:
+			failed = fmt.Errorf("step %q failed: %w", steps[i].Name, err)
+		}
+	}
+	return failed
+}
+
+// runMatrix runs the matrix cells side by side, at most max_parallel at once. With fail_fast, the
+// first failed cell cancels the running ones and skips those that have not started.
+func runMatrix(ctx context.Context, rc *runContext) error {
+	cellSteps := make([][]ci.PipelineStep, len(rc.cells))
+	position := 1
+	for i, cellRC := range rc.cells {
+		cell, err := createCell(rc.pipeline, cellRC.matrix, i+1)
+		if err != nil {
+			return err
+		}
+		cellRC.cell = cell
+		if cellSteps[i], err = createSteps(rc.pipeline, planSteps(cellRC, position)); err != nil {
+			return err
+		}
+		position += len(cellSteps[i])
+	}
+
+	names := make([]string, len(rc.cells))
+	for i, cellRC := range rc.cells {
+		names[i] = cellRC.cell.Name
+	}
+	errs := scheduleCells(ctx, names, rc.definition.MaxParallel(), rc.definition.FailFast(),
+		func(cellCtx context.Context, i int) error { return runCell(cellCtx, rc.cells[i], cellSteps[i]) },
+		func(i int) { skipCell(rc.cells[i].cell, cellSteps[i]) })
+
+	var failures []string
+	for i, err := range errs {
+		// Cells cancelled by fail_fast are not failures of their own
+		if err == nil || errors.Is(err, context.Canceled) && ctx.Err() == nil {
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("cell %s: %v", rc.cells[i].cell.Name, err))
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d matrix cells failed: %s", len(failures), len(rc.cells), strings.Join(failures, "; "))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Every cell restored the same module cache, one of them saves it
+	for _, cellRC := range rc.cells {
+		if cellRC.goModulesSave {
+			runSaveCache(ctx, cellRC, position)
+			break
+		}
+	}
+	return nil
+}
+
+// scheduleCells runs the cells named by names, at most maxParallel at once, and returns the error
+// of each. With failFast, the first failed cell cancels the context of the running ones and skip
+// is called for those that have not started.
+func scheduleCells(ctx context.Context, names []string, maxParallel int, failFast bool, run func(context.Context, int) error, skip func(int)) []error {
+	cellCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	slots := make(chan struct{}, maxParallel)
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		// A free slot must not win over a cancellation that already happened
+		if cellCtx.Err() != nil {
+			skip(i)
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-cellCtx.Done():
+			skip(i)
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = run(cellCtx, i)
+			if errs[i] != nil && failFast {
+				cancel(fmt.Errorf("cell %s failed and fail_fast is set", names[i]))
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// runCell runs the steps of one matrix cell and records the outcome on the cell
+func runCell(ctx context.Context, rc *runContext, steps []ci.PipelineStep) error {
+	if err := transitionCell(rc.cell, StatusRunning); err != nil {
+		return err
+	}
+	err := runSteps(ctx, rc, steps)
+
+	status := StatusSucceeded
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Err(), context.Canceled):
+		status = StatusCancelled
+	default:
+		status = StatusFailed
+	}
+	if transitionErr := transitionCell(rc.cell, status); transitionErr != nil {
+		log.Printf("⚠️ Failed to finish cell %s of pipeline %s: %v", rc.cell.ID, rc.pipeline.ID, transitionErr)
+	}
+	return err
+}
+
+// skipCell marks a cell that never started as skipped, with its steps
+func skipCell(cell *ci.PipelineCell, steps []ci.PipelineStep) {
+	for i := range steps {
+		_ = transitionStep(&steps[i], StatusSkipped, nil)
+	}
+	_ = transitionCell(cell, StatusSkipped)
+}
+
+// runCheckout prepares the workspace, reads the pipeline file and resolves its secrets, logging
+// to the checkout step
+func runCheckout(ctx context.Context, p *ci.CiPipeline, project *projects.Project, step *ci.PipelineStep) (*runContext, error) {
+	if err := transitionStep(step, StatusRunning, nil); err != nil {
+		return nil, err
+	}
+	logger := newStepLogger(step.ID)
+
+	checkoutCtx, cancel := context.WithTimeout(ctx, checkoutTimeout)
+	defer cancel()
+	rc, err := prepareRun(checkoutCtx, p, project, logger)
+
+	status := StatusSucceeded
+	switch {
+	case err == nil && len(rc.cells) > 0:
+		logger.Write(fmt.Sprintf("📋 %d steps in %s, in %d matrix cells", len(rc.definition.Steps), pipeline.DefaultPath, len(rc.cells)))
+	case err == nil:
+		logger.Write(fmt.Sprintf("📋 %d steps in %s", len(rc.definition.Steps), pipeline.DefaultPath))
+	case errors.Is(ctx.Err(), context.Canceled):
+		status = StatusCancelled
+		logger.Write("🛑 Cancelled")
+	default:
+		status = StatusFailed
+		if errors.Is(checkoutCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("checkout timed out after %s", checkoutTimeout)
+		}
+		logger.Write(fmt.Sprintf("❌ %v", err))
+	}
+	logger.Close()
+
+	if transitionErr := transitionStep(step, status, nil); transitionErr != nil {
+		log.Printf("⚠️ Failed to finish checkout of pipeline %s: %v", p.ID, transitionErr)
+	}
+	if err != nil {
+		if rc != nil {
+			rc.cleanup()
+		}
+		return nil, err
+	}
+	return rc, nil
+}
+
+func prepareRun(ctx context.Context, p *ci.CiPipeline, project *projects.Project, logger *stepLogger) (*runContext, error) {
+	rc := &runContext{pipeline: p, project: project, cleanup: func() {}}
+
+	home, err := os.MkdirTemp("", "deva-ci-home-")
+	if err != nil {
+		return nil, err
+	}
+	rc.cleanup = func() { removeTree(home) }
+	rc.home = home
+
+	switch p.Source {
+	case SourceRepository:
+		workspace, err := os.MkdirTemp("", "deva-ci-"+p.ID.String()[:8]+"-")
+		if err != nil {
+			return rc, err
+		}
+		rc.cleanup = func() { removeTree(home); removeTree(workspace) }
+		rc.workspace = workspace
+
+		commitSHA, err := checkoutRepository(ctx, project.RepoURL, p.Ref, p.CommitSHA, workspace, home, logger)
+		if err != nil {
+			return rc, err
+		}
+		p.CommitSHA = commitSHA
+		if err := config.DB.Model(&ci.CiPipeline{}).Where("id = ?", p.ID).Update("commit_sha", commitSHA).Error; err != nil {
+			return rc, fmt.Errorf("failed to record commit: %w", err)
+		}
+		logger.Write(fmt.Sprintf("✔ Checked out %s", commitSHA))
+	default:
+		workspace, cleanup, err := deployments.ExtractProjectArchive(project.Name)
+		if err != nil {
+			return rc, err
+		}
+		rc.cleanup = func() { removeTree(home); cleanup() }
+		rc.workspace = workspace
+		logger.Write(fmt.Sprintf("📦 Extracted the exported workspace of %s", project.Name))
+	}
+
+	content, err := os.ReadFile(filepath.Join(rc.workspace, filepath.FromSlash(pipeline.DefaultPath)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return rc, fmt.Errorf("%s not found in the %s", pipeline.DefaultPath, p.Source)
+		}
+		return rc, err
+	}
+	if err := config.DB.Model(&ci.CiPipeline{}).Where("id = ?", p.ID).Update("definition", string(content)).Error; err != nil {
+		return rc, fmt.Errorf("failed to record the pipeline file: %w", err)
+	}
+	p.Definition = string(content)
+	if rc.definition, err = pipeline.Parse(content); err != nil {
+		return rc, fmt.Errorf("invalid %s: %w", pipeline.DefaultPath, err)
+	}
+
+	if rc.secrets, err = loadBuildSecrets(project.ID, rc.definition.AllSecrets()); err != nil {
+		return rc, err
+	}
+	rc.masker = secretMasker(rc.secrets)
+
+	if rc.definition.HasMatrix() {
+		return rc, prepareCells(ctx, rc, logger)
+	}
+	if err := prepareCaches(ctx, rc, logger); err != nil {
+		return rc, err
+	}
+	return rc, nil
+}
+
+// prepareCells gives every matrix cell a copy of the checked out workspace, a home of its own and
+// its toolchains and caches
+func prepareCells(ctx context.Context, rc *runContext, logger *stepLogger) error {
+	cleanup := rc.cleanup
+	rc.cleanup = func() {
+		for _, cellRC := range rc.cells {
+			cellRC.cleanup()
+		}
+		cleanup()
+	}
+
+	for _, cell := range rc.definition.Cells() {
+		definition, err := rc.definition.ForCell(cell)
+		if err != nil {
+			return err
+		}
+		cellRC := &runContext{
+			pipeline:   rc.pipeline,
+			project:    rc.project,
+			definition: definition,
+			secrets:    rc.secrets,
+			masker:     rc.masker,
+			matrix:     cell,
+			cleanup:    func() {},
+		}
+		rc.cells = append(rc.cells, cellRC)
+
+		home, err := os.MkdirTemp("", "deva-ci-home-")
+		if err != nil {
+			return err
+		}
+		cellRC.cleanup = func() { removeTree(home) }
+		cellRC.home = home
+		workspace, err := os.MkdirTemp("", "deva-ci-"+rc.pipeline.ID.String()[:8]+"-")
+		if err != nil {
+			return err
+		}
+		cellRC.cleanup = func() { removeTree(home); removeTree(workspace) }
+		cellRC.workspace = workspace
+		if err := copyTree(rc.workspace, workspace); err != nil {
+			return fmt.Errorf("failed to copy the workspace of cell %s: %w", cell.Label(), err)
+		}
+
+		logger.Write(fmt.Sprintf("🧩 Preparing cell %s", cell.Label()))
+		if err := prepareCaches(ctx, cellRC, logger); err != nil {
+			return fmt.Errorf("cell %s: %w", cell.Label(), err)
+		}
+	}
+	return nil
+}
+
+// prepareCaches provisions the toolchains of the pipeline and restores its dependency caches
+func prepareCaches(ctx context.Context, rc *runContext, logger *stepLogger) error {
+	cleanup := rc.cleanup
+	if version := rc.definition.Toolchains.Go; version != "" {
+		goroot, release, err := provisionGoToolchain(ctx, version, logger)
+		if err != nil {
+			return fmt.Errorf("failed to provision Go %s: %w", version, err)
+		}
+		rc.goroot = goroot
+		rc.cleanup = func() { release(); cleanup() }
+	}
+
+	if rc.definition.Cache.GoModules {
+		rc.goModCache = filepath.Join(rc.home, "go", "pkg", "mod")
+		key, err := goModulesCacheKey(rc.project.ID, rc.workspace)
+		if err != nil {
+			return fmt.Errorf("failed to compute the module cache key: %w", err)
+		}
+		if key == "" {
+			logger.Write("ℹ️ No go.sum in the workspace, the module cache is not used")
+			return nil
+		}
+		rc.goModulesKey = key
+		hit, err := restoreCache(key, rc.goModCache, logger)
+		if err != nil {
+			// A broken cache only costs a download
+			logger.Write(fmt.Sprintf("⚠️ Failed to restore the module cache: %v", err))
+			removeTree(rc.goModCache)
+		}
+		rc.goModulesSave = !hit
+		if !hit && err == nil {
+			logger.Write("ℹ️ No module cache for this go.sum yet, it is saved after a successful run")
+		}
+	}
+	return nil
+}
+
+// runSaveCache saves the dependency caches in a step of its own. Failing to save is logged and
+// does not fail the pipeline.
+func runSaveCache(ctx context.Context, rc *runContext, position int) {
+	steps, err := createSteps(rc.pipeline, []ci.PipelineStep{{Name: saveCacheStepName, Position: position, Command: "save GOMODCACHE"}})
+	if err != nil {
+		log.Printf("⚠️ Failed to save the caches of pipeline %s: %v", rc.pipeline.ID, err)
+		return
+	}
+	step := &steps[0]
+	if ctx.Err() != nil {
+		_ = transitionStep(step, StatusSkipped, nil)
+		return
+	}
+	if err := transitionStep(step, StatusRunning, nil); err != nil {
+		return
+	}
+	logger := newStepLogger(step.ID)
+	if err := saveCache(rc.project.ID, CacheKindGoModules, rc.goModulesKey, rc.goModCache, logger); err != nil {
+		logger.Write(fmt.Sprintf("⚠️ Failed to save the module cache: %v", err))
+	}
+	logger.Close()
+	if err := transitionStep(step, StatusSucceeded, nil); err != nil {
+		log.Printf("⚠️ Failed to finish step %s of pipeline %s: %v", step.ID, rc.pipeline.ID, err)
+	}
+}
+
+// checkoutRepository fetches one commit of the repository, the requested one or else the tip of
+// ref or of the default branch, and returns its SHA
+func checkoutRepository(ctx context.Context, repoURL, ref, commitSHA, dir, home string, logger *stepLogger) (string, error) {
+	revision := commitSHA
+	if revision == "" {
+		revision = ref
+	}
+	if revision == "" {
+		revision = "HEAD"
+	}
+	logger.Write(fmt.Sprintf("📥 Fetching %s from %s", revision, redactURL(repoURL)))
+	if err := validateRepoURL(ctx, repoURL); err != nil {
+		return "", err
+	}
+
+	commands := [][]string{
+		{"init", "-q"},
+		{"remote", "add", "origin", repoURL},
+		{"fetch", "--depth", "1", "--no-tags", "origin", revision},
+		{"checkout", "-q", "--detach", "FETCH_HEAD"},
+	}
+	for _, args := range commands {
+		if _, err := runGit(ctx, dir, home, args...); err != nil {
+			if args[0] == "fetch" {
+				logger.Write(strings.ReplaceAll(err.Error(), repoURL, redactURL(repoURL)))
+				return "", fmt.Errorf("failed to fetch %s", revision)
+			}
+			return "", err
+		}
+	}
+
+	head, err := runGit(ctx, dir, home, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	head = strings.TrimSpace(head)
+	if commitSHA != "" && !strings.HasPrefix(head, commitSHA) {
+		return "", fmt.Errorf("fetched commit %s instead of %s", head, commitSHA)
+	}
+	return head, nil
+}
+
+// runStep runs the script of a step with bash in its working directory, in a container of its
+// own, and records the outcome.
+// The error is set when the step did not succeed.
+func runStep(ctx context.Context, rc *runContext, step *ci.PipelineStep, def pipeline.Step) error {
+	if err := transitionStep(step, StatusRunning, nil); err != nil {
+		return err
+	}
+	logger := newStepLogger(step.ID)
+	startTime := time.Now()
+
+	timeout := rc.definition.StepTimeout(def)
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dir := filepath.Join(rc.workspace, filepath.FromSlash(def.WorkingDirectory))
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		err = fmt.Errorf("working directory %s does not exist", def.WorkingDirectory)
+		logger.Write(fmt.Sprintf("❌ %v", err))
+		logger.Close()
+		_ = transitionStep(step, StatusFailed, nil)
+		return err
+	}
+	if err := downloadArtifacts(rc, def.DownloadArtifacts, logger); err != nil {
+		logger.Write(fmt.Sprintf("❌ %v", err))
+		logger.Close()
+		_ = transitionStep(step, StatusFailed, nil)
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimRight(def.Run, "\n"), "\n") {
+		logger.Write("$ " + line)
+	}
+
+	output := &stepOutput{logger: logger, masker: rc.masker}
+	exitCode, runErr := runStepContainer(stepCtx, rc, step.ID, def.WorkingDirectory, rc.stepEnv(step, def), def.Run, output)
+	output.Close()
+
+	extra := map[string]interface{}{}
+	if runErr == nil {
+		extra["exit_code"] = exitCode
+		if exitCode != 0 {
+			runErr = fmt.Errorf("exit status %d", exitCode)
+		}
+	}
+	elapsed := time.Since(startTime).Round(time.Millisecond)
+
+	status, stepErr := StatusSucceeded, runErr
+	switch {
+	case runErr == nil:
+		artifacts, err := uploadArtifacts(rc, step, def, true, logger)
+		if encoded, err := json.Marshal(artifacts); err == nil {
+			extra["artifacts"] = string(encoded)
+		}
+		if err != nil {
+			status, stepErr = StatusFailed, err
+			logger.Write(fmt.Sprintf("❌ Failed to upload the artifacts: %v", err))
+			break
+		}
+		logger.Write(fmt.Sprintf("✅ Step succeeded in %s", elapsed))
+	case errors.Is(ctx.Err(), context.Canceled):
+		status = StatusCancelled
+		if cause := context.Cause(ctx); !errors.Is(cause, context.Canceled) {
+			// A matrix cell cancelled by fail_fast
+			logger.Write(fmt.Sprintf("🛑 Cancelled: %v", cause))
+		} else {
+			logger.Write("🛑 Cancelled")
+		}
+	case ctx.Err() != nil:
+		status = StatusFailed
+		logger.Write(fmt.Sprintf("⏱️ The pipeline timed out after %s", rc.definition.PipelineTimeout()))
+	case errors.Is(stepCtx.Err(), context.DeadlineExceeded):
+		status, stepErr = StatusFailed, fmt.Errorf("timed out after %s", timeout)
+		logger.Write(fmt.Sprintf("⏱️ Step timed out after %s", timeout))
+	default:
+		status = StatusFailed
+		logger.Write(fmt.Sprintf("❌ Step failed after %s: %v", elapsed, runErr))
+	}
+	if runErr != nil && ctx.Err() == nil {
+		// Reports of failed steps, like test results, are kept when the artifact asks for it
+		artifacts, err := uploadArtifacts(rc, step, def, false, logger)
+		if err != nil {
+			logger.Write(fmt.Sprintf("⚠️ Failed to upload the artifacts: %v", err))
+		}
+		if encoded, err := json.Marshal(artifacts); err == nil && len(artifacts) > 0 {
+			extra["artifacts"] = string(encoded)
+		}
+	}
+	logger.Close()
+
+	if err := transitionStep(step, status, extra); err != nil {
+		log.Printf("⚠️ Failed to finish step %s of pipeline %s: %v", step.ID, rc.pipeline.ID, err)
+	}
+	return stepErr
+}
+
+// stepEnv builds the environment of a step container from scratch, so server configuration does
+// not leak into pipelines
+func (rc *runContext) stepEnv(step *ci.PipelineStep, def pipeline.Step) []string {
+	env := map[string]string{"PATH": containerPath}
+	for _, name := range passthroughEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+	env["HOME"] = containerHome
+	env["CI"] = "true"
+	if rc.goroot != "" {
+		env["PATH"] = path.Join(containerGoroot, "bin") + ":" + env["PATH"]
+		env["GOROOT"] = containerGoroot
+		env["GOTOOLCHAIN"] = "local"
+	}
+	if rc.goModCache != "" {
+		rel, _ := filepath.Rel(rc.home, rc.goModCache)
+		env["GOMODCACHE"] = path.Join(containerHome, filepath.ToSlash(rel))
+		// Writable module files can be cached and cleaned up; the pipeline env may override it
+		env["GOFLAGS"] = "-modcacherw"
+	}
+	for key, value := range rc.definition.Env {
+		env[key] = value
+	}
+	for key, value := range def.Env {
+		env[key] = value
+	}
+	for _, name := range rc.definition.StepSecrets(def) {
+		env[name] = rc.secrets[name]
+	}
+	env["DEVA_PIPELINE_ID"] = rc.pipeline.ID.String()
+	env["DEVA_STEP_NAME"] = step.Name
+	env["DEVA_PROJECT_ID"] = rc.project.ID.String()
+	env["DEVA_PROJECT_NAME"] = rc.project.Name
+	env["DEVA_COMMIT_SHA"] = rc.pipeline.CommitSHA
+	env["DEVA_REF"] = rc.pipeline.Ref
+	env["DEVA_WORKSPACE"] = containerWorkspace
+	for _, value := range rc.matrix {
+		env["DEVA_MATRIX_"+strings.ToUpper(value.Axis)] = value.Value
+	}
+
+	list := make([]string, 0, len(env))
+	for key, value := range env {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// transitionPipeline moves a pipeline to a new status. The update only applies if nobody changed
+// the status in the meantime; a lost race can only be a cancellation.
+func transitionPipeline(p *ci.CiPipeline, to string) error {
+	if !CanTransition(p.Status, to) {
+		return fmt.Errorf("invalid pipeline transition %s → %s", p.Status, to)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": to}
+	starting := p.Status == StatusPending && !IsTerminalStatus(to)
+	if starting {
+		updates["started_at"] = now
+	}
+	if IsTerminalStatus(to) {
+		updates["finished_at"] = now
+	}
+
+	result := config.DB.Model(&ci.CiPipeline{}).
+		Where("id = ? AND status = ?", p.ID, p.Status).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errPipelineCancelled
+	}
+
+	p.Status = to
+	if starting {
+		p.StartedAt = now
+	}
+	if IsTerminalStatus(to) {
+		p.FinishedAt = now
+	}
+	return nil
+}
+
+// transitionStep moves a step to a new status along with extra columns, like its exit code
+func transitionStep(step *ci.PipelineStep, to string, extra map[string]interface{}) error {
+	if !CanTransition(step.Status, to) {
+		return fmt.Errorf("invalid step transition %s → %s", step.Status, to)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": to}
+	for column, value := range extra {
+		updates[column] = value
+	}
+	if to == StatusRunning {
+		updates["started_at"] = now
+	}
+	if IsTerminalStatus(to) && step.Status == StatusRunning {
+		updates["completed_at"] = now
+	}
+
+	result := config.DB.Model(&ci.PipelineStep{}).
+		Where("id = ? AND status = ?", step.ID, step.Status).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("step %s is no longer %s", step.ID, step.Status)
+	}
+
+	if to == StatusRunning {
+		step.StartedAt = now
+	}
+	if IsTerminalStatus(to) && step.Status == StatusRunning {
+		step.CompletedAt = now
+	}
+	step.Status = to
+	appendStepLog(step.ID, statusLogPrefix+to)
+	if IsTerminalStatus(to) {
+		store.CloseEventStream(stepStreamKey(step.ID), to)
+	} else {
+		store.PublishStatus(stepStreamKey(step.ID), to)
+	}
+	return nil
+}
+
+// transitionCell moves a matrix cell to a new status
+func transitionCell(cell *ci.PipelineCell, to string) error {
+	if !CanTransition(cell.Status, to) {
+		return fmt.Errorf("invalid cell transition %s → %s", cell.Status, to)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": to}
+	if to == StatusRunning {
+		updates["started_at"] = now
+	}
+	if IsTerminalStatus(to) && cell.Status == StatusRunning {
+		updates["finished_at"] = now
+	}
+
+	result := config.DB.Model(&ci.PipelineCell{}).
+		Where("id = ? AND status = ?", cell.ID, cell.Status).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("cell %s is no longer %s", cell.ID, cell.Status)
+	}
+
+	if to == StatusRunning {
+		cell.StartedAt = now
+	}
+	if IsTerminalStatus(to) && cell.Status == StatusRunning {
+		cell.FinishedAt = now
+	}
+	cell.Status = to
+	return nil
+}
+
+// createCell stores a pending matrix cell of a pipeline
+func createCell(p *ci.CiPipeline, matrix pipeline.Cell, position int) (*ci.PipelineCell, error) {
+	values, err := json.Marshal(matrix.Values())
+	if err != nil {
+		return nil, err
+	}
+	cell := ci.PipelineCell{
+		PipelineID: p.ID,
+		Name:       matrix.Label(),
+		Position:   position,
+		Values:     string(values),
+		Status:     StatusPending,
+	}
+	if err := config.DB.Create(&cell).Error; err != nil {
+		return nil, fmt.Errorf("failed to create matrix cell %s: %w", cell.Name, err)
+	}
+	return &cell, nil
+}
+
+// planSteps lists the steps of a pipeline file from position on. The steps of a matrix cell carry
+// its values in their name.
+func planSteps(rc *runContext, position int) []ci.PipelineStep {
+	planned := make([]ci.PipelineStep, 0, len(rc.definition.Steps))
+	for i, step := range rc.definition.Steps {
+		planned = append(planned, ci.PipelineStep{Name: step.Name, Position: position + i, Command: step.Run})
+		if rc.cell != nil {
+			planned[i].Name = fmt.Sprintf("%s (%s)", step.Name, rc.cell.Name)
+			planned[i].CellID = rc.cell.ID
+		}
+	}
+	return planned
+}
+
+// createSteps stores pending steps of a pipeline and opens their event streams
+func createSteps(p *ci.CiPipeline, steps []ci.PipelineStep) ([]ci.PipelineStep, error) {
+	for i := range steps {
+		steps[i].PipelineID = p.ID
+		steps[i].Status = StatusPending
+		steps[i].Artifacts = "[]"
+	}
+	if err := config.DB.Create(&steps).Error; err != nil {
+		return nil, fmt.Errorf("failed to create pipeline steps: %w", err)
+	}
+	for _, step := range steps {
+		store.OpenEventStream(stepStreamKey(step.ID), p.UpdatedBy)
+	}
+	return steps, nil
+}
+
+func recordFailure(pipelineID uuid.UUID, reason string) {
+	if err := config.DB.Model(&ci.CiPipeline{}).Where("id = ?", pipelineID).
+		Update("failure_reason", reason).Error; err != nil {
+		log.Printf("⚠️ Failed to record failure of pipeline %s: %v", pipelineID, err)
+	}
+}
+
+// appendStepLog adds a timestamped line to the step log
+func appendStepLog(stepID uuid.UUID, line string) {
+	appendStepLogLines(stepID, []string{line})
+}
+
+func appendStepLogLines(stepID uuid.UUID, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	var entry strings.Builder
+	stamp := time.Now().UTC().Format(time.RFC3339)
+	for _, line := range lines {
+		entry.WriteString(fmt.Sprintf("[%s] %s\n", stamp, line))
+	}
+
+	if err := config.DB.Model(&ci.PipelineStep{}).
+		Where("id = ?", stepID).
+		Update("log", gorm.Expr("COALESCE(log, '') || ?", entry.String())).Error; err != nil {
+		log.Printf("⚠️ Failed to append step log for %s: %v", stepID, err)
+		return
+	}
+	// One event per stored line keeps live event IDs in step with replays of the stored log
+	streamKey := stepStreamKey(stepID)
+	for _, line := range strings.Split(strings.TrimSuffix(entry.String(), "\n"), "\n") {
+		store.PublishLog(streamKey, line)
+	}
+}
+
+// stepLogger batches the output of a step into fewer log updates
+type stepLogger struct {
+	stepID    uuid.UUID
+	mu        sync.Mutex
+	lines     []string
+	lastFlush time.Time
+}
+
+func newStepLogger(stepID uuid.UUID) *stepLogger {
+	return &stepLogger{stepID: stepID, lastFlush: time.Now()}
+}
+
+func (l *stepLogger) Write(line string) {
+	l.mu.Lock()
+	l.lines = append(l.lines, line)
+	flush := len(l.lines) >= logFlushLines || time.Since(l.lastFlush) >= logFlushInterval
+	l.mu.Unlock()
+
+	if flush {
+		l.Flush()
+	}
+}
+
+func (l *stepLogger) Flush() {
+	l.mu.Lock()
+	lines := l.lines
+	l.lines = nil
+	l.lastFlush = time.Now()
+	l.mu.Unlock()
+
+	appendStepLogLines(l.stepID, lines)
+}
+
+func (l *stepLogger) Close() {
+	l.Flush()
+}
+
+// stepOutput splits the stdout and stderr of a step into masked log lines, up to maxStepLogBytes
+type stepOutput struct {
+	logger    *stepLogger
+	masker    *strings.Replacer
+	partial   []byte
+	written   int
+	truncated bool
+}
+
+func (o *stepOutput) Write(data []byte) (int, error) {
+	o.partial = append(o.partial, data...)
+	for {
+		i := bytes.IndexByte(o.partial, '\n')
+		if i < 0 {
+			break
+		}
+		o.writeLine(string(o.partial[:i]))
+		o.partial = o.partial[i+1:]
+	}
+	return len(data), nil
+}
+
+// Close writes the last line when the output does not end with a newline
+func (o *stepOutput) Close() {
+	if len(o.partial) > 0 {
+		o.writeLine(string(o.partial))
+		o.partial = nil
+	}
+}
+
+func (o *stepOutput) writeLine(line string) {
+	if o.truncated {
+		return
+	}
+	o.written += len(line) + 1
+	if o.written > maxStepLogBytes {
+		o.truncated = true
+		o.logger.Write(fmt.Sprintf("⚠️ Output truncated after %d MiB", maxStepLogBytes/1024/1024))
+		return
+	}
+	line = strings.TrimSuffix(line, "\r")
+	if o.masker != nil {
+		line = o.masker.Replace(line)
+	}
+	o.logger.Write(line)
+}
+
+// Helper Functions
+func pipelineSlots() chan struct{} {
+	runnerSlotsOnce.Do(func() {
+		limit := defaultParallelPipelines
+		if value, err := strconv.Atoi(os.Getenv("CI_MAX_PARALLEL_PIPELINES")); err == nil && value > 0 {
+			limit = value
+		}
+		runnerSlots = make(chan struct{}, limit)
+	})
+	return runnerSlots
+}
+
+// loadBuildSecrets decrypts the named project secrets with the build or both scope
+func loadBuildSecrets(projectID uuid.UUID, names []string) (map[string]string, error) {
+	values := map[string]string{}
+	if len(names) == 0 {
+		return values, nil
+	}
+
+	var projectSecrets []secrets.Secret
+	if err := config.DB.Where("project_id = ? AND key IN ? AND scope IN ?", projectID, names, []string{"build", "both"}).
+		Order("version ASC").
+		Find(&projectSecrets).Error; err != nil {
+		return nil, fmt.Errorf("failed to load project secrets: %w", err)
+	}
+	for _, secret := range projectSecrets {
+		value, err := services.Decrypt(secret.ValueEncrypted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret %s: %w", secret.Key, err)
+		}
+		values[secret.Key] = string(value)
+	}
+
+	var missing []string
+	for _, name := range names {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("the project has no build secret %s", strings.Join(missing, ", "))
+	}
+	return values, nil
+}
+
+// secretMasker hides secret values in step output. Very short values are left alone, they would
+// mask unrelated output.
+func secretMasker(values map[string]string) *strings.Replacer {
+	var secretValues []string
+	for _, value := range values {
+		if len(value) >= 4 {
+			secretValues = append(secretValues, value)
+		}
+	}
+	if len(secretValues) == 0 {
+		return nil
+	}
+	// Longer values first, so a secret containing another one is masked as a whole
+	sort.Slice(secretValues, func(i, j int) bool { return len(secretValues[i]) > len(secretValues[j]) })
+	pairs := make([]string, 0, 2*len(secretValues))
+	for _, value := range secretValues {
+		pairs = append(pairs, value, "***")
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// copyTree copies a workspace for a matrix cell, keeping file modes and symbolic links
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case entry.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// runGit runs git without prompts and only over network transports, so a repository URL cannot
+// read local paths or run commands
+func runGit(ctx context.Context, dir, home string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + home,
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_ALLOW_PROTOCOL=https:ssh",
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// checkoutCommand describes the checkout step
+func checkoutCommand(p *ci.CiPipeline, project *projects.Project) string {
+	if p.Source != SourceRepository {
+		return "extract " + filepath.ToSlash(filepath.Join("public", project.Name+".zip"))
+	}
+	revision := p.CommitSHA
+	if revision == "" {
+		revision = p.Ref
+	}
+	if revision == "" {
+		revision = "HEAD"
+	}
+	return fmt.Sprintf("git fetch %s %s", redactURL(project.RepoURL), revision)
+}
+
+// redactURL hides the credentials of a repository URL
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.User == nil {
+		return raw
+	}
+	return strings.Replace(raw, parsed.User.String()+"@", "***@", 1)
+}
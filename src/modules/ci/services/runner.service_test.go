@@ -0,0 +1,117 @@
+package ci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var errCellFailed = errors.New("tests failed")
+
+// cellOutcomes runs scheduleCells over n cells. Cells in fail return an error, and with wait set
+// the others block until their context ends. It returns the outcome of every cell.
+func cellOutcomes(t *testing.T, n, maxParallel int, failFast bool, fail map[int]bool, wait bool) []string {
+	t.Helper()
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprint(i + 1)
+	}
+	outcomes := make([]string, n)
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var started sync.WaitGroup
+	if wait {
+		started.Add(n)
+	}
+
+	errs := scheduleCells(context.Background(), names, maxParallel, failFast,
+		func(ctx context.Context, i int) error {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				running--
+				mu.Unlock()
+			}()
+			if wait {
+				started.Done()
+				started.Wait()
+			}
+			if fail[i] {
+				return errCellFailed
+			}
+			if wait {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		},
+		func(i int) { outcomes[i] = "skipped" })
+
+	for i, err := range errs {
+		switch {
+		case outcomes[i] != "":
+		case err == nil:
+			outcomes[i] = "succeeded"
+		case errors.Is(err, errCellFailed):
+			outcomes[i] = "failed"
+		case errors.Is(err, context.Canceled):
+			outcomes[i] = "cancelled"
+		default:
+			outcomes[i] = err.Error()
+		}
+	}
+	if peak > maxParallel {
+		t.Errorf("%d cells ran at once, max_parallel is %d", peak, maxParallel)
+	}
+	return outcomes
+}
+
+func TestScheduleCells(t *testing.T) {
+	tests := []struct {
+		name        string
+		cells       int
+		maxParallel int
+		failFast    bool
+		fail        map[int]bool
+		wait        bool
+		want        string
+	}{
+		{"all succeed", 4, 2, true, nil, false, "succeeded succeeded succeeded succeeded"},
+		{"fail_fast skips the cells not started", 4, 1, true, map[int]bool{1: true}, false, "succeeded failed skipped skipped"},
+		{"without fail_fast every cell runs", 4, 1, false, map[int]bool{1: true}, false, "succeeded failed succeeded succeeded"},
+		{"fail_fast cancels the running cells", 3, 3, true, map[int]bool{0: true}, true, "failed cancelled cancelled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(cellOutcomes(t, tt.cells, tt.maxParallel, tt.failFast, tt.fail, tt.wait), " ")
+			if got != tt.want {
+				t.Errorf("scheduleCells() outcomes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleCellsCancelCause(t *testing.T) {
+	var cause error
+	scheduleCells(context.Background(), []string{"go-1.22", "go-1.23"}, 2, true,
+		func(ctx context.Context, i int) error {
+			if i == 0 {
+				return errCellFailed
+			}
+			<-ctx.Done()
+			cause = context.Cause(ctx)
+			return ctx.Err()
+		},
+		func(int) {})
+
+	want := "cell go-1.22 failed and fail_fast is set"
+	if cause == nil || cause.Error() != want {
+		t.Errorf("context.Cause() = %v, want %q", cause, want)
+	}
+}
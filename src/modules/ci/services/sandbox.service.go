@@ -0,0 +1,207 @@
+package ci
+
+import (
+	"context"
+	"deva/src/lib/docker"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Steps run in throwaway containers of CI_STEP_IMAGE on the daemon at CI_DOCKER_HOST
+	defaultStepImage = "buildpack-deps:bookworm"
+	// Steps run as CI_STEP_USER when the server runs as root, and as the server user otherwise
+	defaultStepUser = "1000:1000"
+	// Mount points of the step containers
+	containerWorkspace = "/workspace"
+	containerHome      = "/home/deva"
+	containerGoroot    = "/opt/go"
+	containerPath      = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	// containerRemoveTimeout bounds the removal of a step container once the step is over
+	containerRemoveTimeout = 30 * time.Second
+)
+
+var (
+	sandboxClient     *docker.Client
+	sandboxClientErr  error
+	sandboxClientOnce sync.Once
+)
+
+// Helper Functions
+
+// runStepContainer runs the script of a step in a throwaway container, copies its output and
+// returns its exit code. The container sees the workspace and the home of the run and, read-only,
+// its Go toolchain; nothing else of the host. It is removed when the step ends, however it ends.
+func runStepContainer(ctx context.Context, rc *runContext, stepID uuid.UUID, workDir string, env []string, script string, output *stepOutput) (int, error) {
+	client, err := stepDockerClient()
+	if err != nil {
+		return 0, err
+	}
+	image := stepImage()
+	if err := ensureStepImage(ctx, client, image, output); err != nil {
+		return 0, err
+	}
+	uid, gid, err := stepUser()
+	if err != nil {
+		return 0, err
+	}
+	for _, dir := range []string{rc.workspace, rc.home} {
+		if err := handOver(dir, uid, gid); err != nil {
+			return 0, fmt.Errorf("failed to hand the workspace over to the step: %w", err)
+		}
+	}
+
+	binds := []string{
+		rc.workspace + ":" + containerWorkspace,
+		rc.home + ":" + containerHome,
+	}
+	if rc.goroot != "" {
+		binds = append(binds, rc.goroot+":"+containerGoroot+":ro")
+	}
+	created, err := client.ContainerCreate(ctx, stepContainerName(stepID), docker.ContainerConfig{
+		Image:      image,
+		User:       fmt.Sprintf("%d:%d", uid, gid),
+		Env:        env,
+		Entrypoint: []string{"bash"},
+		Cmd:        []string{"-eo", "pipefail", "-c", script},
+		WorkingDir: path.Join(containerWorkspace, filepath.ToSlash(workDir)),
+		Labels: map[string]string{
+			"deva.pipeline": rc.pipeline.ID.String(),
+			"deva.step":     stepID.String(),
+		},
+		HostConfig: &docker.HostConfig{
+			Binds:       binds,
+			CapDrop:     []string{"ALL"},
+			SecurityOpt: []string{"no-new-privileges"},
+			// An init process reaps what the script leaves behind
+			Init: true,
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the step container: %w", err)
+	}
+	defer removeStepContainer(client, created.ID)
+
+	if err := client.ContainerStart(ctx, created.ID); err != nil {
+		return 0, fmt.Errorf("failed to start the step container: %w", err)
+	}
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		_ = client.ContainerLogs(ctx, created.ID, docker.LogsOptions{Follow: true}, output, output)
+	}()
+
+	exitCode, err := client.ContainerWait(ctx, created.ID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, err
+	}
+	select {
+	case <-logsDone:
+	case <-time.After(stepKillGrace):
+	}
+	return exitCode, nil
+}
+
+// removeInterruptedStepContainer removes the container of a step a previous server process left
+// running
+func removeInterruptedStepContainer(stepID uuid.UUID) {
+	client, err := stepDockerClient()
+	if err != nil {
+		return
+	}
+	removeStepContainer(client, stepContainerName(stepID))
+}
+
+func removeStepContainer(client *docker.Client, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), containerRemoveTimeout)
+	defer cancel()
+	if err := client.ContainerRemove(ctx, id, true, true); err != nil && !docker.IsNotFound(err) {
+		log.Printf("⚠️ Failed to remove step container %s: %v", id, err)
+	}
+}
+
+func stepContainerName(stepID uuid.UUID) string {
+	return "deva-ci-" + stepID.String()
+}
+
+// stepDockerClient connects to the daemon running the steps. It has to run on the API host: the
+// workspaces are bind mounted from the local disk.
+func stepDockerClient() (*docker.Client, error) {
+	sandboxClientOnce.Do(func() {
+		host := os.Getenv("CI_DOCKER_HOST")
+		if host == "" {
+			host = docker.DefaultUnixSocket
+		}
+		sandboxClient, sandboxClientErr = docker.NewClient(host, nil)
+	})
+	return sandboxClient, sandboxClientErr
+}
+
+func stepImage() string {
+	if image := os.Getenv("CI_STEP_IMAGE"); image != "" {
+		return image
+	}
+	return defaultStepImage
+}
+
+// ensureStepImage pulls the step image the first time it is used
+func ensureStepImage(ctx context.Context, client *docker.Client, image string, output *stepOutput) error {
+	if _, err := client.ImageInspect(ctx, image); err == nil {
+		return nil
+	} else if !docker.IsNotFound(err) {
+		return err
+	}
+	output.writeLine("📥 Pulling " + image)
+	return client.ImagePull(ctx, image)
+}
+
+// stepUser is the unprivileged user the steps run as. A server running as root hands the files
+// of the run over to CI_STEP_USER; any other server user owns them already.
+func stepUser() (int, int, error) {
+	if os.Getuid() != 0 {
+		return os.Getuid(), os.Getgid(), nil
+	}
+	value := os.Getenv("CI_STEP_USER")
+	if value == "" {
+		value = defaultStepUser
+	}
+	uidValue, gidValue, _ := strings.Cut(value, ":")
+	uid, err := strconv.Atoi(uidValue)
+	if err != nil || uid <= 0 {
+		return 0, 0, fmt.Errorf("CI_STEP_USER must be a non-root uid:gid, got %q", value)
+	}
+	gid := uid
+	if gidValue != "" {
+		if gid, err = strconv.Atoi(gidValue); err != nil || gid <= 0 {
+			return 0, 0, fmt.Errorf("CI_STEP_USER must be a non-root uid:gid, got %q", value)
+		}
+	}
+	return uid, gid, nil
+}
+
+// handOver gives the step user the files of dir, like the checkout, restored caches and
+// downloaded artifacts. A server not running as root has nothing to hand over.
+func handOver(dir string, uid, gid int) error {
+	if os.Getuid() != 0 {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(name, uid, gid)
+	})
+}
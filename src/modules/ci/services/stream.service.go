@@ -0,0 +1,116 @@
+package ci
+
+import (
+	"deva/src/config"
+	ci "deva/src/modules/ci/models"
+	"deva/src/utils"
+	"deva/store"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+)
+
+// statusLogPrefix marks the log line written for every step status transition
+const statusLogPrefix = "➡️ Status: "
+
+// StreamStepEvents returns the log and status events of a pipeline step after lastEventID and,
+// while it runs, a channel of the events that follow. Steps whose live stream has expired are
+// replayed from the stored log with the same event IDs.
+func StreamStepEvents(userID, pipelineID, stepID uuid.UUID, lastEventID int64) ([]store.Event, <-chan store.Event, func(), *utils.ServiceError) {
+	p, serviceErr := GetAccessiblePipeline(userID, pipelineID)
+	if serviceErr != nil {
+		return nil, nil, nil, serviceErr
+	}
+	var step ci.PipelineStep
+	if err := config.DB.Omit("log").First(&step, "id = ? AND pipeline_id = ?", stepID, p.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "step not found",
+				Err:        err,
+			}
+		}
+		return nil, nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	if backlog, live, cancel, ok := store.SubscribeEvents(stepStreamKey(step.ID), lastEventID); ok {
+		return backlog, live, cancel, nil
+	}
+	if !IsTerminalStatus(step.Status) {
+		// Streams live in memory; a step that is still running always has one
+		return nil, nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "step log stream is not available on this server",
+			Err:        fmt.Errorf("no event stream for running step %s", step.ID),
+		}
+	}
+
+	// Re-read the log: the step may have finished after it was loaded
+	var stored ci.PipelineStep
+	if err := config.DB.Select("log", "status").First(&stored, "id = ?", step.ID).Error; err != nil {
+		return nil, nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return replayStepLog(stored.Log, stored.Status, lastEventID), nil, func() {}, nil
+}
+
+// Helper Functions
+func stepStreamKey(stepID uuid.UUID) string {
+	return "pipeline-step:" + stepID.String()
+}
+
+// replayStepLog rebuilds the events of a finished step: one log event per stored line plus a
+// status event after every status line, up to the terminal status
+func replayStepLog(storedLog, finalStatus string, lastEventID int64) []store.Event {
+	var events []store.Event
+	var id int64
+	add := func(event store.Event) {
+		if event.ID > lastEventID {
+			events = append(events, event)
+		}
+	}
+
+	var terminal store.Event
+	var lines []string
+	if storedLog != "" {
+		lines = strings.Split(strings.TrimSuffix(storedLog, "\n"), "\n")
+	}
+	for _, line := range lines {
+		id++
+		add(store.LogEvent(id, line))
+
+		// Lines are stored as "[timestamp] message"
+		_, message, _ := strings.Cut(line, "] ")
+		status, isStatus := strings.CutPrefix(message, statusLogPrefix)
+		if !isStatus {
+			continue
+		}
+		id++
+		add(store.StatusEvent(id, status))
+		if IsTerminalStatus(status) {
+			terminal = store.StatusEvent(id, status)
+			break
+		}
+	}
+	if terminal.ID == 0 {
+		id++
+		terminal = store.StatusEvent(id, finalStatus)
+		add(terminal)
+	}
+
+	if len(events) == 0 {
+		// The client already has everything; repeat the terminal status so it stops reconnecting
+		events = append(events, terminal)
+	}
+	return events
+}
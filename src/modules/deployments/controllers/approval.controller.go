@@ -0,0 +1,272 @@
+package deployments
+
+import (
+	"deva/src/lib/dto"
+	"deva/src/lib/interfaces"
+	service "deva/src/modules/deployments/services"
+	users "deva/src/modules/users/models"
+	"deva/src/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// CreateApprovalPolicy is a controller function to require approvals for deployments of a project or team to an environment
+func CreateApprovalPolicy(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	var body dto.CreateApprovalPolicyRequest
+	if serviceErr := utils.BindJson(c, &body); serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	response, serviceErr := service.CreateApprovalPolicy(currentUser.ID, body)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusCreated).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusCreated,
+			Message: "Approval policy created",
+		},
+		Error: nil,
+	})
+}
+
+// ListApprovalPolicies is a controller function to list the approval policies of a project (project_id) or team (team_id)
+func ListApprovalPolicies(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	var projectID, teamID uuid.UUID
+	if raw := c.Query("project_id"); raw != "" {
+		parsed, err := uuid.Parse(raw)
+		if err != nil {
+			return invalidIDResponse(c, "Invalid project ID", err)
+		}
+		projectID = parsed
+	} else if raw := c.Query("team_id"); raw != "" {
+		parsed, err := uuid.Parse(raw)
+		if err != nil {
+			return invalidIDResponse(c, "Invalid team ID", err)
+		}
+		teamID = parsed
+	}
+
+	response, serviceErr := service.ListApprovalPolicies(currentUser.ID, projectID, teamID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Retrieved approval policies successfully",
+		},
+		Error: nil,
+	})
+}
+
+// DeleteApprovalPolicy is a controller function to remove an approval policy
+func DeleteApprovalPolicy(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	policyID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid approval policy ID", err)
+	}
+
+	serviceErr := service.DeleteApprovalPolicy(currentUser.ID, policyID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: nil,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Approval policy deleted",
+		},
+		Error: nil,
+	})
+}
+
+// ApproveDeployment is a controller function to approve a deployment awaiting approval
+func ApproveDeployment(c *fiber.Ctx) error {
+	return decideDeployment(c, service.ApproveDeployment, "Deployment approved")
+}
+
+// RejectDeployment is a controller function to reject a deployment awaiting approval
+func RejectDeployment(c *fiber.Ctx) error {
+	return decideDeployment(c, service.RejectDeployment, "Deployment rejected")
+}
+
+// ListDeploymentApprovals is a controller function to list the approval decisions made on a deployment
+func ListDeploymentApprovals(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid deployment ID", err)
+	}
+
+	response, serviceErr := service.ListDeploymentApprovals(currentUser.ID, deploymentID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Retrieved approvals successfully",
+		},
+		Error: nil,
+	})
+}
+
+// Helper Functions
+func decideDeployment(c *fiber.Ctx, decide func(userID, deploymentID uuid.UUID, comment string) (map[string]interface{}, *utils.ServiceError), message string) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid deployment ID", err)
+	}
+
+	var body dto.ApprovalDecisionRequest
+	if len(c.Body()) > 0 {
+		if serviceErr := utils.BindJson(c, &body); serviceErr != nil {
+			s := serviceErr.Err.Error()
+			errStr := &s
+			return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+				Data: nil,
+				Status: interfaces.Status{
+					Code:    serviceErr.StatusCode,
+					Message: serviceErr.Message,
+				},
+				Error: errStr,
+			})
+		}
+	}
+
+	response, serviceErr := decide(currentUser.ID, deploymentID, body.Comment)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: message,
+		},
+		Error: nil,
+	})
+}
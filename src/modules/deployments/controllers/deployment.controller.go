@@ -0,0 +1,341 @@
+package deployments
+
+import (
+	"deva/src/lib/dto"
+	"deva/src/lib/interfaces"
+	service "deva/src/modules/deployments/services"
+	plans "deva/src/modules/plans/services"
+	users "deva/src/modules/users/models"
+	"deva/src/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CreateProjectDeployment is a controller function to deploy a project to a deployment target
+func CreateProjectDeployment(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid project ID", err)
+	}
+
+	// The body is optional: without a target_id the project's default target is used
+	var body dto.CreateDeploymentRequest
+	if len(c.Body()) > 0 {
+		if serviceErr := utils.BindJson(c, &body); serviceErr != nil {
+			s := serviceErr.Err.Error()
+			errStr := &s
+			return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+				Data: nil,
+				Status: interfaces.Status{
+					Code:    serviceErr.StatusCode,
+					Message: serviceErr.Message,
+				},
+				Error: errStr,
+			})
+		}
+	}
+
+	response, quota, serviceErr := service.CreateDeployment(currentUser.ID, projectID, body)
+	setQuotaHeaders(c, quota)
+	if serviceErr != nil {
+		if serviceErr.StatusCode == http.StatusTooManyRequests && quota != nil {
+			c.Set("Retry-After", strconv.Itoa(int(time.Until(quota.Reset).Seconds())+1))
+		}
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	message := "Deployment started"
+	switch response["status"] {
+	case service.StatusScheduled:
+		message = "Deployment scheduled"
+	case service.StatusAwaitingApproval:
+		message = "Deployment awaiting approval"
+	}
+	return c.Status(http.StatusAccepted).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusAccepted,
+			Message: message,
+		},
+		Error: nil,
+	})
+}
+
+// ListProjectDeployments is a controller function to list the deployment history of a project
+func ListProjectDeployments(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid project ID", err)
+	}
+
+	response, serviceErr := service.ListProjectDeployments(currentUser.ID, projectID, c.QueryInt("limit", 20), c.QueryInt("offset", 0))
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Retrieved deployments successfully",
+		},
+		Error: nil,
+	})
+}
+
+// GetDeployment is a controller function to get a deployment with its log
+func GetDeployment(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid deployment ID", err)
+	}
+
+	response, serviceErr := service.GetDeployment(currentUser.ID, deploymentID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Retrieved deployment successfully",
+		},
+		Error: nil,
+	})
+}
+
+// CancelDeployment is a controller function to cancel a running deployment
+func CancelDeployment(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid deployment ID", err)
+	}
+
+	response, serviceErr := service.CancelDeployment(currentUser.ID, deploymentID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Deployment cancelled",
+		},
+		Error: nil,
+	})
+}
+
+// RollbackDeployment is a controller function to redeploy an earlier successful deployment
+func RollbackDeployment(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid deployment ID", err)
+	}
+
+	var body dto.RollbackDeploymentRequest
+	if len(c.Body()) > 0 {
+		if serviceErr := utils.BindJson(c, &body); serviceErr != nil {
+			s := serviceErr.Err.Error()
+			errStr := &s
+			return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+				Data: nil,
+				Status: interfaces.Status{
+					Code:    serviceErr.StatusCode,
+					Message: serviceErr.Message,
+				},
+				Error: errStr,
+			})
+		}
+	}
+
+	response, quota, serviceErr := service.RollbackDeployment(currentUser.ID, deploymentID, body)
+	setQuotaHeaders(c, quota)
+	if serviceErr != nil {
+		if serviceErr.StatusCode == http.StatusTooManyRequests && quota != nil {
+			c.Set("Retry-After", strconv.Itoa(int(time.Until(quota.Reset).Seconds())+1))
+		}
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	message := "Rollback started"
+	if response["status"] == service.StatusAwaitingApproval {
+		message = "Rollback awaiting approval"
+	}
+	return c.Status(http.StatusAccepted).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusAccepted,
+			Message: message,
+		},
+		Error: nil,
+	})
+}
+
+// StreamDeploymentLogs is a controller function to follow the log and status of a deployment as server-sent events
+func StreamDeploymentLogs(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid deployment ID", err)
+	}
+
+	backlog, live, cancel, serviceErr := service.StreamDeploymentEvents(currentUser.ID, deploymentID, utils.LastEventID(c))
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return utils.StreamEvents(c, backlog, live, cancel)
+}
+
+// Helper Functions
+func setQuotaHeaders(c *fiber.Ctx, quota *plans.DeploymentQuota) {
+	if quota == nil {
+		return
+	}
+	c.Set("X-RateLimit-Limit", strconv.Itoa(quota.Limit))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(quota.Remaining))
+	c.Set("X-RateLimit-Reset", strconv.FormatInt(quota.Reset.Unix(), 10))
+}
+
+func invalidIDResponse(c *fiber.Ctx, message string, err error) error {
+	s := err.Error()
+	errStr := &s
+	return c.Status(http.StatusBadRequest).JSON(interfaces.Response{
+		Data: nil,
+		Status: interfaces.Status{
+			Code:    http.StatusBadRequest,
+			Message: message,
+		},
+		Error: errStr,
+	})
+}
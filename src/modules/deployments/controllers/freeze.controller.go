@@ -0,0 +1,160 @@
+package deployments
+
+import (
+	"deva/src/lib/dto"
+	"deva/src/lib/interfaces"
+	service "deva/src/modules/deployments/services"
+	users "deva/src/modules/users/models"
+	"deva/src/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// CreateFreezeWindow is a controller function to declare a deployment freeze for a project or team
+func CreateFreezeWindow(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	var body dto.CreateFreezeWindowRequest
+	if serviceErr := utils.BindJson(c, &body); serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	response, serviceErr := service.CreateFreezeWindow(currentUser.ID, body)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusCreated).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusCreated,
+			Message: "Freeze window created",
+		},
+		Error: nil,
+	})
+}
+
+// ListFreezeWindows is a controller function to list the freeze windows of a project (project_id) or team (team_id)
+func ListFreezeWindows(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	var projectID, teamID uuid.UUID
+	if raw := c.Query("project_id"); raw != "" {
+		parsed, err := uuid.Parse(raw)
+		if err != nil {
+			return invalidIDResponse(c, "Invalid project ID", err)
+		}
+		projectID = parsed
+	} else if raw := c.Query("team_id"); raw != "" {
+		parsed, err := uuid.Parse(raw)
+		if err != nil {
+			return invalidIDResponse(c, "Invalid team ID", err)
+		}
+		teamID = parsed
+	}
+
+	response, serviceErr := service.ListFreezeWindows(currentUser.ID, projectID, teamID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Retrieved freeze windows successfully",
+		},
+		Error: nil,
+	})
+}
+
+// DeleteFreezeWindow is a controller function to lift a freeze window
+func DeleteFreezeWindow(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	windowID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invalidIDResponse(c, "Invalid freeze window ID", err)
+	}
+
+	serviceErr := service.DeleteFreezeWindow(currentUser.ID, windowID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: nil,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Freeze window deleted",
+		},
+		Error: nil,
+	})
+}
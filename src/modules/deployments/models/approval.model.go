@@ -0,0 +1,47 @@
+package deployments
+
+import (
+	users "deva/src/modules/users/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ApprovalPolicy gates deployments of a project, or of every project of a team, to an environment
+// behind approvals by users holding ApproverRole
+type ApprovalPolicy struct {
+	ID                uuid.UUID      `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ProjectID         uuid.UUID      `gorm:"type:uuid;default:null;index"`
+	TeamID            uuid.UUID      `gorm:"type:uuid;default:null;index"`
+	Environment       string         `gorm:"not null;default:'production'"`
+	ApproverRole      string         `gorm:"not null"` // A role name (e.g. "admin") or a team member role
+	RequiredApprovals int            `gorm:"not null;default:1"`
+	TimeoutMinutes    int            `gorm:"not null;default:1440"`
+	CreatedBy         uuid.UUID      `gorm:"type:uuid;not null"`
+	UpdatedBy         uuid.UUID      `gorm:"type:uuid;default:null"`
+	UpdatedByUser     users.User     `gorm:"foreignKey:UpdatedBy;references:ID"`
+	CreatedAt         time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt         time.Time      `gorm:"autoUpdateTime"`
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
+}
+
+// DeploymentApproval is the audit record of one approval decision on a deployment
+type DeploymentApproval struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	DeploymentID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_deployment_approver"`
+	Deployment   Deployment `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:DeploymentID;references:ID"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_deployment_approver"`
+	User         users.User `gorm:"foreignKey:UserID;references:ID"`
+	Decision     string     `gorm:"not null"` // "approved" or "rejected"
+	Role         string     `gorm:"not null"` // The role the decision was made with
+	Comment      string
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+func MigrateApprovalPolicies(db *gorm.DB) error {
+	return db.AutoMigrate(&ApprovalPolicy{})
+}
+
+func MigrateDeploymentApprovals(db *gorm.DB) error {
+	return db.AutoMigrate(&DeploymentApproval{})
+}
@@ -14,6 +14,7 @@ type DeploymentTarget struct {
 	Type          string         `gorm:"not null"` // "kubernetes", "docker", etc.
 	Host          string         `gorm:"not null"`
 	Auth          string         `gorm:"type:jsonb;not null"` // Encrypted auth credentials
+	CreatedBy     uuid.UUID      `gorm:"type:uuid;default:null;index"`
 	UpdatedBy     uuid.UUID      `gorm:"type:uuid;default:null"`
 	UpdatedByUser users.User     `gorm:"foreignKey:UpdatedBy;references:ID"`
 	CreatedAt     time.Time      `gorm:"autoCreateTime"`
@@ -8,17 +8,40 @@ import (
 )
 
 type Deployment struct {
-	ID          uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
-	Platform    string     `gorm:"not null"`
-	Status      string     `gorm:"not null;default:'pending'"`
-	Log         string     `gorm:"type:text"`
-	TriggeredBy uuid.UUID  `gorm:"type:uuid;not null"`
-	User        users.User `gorm:"foreignKey:TriggeredBy;references:ID"`
-	StartedAt   time.Time
-	FinishedAt  time.Time
-	CreatedAt   time.Time      `gorm:"autoCreateTime"`
-	UpdatedAt   time.Time      `gorm:"autoUpdateTime"`
-	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	ID             uuid.UUID        `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ProjectID      uuid.UUID        `gorm:"type:uuid;default:null;index"`
+	TargetID       uuid.UUID        `gorm:"type:uuid;default:null"`
+	Target         DeploymentTarget `gorm:"foreignKey:TargetID;references:ID"`
+	Platform       string           `gorm:"not null"`
+	Environment    string           `gorm:"not null;default:'production'"`
+	Ref            string           `gorm:"index"`                       // Branch or tag the deployment was made from, when known
+	Status         string           `gorm:"not null;default:'pending'"`  // "awaiting_approval", "scheduled", "pending", "building", "deploying", "succeeded", "failed", "cancelled", "rejected", "expired"
+	Strategy       string           `gorm:"not null;default:'recreate'"` // "recreate", "blue-green", "canary"
+	CanaryPercent  int
+	CanarySeconds  int
+	ImageRef       string
+	ImageID        string
+	ConfigSnapshot string    `gorm:"type:text"`                    // Encrypted rendered container config, replayed by rollbacks
+	RollbackToID   uuid.UUID `gorm:"type:uuid;default:null;index"` // Set on rollbacks: the deployment being restored
+	Reason         string
+	HealthCheck    string `gorm:"type:text"` // JSON encoded health check resolved when the deployment was created
+	FailureReason  string
+	ScheduledAt    time.Time // Set on scheduled deployments: when the scheduler starts them
+	ScheduledBy    uuid.UUID `gorm:"type:uuid;default:null"`
+	FreezeOverride string    // Reason given by the admin who deployed through a freeze window
+	OverriddenBy   uuid.UUID `gorm:"type:uuid;default:null"`
+	// Approval gate, resolved from the approval policy when the deployment was created
+	RequiredApprovals int
+	ApproverRole      string
+	ApprovalExpiresAt time.Time
+	Log               string     `gorm:"type:text"`
+	TriggeredBy       uuid.UUID  `gorm:"type:uuid;not null"`
+	User              users.User `gorm:"foreignKey:TriggeredBy;references:ID"`
+	StartedAt         time.Time
+	FinishedAt        time.Time
+	CreatedAt         time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt         time.Time      `gorm:"autoUpdateTime"`
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
 }
 
 func MigrateDeployments(db *gorm.DB) error {
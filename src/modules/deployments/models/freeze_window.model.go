@@ -0,0 +1,34 @@
+package deployments
+
+import (
+	users "deva/src/modules/users/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// FreezeWindow blocks deployments of a project, or of every project of a team, for a period
+type FreezeWindow struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ProjectID     uuid.UUID `gorm:"type:uuid;default:null;index"`
+	TeamID        uuid.UUID `gorm:"type:uuid;default:null;index"`
+	Name          string    `gorm:"not null"`
+	Reason        string
+	Recurrence    string `gorm:"not null;default:'once'"` // "once" or "weekly"
+	StartsAt      time.Time
+	EndsAt        time.Time
+	Days          string         // Weekly: comma separated weekdays, e.g. "sat,sun"
+	StartTime     string         // Weekly: "HH:MM", empty for the whole day
+	EndTime       string         // Weekly: "HH:MM", at or before StartTime to end the next day
+	Timezone      string         `gorm:"not null;default:'UTC'"`
+	CreatedBy     uuid.UUID      `gorm:"type:uuid;not null"`
+	UpdatedBy     uuid.UUID      `gorm:"type:uuid;default:null"`
+	UpdatedByUser users.User     `gorm:"foreignKey:UpdatedBy;references:ID"`
+	CreatedAt     time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time      `gorm:"autoUpdateTime"`
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+}
+
+func MigrateFreezeWindows(db *gorm.DB) error {
+	return db.AutoMigrate(&FreezeWindow{})
+}
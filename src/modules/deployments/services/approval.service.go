@@ -0,0 +1,652 @@
+package deployments
+
+import (
+	"deva/src/config"
+	"deva/src/lib/dto"
+	deployments "deva/src/modules/deployments/models"
+	notifications "deva/src/modules/notifications/services"
+	projects "deva/src/modules/projects/models"
+	roles "deva/src/modules/roles/services"
+	teams "deva/src/modules/teams/services"
+	"deva/src/utils"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Approval decisions
+const (
+	DecisionApproved = "approved"
+	DecisionRejected = "rejected"
+)
+
+const (
+	maxRequiredApprovals = 10
+	// Approval timeouts in minutes
+	defaultApprovalTimeout = 24 * 60
+	minApprovalTimeout     = 5
+	maxApprovalTimeout     = 7 * 24 * 60
+)
+
+var (
+	environmentPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	errAlreadyDecided  = errors.New("approval decision already recorded")
+)
+
+// CreateApprovalPolicy gates deployments of a project, or of every project of a team, to an
+// environment behind approvals. Admins and team owners manage policies.
+func CreateApprovalPolicy(userID uuid.UUID, request dto.CreateApprovalPolicyRequest) (map[string]interface{}, *utils.ServiceError) {
+	if (request.ProjectID == uuid.Nil) == (request.TeamID == uuid.Nil) {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "set exactly one of project_id and team_id",
+			Err:        errors.New("approval policy needs a project or a team"),
+		}
+	}
+	if serviceErr := checkApprovalPolicyManager(userID, request.ProjectID, request.TeamID); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	policy, err := newApprovalPolicy(request)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    err.Error(),
+			Err:        err,
+		}
+	}
+
+	var existing int64
+	if err := config.DB.Model(&deployments.ApprovalPolicy{}).
+		Where("project_id IS NOT DISTINCT FROM ? AND team_id IS NOT DISTINCT FROM ? AND environment = ?",
+			uuidOrNil(policy.ProjectID), uuidOrNil(policy.TeamID), policy.Environment).
+		Count(&existing).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if existing > 0 {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("an approval policy for %s already exists", policy.Environment),
+			Err:        fmt.Errorf("duplicate approval policy for environment %q", policy.Environment),
+		}
+	}
+
+	policy.CreatedBy = userID
+	policy.UpdatedBy = userID
+	if err := config.DB.Create(policy).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to create approval policy",
+			Err:        err,
+		}
+	}
+	return toApprovalPolicyResponse(*policy), nil
+}
+
+// ListApprovalPolicies returns the approval policies of a team, or those that apply to a project:
+// its own and its team's
+func ListApprovalPolicies(userID, projectID, teamID uuid.UUID) ([]map[string]interface{}, *utils.ServiceError) {
+	if serviceErr := checkFreezeScope(userID, projectID, teamID); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	query := config.DB.Where("team_id = ?", teamID)
+	if projectID != uuid.Nil {
+		var project projects.Project
+		if err := config.DB.Select("id", "team_id").First(&project, "id = ?", projectID).Error; err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "DB error",
+				Err:        err,
+			}
+		}
+		query = config.DB.Where("project_id = ?", project.ID)
+		if project.TeamID != uuid.Nil {
+			query = config.DB.Where("project_id = ? OR team_id = ?", project.ID, project.TeamID)
+		}
+	}
+
+	var policies []deployments.ApprovalPolicy
+	if err := query.Order("environment, created_at DESC").Find(&policies).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to list approval policies",
+			Err:        err,
+		}
+	}
+
+	result := make([]map[string]interface{}, 0, len(policies))
+	for _, policy := range policies {
+		result = append(result, toApprovalPolicyResponse(policy))
+	}
+	return result, nil
+}
+
+// DeleteApprovalPolicy removes an approval policy. Deployments already awaiting approval keep
+// waiting for the approvals they were created with.
+func DeleteApprovalPolicy(userID, policyID uuid.UUID) *utils.ServiceError {
+	var policy deployments.ApprovalPolicy
+	if err := config.DB.First(&policy, "id = ?", policyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "approval policy not found",
+				Err:        err,
+			}
+		}
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if serviceErr := checkApprovalPolicyManager(userID, policy.ProjectID, policy.TeamID); serviceErr != nil {
+		if serviceErr.StatusCode == http.StatusNotFound {
+			serviceErr.Message = "approval policy not found"
+		}
+		return serviceErr
+	}
+
+	if err := config.DB.Model(&policy).Update("updated_by", userID).Error; err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if err := config.DB.Delete(&policy).Error; err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to delete approval policy",
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// ApproveDeployment records an approval of a deployment awaiting approval and releases the
+// deployment once it has enough approvals
+func ApproveDeployment(userID, deploymentID uuid.UUID, comment string) (map[string]interface{}, *utils.ServiceError) {
+	return decideDeployment(userID, deploymentID, DecisionApproved, comment)
+}
+
+// RejectDeployment records a rejection of a deployment awaiting approval. One rejection is
+// enough to stop the deployment.
+func RejectDeployment(userID, deploymentID uuid.UUID, comment string) (map[string]interface{}, *utils.ServiceError) {
+	return decideDeployment(userID, deploymentID, DecisionRejected, comment)
+}
+
+// ListDeploymentApprovals returns the approval decisions made on a deployment, oldest first
+func ListDeploymentApprovals(userID, deploymentID uuid.UUID) ([]map[string]interface{}, *utils.ServiceError) {
+	deployment, serviceErr := GetAccessibleDeployment(userID, deploymentID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	decisions, err := deploymentApprovals(deployment.ID)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to list approvals",
+			Err:        err,
+		}
+	}
+	result := make([]map[string]interface{}, 0, len(decisions))
+	for _, decision := range decisions {
+		result = append(result, toDeploymentApprovalResponse(decision))
+	}
+	return result, nil
+}
+
+// resolveApprovalPolicy returns the policy covering deployments of the project to an
+// environment: the project's own policy first, then its team's
+func resolveApprovalPolicy(project *projects.Project, environment string) (*deployments.ApprovalPolicy, error) {
+	var policies []deployments.ApprovalPolicy
+	query := config.DB.Where("environment = ? AND project_id = ?", environment, project.ID)
+	if project.TeamID != uuid.Nil {
+		query = config.DB.Where("environment = ? AND (project_id = ? OR team_id = ?)", environment, project.ID, project.TeamID)
+	}
+	if err := query.Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	var resolved *deployments.ApprovalPolicy
+	for i := range policies {
+		if policies[i].ProjectID == project.ID {
+			return &policies[i], nil
+		}
+		resolved = &policies[i]
+	}
+	return resolved, nil
+}
+
+// requestApprovals logs the approval request of a new deployment and notifies its approvers
+func requestApprovals(deployment *deployments.Deployment, project *projects.Project) {
+	appendLog(deployment.ID, fmt.Sprintf("⏳ Awaiting %d approval(s) from %q for %s until %s",
+		deployment.RequiredApprovals, deployment.ApproverRole, deployment.Environment,
+		deployment.ApprovalExpiresAt.UTC().Format(time.RFC3339)))
+
+	approvers, err := eligibleApprovers(project, deployment.ApproverRole, deployment.TriggeredBy)
+	if err != nil {
+		log.Printf("⚠️ Failed to resolve approvers of deployment %s: %v", deployment.ID, err)
+		return
+	}
+	if len(approvers) == 0 {
+		appendLog(deployment.ID, fmt.Sprintf("⚠️ No other user can approve as %q", deployment.ApproverRole))
+		return
+	}
+
+	message := fmt.Sprintf("Deployment %s of %s to %s awaits your approval", deployment.ID, project.Name, deployment.Environment)
+	for _, approverID := range approvers {
+		if err := notifications.Notify(approverID, notifications.TypeDeploymentApproval, message,
+			map[string]interface{}{
+				"deployment_id": deployment.ID,
+				"project_id":    deployment.ProjectID,
+				"environment":   deployment.Environment,
+				"expires_at":    deployment.ApprovalExpiresAt,
+			}); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}
+}
+
+// expireApprovals moves deployments whose approval window has passed to expired
+func expireApprovals(now time.Time) {
+	var expired []deployments.Deployment
+	if err := config.DB.Omit("log", "config_snapshot").
+		Where("status = ? AND approval_expires_at <= ?", StatusAwaitingApproval, now).
+		Find(&expired).Error; err != nil {
+		log.Printf("⚠️ Failed to load expired approval requests: %v", err)
+		return
+	}
+
+	for i := range expired {
+		expireApproval(&expired[i])
+	}
+}
+
+// Helper Functions
+func decideDeployment(userID, deploymentID uuid.UUID, decision, comment string) (map[string]interface{}, *utils.ServiceError) {
+	// Deciders are authorized by the approver role and the scope of the policy, not by access to
+	// the project: approvers holding a global role may be outside the team
+	var deployment deployments.Deployment
+	if err := config.DB.First(&deployment, "id = ?", deploymentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "deployment not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	var project projects.Project
+	if err := config.DB.Select("id", "name", "team_id", "created_by").First(&project, "id = ?", deployment.ProjectID).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	role, inScope, allowed, err := approvalRights(userID, &project, deployment.ApproverRole)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if !inScope {
+		// Do not reveal deployments outside the scope of the user
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "deployment not found",
+			Err:        fmt.Errorf("user %s is outside the approval scope of deployment %s", userID, deploymentID),
+		}
+	}
+
+	if deployment.Status != StatusAwaitingApproval {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("deployment is %s, not awaiting approval", deployment.Status),
+			Err:        fmt.Errorf("deployment %s is %s", deployment.ID, deployment.Status),
+		}
+	}
+	if !time.Now().Before(deployment.ApprovalExpiresAt) {
+		expireApproval(&deployment)
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    "the approval request has expired",
+			Err:        fmt.Errorf("approval of deployment %s expired at %s", deployment.ID, deployment.ApprovalExpiresAt),
+		}
+	}
+	if deployment.TriggeredBy == userID {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusForbidden,
+			Message:    "you cannot approve or reject your own deployment",
+			Err:        fmt.Errorf("user %s triggered deployment %s", userID, deployment.ID),
+		}
+	}
+	if !allowed {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusForbidden,
+			Message:    fmt.Sprintf("only users with the %q role can decide on this deployment", deployment.ApproverRole),
+			Err:        fmt.Errorf("user %s lacks role %q", userID, deployment.ApproverRole),
+		}
+	}
+
+	record := deployments.DeploymentApproval{
+		DeploymentID: deployment.ID,
+		UserID:       userID,
+		Decision:     decision,
+		Role:         role,
+		Comment:      strings.TrimSpace(comment),
+	}
+	var approvals int64
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&deployments.DeploymentApproval{}).
+			Where("deployment_id = ? AND user_id = ?", deployment.ID, userID).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return errAlreadyDecided
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		return tx.Model(&deployments.DeploymentApproval{}).
+			Where("deployment_id = ? AND decision = ?", deployment.ID, DecisionApproved).
+			Count(&approvals).Error
+	})
+	if errors.Is(err, errAlreadyDecided) {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    "you already decided on this deployment",
+			Err:        err,
+		}
+	}
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to record approval decision",
+			Err:        err,
+		}
+	}
+
+	line := fmt.Sprintf("✍️ Deployment %s by %s as %q", decision, userID, role)
+	if record.Comment != "" {
+		line += ": " + record.Comment
+	}
+	appendLog(deployment.ID, line)
+
+	if decision == DecisionRejected {
+		reason := fmt.Sprintf("rejected by %s", userID)
+		if record.Comment != "" {
+			reason += ": " + record.Comment
+		}
+		closeApprovalRequest(&deployment, StatusRejected, reason)
+	} else if int(approvals) >= deployment.RequiredApprovals {
+		releaseApprovedDeployment(&deployment, &project)
+	}
+
+	response := toDeploymentResponse(deployment, false)
+	response["decision"] = toDeploymentApprovalResponse(record)
+	response["approvals"] = approvals
+	return response, nil
+}
+
+// releaseApprovedDeployment hands a fully approved deployment to the scheduler, or starts it
+// right away when it is not scheduled for later
+func releaseApprovedDeployment(deployment *deployments.Deployment, project *projects.Project) {
+	now := time.Now()
+	if deployment.ScheduledAt.After(now) {
+		if err := transition(deployment, StatusScheduled); err != nil {
+			if !errors.Is(err, errDeploymentCancelled) {
+				log.Printf("⚠️ Failed to schedule approved deployment %s: %v", deployment.ID, err)
+			}
+			return
+		}
+		appendLog(deployment.ID, "✅ Approved, waiting for the scheduled time")
+	} else {
+		startQueuedDeployment(deployment, now, "✅ Approved")
+	}
+
+	if err := notifications.Notify(deployment.TriggeredBy, notifications.TypeDeploymentApproval,
+		fmt.Sprintf("Deployment %s of %s to %s was approved", deployment.ID, project.Name, deployment.Environment),
+		map[string]interface{}{"deployment_id": deployment.ID, "project_id": deployment.ProjectID, "status": deployment.Status}); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+}
+
+func expireApproval(deployment *deployments.Deployment) {
+	closeApprovalRequest(deployment, StatusExpired,
+		fmt.Sprintf("approval expired at %s", deployment.ApprovalExpiresAt.UTC().Format(time.RFC3339)))
+}
+
+// closeApprovalRequest ends a deployment awaiting approval without running it
+func closeApprovalRequest(deployment *deployments.Deployment, status, reason string) {
+	if err := config.DB.Model(&deployments.Deployment{}).
+		Where("id = ? AND status = ?", deployment.ID, StatusAwaitingApproval).
+		Update("failure_reason", reason).Error; err != nil {
+		log.Printf("⚠️ Failed to record outcome of deployment %s: %v", deployment.ID, err)
+	}
+	if err := transition(deployment, status); err != nil {
+		if !errors.Is(err, errDeploymentCancelled) {
+			log.Printf("⚠️ Failed to mark deployment %s as %s: %v", deployment.ID, status, err)
+		}
+		return
+	}
+	deployment.FailureReason = reason
+
+	if err := notifications.Notify(deployment.TriggeredBy, notifications.TypeDeploymentApproval,
+		fmt.Sprintf("Deployment %s was %s: %s", deployment.ID, status, reason),
+		map[string]interface{}{"deployment_id": deployment.ID, "project_id": deployment.ProjectID, "status": status}); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+}
+
+// approverRole reports whether the user holds the approver role, either as their role or as
+// their role in the team, and returns the role matched
+func approverRole(userID, teamID uuid.UUID, required string) (string, bool, error) {
+	if role, err := roles.GetRoleByUserID(userID); err == nil && strings.EqualFold(role.Name, required) {
+		return role.Name, true, nil
+	}
+	teamRole, err := teams.TeamRole(config.DB, teamID, userID)
+	if err != nil {
+		return "", false, err
+	}
+	if teamRole != "" && strings.EqualFold(teamRole, required) {
+		return teamRole, true, nil
+	}
+	return "", false, nil
+}
+
+// approvalRights reports whether the user is within the approval scope of the project and may
+// decide on its deployments needing the approver role, and the role they decide as. The scope is
+// the team of a team project, or the owner of a personal project, plus the admins. Personal
+// projects have no team roles, so admins approve them whatever the approver role.
+func approvalRights(userID uuid.UUID, project *projects.Project, required string) (string, bool, bool, error) {
+	isAdmin := false
+	if role, err := roles.GetRoleByUserID(userID); err == nil && role.Name == "admin" {
+		isAdmin = true
+	}
+	inScope := isAdmin || userID == project.CreatedBy
+	if !inScope && project.TeamID != uuid.Nil {
+		isMember, err := teams.IsTeamMember(config.DB, project.TeamID, userID)
+		if err != nil {
+			return "", false, false, err
+		}
+		inScope = isMember
+	}
+	if !inScope {
+		return "", false, false, nil
+	}
+
+	role, allowed, err := approverRole(userID, project.TeamID, required)
+	if err != nil || allowed {
+		return role, true, allowed, err
+	}
+	if isAdmin && project.TeamID == uuid.Nil {
+		return "admin", true, true, nil
+	}
+	return "", true, false, nil
+}
+
+// eligibleApprovers returns the users, other than the triggering one, who may decide on
+// deployments of the project needing the approver role: its team or owner, and the admins
+func eligibleApprovers(project *projects.Project, required string, triggeredBy uuid.UUID) ([]uuid.UUID, error) {
+	candidates := []uuid.UUID{project.CreatedBy}
+	if project.TeamID != uuid.Nil {
+		members, err := teams.TeamUserIDs(config.DB, project.TeamID)
+		if err != nil {
+			return nil, err
+		}
+		candidates = members
+	}
+	admins, err := roles.GetUserIDsByRoleName("admin")
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, admins...)
+
+	var approvers []uuid.UUID
+	seen := map[uuid.UUID]bool{triggeredBy: true}
+	for _, candidate := range candidates {
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		_, _, allowed, err := approvalRights(candidate, project, required)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			approvers = append(approvers, candidate)
+		}
+	}
+	return approvers, nil
+}
+
+func checkApprovalPolicyManager(userID, projectID, teamID uuid.UUID) *utils.ServiceError {
+	if serviceErr := checkFreezeScope(userID, projectID, teamID); serviceErr != nil {
+		return serviceErr
+	}
+	if projectID != uuid.Nil {
+		var project projects.Project
+		if err := config.DB.Select("team_id").First(&project, "id = ?", projectID).Error; err != nil {
+			return &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "DB error",
+				Err:        err,
+			}
+		}
+		teamID = project.TeamID
+	}
+
+	allowed, err := isDeploymentAdmin(userID, teamID)
+	if err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if !allowed {
+		return &utils.ServiceError{
+			StatusCode: http.StatusForbidden,
+			Message:    "only an admin or the team owner can manage approval policies",
+			Err:        fmt.Errorf("user %s cannot manage approval policies of team %s", userID, teamID),
+		}
+	}
+	return nil
+}
+
+func newApprovalPolicy(request dto.CreateApprovalPolicyRequest) (*deployments.ApprovalPolicy, error) {
+	environment, err := normalizeEnvironment(request.Environment)
+	if err != nil {
+		return nil, err
+	}
+	policy := &deployments.ApprovalPolicy{
+		ProjectID:         request.ProjectID,
+		TeamID:            request.TeamID,
+		Environment:       environment,
+		ApproverRole:      strings.ToLower(strings.TrimSpace(request.ApproverRole)),
+		RequiredApprovals: request.RequiredApprovals,
+		TimeoutMinutes:    request.TimeoutMinutes,
+	}
+	if policy.ApproverRole == "" {
+		return nil, errors.New("approver_role is required")
+	}
+	if policy.RequiredApprovals == 0 {
+		policy.RequiredApprovals = 1
+	}
+	if policy.RequiredApprovals < 1 || policy.RequiredApprovals > maxRequiredApprovals {
+		return nil, fmt.Errorf("required_approvals must be between 1 and %d", maxRequiredApprovals)
+	}
+	if policy.TimeoutMinutes == 0 {
+		policy.TimeoutMinutes = defaultApprovalTimeout
+	}
+	if policy.TimeoutMinutes < minApprovalTimeout || policy.TimeoutMinutes > maxApprovalTimeout {
+		return nil, fmt.Errorf("timeout_minutes must be between %d and %d", minApprovalTimeout, maxApprovalTimeout)
+	}
+	return policy, nil
+}
+
+func normalizeEnvironment(environment string) (string, error) {
+	environment = strings.ToLower(strings.TrimSpace(environment))
+	if environment == "" {
+		return EnvironmentProduction, nil
+	}
+	if !environmentPattern.MatchString(environment) {
+		return "", fmt.Errorf("invalid environment %q, use lowercase letters, digits and dashes", environment)
+	}
+	return environment, nil
+}
+
+func deploymentApprovals(deploymentID uuid.UUID) ([]deployments.DeploymentApproval, error) {
+	var decisions []deployments.DeploymentApproval
+	err := config.DB.Where("deployment_id = ?", deploymentID).Order("created_at").Find(&decisions).Error
+	return decisions, err
+}
+
+func toApprovalPolicyResponse(p deployments.ApprovalPolicy) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                 p.ID,
+		"project_id":         uuidOrNil(p.ProjectID),
+		"team_id":            uuidOrNil(p.TeamID),
+		"environment":        p.Environment,
+		"approver_role":      p.ApproverRole,
+		"required_approvals": p.RequiredApprovals,
+		"timeout_minutes":    p.TimeoutMinutes,
+		"created_by":         p.CreatedBy,
+		"created_at":         p.CreatedAt,
+	}
+}
+
+func toDeploymentApprovalResponse(a deployments.DeploymentApproval) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            a.ID,
+		"deployment_id": a.DeploymentID,
+		"user_id":       a.UserID,
+		"decision":      a.Decision,
+		"role":          a.Role,
+		"comment":       a.Comment,
+		"created_at":    a.CreatedAt,
+	}
+}
@@ -0,0 +1,472 @@
+package deployments
+
+import (
+	"deva/src/config"
+	"deva/src/lib/dto"
+	deployments "deva/src/modules/deployments/models"
+	plans "deva/src/modules/plans/services"
+	projects "deva/src/modules/projects/models"
+	teams "deva/src/modules/teams/services"
+	"deva/src/utils"
+	"deva/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Deployment statuses
+const (
+	StatusAwaitingApproval = "awaiting_approval"
+	StatusScheduled        = "scheduled"
+	StatusPending          = "pending"
+	StatusBuilding         = "building"
+	StatusDeploying        = "deploying"
+	StatusSucceeded        = "succeeded"
+	StatusFailed           = "failed"
+	StatusCancelled        = "cancelled"
+	StatusRejected         = "rejected"
+	StatusExpired          = "expired"
+)
+
+// EnvironmentProduction is the environment of deployments that do not name one
+const EnvironmentProduction = "production"
+
+// refPattern accepts the branch and tag names a deployment records
+var refPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,254}$`)
+
+// transitions lists the statuses each non-terminal status may move to. Rollbacks go
+// straight from pending to deploying since they reuse an existing image.
+var transitions = map[string][]string{
+	StatusAwaitingApproval: {StatusScheduled, StatusPending, StatusFailed, StatusCancelled, StatusRejected, StatusExpired},
+	StatusScheduled:        {StatusPending, StatusFailed, StatusCancelled},
+	StatusPending:          {StatusBuilding, StatusDeploying, StatusFailed, StatusCancelled},
+	StatusBuilding:         {StatusDeploying, StatusFailed, StatusCancelled},
+	StatusDeploying:        {StatusSucceeded, StatusFailed, StatusCancelled},
+}
+
+// IsTerminalStatus reports whether a deployment in this status can no longer change
+func IsTerminalStatus(status string) bool {
+	_, ok := transitions[status]
+	return !ok
+}
+
+// CanTransition reports whether a deployment may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateDeployment queues a deployment of the project to a target and starts the engine, or holds
+// it for approval when an approval policy covers its environment.
+// The daily deployment quota is returned whenever it was checked, including when it is exceeded.
+func CreateDeployment(userID, projectID uuid.UUID, request dto.CreateDeploymentRequest) (map[string]interface{}, *plans.DeploymentQuota, *utils.ServiceError) {
+	project, serviceErr := GetAccessibleProject(userID, projectID)
+	if serviceErr != nil {
+		return nil, nil, serviceErr
+	}
+	if project.Status != "active" {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("project is %s and cannot be deployed", project.Status),
+			Err:        fmt.Errorf("project %s has status %q", project.ID, project.Status),
+		}
+	}
+
+	projectConfig, serviceErr := getProjectConfig(project.ID)
+	if serviceErr != nil {
+		return nil, nil, serviceErr
+	}
+
+	targetID := request.TargetID
+	if targetID == uuid.Nil {
+		targetID = projectConfig.DeployTargetID
+	}
+	target, serviceErr := GetAccessibleTarget(userID, targetID)
+	if serviceErr != nil {
+		return nil, nil, serviceErr
+	}
+	if target.Type != TargetTypeDocker {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("deployments to %s targets are not supported", target.Type),
+			Err:        fmt.Errorf("target %s has type %q", target.ID, target.Type),
+		}
+	}
+
+	strategy, canaryPercent, canarySeconds, err := ResolveStrategy(request.Strategy, request.CanaryPercent, request.CanaryDuration)
+	if err != nil {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    err.Error(),
+			Err:        err,
+		}
+	}
+
+	healthCheck, err := resolveHealthCheck(request.HealthCheck, projectConfig)
+	if err != nil {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    err.Error(),
+			Err:        err,
+		}
+	}
+
+	deployAt := time.Now()
+	if request.ScheduledAt != nil {
+		if !request.ScheduledAt.After(deployAt) || request.ScheduledAt.Sub(deployAt) > maxScheduleAhead {
+			return nil, nil, &utils.ServiceError{
+				StatusCode: http.StatusBadRequest,
+				Message:    fmt.Sprintf("scheduled_at must be in the future and within %d days", int(maxScheduleAhead.Hours()/24)),
+				Err:        fmt.Errorf("invalid scheduled_at %s", request.ScheduledAt.Format(time.RFC3339)),
+			}
+		}
+		deployAt = *request.ScheduledAt
+	}
+	overriddenBy, serviceErr := checkDeploymentFreeze(userID, project, deployAt, request.OverrideFreeze)
+	if serviceErr != nil {
+		return nil, nil, serviceErr
+	}
+
+	environment, err := normalizeEnvironment(request.Environment)
+	if err != nil {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    err.Error(),
+			Err:        err,
+		}
+	}
+	ref := strings.TrimSpace(request.Ref)
+	if ref != "" && (!refPattern.MatchString(ref) || strings.Contains(ref, "..")) {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("invalid ref %q", ref),
+			Err:        fmt.Errorf("ref %q is not a branch or tag name", ref),
+		}
+	}
+	policy, err := resolveApprovalPolicy(project, environment)
+	if err != nil {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to check approval policies",
+			Err:        err,
+		}
+	}
+
+	quota, serviceErr := plans.ReserveDeployment(userID, project.TeamID)
+	if serviceErr != nil {
+		return nil, quota, serviceErr
+	}
+
+	deployment := deployments.Deployment{
+		ProjectID:     project.ID,
+		TargetID:      target.ID,
+		Platform:      target.Type,
+		Environment:   environment,
+		Ref:           ref,
+		Status:        StatusPending,
+		Strategy:      strategy,
+		CanaryPercent: canaryPercent,
+		CanarySeconds: canarySeconds,
+		HealthCheck:   healthCheck,
+		TriggeredBy:   userID,
+	}
+	if request.ScheduledAt != nil {
+		deployment.Status = StatusScheduled
+		deployment.ScheduledAt = deployAt
+		deployment.ScheduledBy = userID
+	}
+	if policy != nil {
+		deployment.Status = StatusAwaitingApproval
+		deployment.RequiredApprovals = policy.RequiredApprovals
+		deployment.ApproverRole = policy.ApproverRole
+		deployment.ApprovalExpiresAt = time.Now().Add(time.Duration(policy.TimeoutMinutes) * time.Minute)
+	}
+	if overriddenBy != uuid.Nil {
+		deployment.OverriddenBy = overriddenBy
+		deployment.FreezeOverride = strings.TrimSpace(request.OverrideReason)
+	}
+	if serviceErr := createDeploymentRecord(&deployment, userID); serviceErr != nil {
+		plans.ReleaseDeployment(quota)
+		return nil, quota, serviceErr
+	}
+	plans.RecordDeploymentUsage(userID, project.ID)
+
+	if deployment.OverriddenBy != uuid.Nil {
+		appendLog(deployment.ID, fmt.Sprintf("🧊 Freeze window overridden by %s: %s", userID, deployment.FreezeOverride))
+	}
+	if deployment.Status == StatusAwaitingApproval {
+		requestApprovals(&deployment, project)
+		return toDeploymentResponse(deployment, false), quota, nil
+	}
+	if deployment.Status == StatusScheduled {
+		appendLog(deployment.ID, fmt.Sprintf("🗓️ Scheduled for %s by %s", deployAt.UTC().Format(time.RFC3339), userID))
+		return toDeploymentResponse(deployment, false), quota, nil
+	}
+
+	startDeployment(deployment.ID)
+	return toDeploymentResponse(deployment, false), quota, nil
+}
+
+// ListProjectDeployments returns the deployment history of a project, newest first
+func ListProjectDeployments(userID, projectID uuid.UUID, limit, offset int) ([]map[string]interface{}, *utils.ServiceError) {
+	if _, serviceErr := GetAccessibleProject(userID, projectID); serviceErr != nil {
+		return nil, serviceErr
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var list []deployments.Deployment
+	if err := config.DB.Omit("log", "config_snapshot").
+		Where("project_id = ?", projectID).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&list).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	response := make([]map[string]interface{}, 0, len(list))
+	for _, d := range list {
+		response = append(response, toDeploymentResponse(d, false))
+	}
+	return response, nil
+}
+
+// GetDeployment returns a deployment with its log and approval decisions
+func GetDeployment(userID, deploymentID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	deployment, serviceErr := GetAccessibleDeployment(userID, deploymentID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	response := toDeploymentResponse(*deployment, true)
+	if deployment.RequiredApprovals > 0 {
+		decisions, err := deploymentApprovals(deployment.ID)
+		if err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "DB error",
+				Err:        err,
+			}
+		}
+		approvals := make([]map[string]interface{}, 0, len(decisions))
+		for _, decision := range decisions {
+			approvals = append(approvals, toDeploymentApprovalResponse(decision))
+		}
+		response["approvals"] = approvals
+	}
+	return response, nil
+}
+
+// CancelDeployment stops a deployment that has not finished yet
+func CancelDeployment(userID, deploymentID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	deployment, serviceErr := GetAccessibleDeployment(userID, deploymentID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	if IsTerminalStatus(deployment.Status) {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("deployment already %s", deployment.Status),
+			Err:        fmt.Errorf("deployment %s is %s", deployment.ID, deployment.Status),
+		}
+	}
+
+	if err := transition(deployment, StatusCancelled); err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    "deployment could not be cancelled",
+			Err:        err,
+		}
+	}
+	appendLog(deployment.ID, "🛑 Cancelled by user")
+	stopDeployment(deployment.ID)
+
+	return toDeploymentResponse(*deployment, false), nil
+}
+
+// GetAccessibleDeployment loads a deployment of a project the user can access
+func GetAccessibleDeployment(userID, deploymentID uuid.UUID) (*deployments.Deployment, *utils.ServiceError) {
+	var deployment deployments.Deployment
+	if err := config.DB.First(&deployment, "id = ?", deploymentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "deployment not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	if _, serviceErr := GetAccessibleProject(userID, deployment.ProjectID); serviceErr != nil {
+		if serviceErr.StatusCode == http.StatusNotFound {
+			serviceErr.Message = "deployment not found"
+		}
+		return nil, serviceErr
+	}
+	return &deployment, nil
+}
+
+// GetAccessibleProject loads a project created by the user or owned by one of the user's teams
+func GetAccessibleProject(userID, projectID uuid.UUID) (*projects.Project, *utils.ServiceError) {
+	db := config.DB
+
+	var project projects.Project
+	if err := db.First(&project, "id = ?", projectID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "project not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	if project.CreatedBy == userID {
+		return &project, nil
+	}
+	isMember, err := teams.IsTeamMember(db, project.TeamID, userID)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if !isMember {
+		// Do not reveal projects the user cannot access
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "project not found",
+			Err:        fmt.Errorf("user %s cannot access project %s", userID, projectID),
+		}
+	}
+	return &project, nil
+}
+
+// Helper Functions
+func getProjectConfig(projectID uuid.UUID) (*projects.ProjectConfig, *utils.ServiceError) {
+	var projectConfig projects.ProjectConfig
+	if err := config.DB.First(&projectConfig, "project_id = ?", projectID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusConflict,
+				Message:    "project has no configuration to deploy",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return &projectConfig, nil
+}
+
+// createDeploymentRecord stores the deployment together with its project link
+func createDeploymentRecord(deployment *deployments.Deployment, userID uuid.UUID) *utils.ServiceError {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(deployment).Error; err != nil {
+			return err
+		}
+		link := projects.ProjectDeployment{
+			ProjectID:    deployment.ProjectID,
+			DeploymentID: deployment.ID,
+			UpdatedBy:    userID,
+		}
+		return tx.Create(&link).Error
+	})
+	if err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to create deployment",
+			Err:        err,
+		}
+	}
+	store.OpenEventStream(deploymentStreamKey(deployment.ID), userID)
+	return nil
+}
+
+func toDeploymentResponse(d deployments.Deployment, withLog bool) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":              d.ID,
+		"project_id":      d.ProjectID,
+		"target_id":       d.TargetID,
+		"platform":        d.Platform,
+		"environment":     d.Environment,
+		"ref":             d.Ref,
+		"status":          d.Status,
+		"strategy":        d.Strategy,
+		"image_ref":       d.ImageRef,
+		"image_id":        d.ImageID,
+		"rollback_to":     uuidOrNil(d.RollbackToID),
+		"reason":          d.Reason,
+		"failure":         d.FailureReason,
+		"triggered_by":    d.TriggeredBy,
+		"scheduled_at":    timeOrNil(d.ScheduledAt),
+		"scheduled_by":    uuidOrNil(d.ScheduledBy),
+		"overridden_by":   uuidOrNil(d.OverriddenBy),
+		"freeze_override": d.FreezeOverride,
+		"started_at":      timeOrNil(d.StartedAt),
+		"finished_at":     timeOrNil(d.FinishedAt),
+		"created_at":      d.CreatedAt,
+		"updated_at":      d.UpdatedAt,
+	}
+	if d.RequiredApprovals > 0 {
+		response["approval"] = map[string]interface{}{
+			"required":      d.RequiredApprovals,
+			"approver_role": d.ApproverRole,
+			"expires_at":    d.ApprovalExpiresAt,
+		}
+	}
+	if d.HealthCheck != "" {
+		response["health_check"] = json.RawMessage(d.HealthCheck)
+	}
+	if withLog {
+		response["log"] = d.Log
+	}
+	return response
+}
+
+func uuidOrNil(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
+func timeOrNil(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,83 @@
+package deployments
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusAwaitingApproval, StatusPending, true},
+		{StatusAwaitingApproval, StatusScheduled, true},
+		{StatusAwaitingApproval, StatusRejected, true},
+		{StatusAwaitingApproval, StatusExpired, true},
+		{StatusAwaitingApproval, StatusDeploying, false},
+		{StatusScheduled, StatusPending, true},
+		{StatusScheduled, StatusCancelled, true},
+		{StatusScheduled, StatusBuilding, false},
+		{StatusPending, StatusBuilding, true},
+		{StatusPending, StatusDeploying, true},
+		{StatusPending, StatusSucceeded, false},
+		{StatusBuilding, StatusDeploying, true},
+		{StatusBuilding, StatusFailed, true},
+		{StatusBuilding, StatusPending, false},
+		{StatusDeploying, StatusSucceeded, true},
+		{StatusDeploying, StatusCancelled, true},
+		{StatusDeploying, StatusBuilding, false},
+		{StatusSucceeded, StatusFailed, false},
+		{StatusFailed, StatusPending, false},
+		{StatusCancelled, StatusPending, false},
+		{StatusRejected, StatusPending, false},
+		{StatusExpired, StatusAwaitingApproval, false},
+		{StatusPending, StatusPending, false},
+		{"unknown", StatusPending, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestIsTerminalStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{StatusAwaitingApproval, false},
+		{StatusScheduled, false},
+		{StatusPending, false},
+		{StatusBuilding, false},
+		{StatusDeploying, false},
+		{StatusSucceeded, true},
+		{StatusFailed, true},
+		{StatusCancelled, true},
+		{StatusRejected, true},
+		{StatusExpired, true},
+	}
+	for _, tt := range tests {
+		if got := IsTerminalStatus(tt.status); got != tt.want {
+			t.Errorf("IsTerminalStatus(%s) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestRefPattern(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"main", true},
+		{"release/1.2", true},
+		{"v1.2.0", true},
+		{"", false},
+		{"-main", false},
+		{"main branch", false},
+		{"main;rm", false},
+	}
+	for _, tt := range tests {
+		if got := refPattern.MatchString(tt.ref); got != tt.want {
+			t.Errorf("refPattern.MatchString(%q) = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,654 @@
+package deployments
+
+import (
+	"archive/zip"
+	"context"
+	"deva/src/config"
+	"deva/src/lib/docker"
+	deployments "deva/src/modules/deployments/models"
+	notifications "deva/src/modules/notifications/services"
+	projects "deva/src/modules/projects/models"
+	secrets "deva/src/modules/secrets/models"
+	"deva/src/services"
+	"deva/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	deploymentTimeout   = 45 * time.Minute
+	containerStartGrace = 3 * time.Second
+	logFlushInterval    = time.Second
+	logFlushLines       = 25
+)
+
+var (
+	runningDeployments = make(map[uuid.UUID]context.CancelFunc)
+	runningMutex       sync.Mutex
+
+	errDeploymentCancelled = errors.New("deployment cancelled")
+	dnsLabelInvalid        = regexp.MustCompile(`[^a-z0-9-]+`)
+)
+
+// deploymentContext is everything the engine needs to deploy one project version
+type deploymentContext struct {
+	deployment    *deployments.Deployment
+	project       *projects.Project
+	projectConfig *projects.ProjectConfig
+	target        *deployments.DeploymentTarget
+	client        *docker.Client
+	logger        *deploymentLogger
+	snapshot      *containerSnapshot
+	verified      bool // the health check already passed before traffic moved
+}
+
+// containerSnapshot is the rendered container of a deployment. It is stored encrypted on the
+// deployment because the env holds decrypted secrets.
+type containerSnapshot struct {
+	Name   string                 `json:"name"`
+	Config docker.ContainerConfig `json:"config"`
+}
+
+// healthCheckError reports a deployed container that did not come up healthy. trafficKept is
+// set when a strategy never moved traffic off the previous container, so no rollback is needed.
+type healthCheckError struct {
+	reason      string
+	trafficKept bool
+}
+
+func (e *healthCheckError) Error() string {
+	return "health check failed: " + e.reason
+}
+
+// RecoverInterruptedDeployments fails deployments left unfinished by a previous server process
+func RecoverInterruptedDeployments() {
+	var interrupted []deployments.Deployment
+	if err := config.DB.Select("id", "status").
+		Where("status IN ?", []string{StatusPending, StatusBuilding, StatusDeploying}).
+		Find(&interrupted).Error; err != nil {
+		log.Printf("⚠️ Failed to load interrupted deployments: %v", err)
+		return
+	}
+
+	for i := range interrupted {
+		if err := transition(&interrupted[i], StatusFailed); err == nil {
+			appendLog(interrupted[i].ID, "❌ Interrupted by a server restart")
+		}
+	}
+}
+
+// startDeployment runs a pending deployment in the background
+func startDeployment(deploymentID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), deploymentTimeout)
+
+	runningMutex.Lock()
+	runningDeployments[deploymentID] = cancel
+	runningMutex.Unlock()
+
+	go func() {
+		defer func() {
+			runningMutex.Lock()
+			delete(runningDeployments, deploymentID)
+			runningMutex.Unlock()
+			cancel()
+		}()
+		runDeployment(ctx, deploymentID)
+	}()
+}
+
+// stopDeployment aborts the in-flight work of a running deployment
+func stopDeployment(deploymentID uuid.UUID) {
+	runningMutex.Lock()
+	cancel, ok := runningDeployments[deploymentID]
+	runningMutex.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+func runDeployment(ctx context.Context, deploymentID uuid.UUID) {
+	var deployment deployments.Deployment
+	if err := config.DB.Omit("log").First(&deployment, "id = ?", deploymentID).Error; err != nil {
+		log.Printf("⚠️ Failed to load deployment %s: %v", deploymentID, err)
+		return
+	}
+
+	logger := newDeploymentLogger(deployment.ID)
+	defer logger.Close()
+
+	err := executeDeployment(ctx, &deployment, logger)
+	logger.Flush()
+
+	switch {
+	case err == nil:
+		if err := transition(&deployment, StatusSucceeded); err != nil {
+			log.Printf("⚠️ Failed to complete deployment %s: %v", deployment.ID, err)
+			return
+		}
+		appendLog(deployment.ID, "✅ Deployment succeeded")
+	case errors.Is(err, errDeploymentCancelled) || errors.Is(err, context.Canceled):
+		// CancelDeployment already recorded the final status
+	default:
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s", deploymentTimeout)
+		}
+		appendLog(deployment.ID, fmt.Sprintf("❌ %v", err))
+		if err := config.DB.Model(&deployments.Deployment{}).Where("id = ?", deployment.ID).
+			Update("failure_reason", err.Error()).Error; err != nil {
+			log.Printf("⚠️ Failed to record failure of deployment %s: %v", deployment.ID, err)
+		}
+		if err := transition(&deployment, StatusFailed); err != nil {
+			if !errors.Is(err, errDeploymentCancelled) {
+				log.Printf("⚠️ Failed to mark deployment %s as failed: %v", deployment.ID, err)
+			}
+			return
+		}
+
+		var healthErr *healthCheckError
+		if errors.As(err, &healthErr) {
+			handleFailedHealthCheck(&deployment, healthErr)
+		}
+	}
+}
+
+// handleFailedHealthCheck restores the last healthy deployment when traffic already reached the
+// broken version, and tells the user who triggered the deployment what happened
+func handleFailedHealthCheck(deployment *deployments.Deployment, healthErr *healthCheckError) {
+	metadata := map[string]interface{}{
+		"deployment_id": deployment.ID,
+		"project_id":    deployment.ProjectID,
+		"reason":        healthErr.Error(),
+	}
+	message := fmt.Sprintf("Deployment %s failed its health check (%s).", deployment.ID, healthErr.reason)
+
+	switch {
+	case healthErr.trafficKept:
+		appendLog(deployment.ID, "↩️ Traffic stayed on the previous container, no rollback needed")
+		message += " Traffic stayed on the previous version."
+	case deployment.RollbackToID != uuid.Nil:
+		// Never roll back a rollback: that could loop between two broken versions
+		message += " It was a rollback, so no further rollback was attempted."
+	default:
+		if rollback := rollbackToLastHealthy(deployment, healthErr.Error()); rollback != nil {
+			metadata["rollback_id"] = rollback.ID
+			metadata["restored_deployment_id"] = rollback.RollbackToID
+			message += fmt.Sprintf(" Rolling back to deployment %s.", rollback.RollbackToID)
+		} else {
+			message += " No earlier healthy deployment was available to roll back to."
+		}
+	}
+
+	if err := notifications.Notify(deployment.TriggeredBy, notifications.TypeDeployment, message, metadata); err != nil {
+		log.Printf("⚠️ Failed to notify user %s about deployment %s: %v", deployment.TriggeredBy, deployment.ID, err)
+	}
+}
+
+func executeDeployment(ctx context.Context, deployment *deployments.Deployment, logger *deploymentLogger) error {
+	dc, err := loadDeploymentContext(deployment, logger)
+	if err != nil {
+		return err
+	}
+
+	// Rollbacks skip the build and replay the artifact of the restored deployment
+	if deployment.RollbackToID == uuid.Nil {
+		if err := transition(deployment, StatusBuilding); err != nil {
+			return err
+		}
+		if err := buildImage(ctx, dc); err != nil {
+			return err
+		}
+		if dc.snapshot, err = renderContainer(dc); err != nil {
+			return err
+		}
+	}
+
+	if err := transition(deployment, StatusDeploying); err != nil {
+		return err
+	}
+	if deployment.RollbackToID != uuid.Nil {
+		if err := restoreSnapshot(ctx, dc); err != nil {
+			return err
+		}
+	}
+	if err := saveSnapshot(dc); err != nil {
+		return err
+	}
+	if err := deployContainer(ctx, dc); err != nil {
+		return err
+	}
+	return verifyDeployment(ctx, dc)
+}
+
+func loadDeploymentContext(deployment *deployments.Deployment, logger *deploymentLogger) (*deploymentContext, error) {
+	db := config.DB
+	dc := &deploymentContext{deployment: deployment, logger: logger}
+
+	dc.project = &projects.Project{}
+	if err := db.First(dc.project, "id = ?", deployment.ProjectID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load project: %w", err)
+	}
+	dc.projectConfig = &projects.ProjectConfig{}
+	if err := db.First(dc.projectConfig, "project_id = ?", deployment.ProjectID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load project config: %w", err)
+	}
+	dc.target = &deployments.DeploymentTarget{}
+	if err := db.First(dc.target, "id = ?", deployment.TargetID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load deployment target: %w", err)
+	}
+
+	client, err := dockerClientForTarget(dc.target)
+	if err != nil {
+		return nil, err
+	}
+	dc.client = client
+	return dc, nil
+}
+
+// buildImage builds the exported project archive on the target host
+func buildImage(ctx context.Context, dc *deploymentContext) error {
+	if _, err := dc.client.Ping(ctx); err != nil {
+		return err
+	}
+
+	workspace, cleanup, err := ExtractProjectArchive(dc.project.Name)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	imageRef := fmt.Sprintf("%s:%s", dnsLabel(dc.project.Name), dc.deployment.ID.String()[:8])
+	dc.logger.Write(fmt.Sprintf("🔨 Building image %s on %s", imageRef, dc.target.Host))
+
+	buildContext, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(docker.TarDirectory(workspace, writer))
+	}()
+	defer buildContext.Close()
+
+	result, err := dc.client.ImageBuild(ctx, buildContext, docker.BuildOptions{
+		Tags: []string{imageRef},
+		Labels: map[string]string{
+			"deva.project":    dc.project.ID.String(),
+			"deva.deployment": dc.deployment.ID.String(),
+		},
+	}, func(msg docker.BuildMessage) {
+		if line := strings.TrimRight(msg.Stream, "\n"); strings.TrimSpace(line) != "" {
+			dc.logger.Write(line)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	dc.deployment.ImageRef = imageRef
+	dc.deployment.ImageID = result.ImageID
+	if err := config.DB.Model(&deployments.Deployment{}).Where("id = ?", dc.deployment.ID).Updates(map[string]interface{}{
+		"image_ref": imageRef,
+		"image_id":  result.ImageID,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record image: %w", err)
+	}
+	dc.logger.Write(fmt.Sprintf("📦 Built image %s (%s)", imageRef, result.ImageID))
+	return nil
+}
+
+// renderContainer builds the container configuration of a freshly built image
+func renderContainer(dc *deploymentContext) (*containerSnapshot, error) {
+	env, err := containerEnv(dc.projectConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	containerConfig := docker.ContainerConfig{
+		Image: dc.deployment.ImageRef,
+		Labels: map[string]string{
+			"deva.project":    dc.project.ID.String(),
+			"deva.deployment": dc.deployment.ID.String(),
+		},
+		HostConfig: &docker.HostConfig{RestartPolicy: &docker.RestartPolicy{Name: "unless-stopped"}},
+	}
+	for key, value := range env {
+		containerConfig.Env = append(containerConfig.Env, key+"="+value)
+	}
+	sort.Strings(containerConfig.Env)
+	if port := env["APP_PORT"]; port != "" {
+		containerConfig.ExposedPorts = map[string]struct{}{port + "/tcp": {}}
+		containerConfig.HostConfig.PortBindings = map[string][]docker.PortBinding{port + "/tcp": {{HostPort: port}}}
+	}
+
+	return &containerSnapshot{Name: "deva-" + dnsLabel(dc.project.Name), Config: containerConfig}, nil
+}
+
+// restoreSnapshot loads the container of the deployment being rolled back to and pins it to its image digest
+func restoreSnapshot(ctx context.Context, dc *deploymentContext) error {
+	var source deployments.Deployment
+	if err := config.DB.Omit("log").First(&source, "id = ?", dc.deployment.RollbackToID).Error; err != nil {
+		return fmt.Errorf("failed to load deployment to restore: %w", err)
+	}
+	snapshot, err := decryptSnapshot(source.ConfigSnapshot)
+	if err != nil {
+		return fmt.Errorf("failed to restore the configuration of deployment %s: %w", source.ID, err)
+	}
+
+	if _, err := dc.client.ImageInspect(ctx, source.ImageID); err != nil {
+		if docker.IsNotFound(err) {
+			return fmt.Errorf("image %s of deployment %s is no longer on %s", source.ImageID, source.ID, dc.target.Host)
+		}
+		return err
+	}
+	dc.logger.Write(fmt.Sprintf("↩️ Restoring deployment %s (%s, %s)", source.ID, source.ImageRef, source.ImageID))
+
+	snapshot.Config.Image = source.ImageID
+	snapshot.Config.Labels["deva.deployment"] = dc.deployment.ID.String()
+	snapshot.Config.Labels["deva.rollback-to"] = source.ID.String()
+	dc.snapshot = snapshot
+
+	dc.deployment.ImageRef = source.ImageRef
+	dc.deployment.ImageID = source.ImageID
+	if err := config.DB.Model(&deployments.Deployment{}).Where("id = ?", dc.deployment.ID).Updates(map[string]interface{}{
+		"image_ref": source.ImageRef,
+		"image_id":  source.ImageID,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record image: %w", err)
+	}
+	return nil
+}
+
+// saveSnapshot stores the rendered container so the deployment can be rolled back to later
+func saveSnapshot(dc *deploymentContext) error {
+	raw, err := json.Marshal(dc.snapshot)
+	if err != nil {
+		return err
+	}
+	encrypted, err := services.Encrypt(raw)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt container snapshot: %w", err)
+	}
+	dc.deployment.ConfigSnapshot = encrypted
+	return config.DB.Model(&deployments.Deployment{}).Where("id = ?", dc.deployment.ID).
+		Update("config_snapshot", encrypted).Error
+}
+
+func decryptSnapshot(encrypted string) (*containerSnapshot, error) {
+	if encrypted == "" {
+		return nil, errors.New("no container snapshot recorded")
+	}
+	raw, err := services.Decrypt(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot containerSnapshot
+	if err := json.Unmarshal(raw, &snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.Config.Labels == nil {
+		snapshot.Config.Labels = map[string]string{}
+	}
+	return &snapshot, nil
+}
+
+// startContainer replaces the container called name with a new one and waits until it is up
+func startContainer(ctx context.Context, dc *deploymentContext, name string, containerConfig docker.ContainerConfig) error {
+	if err := dc.client.ContainerRemove(ctx, name, true, false); err != nil && !docker.IsNotFound(err) {
+		return err
+	}
+
+	dc.logger.Write(fmt.Sprintf("🚀 Starting container %s", name))
+	created, err := dc.client.ContainerCreate(ctx, name, containerConfig)
+	if err != nil {
+		return err
+	}
+	for _, warning := range created.Warnings {
+		dc.logger.Write("⚠️ " + warning)
+	}
+	if err := dc.client.ContainerStart(ctx, created.ID); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(containerStartGrace):
+	}
+	if err := checkContainer(ctx, dc, created.ID); err != nil {
+		return err
+	}
+	dc.logger.Write(fmt.Sprintf("✔ Container %s is running", name))
+	return nil
+}
+
+// checkContainer verifies that a container is running and not reported unhealthy by Docker
+func checkContainer(ctx context.Context, dc *deploymentContext, id string) error {
+	info, err := dc.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !info.State.Running {
+		return &healthCheckError{reason: fmt.Sprintf("container exited with code %d", info.State.ExitCode)}
+	}
+	if info.State.Health != nil && info.State.Health.Status == "unhealthy" {
+		return &healthCheckError{reason: "container reported unhealthy by its HEALTHCHECK"}
+	}
+	return nil
+}
+
+// transition moves a deployment to a new status. The update only applies if nobody changed
+// the status in the meantime; a lost race can only be a cancellation.
+func transition(deployment *deployments.Deployment, to string) error {
+	if !CanTransition(deployment.Status, to) {
+		return fmt.Errorf("invalid deployment transition %s → %s", deployment.Status, to)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": to}
+	starting := deployment.Status == StatusPending && !IsTerminalStatus(to)
+	if starting {
+		updates["started_at"] = now
+	}
+	if IsTerminalStatus(to) {
+		updates["finished_at"] = now
+	}
+
+	result := config.DB.Model(&deployments.Deployment{}).
+		Where("id = ? AND status = ?", deployment.ID, deployment.Status).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errDeploymentCancelled
+	}
+
+	deployment.Status = to
+	if starting {
+		deployment.StartedAt = now
+	}
+	if IsTerminalStatus(to) {
+		deployment.FinishedAt = now
+	}
+	appendLog(deployment.ID, statusLogPrefix+to)
+	if IsTerminalStatus(to) {
+		store.CloseEventStream(deploymentStreamKey(deployment.ID), to)
+	} else {
+		store.PublishStatus(deploymentStreamKey(deployment.ID), to)
+	}
+	return nil
+}
+
+// appendLog adds a timestamped line to the deployment log
+func appendLog(deploymentID uuid.UUID, line string) {
+	appendLogLines(deploymentID, []string{line})
+}
+
+func appendLogLines(deploymentID uuid.UUID, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	var entry strings.Builder
+	stamp := time.Now().UTC().Format(time.RFC3339)
+	for _, line := range lines {
+		entry.WriteString(fmt.Sprintf("[%s] %s\n", stamp, line))
+	}
+
+	if err := config.DB.Model(&deployments.Deployment{}).
+		Where("id = ?", deploymentID).
+		Update("log", gorm.Expr("COALESCE(log, '') || ?", entry.String())).Error; err != nil {
+		log.Printf("⚠️ Failed to append deployment log for %s: %v", deploymentID, err)
+		return
+	}
+	// One event per stored line keeps live event IDs in step with replays of the stored log
+	streamKey := deploymentStreamKey(deploymentID)
+	for _, line := range strings.Split(strings.TrimSuffix(entry.String(), "\n"), "\n") {
+		store.PublishLog(streamKey, line)
+	}
+}
+
+// deploymentLogger batches chatty output (e.g. build progress) into fewer log updates
+type deploymentLogger struct {
+	deploymentID uuid.UUID
+	mu           sync.Mutex
+	lines        []string
+	lastFlush    time.Time
+}
+
+func newDeploymentLogger(deploymentID uuid.UUID) *deploymentLogger {
+	return &deploymentLogger{deploymentID: deploymentID, lastFlush: time.Now()}
+}
+
+func (l *deploymentLogger) Write(line string) {
+	l.mu.Lock()
+	l.lines = append(l.lines, line)
+	flush := len(l.lines) >= logFlushLines || time.Since(l.lastFlush) >= logFlushInterval
+	l.mu.Unlock()
+
+	if flush {
+		l.Flush()
+	}
+}
+
+func (l *deploymentLogger) Flush() {
+	l.mu.Lock()
+	lines := l.lines
+	l.lines = nil
+	l.lastFlush = time.Now()
+	l.mu.Unlock()
+
+	appendLogLines(l.deploymentID, lines)
+}
+
+func (l *deploymentLogger) Close() {
+	l.Flush()
+}
+
+// ExtractProjectArchive unpacks public/<project>.zip into a temp directory and returns its cleanup
+func ExtractProjectArchive(projectName string) (string, func(), error) {
+	reader, err := zip.OpenReader(filepath.Join("public", projectName+".zip"))
+	if err != nil {
+		return "", nil, fmt.Errorf("project archive not found: %w", err)
+	}
+	defer reader.Close()
+
+	dir, err := os.MkdirTemp("", "deva-deploy-"+projectName+"-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+
+	for _, file := range reader.File {
+		target := filepath.Join(dir, filepath.FromSlash(file.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			cleanup()
+			return "", nil, fmt.Errorf("invalid path %q in project archive", file.Name)
+		}
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				cleanup()
+				return "", nil, err
+			}
+			continue
+		}
+		if err := extractZipFile(file, target); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+	return dir, cleanup, nil
+}
+
+// Helper Functions
+func dockerClientForTarget(target *deployments.DeploymentTarget) (*docker.Client, error) {
+	var auth DockerTLSAuth
+	if err := DecryptAuth(target.Auth, &auth); err != nil {
+		return nil, fmt.Errorf("failed to decrypt target credentials: %w", err)
+	}
+	tlsConfig, err := docker.TLSConfigFromPEM([]byte(auth.CACert), []byte(auth.Cert), []byte(auth.Key))
+	if err != nil {
+		return nil, err
+	}
+	return docker.NewClient(target.Host, tlsConfig)
+}
+
+// containerEnv merges the project env vars with its decrypted runtime secrets
+func containerEnv(projectConfig *projects.ProjectConfig) (map[string]string, error) {
+	env := map[string]string{}
+	if projectConfig.EnvVars != "" {
+		if err := json.Unmarshal([]byte(projectConfig.EnvVars), &env); err != nil {
+			return nil, fmt.Errorf("invalid project env vars: %w", err)
+		}
+	}
+
+	var projectSecrets []secrets.Secret
+	if err := config.DB.Where("project_id = ? AND scope IN ?", projectConfig.ProjectID, []string{"runtime", "both"}).
+		Find(&projectSecrets).Error; err != nil {
+		return nil, fmt.Errorf("failed to load project secrets: %w", err)
+	}
+	for _, secret := range projectSecrets {
+		value, err := services.Decrypt(secret.ValueEncrypted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret %s: %w", secret.Key, err)
+		}
+		env[secret.Key] = string(value)
+	}
+	return env, nil
+}
+
+func extractZipFile(file *zip.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, file.Mode().Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// dnsLabel converts a name into a valid lowercase DNS label usable as image and container name
+func dnsLabel(name string) string {
+	label := dnsLabelInvalid.ReplaceAllString(strings.ToLower(name), "-")
+	if len(label) > 63 {
+		label = label[:63]
+	}
+	return strings.Trim(label, "-")
+}
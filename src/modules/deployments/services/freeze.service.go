@@ -0,0 +1,403 @@
+package deployments
+
+import (
+	"deva/src/config"
+	"deva/src/lib/dto"
+	deployments "deva/src/modules/deployments/models"
+	projects "deva/src/modules/projects/models"
+	roles "deva/src/modules/roles/services"
+	teams "deva/src/modules/teams/services"
+	"deva/src/utils"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Freeze window recurrences
+const (
+	FreezeOnce   = "once"
+	FreezeWeekly = "weekly"
+)
+
+var freezeWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// CreateFreezeWindow declares a freeze window for a project or for every project of a team
+func CreateFreezeWindow(userID uuid.UUID, request dto.CreateFreezeWindowRequest) (map[string]interface{}, *utils.ServiceError) {
+	if (request.ProjectID == uuid.Nil) == (request.TeamID == uuid.Nil) {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "set exactly one of project_id and team_id",
+			Err:        errors.New("freeze window needs a project or a team"),
+		}
+	}
+	if serviceErr := checkFreezeScope(userID, request.ProjectID, request.TeamID); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	window, err := newFreezeWindow(request)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    err.Error(),
+			Err:        err,
+		}
+	}
+	window.CreatedBy = userID
+	window.UpdatedBy = userID
+	if err := config.DB.Create(window).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to create freeze window",
+			Err:        err,
+		}
+	}
+	return toFreezeWindowResponse(*window, time.Now()), nil
+}
+
+// ListFreezeWindows returns the freeze windows of a team, or those that apply to a project: its
+// own and its team's
+func ListFreezeWindows(userID, projectID, teamID uuid.UUID) ([]map[string]interface{}, *utils.ServiceError) {
+	if serviceErr := checkFreezeScope(userID, projectID, teamID); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	var windows []deployments.FreezeWindow
+	var err error
+	if projectID != uuid.Nil {
+		var project projects.Project
+		if err = config.DB.Select("id", "team_id").First(&project, "id = ?", projectID).Error; err == nil {
+			windows, err = projectFreezeWindows(&project)
+		}
+	} else {
+		err = config.DB.Where("team_id = ?", teamID).Order("created_at DESC").Find(&windows).Error
+	}
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to list freeze windows",
+			Err:        err,
+		}
+	}
+
+	now := time.Now()
+	result := make([]map[string]interface{}, 0, len(windows))
+	for _, window := range windows {
+		result = append(result, toFreezeWindowResponse(window, now))
+	}
+	return result, nil
+}
+
+// DeleteFreezeWindow lifts a freeze window. Its creator, the owner of its team and admins may
+// delete it.
+func DeleteFreezeWindow(userID, windowID uuid.UUID) *utils.ServiceError {
+	var window deployments.FreezeWindow
+	if err := config.DB.First(&window, "id = ?", windowID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "freeze window not found",
+				Err:        err,
+			}
+		}
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if serviceErr := checkFreezeScope(userID, window.ProjectID, window.TeamID); serviceErr != nil {
+		serviceErr.Message = "freeze window not found"
+		return serviceErr
+	}
+
+	teamID := window.TeamID
+	if window.ProjectID != uuid.Nil {
+		var project projects.Project
+		if err := config.DB.Select("team_id").First(&project, "id = ?", window.ProjectID).Error; err == nil {
+			teamID = project.TeamID
+		}
+	}
+	if window.CreatedBy != userID {
+		allowed, err := isDeploymentAdmin(userID, teamID)
+		if err != nil {
+			return &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "DB error",
+				Err:        err,
+			}
+		}
+		if !allowed {
+			return &utils.ServiceError{
+				StatusCode: http.StatusForbidden,
+				Message:    "only the creator, the team owner or an admin can lift this freeze window",
+				Err:        fmt.Errorf("user %s cannot delete freeze window %s", userID, window.ID),
+			}
+		}
+	}
+
+	if err := config.DB.Model(&window).Update("updated_by", userID).Error; err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if err := config.DB.Delete(&window).Error; err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to delete freeze window",
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// checkDeploymentFreeze rejects a deployment of the project at the given time when a freeze window
+// covers it, unless the user overrides the freeze and is allowed to. It returns who overrode.
+func checkDeploymentFreeze(userID uuid.UUID, project *projects.Project, at time.Time, override bool) (uuid.UUID, *utils.ServiceError) {
+	window, until, err := activeFreeze(project, at)
+	if err != nil {
+		return uuid.Nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to check freeze windows",
+			Err:        err,
+		}
+	}
+	if window == nil {
+		return uuid.Nil, nil
+	}
+
+	if !override {
+		message := fmt.Sprintf("deployments are frozen by %q until %s", window.Name, until.UTC().Format(time.RFC3339))
+		if window.Reason != "" {
+			message += ": " + window.Reason
+		}
+		return uuid.Nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    message,
+			Err:        fmt.Errorf("project %s is frozen by window %s", project.ID, window.ID),
+		}
+	}
+
+	allowed, err := isDeploymentAdmin(userID, project.TeamID)
+	if err != nil {
+		return uuid.Nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if !allowed {
+		return uuid.Nil, &utils.ServiceError{
+			StatusCode: http.StatusForbidden,
+			Message:    "only an admin or the team owner can deploy during a freeze window",
+			Err:        fmt.Errorf("user %s cannot override freeze window %s", userID, window.ID),
+		}
+	}
+	return userID, nil
+}
+
+// activeFreeze returns the freeze window covering the project at the given time and when it ends
+func activeFreeze(project *projects.Project, at time.Time) (*deployments.FreezeWindow, time.Time, error) {
+	windows, err := projectFreezeWindows(project)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	for i := range windows {
+		if until, covered := freezeCovers(windows[i], at); covered {
+			return &windows[i], until, nil
+		}
+	}
+	return nil, time.Time{}, nil
+}
+
+// Helper Functions
+func projectFreezeWindows(project *projects.Project) ([]deployments.FreezeWindow, error) {
+	query := config.DB.Where("project_id = ?", project.ID)
+	if project.TeamID != uuid.Nil {
+		query = config.DB.Where("project_id = ? OR team_id = ?", project.ID, project.TeamID)
+	}
+	var windows []deployments.FreezeWindow
+	err := query.Order("created_at DESC").Find(&windows).Error
+	return windows, err
+}
+
+func checkFreezeScope(userID, projectID, teamID uuid.UUID) *utils.ServiceError {
+	if projectID != uuid.Nil {
+		_, serviceErr := GetAccessibleProject(userID, projectID)
+		return serviceErr
+	}
+	if teamID == uuid.Nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "project_id or team_id is required",
+			Err:        errors.New("missing freeze window scope"),
+		}
+	}
+
+	isMember, err := teams.IsTeamMember(config.DB, teamID, userID)
+	if err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if !isMember {
+		return &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "team not found",
+			Err:        fmt.Errorf("user %s is not a member of team %s", userID, teamID),
+		}
+	}
+	return nil
+}
+
+// isDeploymentAdmin reports whether the user may override freezes or manage approval policies:
+// admins everywhere, team owners for their team
+func isDeploymentAdmin(userID, teamID uuid.UUID) (bool, error) {
+	if role, err := roles.GetRoleByUserID(userID); err == nil && role.Name == "admin" {
+		return true, nil
+	}
+	return teams.IsTeamOwner(config.DB, teamID, userID)
+}
+
+func newFreezeWindow(request dto.CreateFreezeWindowRequest) (*deployments.FreezeWindow, error) {
+	window := &deployments.FreezeWindow{
+		ProjectID: request.ProjectID,
+		TeamID:    request.TeamID,
+		Name:      strings.TrimSpace(request.Name),
+		Reason:    strings.TrimSpace(request.Reason),
+		Timezone:  request.Timezone,
+	}
+	if window.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if window.Timezone == "" {
+		window.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(window.Timezone); err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", window.Timezone)
+	}
+
+	if len(request.Days) == 0 {
+		if request.StartsAt.IsZero() || request.EndsAt.IsZero() || !request.EndsAt.After(request.StartsAt) {
+			return nil, errors.New("starts_at and ends_at are required, ends_at after starts_at (or set days for a weekly window)")
+		}
+		if request.StartTime != "" || request.EndTime != "" {
+			return nil, errors.New("start_time and end_time only apply to weekly windows")
+		}
+		window.Recurrence = FreezeOnce
+		window.StartsAt = request.StartsAt
+		window.EndsAt = request.EndsAt
+		return window, nil
+	}
+
+	days := make([]string, 0, len(request.Days))
+	for _, day := range request.Days {
+		day = strings.ToLower(strings.TrimSpace(day))
+		if len(day) > 3 {
+			day = day[:3]
+		}
+		if _, ok := freezeWeekdays[day]; !ok {
+			return nil, fmt.Errorf("unknown weekday %q", day)
+		}
+		days = append(days, day)
+	}
+	for _, clock := range []string{request.StartTime, request.EndTime} {
+		if _, err := time.Parse("15:04", clock); clock != "" && err != nil {
+			return nil, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+		}
+	}
+	if (request.StartTime == "") != (request.EndTime == "") {
+		return nil, errors.New("set both start_time and end_time, or neither for whole days")
+	}
+	window.Recurrence = FreezeWeekly
+	window.Days = strings.Join(days, ",")
+	window.StartTime = request.StartTime
+	window.EndTime = request.EndTime
+	return window, nil
+}
+
+// freezeCovers reports whether the window covers the given time and when the freeze ends.
+// Back-to-back weekly occurrences, like a whole weekend, count as one freeze.
+func freezeCovers(window deployments.FreezeWindow, at time.Time) (time.Time, bool) {
+	if window.Recurrence != FreezeWeekly {
+		return window.EndsAt, !at.Before(window.StartsAt) && at.Before(window.EndsAt)
+	}
+
+	until, covered := weeklyOccurrence(window, at)
+	for i := 0; covered && i < 7; i++ {
+		next, continues := weeklyOccurrence(window, until)
+		if !continues {
+			break
+		}
+		until = next
+	}
+	return until, covered
+}
+
+// weeklyOccurrence reports whether an occurrence of a weekly window covers the given time and
+// when that occurrence ends
+func weeklyOccurrence(window deployments.FreezeWindow, at time.Time) (time.Time, bool) {
+
+	location, err := time.LoadLocation(window.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	local := at.In(location)
+	start, _ := time.Parse("15:04", window.StartTime)
+	end, _ := time.Parse("15:04", window.EndTime)
+
+	// An occurrence that started the day before may still be running
+	for _, offset := range []int{0, -1} {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, location)
+		if !strings.Contains(window.Days, strings.ToLower(day.Weekday().String()[:3])) {
+			continue
+		}
+		from := day.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+		until := day.Add(time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute)
+		if !until.After(from) {
+			until = until.AddDate(0, 0, 1)
+		}
+		if !local.Before(from) && local.Before(until) {
+			return until, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func toFreezeWindowResponse(w deployments.FreezeWindow, now time.Time) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":         w.ID,
+		"project_id": uuidOrNil(w.ProjectID),
+		"team_id":    uuidOrNil(w.TeamID),
+		"name":       w.Name,
+		"reason":     w.Reason,
+		"recurrence": w.Recurrence,
+		"timezone":   w.Timezone,
+		"created_by": w.CreatedBy,
+		"created_at": w.CreatedAt,
+	}
+	if w.Recurrence == FreezeWeekly {
+		response["days"] = strings.Split(w.Days, ",")
+		response["start_time"] = w.StartTime
+		response["end_time"] = w.EndTime
+	} else {
+		response["starts_at"] = w.StartsAt
+		response["ends_at"] = w.EndsAt
+	}
+	until, active := freezeCovers(w, now)
+	response["active"] = active
+	if active {
+		response["active_until"] = until
+	}
+	return response
+}
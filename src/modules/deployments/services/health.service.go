@@ -0,0 +1,285 @@
+package deployments
+
+import (
+	"context"
+	"deva/src/lib/dto"
+	projects "deva/src/modules/projects/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Health check types
+const (
+	HealthCheckHTTP = "http"
+	HealthCheckTCP  = "tcp"
+)
+
+// Health check defaults, applied to zero values
+const (
+	defaultHealthInitialDelay     = 5
+	defaultHealthInterval         = 5
+	defaultHealthTimeout          = 3
+	defaultHealthRetries          = 12
+	defaultHealthSuccessThreshold = 1
+	defaultHealthFailureThreshold = 3
+)
+
+// NormalizeHealthCheck validates health check options and fills in the defaults
+func NormalizeHealthCheck(opts dto.HealthCheckOptions) (dto.HealthCheckOptions, error) {
+	if opts.Disabled {
+		return dto.HealthCheckOptions{Disabled: true}, nil
+	}
+
+	if opts.Type == "" {
+		opts.Type = HealthCheckTCP
+		if opts.Path != "" {
+			opts.Type = HealthCheckHTTP
+		}
+	}
+	switch opts.Type {
+	case HealthCheckHTTP:
+		if opts.Path == "" {
+			opts.Path = "/"
+		}
+		if !strings.HasPrefix(opts.Path, "/") {
+			return opts, fmt.Errorf("health check path must start with /, got %q", opts.Path)
+		}
+		if opts.ExpectedStatus != 0 && (opts.ExpectedStatus < 100 || opts.ExpectedStatus > 599) {
+			return opts, fmt.Errorf("invalid expected_status %d", opts.ExpectedStatus)
+		}
+	case HealthCheckTCP:
+		if opts.Path != "" || opts.ExpectedStatus != 0 {
+			return opts, errors.New("path and expected_status only apply to http health checks")
+		}
+	default:
+		return opts, fmt.Errorf("unsupported health check type %q (use %s or %s)", opts.Type, HealthCheckHTTP, HealthCheckTCP)
+	}
+	if opts.Port < 0 || opts.Port > 65535 {
+		return opts, fmt.Errorf("invalid health check port %d", opts.Port)
+	}
+
+	defaults := []struct {
+		value    *int
+		fallback int
+		name     string
+		limit    int
+	}{
+		{&opts.InitialDelaySeconds, defaultHealthInitialDelay, "initial_delay_seconds", 600},
+		{&opts.IntervalSeconds, defaultHealthInterval, "interval_seconds", 300},
+		{&opts.TimeoutSeconds, defaultHealthTimeout, "timeout_seconds", 60},
+		{&opts.Retries, defaultHealthRetries, "retries", 100},
+		{&opts.SuccessThreshold, defaultHealthSuccessThreshold, "success_threshold", 10},
+		{&opts.FailureThreshold, defaultHealthFailureThreshold, "failure_threshold", 100},
+	}
+	for _, d := range defaults {
+		if *d.value == 0 {
+			*d.value = d.fallback
+		}
+		if *d.value < 0 || *d.value > d.limit {
+			return opts, fmt.Errorf("%s must be between 1 and %d, got %d", d.name, d.limit, *d.value)
+		}
+	}
+	if opts.SuccessThreshold > opts.Retries {
+		return opts, fmt.Errorf("success_threshold (%d) cannot exceed retries (%d)", opts.SuccessThreshold, opts.Retries)
+	}
+	return opts, nil
+}
+
+// resolveHealthCheck picks the health check of a new deployment: the request override, then the
+// project configuration, then a TCP check of APP_PORT. An empty result disables the check.
+func resolveHealthCheck(override *dto.HealthCheckOptions, projectConfig *projects.ProjectConfig) (string, error) {
+	var opts dto.HealthCheckOptions
+	switch {
+	case override != nil:
+		opts = *override
+	case projectConfig.HealthCheck != "":
+		if err := json.Unmarshal([]byte(projectConfig.HealthCheck), &opts); err != nil {
+			return "", fmt.Errorf("invalid project health check: %w", err)
+		}
+	}
+
+	opts, err := NormalizeHealthCheck(opts)
+	if err != nil {
+		return "", err
+	}
+	if opts.Disabled {
+		return "", nil
+	}
+	if opts.Port == 0 {
+		env := map[string]string{}
+		if projectConfig.EnvVars != "" {
+			_ = json.Unmarshal([]byte(projectConfig.EnvVars), &env)
+		}
+		port, err := strconv.Atoi(env["APP_PORT"])
+		if err != nil || port <= 0 {
+			// Nothing is published, so there is nothing to probe
+			if override != nil {
+				return "", errors.New("health check needs a port: set port or APP_PORT")
+			}
+			return "", nil
+		}
+		opts.Port = port
+	}
+
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// verifyDeployment probes the deployed app until it passes or fails its health check thresholds.
+// Blue-green deployments verify their new slot before the switch instead.
+func verifyDeployment(ctx context.Context, dc *deploymentContext) error {
+	if dc.verified {
+		return nil
+	}
+	opts, err := deploymentHealthCheck(dc)
+	if err != nil {
+		return err
+	}
+	if opts == nil {
+		dc.logger.Write("🩺 No health check configured")
+		return nil
+	}
+	return runHealthCheck(ctx, dc, opts, strconv.Itoa(opts.Port))
+}
+
+// Helper Functions
+
+// deploymentHealthCheck decodes the health check of the deployment, nil when it has none
+func deploymentHealthCheck(dc *deploymentContext) (*dto.HealthCheckOptions, error) {
+	if dc.deployment.HealthCheck == "" {
+		return nil, nil
+	}
+	var opts dto.HealthCheckOptions
+	if err := json.Unmarshal([]byte(dc.deployment.HealthCheck), &opts); err != nil {
+		return nil, fmt.Errorf("invalid health check: %w", err)
+	}
+	return &opts, nil
+}
+
+// runHealthCheck probes a port of the deployment target. The host is always the target's, so a
+// health check cannot point the server at other machines.
+func runHealthCheck(ctx context.Context, dc *deploymentContext, opts *dto.HealthCheckOptions, port string) error {
+	endpoint, probe := healthProbe(dc, opts, port)
+
+	dc.logger.Write(fmt.Sprintf("🩺 Verifying %s (%d retries, every %ds, pass after %d, fail after %d)",
+		endpoint, opts.Retries, opts.IntervalSeconds, opts.SuccessThreshold, opts.FailureThreshold))
+	if err := sleepContext(ctx, time.Duration(opts.InitialDelaySeconds)*time.Second); err != nil {
+		return err
+	}
+
+	successes, failures := 0, 0
+	var lastErr error
+	for attempt := 1; attempt <= opts.Retries; attempt++ {
+		probeCtx, cancel := context.WithTimeout(ctx, time.Duration(opts.TimeoutSeconds)*time.Second)
+		err := probe(probeCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err == nil {
+			successes, failures = successes+1, 0
+			dc.logger.Write(fmt.Sprintf("🩺 Probe %d/%d passed (%d/%d)", attempt, opts.Retries, successes, opts.SuccessThreshold))
+			if successes >= opts.SuccessThreshold {
+				dc.logger.Write("✔ Health check passed")
+				return nil
+			}
+		} else {
+			successes, failures, lastErr = 0, failures+1, err
+			dc.logger.Write(fmt.Sprintf("🩺 Probe %d/%d failed (%d/%d): %v", attempt, opts.Retries, failures, opts.FailureThreshold, err))
+			if failures >= opts.FailureThreshold {
+				return &healthCheckError{reason: fmt.Sprintf("%s failed %d consecutive probes: %v", endpoint, failures, err)}
+			}
+		}
+
+		if attempt < opts.Retries {
+			if err := sleepContext(ctx, time.Duration(opts.IntervalSeconds)*time.Second); err != nil {
+				return err
+			}
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("not enough consecutive successes")
+	}
+	return &healthCheckError{reason: fmt.Sprintf("%s did not pass within %d probes: %v", endpoint, opts.Retries, lastErr)}
+}
+
+// healthProbe builds a single probe of the health check against a port of the deployment target
+func healthProbe(dc *deploymentContext, opts *dto.HealthCheckOptions, port string) (string, func(context.Context) error) {
+	address := net.JoinHostPort(targetHostname(dc.target.Host), port)
+	if opts.Type == HealthCheckHTTP {
+		endpoint := (&url.URL{Scheme: "http", Host: address, Path: opts.Path}).String()
+		return endpoint, func(ctx context.Context) error { return probeHTTP(ctx, endpoint, opts.ExpectedStatus) }
+	}
+	return "tcp://" + address, func(ctx context.Context) error { return probeTCP(ctx, address) }
+}
+
+func probeTCP(ctx context.Context, address string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func probeHTTP(ctx context.Context, endpoint string, expectedStatus int) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "deva-health-check")
+
+	// Redirects are judged by their own status, not followed
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if expectedStatus != 0 {
+		if resp.StatusCode != expectedStatus {
+			return fmt.Errorf("status %d, expected %d", resp.StatusCode, expectedStatus)
+		}
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// targetHostname extracts the host of a Docker target address such as tcp://10.0.0.5:2376
+func targetHostname(dockerHost string) string {
+	if parsed, err := url.Parse(dockerHost); err == nil && parsed.Hostname() != "" {
+		return parsed.Hostname()
+	}
+	if host, _, err := net.SplitHostPort(dockerHost); err == nil {
+		return host
+	}
+	return dockerHost
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
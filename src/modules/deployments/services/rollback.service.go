@@ -0,0 +1,173 @@
+package deployments
+
+import (
+	"deva/src/config"
+	"deva/src/lib/dto"
+	deployments "deva/src/modules/deployments/models"
+	plans "deva/src/modules/plans/services"
+	"deva/src/utils"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RollbackDeployment redeploys the image and rendered configuration of an earlier successful
+// deployment without rebuilding. The rollback is a new deployment linked to the restored one and
+// is admitted like any other deployment: freeze windows, approval policies and the daily quota apply.
+func RollbackDeployment(userID, deploymentID uuid.UUID, request dto.RollbackDeploymentRequest) (map[string]interface{}, *plans.DeploymentQuota, *utils.ServiceError) {
+	source, serviceErr := GetAccessibleDeployment(userID, deploymentID)
+	if serviceErr != nil {
+		return nil, nil, serviceErr
+	}
+	if source.Status != StatusSucceeded {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    fmt.Sprintf("only succeeded deployments can be restored, this one is %s", source.Status),
+			Err:        fmt.Errorf("deployment %s is %s", source.ID, source.Status),
+		}
+	}
+	if source.ImageID == "" || source.ConfigSnapshot == "" {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    "deployment has no recorded artifact to restore",
+			Err:        fmt.Errorf("deployment %s has no image or container snapshot", source.ID),
+		}
+	}
+	project, serviceErr := GetAccessibleProject(userID, source.ProjectID)
+	if serviceErr != nil {
+		return nil, nil, serviceErr
+	}
+
+	strategy := request.Strategy
+	if strategy == "" {
+		strategy = rollbackStrategy(source.ProjectID, source.TargetID)
+	}
+	if strategy != StrategyRecreate && strategy != StrategyBlueGreen {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("rollbacks use %s or %s", StrategyRecreate, StrategyBlueGreen),
+			Err:        fmt.Errorf("unsupported rollback strategy %q", strategy),
+		}
+	}
+
+	overriddenBy, serviceErr := checkDeploymentFreeze(userID, project, time.Now(), request.OverrideFreeze)
+	if serviceErr != nil {
+		return nil, nil, serviceErr
+	}
+	policy, err := resolveApprovalPolicy(project, source.Environment)
+	if err != nil {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to check approval policies",
+			Err:        err,
+		}
+	}
+	quota, serviceErr := plans.ReserveDeployment(userID, project.TeamID)
+	if serviceErr != nil {
+		return nil, quota, serviceErr
+	}
+
+	reason := strings.TrimSpace(request.Reason)
+	if reason == "" {
+		reason = "manual rollback"
+	}
+	rollback := newRollback(source, userID, strategy, reason)
+	if policy != nil {
+		rollback.Status = StatusAwaitingApproval
+		rollback.RequiredApprovals = policy.RequiredApprovals
+		rollback.ApproverRole = policy.ApproverRole
+		rollback.ApprovalExpiresAt = time.Now().Add(time.Duration(policy.TimeoutMinutes) * time.Minute)
+	}
+	if overriddenBy != uuid.Nil {
+		rollback.OverriddenBy = overriddenBy
+		rollback.FreezeOverride = strings.TrimSpace(request.OverrideReason)
+	}
+	if serviceErr := createDeploymentRecord(&rollback, userID); serviceErr != nil {
+		plans.ReleaseDeployment(quota)
+		return nil, quota, serviceErr
+	}
+	plans.RecordDeploymentUsage(userID, project.ID)
+
+	appendLog(rollback.ID, fmt.Sprintf("↩️ Rollback to deployment %s: %s", source.ID, reason))
+	if rollback.OverriddenBy != uuid.Nil {
+		appendLog(rollback.ID, fmt.Sprintf("🧊 Freeze window overridden by %s: %s", userID, rollback.FreezeOverride))
+	}
+	if rollback.Status == StatusAwaitingApproval {
+		requestApprovals(&rollback, project)
+		return toDeploymentResponse(rollback, false), quota, nil
+	}
+
+	startDeployment(rollback.ID)
+	return toDeploymentResponse(rollback, false), quota, nil
+}
+
+// Helper Functions
+func newRollback(source *deployments.Deployment, userID uuid.UUID, strategy, reason string) deployments.Deployment {
+	return deployments.Deployment{
+		ProjectID:    source.ProjectID,
+		TargetID:     source.TargetID,
+		Platform:     source.Platform,
+		Status:       StatusPending,
+		Strategy:     strategy,
+		HealthCheck:  source.HealthCheck,
+		Environment:  source.Environment,
+		Ref:          source.Ref,
+		RollbackToID: source.ID,
+		Reason:       reason,
+		TriggeredBy:  userID,
+	}
+}
+
+// rollbackToLastHealthy restores the latest succeeded deployment of the project on the same
+// target. It returns the rollback, or nil when there was nothing to restore. Traffic already
+// reached a broken version, so this rollback is the one deployment that skips freeze windows,
+// approvals and the quota.
+func rollbackToLastHealthy(failed *deployments.Deployment, reason string) *deployments.Deployment {
+	var source deployments.Deployment
+	err := config.DB.Omit("log").
+		Where("project_id = ? AND target_id = ? AND status = ? AND id <> ?", failed.ProjectID, failed.TargetID, StatusSucceeded, failed.ID).
+		Where("image_id <> '' AND config_snapshot <> ''").
+		Order("finished_at DESC").
+		First(&source).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		appendLog(failed.ID, "⚠️ No earlier healthy deployment to roll back to")
+		return nil
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to find a deployment to roll back %s to: %v", failed.ID, err)
+		return nil
+	}
+
+	rollback := newRollback(&source, failed.TriggeredBy, rollbackStrategy(failed.ProjectID, failed.TargetID),
+		fmt.Sprintf("automatic rollback after deployment %s failed: %s", failed.ID, reason))
+	if serviceErr := createDeploymentRecord(&rollback, failed.TriggeredBy); serviceErr != nil {
+		log.Printf("⚠️ Failed to roll back deployment %s: %v", failed.ID, serviceErr.Err)
+		return nil
+	}
+	log.Printf("↩️ Automatic rollback %s of deployment %s bypasses freeze windows, approvals and the deployment quota", rollback.ID, failed.ID)
+	appendLog(rollback.ID, fmt.Sprintf("↩️ Rollback to deployment %s: %s", source.ID, rollback.Reason))
+	appendLog(rollback.ID, "⚠️ Automatic rollback after a failed health check: freeze windows, approvals and the deployment quota were not checked")
+	startDeployment(rollback.ID)
+
+	appendLog(failed.ID, fmt.Sprintf("↩️ Rolling back to deployment %s (rollback %s)", source.ID, rollback.ID))
+	return &rollback
+}
+
+// rollbackStrategy keeps a project that runs behind the proxy there: rollbacks use blue-green
+// when the latest deployment on the target did not recreate the container. A canary would only
+// delay the restore.
+func rollbackStrategy(projectID, targetID uuid.UUID) string {
+	var latest deployments.Deployment
+	if err := config.DB.Select("strategy").
+		Where("project_id = ? AND target_id = ?", projectID, targetID).
+		Order("created_at DESC").
+		First(&latest).Error; err != nil || latest.Strategy == StrategyRecreate || latest.Strategy == "" {
+		return StrategyRecreate
+	}
+	return StrategyBlueGreen
+}
@@ -0,0 +1,101 @@
+package deployments
+
+import (
+	"deva/src/config"
+	deployments "deva/src/modules/deployments/models"
+	notifications "deva/src/modules/notifications/services"
+	projects "deva/src/modules/projects/models"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+const (
+	deploymentSchedulerInterval = 15 * time.Second
+	// Deployments cannot be scheduled further ahead than this
+	maxScheduleAhead = 90 * 24 * time.Hour
+)
+
+// StartDeploymentScheduler starts scheduled deployments once they are due and expires approval
+// requests past their timeout. Deployments that came due while the API was down are handled on
+// the first tick.
+func StartDeploymentScheduler() {
+	go func() {
+		ticker := time.NewTicker(deploymentSchedulerInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			now := time.Now()
+			expireApprovals(now)
+			fireScheduledDeployments(now)
+		}
+	}()
+}
+
+// Helper Functions
+func fireScheduledDeployments(now time.Time) {
+	var due []deployments.Deployment
+	if err := config.DB.Omit("log", "config_snapshot").
+		Where("status = ? AND scheduled_at <= ?", StatusScheduled, now).
+		Order("scheduled_at").
+		Find(&due).Error; err != nil {
+		log.Printf("⚠️ Failed to load scheduled deployments: %v", err)
+		return
+	}
+
+	for i := range due {
+		startQueuedDeployment(&due[i], now, "🗓️ Scheduled time reached")
+	}
+}
+
+// startQueuedDeployment starts a scheduled or approved deployment that is due
+func startQueuedDeployment(deployment *deployments.Deployment, now time.Time, reason string) {
+	// A freeze declared after scheduling still applies, unless an admin overrode freezes up front
+	if deployment.OverriddenBy == uuid.Nil {
+		var project projects.Project
+		if err := config.DB.Select("id", "team_id").First(&project, "id = ?", deployment.ProjectID).Error; err != nil {
+			log.Printf("⚠️ Failed to load project of deployment %s: %v", deployment.ID, err)
+			return
+		}
+		window, until, err := activeFreeze(&project, now)
+		if err != nil {
+			log.Printf("⚠️ Failed to check freeze windows of deployment %s: %v", deployment.ID, err)
+			return
+		}
+		if window != nil {
+			frozen := fmt.Sprintf("deployments are frozen by %q until %s", window.Name, until.UTC().Format(time.RFC3339))
+			failQueuedDeployment(deployment, frozen)
+			return
+		}
+	}
+
+	if err := transition(deployment, StatusPending); err != nil {
+		if !errors.Is(err, errDeploymentCancelled) {
+			log.Printf("⚠️ Failed to start deployment %s: %v", deployment.ID, err)
+		}
+		return
+	}
+	appendLog(deployment.ID, reason)
+	startDeployment(deployment.ID)
+}
+
+func failQueuedDeployment(deployment *deployments.Deployment, reason string) {
+	appendLog(deployment.ID, "🧊 "+reason)
+	if err := config.DB.Model(&deployments.Deployment{}).Where("id = ?", deployment.ID).
+		Update("failure_reason", reason).Error; err != nil {
+		log.Printf("⚠️ Failed to record failure of deployment %s: %v", deployment.ID, err)
+	}
+	if err := transition(deployment, StatusFailed); err != nil {
+		if !errors.Is(err, errDeploymentCancelled) {
+			log.Printf("⚠️ Failed to mark deployment %s as failed: %v", deployment.ID, err)
+		}
+		return
+	}
+
+	if err := notifications.Notify(deployment.TriggeredBy, notifications.TypeDeployment,
+		fmt.Sprintf("Deployment %s did not start: %s", deployment.ID, reason),
+		map[string]interface{}{"deployment_id": deployment.ID, "project_id": deployment.ProjectID, "status": StatusFailed}); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+}
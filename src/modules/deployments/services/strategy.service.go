@@ -0,0 +1,591 @@
+package deployments
+
+import (
+	"bytes"
+	"context"
+	"deva/src/config"
+	"deva/src/lib/docker"
+	"deva/src/lib/dto"
+	deployments "deva/src/modules/deployments/models"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Deployment strategies for Docker targets
+const (
+	StrategyRecreate  = "recreate"
+	StrategyBlueGreen = "blue-green"
+	StrategyCanary    = "canary"
+
+	DefaultCanaryPercent = 10
+	DefaultCanarySeconds = 60
+	maxCanarySeconds     = 30 * 60
+
+	proxyImage          = "nginx:1.27-alpine"
+	proxyConfigDir      = "/etc/nginx/conf.d"
+	canaryCheckInterval = 5 * time.Second
+	retireTimeout       = 10
+)
+
+// slots are the two container slots blue/green and canary deployments alternate between
+var slots = []string{"blue", "green"}
+
+var proxyConfigTemplate = template.Must(template.New("proxy").Parse(`# Generated by Deva, rewritten on every deployment
+map $http_upgrade $connection_upgrade {
+    default upgrade;
+    ''      close;
+}
+
+upstream deva_app {
+{{- range .Servers}}
+    server {{.Host}}:{{$.Port}} weight={{.Weight}};
+{{- end}}
+}
+
+server {
+    listen 80;
+
+    location / {
+        proxy_pass http://deva_app;
+        proxy_http_version 1.1;
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+        proxy_set_header Upgrade $http_upgrade;
+        proxy_set_header Connection $connection_upgrade;
+    }
+}
+`))
+
+// proxyLayout names the containers and network of a project deployed behind the proxy
+type proxyLayout struct {
+	base     string // container of recreate deployments, prefix of all other names
+	network  string
+	proxy    string
+	port     string // container port of the app
+	hostPort string // published by the proxy
+}
+
+type proxyServer struct {
+	Host   string
+	Weight int
+}
+
+// ResolveStrategy validates the strategy options of a deployment and fills in the defaults
+func ResolveStrategy(strategy string, canaryPercent, canarySeconds int) (string, int, int, error) {
+	switch strategy {
+	case "", StrategyRecreate:
+		return StrategyRecreate, 0, 0, nil
+	case StrategyBlueGreen:
+		return StrategyBlueGreen, 0, 0, nil
+	case StrategyCanary:
+		if canaryPercent == 0 {
+			canaryPercent = DefaultCanaryPercent
+		}
+		if canarySeconds == 0 {
+			canarySeconds = DefaultCanarySeconds
+		}
+		if canaryPercent < 1 || canaryPercent > 99 {
+			return "", 0, 0, fmt.Errorf("canary_percent must be between 1 and 99, got %d", canaryPercent)
+		}
+		if canarySeconds < 1 || canarySeconds > maxCanarySeconds {
+			return "", 0, 0, fmt.Errorf("canary_duration must be between 1 and %d seconds, got %d", maxCanarySeconds, canarySeconds)
+		}
+		return StrategyCanary, canaryPercent, canarySeconds, nil
+	default:
+		return "", 0, 0, fmt.Errorf("unsupported strategy %q (use %s, %s or %s)", strategy, StrategyRecreate, StrategyBlueGreen, StrategyCanary)
+	}
+}
+
+// deployContainer rolls the rendered container out with the strategy of the deployment
+func deployContainer(ctx context.Context, dc *deploymentContext) error {
+	switch dc.deployment.Strategy {
+	case StrategyBlueGreen:
+		dc.logger.Write("🧭 Strategy: blue-green")
+		return deployBlueGreen(ctx, dc)
+	case StrategyCanary:
+		dc.logger.Write(fmt.Sprintf("🧭 Strategy: canary (%d%% of traffic for %ds)", dc.deployment.CanaryPercent, dc.deployment.CanarySeconds))
+		return deployCanary(ctx, dc)
+	default:
+		dc.logger.Write("🧭 Strategy: recreate")
+		return deployRecreate(ctx, dc)
+	}
+}
+
+// deployRecreate replaces the running container in place. The proxy and slot containers of
+// earlier blue/green or canary deployments are removed so the app can publish its port again.
+func deployRecreate(ctx context.Context, dc *deploymentContext) error {
+	layout := newProxyLayout(dc.snapshot)
+	for _, name := range []string{layout.proxy, layout.slotName(slots[0]), layout.slotName(slots[1])} {
+		if err := dc.client.ContainerRemove(ctx, name, true, false); err != nil && !docker.IsNotFound(err) {
+			return err
+		}
+	}
+	return startContainer(ctx, dc, layout.base, dc.snapshot.Config)
+}
+
+// deployBlueGreen starts the new version next to the live one, switches the proxy once it passes
+// the health check and retires the old version
+func deployBlueGreen(ctx context.Context, dc *deploymentContext) error {
+	const phases = 4
+	layout, live, next, err := prepareSlots(ctx, dc)
+	if err != nil {
+		return err
+	}
+
+	logPhase(dc, 1, phases, fmt.Sprintf("start %s container %s", next, layout.slotName(next)))
+	if err := startSlot(ctx, dc, layout, next, live); err != nil {
+		return err
+	}
+
+	logPhase(dc, 2, phases, fmt.Sprintf("health check %s", next))
+	if err := verifySlot(ctx, dc, layout, next, live); err != nil {
+		return err
+	}
+
+	logPhase(dc, 3, phases, fmt.Sprintf("switch proxy to %s", next))
+	if err := applyProxy(ctx, dc, layout, map[string]int{next: 100}); err != nil {
+		return err
+	}
+
+	logPhase(dc, 4, phases, retireMessage(live))
+	return retireSlot(ctx, dc, layout, live)
+}
+
+// deployCanary sends a share of the traffic to the new version, watches it for the canary
+// duration and then promotes it. Without a live slot it behaves like blue-green.
+func deployCanary(ctx context.Context, dc *deploymentContext) error {
+	const phases = 5
+	layout, live, next, err := prepareSlots(ctx, dc)
+	if err != nil {
+		return err
+	}
+
+	logPhase(dc, 1, phases, fmt.Sprintf("start %s container %s", next, layout.slotName(next)))
+	if err := startSlot(ctx, dc, layout, next, live); err != nil {
+		return err
+	}
+
+	if live == "" {
+		logPhase(dc, 2, phases, fmt.Sprintf("no live slot to share traffic with, sending 100%% to %s once healthy", next))
+		if err := verifySlot(ctx, dc, layout, next, live); err != nil {
+			return err
+		}
+		if err := applyProxy(ctx, dc, layout, map[string]int{next: 100}); err != nil {
+			return err
+		}
+		logPhase(dc, 3, phases, "observation skipped")
+	} else {
+		percent := dc.deployment.CanaryPercent
+		logPhase(dc, 2, phases, fmt.Sprintf("shift %d%% of traffic to %s", percent, next))
+		if err := applyProxy(ctx, dc, layout, map[string]int{live: 100 - percent, next: percent}); err != nil {
+			return err
+		}
+
+		logPhase(dc, 3, phases, fmt.Sprintf("observe %s for %ds", next, dc.deployment.CanarySeconds))
+		if err := observeCanary(ctx, dc, layout, next); err != nil {
+			dc.logger.Write(fmt.Sprintf("⚠️ Canary failed, sending all traffic back to %s", live))
+			if revertErr := applyProxy(ctx, dc, layout, map[string]int{live: 100}); revertErr != nil {
+				return fmt.Errorf("%v; reverting the proxy also failed: %w", err, revertErr)
+			}
+			_ = retireSlot(ctx, dc, layout, next)
+
+			var healthErr *healthCheckError
+			if errors.As(err, &healthErr) {
+				healthErr.trafficKept = true
+			}
+			return err
+		}
+	}
+
+	logPhase(dc, 4, phases, fmt.Sprintf("promote %s to 100%% of traffic", next))
+	if err := applyProxy(ctx, dc, layout, map[string]int{next: 100}); err != nil {
+		return err
+	}
+
+	logPhase(dc, 5, phases, retireMessage(live))
+	return retireSlot(ctx, dc, layout, live)
+}
+
+// Helper Functions
+func newProxyLayout(snapshot *containerSnapshot) *proxyLayout {
+	layout := &proxyLayout{
+		base:    snapshot.Name,
+		network: snapshot.Name,
+		proxy:   snapshot.Name + "-proxy",
+	}
+	for exposed := range snapshot.Config.ExposedPorts {
+		layout.port = strings.TrimSuffix(exposed, "/tcp")
+		layout.hostPort = layout.port
+		if hostConfig := snapshot.Config.HostConfig; hostConfig != nil {
+			if bindings := hostConfig.PortBindings[exposed]; len(bindings) > 0 {
+				layout.hostPort = bindings[0].HostPort
+			}
+		}
+	}
+	return layout
+}
+
+func (l *proxyLayout) slotName(slot string) string {
+	return l.base + "-" + slot
+}
+
+// prepareSlots makes sure the project network exists and picks the slot for the new version
+func prepareSlots(ctx context.Context, dc *deploymentContext) (*proxyLayout, string, string, error) {
+	layout := newProxyLayout(dc.snapshot)
+	if layout.port == "" {
+		return nil, "", "", fmt.Errorf("%s deployments need APP_PORT to route traffic through the proxy", dc.deployment.Strategy)
+	}
+
+	if _, err := dc.client.NetworkInspect(ctx, layout.network); err != nil {
+		if !docker.IsNotFound(err) {
+			return nil, "", "", err
+		}
+		if _, err := dc.client.NetworkCreate(ctx, docker.NetworkConfig{
+			Name:   layout.network,
+			Driver: "bridge",
+			Labels: map[string]string{"deva.project": dc.project.ID.String()},
+		}); err != nil && !docker.IsConflict(err) {
+			return nil, "", "", err
+		}
+		dc.logger.Write(fmt.Sprintf("🌐 Created network %s", layout.network))
+	}
+
+	live, err := liveSlot(ctx, dc, layout)
+	if err != nil {
+		return nil, "", "", err
+	}
+	next := slots[0]
+	if live == slots[0] {
+		next = slots[1]
+	}
+	if live == "" {
+		dc.logger.Write("ℹ️ No live slot yet")
+	} else {
+		dc.logger.Write(fmt.Sprintf("ℹ️ Live slot is %s, deploying to %s", live, next))
+	}
+	return layout, live, next, nil
+}
+
+// liveSlot returns the slot serving traffic. When both slots run (an interrupted deployment)
+// the one holding the most recent succeeded deployment wins.
+func liveSlot(ctx context.Context, dc *deploymentContext, layout *proxyLayout) (string, error) {
+	running := map[string]uuid.UUID{}
+	for _, slot := range slots {
+		info, err := dc.client.ContainerInspect(ctx, layout.slotName(slot))
+		if err != nil {
+			if docker.IsNotFound(err) {
+				continue
+			}
+			return "", err
+		}
+		if info.State.Running {
+			id, _ := uuid.Parse(info.Config.Labels["deva.deployment"])
+			running[slot] = id
+		}
+	}
+
+	switch len(running) {
+	case 0:
+		return "", nil
+	case 1:
+		for slot := range running {
+			return slot, nil
+		}
+	}
+
+	var latest deployments.Deployment
+	if err := config.DB.Select("id").
+		Where("id IN ? AND status = ?", []uuid.UUID{running[slots[0]], running[slots[1]]}, StatusSucceeded).
+		Order("finished_at DESC").
+		First(&latest).Error; err != nil {
+		return slots[0], nil
+	}
+	for slot, id := range running {
+		if id == latest.ID {
+			return slot, nil
+		}
+	}
+	return slots[0], nil
+}
+
+// startSlot starts the new version in a slot on the project network. A failed health check
+// leaves the live version untouched.
+func startSlot(ctx context.Context, dc *deploymentContext, layout *proxyLayout, slot, live string) error {
+	containerConfig := dc.snapshot.Config
+	containerConfig.Labels = map[string]string{"deva.slot": slot}
+	for key, value := range dc.snapshot.Config.Labels {
+		containerConfig.Labels[key] = value
+	}
+	hostConfig := docker.HostConfig{NetworkMode: layout.network}
+	if dc.snapshot.Config.HostConfig != nil {
+		hostConfig.RestartPolicy = dc.snapshot.Config.HostConfig.RestartPolicy
+		hostConfig.Binds = dc.snapshot.Config.HostConfig.Binds
+	}
+	// The slot is probed before and, for canaries, while the proxy routes to it, on a port Docker picks
+	if dc.deployment.Strategy == StrategyBlueGreen || dc.deployment.Strategy == StrategyCanary {
+		opts, err := deploymentHealthCheck(dc)
+		if err != nil {
+			return err
+		}
+		if opts != nil {
+			probePort := slotProbePort(opts, layout) + "/tcp"
+			containerConfig.ExposedPorts = map[string]struct{}{probePort: {}}
+			for exposed := range dc.snapshot.Config.ExposedPorts {
+				containerConfig.ExposedPorts[exposed] = struct{}{}
+			}
+			hostConfig.PortBindings = map[string][]docker.PortBinding{probePort: {{}}}
+		}
+	}
+	containerConfig.HostConfig = &hostConfig
+
+	return discardFailedSlot(ctx, dc, layout, slot, live, startContainer(ctx, dc, layout.slotName(slot), containerConfig))
+}
+
+// verifySlot runs the health check of the deployment against the new slot, through the port
+// startSlot published for it
+func verifySlot(ctx context.Context, dc *deploymentContext, layout *proxyLayout, slot, live string) error {
+	opts, hostPort, err := slotHealthCheck(ctx, dc, layout, slot)
+	if err != nil {
+		return discardFailedSlot(ctx, dc, layout, slot, live, err)
+	}
+	dc.verified = true
+	if opts == nil {
+		dc.logger.Write("🩺 No health check configured")
+		return nil
+	}
+	return discardFailedSlot(ctx, dc, layout, slot, live, runHealthCheck(ctx, dc, opts, hostPort))
+}
+
+// slotHealthCheck returns the health check of the deployment and the host port it reaches the
+// slot on. The options are nil when the deployment has no health check.
+func slotHealthCheck(ctx context.Context, dc *deploymentContext, layout *proxyLayout, slot string) (*dto.HealthCheckOptions, string, error) {
+	opts, err := deploymentHealthCheck(dc)
+	if err != nil || opts == nil {
+		return nil, "", err
+	}
+	name := layout.slotName(slot)
+	info, err := dc.client.ContainerInspect(ctx, name)
+	if err != nil {
+		return nil, "", err
+	}
+	bindings := info.NetworkSettings.Ports[slotProbePort(opts, layout)+"/tcp"]
+	if len(bindings) == 0 || bindings[0].HostPort == "" {
+		return nil, "", &healthCheckError{reason: fmt.Sprintf("%s publishes no port to probe", name)}
+	}
+	return opts, bindings[0].HostPort, nil
+}
+
+// slotProbePort is the container port the health check reaches: APP_PORT behind the proxy, any
+// other configured port as is
+func slotProbePort(opts *dto.HealthCheckOptions, layout *proxyLayout) string {
+	if port := strconv.Itoa(opts.Port); port != layout.hostPort {
+		return port
+	}
+	return layout.port
+}
+
+// discardFailedSlot removes a slot that failed its health check. The live version keeps the
+// traffic, if there is one.
+func discardFailedSlot(ctx context.Context, dc *deploymentContext, layout *proxyLayout, slot, live string, err error) error {
+	var healthErr *healthCheckError
+	if errors.As(err, &healthErr) {
+		_ = dc.client.ContainerRemove(ctx, layout.slotName(slot), true, false)
+		healthErr.trafficKept = live != "" || containerExists(ctx, dc, layout.base)
+	}
+	return err
+}
+
+// observeCanary watches the canary for the configured duration: its container, and on every tick
+// one probe of the deployment's health check, which fails the canary after failure_threshold
+// consecutive failed probes
+func observeCanary(ctx context.Context, dc *deploymentContext, layout *proxyLayout, slot string) error {
+	opts, hostPort, err := slotHealthCheck(ctx, dc, layout, slot)
+	if err != nil {
+		return err
+	}
+	var endpoint string
+	var probe func(context.Context) error
+	if opts != nil {
+		endpoint, probe = healthProbe(dc, opts, hostPort)
+		dc.logger.Write(fmt.Sprintf("🩺 Probing %s every %s, fail after %d", endpoint, canaryCheckInterval, opts.FailureThreshold))
+	}
+
+	failures := 0
+	deadline := time.Now().Add(time.Duration(dc.deployment.CanarySeconds) * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(canaryCheckInterval, time.Until(deadline))):
+		}
+		if err := checkContainer(ctx, dc, layout.slotName(slot)); err != nil {
+			return err
+		}
+		if probe == nil {
+			continue
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, time.Duration(opts.TimeoutSeconds)*time.Second)
+		err := probe(probeCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			failures = 0
+			continue
+		}
+		failures++
+		dc.logger.Write(fmt.Sprintf("🩺 Canary probe failed (%d/%d): %v", failures, opts.FailureThreshold, err))
+		if failures >= opts.FailureThreshold {
+			return &healthCheckError{reason: fmt.Sprintf("canary %s failed %d consecutive probes: %v", endpoint, failures, err)}
+		}
+	}
+	dc.logger.Write(fmt.Sprintf("✔ Canary %s stayed healthy", slot))
+	return nil
+}
+
+// applyProxy points the proxy at the given slot weights, creating the proxy on first use
+func applyProxy(ctx context.Context, dc *deploymentContext, layout *proxyLayout, weights map[string]int) error {
+	var servers []proxyServer
+	for _, slot := range slots {
+		if weights[slot] > 0 {
+			servers = append(servers, proxyServer{Host: layout.slotName(slot), Weight: weights[slot]})
+		}
+	}
+	var rendered bytes.Buffer
+	if err := proxyConfigTemplate.Execute(&rendered, map[string]interface{}{"Servers": servers, "Port": layout.port}); err != nil {
+		return err
+	}
+	archive, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(docker.TarFiles(map[string][]byte{"default.conf": rendered.Bytes()}, writer))
+	}()
+	defer archive.Close()
+
+	info, err := dc.client.ContainerInspect(ctx, layout.proxy)
+	if err != nil && !docker.IsNotFound(err) {
+		return err
+	}
+	if err == nil && info.State.Running {
+		if err := dc.client.ContainerPutArchive(ctx, layout.proxy, proxyConfigDir, archive); err != nil {
+			return err
+		}
+		if err := proxyExec(ctx, dc, layout, "nginx", "-t"); err != nil {
+			return fmt.Errorf("invalid proxy configuration: %w", err)
+		}
+		if err := proxyExec(ctx, dc, layout, "nginx", "-s", "reload"); err != nil {
+			return err
+		}
+		dc.logger.Write(fmt.Sprintf("🔀 Proxy %s now routes %s", layout.proxy, describeWeights(servers)))
+		return nil
+	}
+
+	return createProxy(ctx, dc, layout, archive, servers)
+}
+
+// createProxy starts the proxy container, taking the published port over from a container of
+// an earlier recreate deployment
+func createProxy(ctx context.Context, dc *deploymentContext, layout *proxyLayout, archive io.Reader, servers []proxyServer) error {
+	if _, err := dc.client.ImageInspect(ctx, proxyImage); err != nil {
+		if !docker.IsNotFound(err) {
+			return err
+		}
+		dc.logger.Write(fmt.Sprintf("⬇️ Pulling %s", proxyImage))
+		if err := dc.client.ImagePull(ctx, proxyImage); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range []string{layout.proxy, layout.base} {
+		if err := dc.client.ContainerRemove(ctx, name, true, false); err != nil {
+			if !docker.IsNotFound(err) {
+				return err
+			}
+		} else if name == layout.base {
+			dc.logger.Write(fmt.Sprintf("⚠️ Handing port %s over from %s to the proxy", layout.hostPort, layout.base))
+		}
+	}
+
+	created, err := dc.client.ContainerCreate(ctx, layout.proxy, docker.ContainerConfig{
+		Image:        proxyImage,
+		Labels:       map[string]string{"deva.project": dc.project.ID.String(), "deva.role": "proxy"},
+		ExposedPorts: map[string]struct{}{"80/tcp": {}},
+		HostConfig: &docker.HostConfig{
+			PortBindings:  map[string][]docker.PortBinding{"80/tcp": {{HostPort: layout.hostPort}}},
+			RestartPolicy: &docker.RestartPolicy{Name: "unless-stopped"},
+			NetworkMode:   layout.network,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := dc.client.ContainerPutArchive(ctx, created.ID, proxyConfigDir, archive); err != nil {
+		return err
+	}
+	if err := dc.client.ContainerStart(ctx, created.ID); err != nil {
+		return err
+	}
+	dc.logger.Write(fmt.Sprintf("🔀 Started proxy %s on port %s routing %s", layout.proxy, layout.hostPort, describeWeights(servers)))
+	return nil
+}
+
+func proxyExec(ctx context.Context, dc *deploymentContext, layout *proxyLayout, cmd ...string) error {
+	var output bytes.Buffer
+	exitCode, err := dc.client.ContainerExec(ctx, layout.proxy, cmd, &output, &output)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("%s exited with code %d: %s", strings.Join(cmd, " "), exitCode, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// retireSlot stops and removes the container of a slot that no longer receives traffic
+func retireSlot(ctx context.Context, dc *deploymentContext, layout *proxyLayout, slot string) error {
+	if slot == "" {
+		return nil
+	}
+	name := layout.slotName(slot)
+	if err := dc.client.ContainerStop(ctx, name, retireTimeout); err != nil && !docker.IsNotFound(err) {
+		dc.logger.Write(fmt.Sprintf("⚠️ Failed to stop %s gracefully: %v", name, err))
+	}
+	if err := dc.client.ContainerRemove(ctx, name, true, false); err != nil && !docker.IsNotFound(err) {
+		return err
+	}
+	dc.logger.Write(fmt.Sprintf("🧹 Retired %s", name))
+	return nil
+}
+
+func containerExists(ctx context.Context, dc *deploymentContext, name string) bool {
+	info, err := dc.client.ContainerInspect(ctx, name)
+	return err == nil && info.State.Running
+}
+
+func logPhase(dc *deploymentContext, phase, phases int, message string) {
+	dc.logger.Write(fmt.Sprintf("▶ [%s %d/%d] %s", dc.deployment.Strategy, phase, phases, message))
+}
+
+func retireMessage(live string) string {
+	if live == "" {
+		return "nothing to retire"
+	}
+	return "retire " + live
+}
+
+func describeWeights(servers []proxyServer) string {
+	parts := make([]string, 0, len(servers))
+	for _, server := range servers {
+		parts = append(parts, fmt.Sprintf("%d%% → %s", server.Weight, server.Host))
+	}
+	return strings.Join(parts, ", ")
+}
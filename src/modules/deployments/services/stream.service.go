@@ -0,0 +1,99 @@
+package deployments
+
+import (
+	"deva/src/config"
+	deployments "deva/src/modules/deployments/models"
+	"deva/src/utils"
+	"deva/store"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"strings"
+)
+
+// statusLogPrefix marks the log line written for every status transition
+const statusLogPrefix = "➡️ Status: "
+
+// StreamDeploymentEvents returns the log and status events of a deployment after lastEventID and,
+// while it runs, a channel of the events that follow. Deployments whose live stream has expired
+// are replayed from the stored log with the same event IDs.
+func StreamDeploymentEvents(userID, deploymentID uuid.UUID, lastEventID int64) ([]store.Event, <-chan store.Event, func(), *utils.ServiceError) {
+	deployment, serviceErr := GetAccessibleDeployment(userID, deploymentID)
+	if serviceErr != nil {
+		return nil, nil, nil, serviceErr
+	}
+
+	if backlog, live, cancel, ok := store.SubscribeEvents(deploymentStreamKey(deployment.ID), lastEventID); ok {
+		return backlog, live, cancel, nil
+	}
+	if !IsTerminalStatus(deployment.Status) {
+		// Streams live in memory; a deployment that is still running always has one
+		return nil, nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "deployment log stream is not available on this server",
+			Err:        fmt.Errorf("no event stream for running deployment %s", deployment.ID),
+		}
+	}
+
+	// Re-read the log: the deployment may have finished after it was loaded
+	var stored deployments.Deployment
+	if err := config.DB.Select("log", "status").First(&stored, "id = ?", deployment.ID).Error; err != nil {
+		return nil, nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return replayDeploymentLog(stored.Log, stored.Status, lastEventID), nil, func() {}, nil
+}
+
+// Helper Functions
+func deploymentStreamKey(deploymentID uuid.UUID) string {
+	return "deployment:" + deploymentID.String()
+}
+
+// replayDeploymentLog rebuilds the events of a finished deployment: one log event per stored
+// line plus a status event after every status line, up to the terminal status
+func replayDeploymentLog(storedLog, finalStatus string, lastEventID int64) []store.Event {
+	var events []store.Event
+	var id int64
+	add := func(event store.Event) {
+		if event.ID > lastEventID {
+			events = append(events, event)
+		}
+	}
+
+	var terminal store.Event
+	var lines []string
+	if storedLog != "" {
+		lines = strings.Split(strings.TrimSuffix(storedLog, "\n"), "\n")
+	}
+	for _, line := range lines {
+		id++
+		add(store.LogEvent(id, line))
+
+		// Lines are stored as "[timestamp] message"
+		_, message, _ := strings.Cut(line, "] ")
+		status, isStatus := strings.CutPrefix(message, statusLogPrefix)
+		if !isStatus {
+			continue
+		}
+		id++
+		add(store.StatusEvent(id, status))
+		if IsTerminalStatus(status) {
+			terminal = store.StatusEvent(id, status)
+			break
+		}
+	}
+	if terminal.ID == 0 {
+		id++
+		terminal = store.StatusEvent(id, finalStatus)
+		add(terminal)
+	}
+
+	if len(events) == 0 {
+		// The client already has everything; repeat the terminal status so it stops reconnecting
+		events = append(events, terminal)
+	}
+	return events
+}
@@ -0,0 +1,561 @@
+package deployments
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"deva/src/config"
+	"deva/src/lib/dto"
+	"deva/src/lib/interfaces"
+	deployments "deva/src/modules/deployments/models"
+	teams "deva/src/modules/teams/services"
+	"deva/src/services"
+	"deva/src/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Supported deployment target types
+const (
+	TargetTypeDocker     = "docker"
+	TargetTypeKubernetes = "kubernetes"
+)
+
+// DockerTLSAuth holds the PEM encoded TLS material of a remote Docker host
+type DockerTLSAuth struct {
+	CACert string `json:"ca_cert"`
+	Cert   string `json:"cert"`
+	Key    string `json:"key"`
+}
+
+// KubernetesAuth holds the credentials of a Kubernetes API server: the cluster CA and either a
+// bearer token or a client certificate
+type KubernetesAuth struct {
+	CACert string `json:"ca_cert"`
+	Cert   string `json:"cert,omitempty"`
+	Key    string `json:"key,omitempty"`
+	Token  string `json:"token,omitempty"`
+}
+
+// encryptedAuth is the JSON envelope stored in DeploymentTarget.Auth
+type encryptedAuth struct {
+	Ciphertext string `json:"ciphertext"`
+}
+
+// CreateTarget registers a new deployment target, owned by the user or shared with a team
+func CreateTarget(userID uuid.UUID, request dto.CreateDeploymentTargetRequest) (map[string]interface{}, *utils.ServiceError) {
+	db := config.DB
+
+	if request.Name == "" || request.Host == "" {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "name and host are required",
+			Err:        errors.New("missing name or host"),
+		}
+	}
+	if request.Type != TargetTypeDocker && request.Type != TargetTypeKubernetes {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("unsupported target type %q", request.Type),
+			Err:        fmt.Errorf("unsupported target type %q", request.Type),
+		}
+	}
+	if serviceErr := checkTargetTeam(userID, request.TeamID); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	host, serviceErr := normalizeTargetHost(request.Type, request.Host)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	encrypted, serviceErr := encryptTargetAuth(request.Type, request.CACert, request.Cert, request.Key, request.Token)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	target := deployments.DeploymentTarget{
+		TeamID:    request.TeamID,
+		Name:      request.Name,
+		Type:      request.Type,
+		Host:      host,
+		Auth:      encrypted,
+		CreatedBy: userID,
+		UpdatedBy: userID,
+	}
+	if err := db.Create(&target).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to create deployment target",
+			Err:        err,
+		}
+	}
+
+	return toTargetResponse(target), nil
+}
+
+// ListTargets returns the deployment targets the user can use: the user's own and those of the
+// user's teams. A non-nil teamID lists the targets of that team only.
+func ListTargets(userID, teamID uuid.UUID) ([]map[string]interface{}, *utils.ServiceError) {
+	db := config.DB
+
+	query := db.Order("created_at desc")
+	if teamID != uuid.Nil {
+		if serviceErr := checkTargetTeam(userID, teamID); serviceErr != nil {
+			return nil, serviceErr
+		}
+		query = query.Where("team_id = ?", teamID)
+	} else {
+		scoped, serviceErr := accessibleTargets(db, userID)
+		if serviceErr != nil {
+			return nil, serviceErr
+		}
+		query = query.Where(scoped)
+	}
+
+	var targets []deployments.DeploymentTarget
+	if err := query.Find(&targets).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to list deployment targets",
+			Err:        err,
+		}
+	}
+
+	result := make([]map[string]interface{}, 0, len(targets))
+	for _, t := range targets {
+		result = append(result, toTargetResponse(t))
+	}
+	return result, nil
+}
+
+// GetTarget returns a deployment target the user can use
+func GetTarget(userID, targetID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	target, serviceErr := GetAccessibleTarget(userID, targetID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	return toTargetResponse(*target), nil
+}
+
+// UpdateTarget renames, moves or re-credentials a deployment target. Only its creator or the
+// owner of its team may change it.
+func UpdateTarget(userID, targetID uuid.UUID, request dto.UpdateDeploymentTargetRequest) (map[string]interface{}, *utils.ServiceError) {
+	target, serviceErr := getManageableTarget(userID, targetID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	updates := map[string]interface{}{"updated_by": userID}
+	if name := strings.TrimSpace(request.Name); name != "" {
+		updates["name"] = name
+	}
+	if request.Host != "" {
+		host, serviceErr := normalizeTargetHost(target.Type, request.Host)
+		if serviceErr != nil {
+			return nil, serviceErr
+		}
+		updates["host"] = host
+	}
+	if request.TeamID != nil && *request.TeamID != target.TeamID {
+		// uuid.Nil turns a team target back into a personal one
+		if *request.TeamID != uuid.Nil {
+			if serviceErr := checkTargetTeam(userID, *request.TeamID); serviceErr != nil {
+				return nil, serviceErr
+			}
+		}
+		updates["team_id"] = uuidOrNil(*request.TeamID)
+	}
+	if request.CACert != "" || request.Cert != "" || request.Key != "" || request.Token != "" {
+		encrypted, serviceErr := encryptTargetAuth(target.Type, request.CACert, request.Cert, request.Key, request.Token)
+		if serviceErr != nil {
+			return nil, serviceErr
+		}
+		updates["auth"] = encrypted
+	}
+
+	if err := config.DB.Model(target).Updates(updates).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to update deployment target",
+			Err:        err,
+		}
+	}
+	if err := config.DB.First(target, "id = ?", target.ID).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return toTargetResponse(*target), nil
+}
+
+// DeleteTarget removes a deployment target that has no deployment in progress
+func DeleteTarget(userID, targetID uuid.UUID) *utils.ServiceError {
+	target, serviceErr := getManageableTarget(userID, targetID)
+	if serviceErr != nil {
+		return serviceErr
+	}
+
+	// Scheduled deployments and those awaiting approval would start against a deleted target later
+	var active int64
+	if err := config.DB.Model(&deployments.Deployment{}).
+		Where("target_id = ? AND status IN ?", target.ID, []string{StatusScheduled, StatusAwaitingApproval, StatusPending, StatusBuilding, StatusDeploying}).
+		Count(&active).Error; err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if active > 0 {
+		return &utils.ServiceError{
+			StatusCode: http.StatusConflict,
+			Message:    "deployment target has deployments in progress, scheduled or awaiting approval",
+			Err:        fmt.Errorf("target %s has %d active deployments", target.ID, active),
+		}
+	}
+
+	if err := config.DB.Model(target).Update("updated_by", userID).Error; err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if err := config.DB.Delete(target).Error; err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to delete deployment target",
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// GetAccessibleTarget loads a deployment target created by the user or shared with one of the
+// user's teams
+func GetAccessibleTarget(userID, targetID uuid.UUID) (*deployments.DeploymentTarget, *utils.ServiceError) {
+	db := config.DB
+
+	scoped, serviceErr := accessibleTargets(db, userID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	var target deployments.DeploymentTarget
+	if err := db.Where("id = ?", targetID).Where(scoped).First(&target).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "deployment target not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return &target, nil
+}
+
+// PrepareRemoteBuild writes the TLS material of a Docker target to a per-job temp directory.
+// The returned cleanup function removes the directory and must always be called.
+func PrepareRemoteBuild(userID, targetID uuid.UUID, jobName string) (*interfaces.RemoteBuildConfig, func(), *utils.ServiceError) {
+	if targetID == uuid.Nil {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "deploy_target_id is required",
+			Err:        errors.New("missing deploy target"),
+		}
+	}
+
+	target, serviceErr := GetAccessibleTarget(userID, targetID)
+	if serviceErr != nil {
+		return nil, nil, serviceErr
+	}
+	if target.Type != TargetTypeDocker {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "only docker targets can be used for builds",
+			Err:        fmt.Errorf("target %s has type %q", target.ID, target.Type),
+		}
+	}
+
+	var auth DockerTLSAuth
+	if err := DecryptAuth(target.Auth, &auth); err != nil {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to decrypt target credentials",
+			Err:        err,
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "deva-build-"+jobName+"-")
+	if err != nil {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to create job directory",
+			Err:        err,
+		}
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+
+	remote := &interfaces.RemoteBuildConfig{
+		DockerHost:    target.Host,
+		TLSCACertPath: filepath.Join(dir, "ca.pem"),
+		TLSCertPath:   filepath.Join(dir, "cert.pem"),
+		TLSKeyPath:    filepath.Join(dir, "key.pem"),
+		ProjectPath:   filepath.Join("public", jobName),
+	}
+
+	files := []struct {
+		path    string
+		content string
+		mode    os.FileMode
+	}{
+		{remote.TLSCACertPath, auth.CACert, 0644},
+		{remote.TLSCertPath, auth.Cert, 0644},
+		{remote.TLSKeyPath, auth.Key, 0600},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(f.path, []byte(f.content), f.mode); err != nil {
+			cleanup()
+			return nil, nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "failed to write target certificates",
+				Err:        err,
+			}
+		}
+	}
+
+	return remote, cleanup, nil
+}
+
+// EncryptAuth encrypts credentials into the JSON envelope stored in DeploymentTarget.Auth
+func EncryptAuth(v interface{}) (string, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := services.Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+	envelope, err := json.Marshal(encryptedAuth{Ciphertext: ciphertext})
+	if err != nil {
+		return "", err
+	}
+	return string(envelope), nil
+}
+
+// DecryptAuth decodes a DeploymentTarget.Auth envelope into v
+func DecryptAuth(raw string, v interface{}) error {
+	var envelope encryptedAuth
+	if err := json.Unmarshal([]byte(raw), &envelope); err != nil {
+		return fmt.Errorf("malformed auth envelope: %w", err)
+	}
+	plaintext, err := services.Decrypt(envelope.Ciphertext)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, v)
+}
+
+// NormalizeDockerHost turns "host", "host:port" or "tcp://host:port" into "tcp://host:port"
+func NormalizeDockerHost(raw string) (string, error) {
+	host := strings.TrimSpace(raw)
+	host = strings.TrimPrefix(host, "tcp://")
+	host = strings.TrimSuffix(host, "/")
+	if host == "" || strings.Contains(host, "://") || strings.Contains(host, "/") {
+		return "", fmt.Errorf("invalid docker host %q", raw)
+	}
+
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "2376")
+	}
+	return "tcp://" + host, nil
+}
+
+// NormalizeKubernetesServer turns "host", "host:port" or "https://host:port" into an https URL
+func NormalizeKubernetesServer(raw string) (string, error) {
+	server := strings.TrimSuffix(strings.TrimSpace(raw), "/")
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	parsed, err := url.Parse(server)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" || parsed.RawQuery != "" {
+		return "", fmt.Errorf("invalid kubernetes API server %q: expected https://host[:port]", raw)
+	}
+	return parsed.String(), nil
+}
+
+// Helper Functions
+func accessibleTargets(db *gorm.DB, userID uuid.UUID) (*gorm.DB, *utils.ServiceError) {
+	teamIDs, err := teams.UserTeamIDs(db, userID)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if len(teamIDs) == 0 {
+		return db.Where("created_by = ?", userID), nil
+	}
+	return db.Where("created_by = ? OR team_id IN ?", userID, teamIDs), nil
+}
+
+// getManageableTarget loads a target the user may change: one the user created, or one of a
+// team the user owns
+func getManageableTarget(userID, targetID uuid.UUID) (*deployments.DeploymentTarget, *utils.ServiceError) {
+	target, serviceErr := GetAccessibleTarget(userID, targetID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	if target.CreatedBy == userID {
+		return target, nil
+	}
+
+	isOwner, err := teams.IsTeamOwner(config.DB, target.TeamID, userID)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if !isOwner {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusForbidden,
+			Message:    "only the creator or the team owner can change this deployment target",
+			Err:        fmt.Errorf("user %s cannot manage target %s", userID, target.ID),
+		}
+	}
+	return target, nil
+}
+
+func checkTargetTeam(userID, teamID uuid.UUID) *utils.ServiceError {
+	if teamID == uuid.Nil {
+		return nil
+	}
+	isMember, err := teams.IsTeamMember(config.DB, teamID, userID)
+	if err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if !isMember {
+		return &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "team not found",
+			Err:        fmt.Errorf("user %s is not a member of team %s", userID, teamID),
+		}
+	}
+	return nil
+}
+
+func normalizeTargetHost(targetType, raw string) (string, *utils.ServiceError) {
+	normalize := NormalizeDockerHost
+	if targetType == TargetTypeKubernetes {
+		normalize = NormalizeKubernetesServer
+	}
+	host, err := normalize(raw)
+	if err != nil {
+		return "", &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("invalid %s host", targetType),
+			Err:        err,
+		}
+	}
+	return host, nil
+}
+
+// encryptTargetAuth validates the credentials of a target type and encrypts them
+func encryptTargetAuth(targetType, caCert, cert, key, token string) (string, *utils.ServiceError) {
+	var auth interface{}
+	var err error
+	switch targetType {
+	case TargetTypeKubernetes:
+		kubeAuth := KubernetesAuth{CACert: caCert, Cert: cert, Key: key, Token: strings.TrimSpace(token)}
+		err = validateKubernetesAuth(kubeAuth)
+		auth = kubeAuth
+	default:
+		dockerAuth := DockerTLSAuth{CACert: caCert, Cert: cert, Key: key}
+		err = validateDockerTLSAuth(dockerAuth)
+		if err == nil && token != "" {
+			err = errors.New("docker targets authenticate with a client certificate, not a token")
+		}
+		auth = dockerAuth
+	}
+	if err != nil {
+		return "", &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "invalid credentials",
+			Err:        err,
+		}
+	}
+
+	encrypted, err := EncryptAuth(auth)
+	if err != nil {
+		return "", &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to encrypt credentials",
+			Err:        err,
+		}
+	}
+	return encrypted, nil
+}
+
+func validateKubernetesAuth(auth KubernetesAuth) error {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(auth.CACert)) {
+		return errors.New("CA certificate is not a valid PEM certificate")
+	}
+	if auth.Cert == "" && auth.Key == "" {
+		if auth.Token == "" {
+			return errors.New("a bearer token or a client certificate and key are required")
+		}
+		return nil
+	}
+	if _, err := tls.X509KeyPair([]byte(auth.Cert), []byte(auth.Key)); err != nil {
+		return fmt.Errorf("client certificate and key do not match: %w", err)
+	}
+	return nil
+}
+
+func validateDockerTLSAuth(auth DockerTLSAuth) error {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(auth.CACert)) {
+		return errors.New("CA certificate is not a valid PEM certificate")
+	}
+	if _, err := tls.X509KeyPair([]byte(auth.Cert), []byte(auth.Key)); err != nil {
+		return fmt.Errorf("client certificate and key do not match: %w", err)
+	}
+	return nil
+}
+
+func toTargetResponse(t deployments.DeploymentTarget) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         t.ID,
+		"team_id":    uuidOrNil(t.TeamID),
+		"name":       t.Name,
+		"type":       t.Type,
+		"host":       t.Host,
+		"created_by": t.CreatedBy,
+		"created_at": t.CreatedAt,
+		"updated_at": t.UpdatedAt,
+	}
+}
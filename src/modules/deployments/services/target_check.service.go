@@ -0,0 +1,328 @@
+package deployments
+
+import (
+	"context"
+	"crypto/tls"
+	"deva/src/lib/docker"
+	"deva/src/lib/kubernetes"
+	deployments "deva/src/modules/deployments/models"
+	"deva/src/utils"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	targetCheckTimeout = 20 * time.Second
+	// Certificates expiring sooner than this are reported as a warning
+	certificateExpiryWarning = 30 * 24 * time.Hour
+)
+
+// targetCheck is one step of a connection test
+type targetCheck struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Detail     string `json:"detail,omitempty"`
+	Warning    string `json:"warning,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// targetReport is the result of a connection test
+type targetReport struct {
+	checks       []targetCheck
+	version      map[string]interface{}
+	capabilities map[string]interface{}
+}
+
+// TestTarget checks the TLS credentials, reachability, version and capabilities of a deployment
+// target. Failed checks are part of the report, not errors. namespace scopes the permission
+// checks of Kubernetes targets.
+func TestTarget(userID, targetID uuid.UUID, namespace string) (map[string]interface{}, *utils.ServiceError) {
+	target, serviceErr := GetAccessibleTarget(userID, targetID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), targetCheckTimeout)
+	defer cancel()
+
+	report := &targetReport{}
+	var err error
+	switch target.Type {
+	case TargetTypeDocker:
+		err = checkDockerTarget(ctx, target, report)
+	case TargetTypeKubernetes:
+		if namespace == "" {
+			namespace = "default"
+		}
+		err = checkKubernetesTarget(ctx, target, namespace, report)
+	default:
+		err = fmt.Errorf("unsupported target type %q", target.Type)
+	}
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to test deployment target",
+			Err:        err,
+		}
+	}
+
+	ok := len(report.checks) > 0
+	for _, check := range report.checks {
+		ok = ok && check.OK
+	}
+	return map[string]interface{}{
+		"target_id":    target.ID,
+		"type":         target.Type,
+		"host":         target.Host,
+		"ok":           ok,
+		"checks":       report.checks,
+		"version":      report.version,
+		"capabilities": report.capabilities,
+		"checked_at":   time.Now(),
+	}, nil
+}
+
+// Helper Functions
+func checkDockerTarget(ctx context.Context, target *deployments.DeploymentTarget, report *targetReport) error {
+	var auth DockerTLSAuth
+	if err := DecryptAuth(target.Auth, &auth); err != nil {
+		return fmt.Errorf("failed to decrypt target credentials: %w", err)
+	}
+	tlsConfig, err := docker.TLSConfigFromPEM([]byte(auth.CACert), []byte(auth.Cert), []byte(auth.Key))
+	if err != nil {
+		report.add("tls", time.Now(), err, "")
+		return nil
+	}
+	if !report.checkTLS(ctx, target.Host, tlsConfig) {
+		return nil
+	}
+
+	client, err := docker.NewClient(target.Host, tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	apiVersion, err := client.Ping(ctx)
+	report.add("api", started, err, "Engine API "+apiVersion)
+	if err != nil {
+		return nil
+	}
+
+	started = time.Now()
+	version, err := client.Version(ctx)
+	if err == nil {
+		report.version = map[string]interface{}{
+			"server":          version.Version,
+			"api_version":     version.APIVersion,
+			"min_api_version": version.MinAPIVersion,
+			"os":              version.Os,
+			"arch":            version.Arch,
+			"kernel":          version.KernelVersion,
+		}
+		report.add("version", started, nil, "Docker "+version.Version)
+	} else {
+		report.add("version", started, err, "")
+	}
+
+	started = time.Now()
+	info, err := client.Info(ctx)
+	if err != nil {
+		report.add("capabilities", started, err, "")
+		return nil
+	}
+	runtimes := make([]string, 0, len(info.Runtimes))
+	for name := range info.Runtimes {
+		runtimes = append(runtimes, name)
+	}
+	sort.Strings(runtimes)
+	report.capabilities = map[string]interface{}{
+		"os":              info.OperatingSystem,
+		"os_type":         info.OSType,
+		"architecture":    info.Architecture,
+		"cpus":            info.NCPU,
+		"memory_bytes":    info.MemTotal,
+		"storage_driver":  info.Driver,
+		"cgroup_version":  info.CgroupVersion,
+		"default_runtime": info.DefaultRuntime,
+		"runtimes":        runtimes,
+		"swarm":           info.Swarm.LocalNodeState == "active",
+		"build":           true,
+		"strategies":      []string{StrategyRecreate, StrategyBlueGreen, StrategyCanary},
+	}
+	check := targetCheck{Name: "capabilities", OK: true, DurationMS: time.Since(started).Milliseconds()}
+	if info.OSType != "linux" {
+		check.Warning = fmt.Sprintf("deva deploys linux containers, the daemon runs %s containers", info.OSType)
+	}
+	report.checks = append(report.checks, check)
+	return nil
+}
+
+func checkKubernetesTarget(ctx context.Context, target *deployments.DeploymentTarget, namespace string, report *targetReport) error {
+	var auth KubernetesAuth
+	if err := DecryptAuth(target.Auth, &auth); err != nil {
+		return fmt.Errorf("failed to decrypt target credentials: %w", err)
+	}
+	tlsConfig, err := kubernetes.TLSConfigFromPEM([]byte(auth.CACert), []byte(auth.Cert), []byte(auth.Key))
+	if err != nil {
+		report.add("tls", time.Now(), err, "")
+		return nil
+	}
+	if !report.checkTLS(ctx, target.Host, tlsConfig) {
+		return nil
+	}
+
+	client, err := kubernetes.NewClient(target.Host, tlsConfig, auth.Token)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	version, err := client.Version(ctx)
+	if err != nil {
+		report.add("api", started, err, "")
+		return nil
+	}
+	report.version = map[string]interface{}{
+		"server":   version.GitVersion,
+		"major":    version.Major,
+		"minor":    version.Minor,
+		"platform": version.Platform,
+	}
+	report.add("api", started, nil, "Kubernetes "+version.GitVersion)
+
+	// Discovery needs an authenticated user, so it doubles as the credentials check
+	started = time.Now()
+	groups, err := client.ServerGroups(ctx)
+	report.add("credentials", started, err, "authenticated")
+	if err != nil {
+		return nil
+	}
+	served := map[string]bool{}
+	for _, group := range groups {
+		served[group] = true
+	}
+
+	started = time.Now()
+	permissions := map[string]bool{}
+	var denied []string
+	for _, resource := range []struct{ group, resource string }{
+		{"apps", "deployments"},
+		{"", "services"},
+		{"", "secrets"},
+		{"networking.k8s.io", "ingresses"},
+	} {
+		allowed, err := client.CanI(ctx, namespace, "create", resource.group, resource.resource)
+		if err != nil {
+			report.add("permissions", started, err, "")
+			return nil
+		}
+		permissions["create "+resource.resource] = allowed
+		if !allowed {
+			denied = append(denied, resource.resource)
+		}
+	}
+	// Deployments are required, the other resources only by some manifests
+	check := targetCheck{Name: "permissions", OK: permissions["create deployments"],
+		Detail: "namespace " + namespace, DurationMS: time.Since(started).Milliseconds()}
+	if len(denied) > 0 {
+		check.Warning = "cannot create " + strings.Join(denied, ", ")
+	}
+	report.checks = append(report.checks, check)
+
+	report.capabilities = map[string]interface{}{
+		"namespace":   namespace,
+		"deployments": served["apps/v1"],
+		"ingress":     served["networking.k8s.io/v1"],
+		"autoscaling": served["autoscaling/v2"],
+		"metrics":     served["metrics.k8s.io/v1beta1"],
+		"permissions": permissions,
+	}
+	return nil
+}
+
+// checkTLS completes a TLS handshake with the target, verifying the server certificate against
+// the target CA, and reports the certificates involved
+func (r *targetReport) checkTLS(ctx context.Context, host string, tlsConfig *tls.Config) bool {
+	started := time.Now()
+	address, serverName, err := tlsAddress(host)
+	if err != nil {
+		r.add("tls", started, err, "")
+		return false
+	}
+
+	config := tlsConfig.Clone()
+	config.ServerName = serverName
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{}, Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		r.add("tls", started, err, "")
+		return false
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	check := targetCheck{Name: "tls", OK: true, DurationMS: time.Since(started).Milliseconds()}
+	if len(state.PeerCertificates) > 0 {
+		server := state.PeerCertificates[0]
+		check.Detail = fmt.Sprintf("%s, server certificate %s valid until %s",
+			tls.VersionName(state.Version), server.Subject.CommonName, server.NotAfter.Format(time.RFC3339))
+		if time.Until(server.NotAfter) < certificateExpiryWarning {
+			check.Warning = "server certificate expires " + server.NotAfter.Format(time.RFC3339)
+		}
+	}
+	for _, cert := range config.Certificates {
+		if cert.Leaf != nil && time.Until(cert.Leaf.NotAfter) < certificateExpiryWarning {
+			check.Warning = strings.TrimPrefix(check.Warning+"; client certificate expires "+cert.Leaf.NotAfter.Format(time.RFC3339), "; ")
+		}
+	}
+	r.checks = append(r.checks, check)
+	return true
+}
+
+func (r *targetReport) add(name string, started time.Time, err error, detail string) {
+	check := targetCheck{Name: name, OK: err == nil, Detail: detail, DurationMS: time.Since(started).Milliseconds()}
+	if err != nil {
+		check.Detail = describeCheckError(err)
+	}
+	r.checks = append(r.checks, check)
+}
+
+// tlsAddress returns the dial address and TLS server name of a tcp:// or https:// target host
+func tlsAddress(host string) (string, string, error) {
+	parsed, err := url.Parse(host)
+	if err != nil || parsed.Hostname() == "" {
+		return "", "", fmt.Errorf("invalid target host %q", host)
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+	}
+	return net.JoinHostPort(parsed.Hostname(), port), parsed.Hostname(), nil
+}
+
+func describeCheckError(err error) string {
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return "server certificate is not trusted by the target CA: " + certErr.Err.Error()
+	}
+	var kubeErr *kubernetes.APIError
+	if errors.As(err, &kubeErr) && (kubeErr.StatusCode == http.StatusUnauthorized || kubeErr.StatusCode == http.StatusForbidden) {
+		return "credentials rejected: " + kubeErr.Message
+	}
+	var dockerErr *docker.APIError
+	if errors.As(err, &dockerErr) {
+		return dockerErr.Message
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timed out"
+	}
+	return err.Error()
+}
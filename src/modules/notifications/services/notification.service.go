@@ -0,0 +1,38 @@
+package notifications
+
+import (
+	"deva/src/config"
+	notifications "deva/src/modules/notifications/models"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// Notification types
+const (
+	TypeDeployment         = "deployment"
+	TypeDeploymentApproval = "deployment_approval"
+)
+
+// Notify stores an in-app notification for a user
+func Notify(userID uuid.UUID, notificationType, message string, metadata map[string]interface{}) error {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification metadata: %w", err)
+	}
+
+	notification := notifications.Notification{
+		UserID:    userID,
+		Type:      notificationType,
+		Message:   message,
+		Metadata:  string(encoded),
+		UpdatedBy: userID,
+	}
+	if err := config.DB.Create(&notification).Error; err != nil {
+		return fmt.Errorf("failed to store notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package plans
+
+import (
+	"deva/src/config"
+	deployments "deva/src/modules/deployments/models"
+	templates "deva/src/modules/templates/models"
+	"deva/src/utils"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	deploymentQuotaKeyPrefix = "quota:deployments"
+	deploymentUsageKeyPrefix = "usage:deployments"
+	// Counters outlive their day so the last reconciliation of the day still sees them
+	deploymentCounterTTL = 48 * time.Hour
+
+	DeploymentUsageReconcileInterval = 5 * time.Minute
+)
+
+// reserveDeploymentScript seeds a missing counter, then takes one slot unless the limit is reached.
+// KEYS[1] = counter, ARGV[1] = seed, ARGV[2] = limit, ARGV[3] = ttl in seconds.
+var reserveDeploymentScript = redis.NewScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'NX', 'EX', ARGV[3])
+local count = redis.call('INCR', KEYS[1])
+if count > tonumber(ARGV[2]) then
+	redis.call('DECR', KEYS[1])
+	return {0, count - 1}
+end
+return {1, count}
+`)
+
+// DeploymentQuota describes the daily deployment allowance of a user or team
+type DeploymentQuota struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	key       string
+}
+
+// ReserveDeployment takes one deployment slot for today (UTC). Team projects count against
+// the team, personal projects against the user. The quota is returned even when the limit
+// is exceeded so callers can report it.
+func ReserveDeployment(userID, teamID uuid.UUID) (*DeploymentQuota, *utils.ServiceError) {
+	plan, serviceErr := resolvePlan(config.DB, userID, teamID, false)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	dayStart, reset := utcDay(time.Now())
+	quota := &DeploymentQuota{
+		Limit: plan.MaxDeploymentsPerDay,
+		Reset: reset,
+		key:   deploymentQuotaKey(userID, teamID, dayStart),
+	}
+
+	// A lost counter (e.g. Redis restarted) is rebuilt from today's deployments
+	seed, err := countDeploymentsSince(userID, teamID, dayStart)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to count today's deployments",
+			Err:        err,
+		}
+	}
+
+	result, err := reserveDeploymentScript.Run(config.Ctx, config.RDB, []string{quota.key},
+		seed, quota.Limit, int(deploymentCounterTTL.Seconds())).Int64Slice()
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "Failed to check deployment quota",
+			Err:        err,
+		}
+	}
+
+	allowed, used := result[0] == 1, int(result[1])
+	quota.Remaining = max(quota.Limit-used, 0)
+	if !allowed {
+		return quota, &utils.ServiceError{
+			StatusCode: http.StatusTooManyRequests,
+			Message: fmt.Sprintf("Deployment quota exceeded: the %s plan allows %d deployment(s) per day. The quota resets at %s.",
+				plan.Name, quota.Limit, reset.Format(time.RFC3339)),
+			Err: fmt.Errorf("%d of %d daily deployments in use", used, quota.Limit),
+		}
+	}
+	return quota, nil
+}
+
+// ReleaseDeployment gives back a slot taken by ReserveDeployment when the deployment was not created
+func ReleaseDeployment(quota *DeploymentQuota) {
+	if err := config.RDB.Decr(config.Ctx, quota.key).Err(); err != nil {
+		log.Printf("⚠️ Failed to release deployment quota %s: %v", quota.key, err)
+		return
+	}
+	quota.Remaining = min(quota.Remaining+1, quota.Limit)
+}
+
+// RecordDeploymentUsage counts a created deployment in today's usage, which is later
+// reconciled into UsageMetric rows
+func RecordDeploymentUsage(userID, projectID uuid.UUID) {
+	dayStart, _ := utcDay(time.Now())
+	key := deploymentUsageKey(dayStart)
+
+	pipe := config.RDB.TxPipeline()
+	pipe.HIncrBy(config.Ctx, key, userID.String()+":"+projectID.String(), 1)
+	pipe.Expire(config.Ctx, key, deploymentCounterTTL)
+	if _, err := pipe.Exec(config.Ctx); err != nil {
+		log.Printf("⚠️ Failed to record deployment usage of user %s: %v", userID, err)
+	}
+}
+
+// ReconcileDeploymentUsage writes the deployment counts of a UTC day from Redis into UsageMetric rows
+func ReconcileDeploymentUsage(day time.Time) error {
+	db := config.DB
+	dayStart, dayEnd := utcDay(day)
+
+	counts, err := config.RDB.HGetAll(config.Ctx, deploymentUsageKey(dayStart)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read deployment usage: %w", err)
+	}
+
+	for field, value := range counts {
+		userID, projectID, err := parseUsageField(field)
+		if err != nil {
+			log.Printf("⚠️ Skipping deployment usage %q: %v", field, err)
+			continue
+		}
+		var count int
+		if _, err := fmt.Sscan(value, &count); err != nil {
+			log.Printf("⚠️ Skipping deployment usage %q: %v", field, err)
+			continue
+		}
+
+		var metric templates.UsageMetric
+		err = db.Where("user_id = ? AND project_id = ? AND metric_type = ? AND period_start = ?",
+			userID, projectID, MetricDeployment, dayStart).First(&metric).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			metric = templates.UsageMetric{
+				UserID:      userID,
+				ProjectID:   projectID,
+				MetricType:  MetricDeployment,
+				Count:       count,
+				PeriodStart: dayStart,
+				PeriodEnd:   dayEnd,
+				UpdatedBy:   userID,
+			}
+			if err := db.Create(&metric).Error; err != nil {
+				return fmt.Errorf("failed to record deployment usage: %w", err)
+			}
+		case err != nil:
+			return err
+		case count > metric.Count:
+			// Never lower a stored count: Redis may have lost part of the day
+			if err := db.Model(&metric).Update("count", count).Error; err != nil {
+				return fmt.Errorf("failed to update deployment usage: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// StartDeploymentUsageReconciler periodically reconciles yesterday's and today's deployment usage
+func StartDeploymentUsageReconciler() {
+	go func() {
+		ticker := time.NewTicker(DeploymentUsageReconcileInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			now := time.Now()
+			for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+				if err := ReconcileDeploymentUsage(day); err != nil {
+					log.Printf("⚠️ Failed to reconcile deployment usage: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Helper Functions
+func utcDay(at time.Time) (time.Time, time.Time) {
+	at = at.UTC()
+	start := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 0, 1)
+}
+
+func deploymentQuotaKey(userID, teamID uuid.UUID, day time.Time) string {
+	if teamID != uuid.Nil {
+		return fmt.Sprintf("%s:team:%s:%s", deploymentQuotaKeyPrefix, teamID, day.Format(time.DateOnly))
+	}
+	return fmt.Sprintf("%s:user:%s:%s", deploymentQuotaKeyPrefix, userID, day.Format(time.DateOnly))
+}
+
+func deploymentUsageKey(day time.Time) string {
+	return fmt.Sprintf("%s:%s", deploymentUsageKeyPrefix, day.Format(time.DateOnly))
+}
+
+func parseUsageField(field string) (uuid.UUID, uuid.UUID, error) {
+	userPart, projectPart, ok := strings.Cut(field, ":")
+	if !ok {
+		return uuid.Nil, uuid.Nil, errors.New("malformed usage field")
+	}
+	userID, err := uuid.Parse(userPart)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	projectID, err := uuid.Parse(projectPart)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	return userID, projectID, nil
+}
+
+// countDeploymentsSince counts the deployments of the team's projects, or of the user's personal projects
+func countDeploymentsSince(userID, teamID uuid.UUID, since time.Time) (int64, error) {
+	query := config.DB.Model(&deployments.Deployment{}).
+		Joins("JOIN projects ON projects.id = deployments.project_id").
+		Where("deployments.created_at >= ?", since)
+	if teamID != uuid.Nil {
+		query = query.Where("projects.team_id = ?", teamID)
+	} else {
+		query = query.Where("deployments.triggered_by = ? AND projects.team_id IS NULL", userID)
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,166 @@
+package plans
+
+import (
+	"deva/src/config"
+	billing "deva/src/modules/billing/model"
+	plans "deva/src/modules/plans/models"
+	projects "deva/src/modules/projects/models"
+	teams "deva/src/modules/teams/models"
+	templates "deva/src/modules/templates/models"
+	users "deva/src/modules/users/models"
+	"deva/src/utils"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"time"
+)
+
+// Usage metric types
+const (
+	MetricProject    = "project"
+	MetricDeployment = "deployment"
+)
+
+// ActiveProjectStatuses are the project statuses that occupy a plan slot
+var ActiveProjectStatuses = []string{"creating", "active"}
+
+// ResolvePlan returns the plan that applies to a user, or to a team when teamID is set.
+// Team usage is counted against the plan of the team owner.
+func ResolvePlan(tx *gorm.DB, userID, teamID uuid.UUID) (*plans.Plan, *utils.ServiceError) {
+	return resolvePlan(tx, userID, teamID, false)
+}
+
+// CheckProjectQuota verifies that the user (or team) can create one more project.
+// It must run inside the transaction that creates the project: the owner row is locked
+// so concurrent creations for the same owner cannot both pass the check.
+func CheckProjectQuota(tx *gorm.DB, userID, teamID uuid.UUID) *utils.ServiceError {
+	plan, serviceErr := resolvePlan(tx, userID, teamID, true)
+	if serviceErr != nil {
+		return serviceErr
+	}
+
+	query := tx.Model(&projects.Project{}).Where("status IN ?", ActiveProjectStatuses)
+	if teamID != uuid.Nil {
+		query = query.Where("team_id = ?", teamID)
+	} else {
+		query = query.Where("created_by = ? AND team_id IS NULL", userID)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to count active projects",
+			Err:        err,
+		}
+	}
+
+	if int(count) >= plan.MaxProjects {
+		return &utils.ServiceError{
+			StatusCode: http.StatusForbidden,
+			Message: fmt.Sprintf("Project quota exceeded: the %s plan allows %d active project(s). Delete a project or upgrade your plan.",
+				plan.Name, plan.MaxProjects),
+			Err: fmt.Errorf("%d of %d active projects in use", count, plan.MaxProjects),
+		}
+	}
+	return nil
+}
+
+// CurrentBillingPeriod returns the billing period of a user at the given time. The period of
+// an active subscription is used when there is one, otherwise the calendar month (UTC).
+func CurrentBillingPeriod(userID uuid.UUID, at time.Time) (time.Time, time.Time) {
+	db := config.DB
+
+	var subscription billing.BillingSubscription
+	err := db.Where("user_id = ? AND status = ? AND started_at <= ? AND renew_at > ?", userID, "active", at, at).
+		Order("started_at desc").
+		First(&subscription).Error
+	if err == nil {
+		return subscription.StartedAt, subscription.RenewAt
+	}
+
+	at = at.UTC()
+	start := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// RecordUsage stores a usage metric for the current billing period of the user
+func RecordUsage(userID, projectID uuid.UUID, metricType string, count int) error {
+	db := config.DB
+
+	start, end := CurrentBillingPeriod(userID, time.Now())
+	metric := templates.UsageMetric{
+		UserID:      userID,
+		ProjectID:   projectID,
+		MetricType:  metricType,
+		Count:       count,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		UpdatedBy:   userID,
+	}
+	if err := db.Create(&metric).Error; err != nil {
+		return fmt.Errorf("failed to record %s usage: %w", metricType, err)
+	}
+	return nil
+}
+
+// Helper Functions
+func resolvePlan(tx *gorm.DB, userID, teamID uuid.UUID, lock bool) (*plans.Plan, *utils.ServiceError) {
+	query := func() *gorm.DB {
+		if lock {
+			return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		return tx
+	}
+
+	ownerID := userID
+	if teamID != uuid.Nil {
+		var team teams.Team
+		if err := query().First(&team, "id = ?", teamID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, &utils.ServiceError{
+					StatusCode: http.StatusNotFound,
+					Message:    "Team not found",
+					Err:        err,
+				}
+			}
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "DB error",
+				Err:        err,
+			}
+		}
+
+		if team.OwnerID != userID {
+			var member teams.TeamMember
+			if err := tx.Where("team_id = ? AND user_id = ?", teamID, userID).First(&member).Error; err != nil {
+				return nil, &utils.ServiceError{
+					StatusCode: http.StatusForbidden,
+					Message:    "You are not a member of this team",
+					Err:        err,
+				}
+			}
+		}
+		ownerID = team.OwnerID
+	}
+
+	var owner users.User
+	if err := query().Preload("Plan").First(&owner, "id = ?", ownerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "User not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return &owner.Plan, nil
+}
@@ -4,16 +4,29 @@ import (
 	"deva/src/lib/dto"
 	"deva/src/lib/interfaces"
 	projects "deva/src/modules/projects/services"
+	users "deva/src/modules/users/models"
 	"deva/src/utils"
 	"deva/store"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
-	"path/filepath"
+	"github.com/google/uuid"
 	"time"
 )
 
 // CreateNewFiberProject is a controller function to handle create new fiber project
 func CreateNewFiberProject(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
 	var requestData dto.CreateFiberRequest
 
 	// Bind the incoming JSON request data to requestData struct
@@ -30,22 +43,14 @@ func CreateNewFiberProject(c *fiber.Ctx) error {
 			Error: errStr,
 		})
 	}
+	requestData.UserID = currentUser.ID
 
-	// Get socket id from users
-	conn, _ := store.GetUserSocket(requestData.UserID)
-	if conn == nil {
-		return c.Status(fiber.StatusNotFound).JSON(interfaces.Response{
-			Data: nil,
-			Status: interfaces.Status{
-				Code:    fiber.StatusNotFound,
-				Message: "WebSocket connection not found for users",
-			},
-			Error: nil,
-		})
-	}
+	// The job output also goes to the websocket of the user, when one is open
+	conn, _ := store.GetUserSocket(currentUser.ID)
 
-	// Call the services function to create the fiber project
-	zipPath, serviceError := projects.CreateFiberProject(conn, requestData.ProjectName, requestData.Env)
+	// Call the services function to create the fiber project; it keeps running in the background
+	jobID := uuid.New()
+	project, serviceError := projects.CreateFiberProject(conn, jobID, requestData)
 	if serviceError != nil {
 		s := serviceError.Err.Error()
 		errStr := &s
@@ -61,23 +66,66 @@ func CreateNewFiberProject(c *fiber.Ctx) error {
 
 	// Response
 	responseData := fiber.Map{
+		"project_id":   project.ID,
+		"job_id":       jobID,
 		"project_name": requestData.ProjectName,
 		"framework":    requestData.Env["FRAMEWORK"],
-		"created_at":   time.Now().Format(time.RFC3339),
-		"download": fiber.Map{
-			"file_name": filepath.Base(zipPath),
-			"path":      zipPath,
-		},
+		"created_at":   project.CreatedAt.Format(time.RFC3339),
+		"logs":         fmt.Sprintf("/api/v1/projects/jobs/%s/logs/stream", jobID),
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(interfaces.Response{
+	return c.Status(fiber.StatusAccepted).JSON(interfaces.Response{
 		Data: responseData,
 		Status: interfaces.Status{
-			Code: fiber.StatusOK,
-			Message: fmt.Sprintf("Project '%s' with framework '%s' created successfully",
+			Code: fiber.StatusAccepted,
+			Message: fmt.Sprintf("Project '%s' with framework '%s' is being created",
 				requestData.ProjectName,
 				requestData.Env["FRAMEWORK"]),
 		},
 		Error: nil,
 	})
 }
+
+// StreamJobLogs is a controller function to follow the output of a project creation job as server-sent events
+func StreamJobLogs(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		s := err.Error()
+		return c.Status(fiber.StatusBadRequest).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusBadRequest,
+				Message: "Invalid job ID",
+			},
+			Error: &s,
+		})
+	}
+
+	backlog, live, cancel, serviceErr := projects.StreamJobEvents(currentUser.ID, jobID, utils.LastEventID(c))
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return utils.StreamEvents(c, backlog, live, cancel)
+}
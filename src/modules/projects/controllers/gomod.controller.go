@@ -0,0 +1,181 @@
+package projects
+
+import (
+	"deva/src/lib/dto"
+	"deva/src/lib/interfaces"
+	projects "deva/src/modules/projects/services"
+	users "deva/src/modules/users/models"
+	"deva/src/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// AnalyzeGoModules is a controller function to list the requirements of a go.mod sent in the request
+func AnalyzeGoModules(c *fiber.Ctx) error {
+	if _, ok := c.Locals("user").(*users.User); !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	var body dto.AnalyzeGoModulesRequest
+	if serviceErr := utils.BindJson(c, &body); serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	response, serviceErr := projects.AnalyzeGoModules(body)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    fiber.StatusOK,
+			Message: "Go modules analyzed",
+		},
+		Error: nil,
+	})
+}
+
+// AnalyzeProjectGoModules is a controller function to list the requirements of a project go.mod,
+// with upgrades when ?upgrades=true
+func AnalyzeProjectGoModules(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		s := err.Error()
+		return c.Status(fiber.StatusBadRequest).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusBadRequest,
+				Message: "Invalid project ID",
+			},
+			Error: &s,
+		})
+	}
+
+	response, serviceErr := projects.AnalyzeProjectGoModules(currentUser.ID, projectID, c.QueryBool("upgrades"), c.QueryBool("indirect"))
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    fiber.StatusOK,
+			Message: "Go modules analyzed",
+		},
+		Error: nil,
+	})
+}
+
+// UpgradeProjectGoModules is a controller function to build an upgraded go.mod for a project
+func UpgradeProjectGoModules(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		s := err.Error()
+		return c.Status(fiber.StatusBadRequest).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusBadRequest,
+				Message: "Invalid project ID",
+			},
+			Error: &s,
+		})
+	}
+
+	var body dto.UpgradeGoModulesRequest
+	if len(c.Body()) > 0 {
+		if serviceErr := utils.BindJson(c, &body); serviceErr != nil {
+			s := serviceErr.Err.Error()
+			errStr := &s
+			return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+				Data: nil,
+				Status: interfaces.Status{
+					Code:    serviceErr.StatusCode,
+					Message: serviceErr.Message,
+				},
+				Error: errStr,
+			})
+		}
+	}
+
+	response, serviceErr := projects.UpgradeProjectGoModules(currentUser.ID, projectID, body)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    fiber.StatusOK,
+			Message: "go.mod upgraded",
+		},
+		Error: nil,
+	})
+}
@@ -0,0 +1,113 @@
+package projects
+
+import (
+	"deva/src/lib/dto"
+	"deva/src/lib/interfaces"
+	projects "deva/src/modules/projects/services"
+	users "deva/src/modules/users/models"
+	"deva/src/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// LintDockerFiles is a controller function to lint Dockerfiles and compose files sent in the request
+func LintDockerFiles(c *fiber.Ctx) error {
+	if _, ok := c.Locals("user").(*users.User); !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	var body dto.LintDockerFilesRequest
+	if serviceErr := utils.BindJson(c, &body); serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	response, serviceErr := projects.LintDockerFiles(body)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    fiber.StatusOK,
+			Message: "Files linted",
+		},
+		Error: nil,
+	})
+}
+
+// LintProjectFiles is a controller function to lint the stored Dockerfiles and compose file of a project
+func LintProjectFiles(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		s := err.Error()
+		return c.Status(fiber.StatusBadRequest).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusBadRequest,
+				Message: "Invalid project ID",
+			},
+			Error: &s,
+		})
+	}
+
+	response, serviceErr := projects.LintProjectFiles(currentUser.ID, projectID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    fiber.StatusOK,
+			Message: "Project files linted",
+		},
+		Error: nil,
+	})
+}
@@ -0,0 +1,64 @@
+package projects
+
+import (
+	"deva/src/lib/interfaces"
+	"deva/src/lib/sbom"
+	projects "deva/src/modules/projects/services"
+	users "deva/src/modules/users/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"strings"
+)
+
+var sbomContentTypes = map[string]string{
+	sbom.FormatCycloneDX: "application/vnd.cyclonedx+json",
+	sbom.FormatSPDX:      "application/spdx+json",
+}
+
+// GetProjectSBOM is a controller function to download the SBOM of a project. ?format= is cyclonedx
+// (default) or spdx; the document is sent as is, so SBOM tools can consume it.
+func GetProjectSBOM(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		s := err.Error()
+		return c.Status(fiber.StatusBadRequest).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusBadRequest,
+				Message: "Invalid project ID",
+			},
+			Error: &s,
+		})
+	}
+
+	format := strings.ToLower(c.Query("format", sbom.FormatCycloneDX))
+	document, fileName, serviceErr := projects.GetProjectSBOM(currentUser.ID, projectID, format)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	c.Attachment(fileName)
+	c.Set(fiber.HeaderContentType, sbomContentTypes[format])
+	return c.Status(fiber.StatusOK).Send(document)
+}
@@ -20,6 +20,7 @@ type ProjectConfig struct {
 	Framework      string
 	EnvVars        string `gorm:"type:jsonb"`
 	CITool         string
+	HealthCheck    string                       `gorm:"type:text"` // JSON encoded dto.HealthCheckOptions
 	DeployTargetID uuid.UUID                    `gorm:"type:uuid;not null"`
 	DeployTarget   deployments.DeploymentTarget `gorm:"foreignKey:DeployTargetID;references:ID"`
 
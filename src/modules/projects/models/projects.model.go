@@ -13,7 +13,8 @@ type Project struct {
 	Name          string    `gorm:"not null"`
 	RepoURL       string
 	SourceType    string         `gorm:"not null"`
-	Status        string         `gorm:"not null;default:'active'"`
+	Status        string         `gorm:"not null;default:'active'"` // "creating", "active", "failed", "archived"
+	CreatedBy     uuid.UUID      `gorm:"type:uuid;default:null;index"`
 	UpdatedBy     uuid.UUID      `gorm:"type:uuid;not null"`
 	UpdatedByUser users.User     `gorm:"foreignKey:UpdatedBy;references:ID;"`
 	CreatedAt     time.Time      `gorm:"autoCreateTime"`
@@ -0,0 +1,206 @@
+package projects
+
+import (
+	"deva/src/config"
+	"deva/src/lib/dto"
+	"deva/src/lib/interfaces"
+	"deva/src/lib/lint"
+	projects "deva/src/modules/projects/models"
+	secrets "deva/src/modules/secrets/models"
+	vulnerabilities "deva/src/modules/vulnerabilities/services"
+	"deva/src/services"
+	"deva/src/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// secretEnvMarkers identify env vars whose values are stored as encrypted Secrets instead of in ProjectConfig
+var secretEnvMarkers = []string{"PASS", "SECRET", "TOKEN", "PRIVATE", "API_KEY"}
+
+// dependencyManifests are kept with the project for module reports and vulnerability scans
+var dependencyManifests = []string{"go.mod", "go.sum", "package.json", "package-lock.json"}
+
+// IsSecretEnvKey reports whether an env var holds a credential
+func IsSecretEnvKey(key string) bool {
+	upper := strings.ToUpper(key)
+	for _, marker := range secretEnvMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// createProjectConfig stores the project configuration. Credentials are moved to encrypted
+// runtime Secrets and left out of ProjectConfig.EnvVars.
+func createProjectConfig(tx *gorm.DB, project *projects.Project, request dto.CreateFiberRequest, language, framework string, env map[string]string) (*projects.ProjectConfig, *utils.ServiceError) {
+	userID := request.UserID
+	plainEnv := map[string]string{}
+	for key, value := range env {
+		if !IsSecretEnvKey(key) {
+			plainEnv[key] = value
+			continue
+		}
+		if value == "" {
+			continue
+		}
+
+		encrypted, err := services.Encrypt([]byte(value))
+		if err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "failed to encrypt project secret",
+				Err:        err,
+			}
+		}
+		secret := secrets.Secret{
+			ProjectID:      project.ID,
+			Key:            key,
+			ValueEncrypted: encrypted,
+			Scope:          "runtime",
+			UpdatedBy:      userID,
+			CreatedBy:      userID,
+		}
+		if err := tx.Create(&secret).Error; err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "failed to store project secret",
+				Err:        err,
+			}
+		}
+	}
+
+	envJSON, err := json.Marshal(plainEnv)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to encode project env vars",
+			Err:        err,
+		}
+	}
+
+	var healthCheck []byte
+	if request.HealthCheck != nil {
+		if healthCheck, err = json.Marshal(request.HealthCheck); err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "failed to encode project health check",
+				Err:        err,
+			}
+		}
+	}
+
+	projectConfig := projects.ProjectConfig{
+		ProjectID:      project.ID,
+		UpdatedBy:      userID,
+		Language:       language,
+		Framework:      framework,
+		EnvVars:        string(envJSON),
+		CITool:         request.CITool,
+		HealthCheck:    string(healthCheck),
+		DeployTargetID: request.DeployTargetID,
+	}
+	if err := tx.Create(&projectConfig).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to create project config",
+			Err:        err,
+		}
+	}
+	return &projectConfig, nil
+}
+
+// GetProjectSecretKeys returns the keys of the runtime secrets of a project
+func GetProjectSecretKeys(projectID uuid.UUID) ([]string, error) {
+	var keys []string
+	err := config.DB.Model(&secrets.Secret{}).
+		Where("project_id = ? AND scope IN ?", projectID, []string{"runtime", "both"}).
+		Order("key").
+		Pluck("key", &keys).Error
+	return keys, err
+}
+
+// workspaceFilesStep stores the Dockerfiles, the compose file and the dependency manifests of the
+// workspace as generated ProjectFiles, so the project can be inspected after its workspace is gone
+func workspaceFilesStep(project *projects.Project, userID uuid.UUID) func(sc *interfaces.SafeConn) error {
+	return func(sc *interfaces.SafeConn) error {
+		workspace := filepath.Join("public", project.Name)
+		entries, err := os.ReadDir(workspace)
+		if err != nil {
+			return err
+		}
+		var files []GeneratedFile
+		for _, entry := range entries {
+			if entry.IsDir() || !(lint.Supports(entry.Name()) || contains(dependencyManifests, entry.Name())) {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(workspace, entry.Name()))
+			if err != nil {
+				return err
+			}
+			files = append(files, GeneratedFile{Path: entry.Name(), Content: string(content)})
+		}
+		return saveGeneratedFiles(project, userID, files)
+	}
+}
+
+// vulnerabilityScanStep scans the stored dependency manifests against the OSV snapshot and reports
+// the result. Findings are advisory and do not stop the workflow.
+func vulnerabilityScanStep(project *projects.Project, userID uuid.UUID) func(sc *interfaces.SafeConn) error {
+	return func(sc *interfaces.SafeConn) error {
+		scan, err := vulnerabilities.ScanProject(project.ID, userID, vulnerabilities.TriggerGeneration)
+		if err != nil {
+			return err
+		}
+		if scan.Status != vulnerabilities.ScanCompleted {
+			sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("⚠️ Vulnerability scan %s: %s", scan.Status, scan.Error)))
+			return nil
+		}
+		sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("🛡️ %d package(s) scanned: %d critical, %d high, %d medium, %d low, %d unknown (GET /api/v1/vulnerability-scans/%s)",
+			scan.PackagesScanned, scan.Critical, scan.High, scan.Medium, scan.Low, scan.Unknown, scan.ID)))
+		return nil
+	}
+}
+
+// saveGeneratedFiles writes generated files into the project workspace so they are exported with
+// the archive, and stores them as ProjectFiles replacing earlier generated versions.
+func saveGeneratedFiles(project *projects.Project, userID uuid.UUID, files []GeneratedFile) error {
+	workspace := filepath.Join("public", project.Name)
+	for _, file := range files {
+		target := filepath.Join(workspace, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", file.Path, err)
+		}
+		if err := os.WriteFile(target, []byte(file.Content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, file := range files {
+			if err := tx.Where("project_id = ? AND path = ? AND is_generated = ?", project.ID, file.Path, true).
+				Delete(&projects.ProjectFile{}).Error; err != nil {
+				return err
+			}
+			record := projects.ProjectFile{
+				ProjectID:   project.ID,
+				Path:        file.Path,
+				Content:     file.Content,
+				IsGenerated: true,
+				UpdatedBy:   userID,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return fmt.Errorf("failed to store %s: %w", file.Path, err)
+			}
+		}
+		return nil
+	})
+}
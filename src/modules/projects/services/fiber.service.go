@@ -1,10 +1,21 @@
 package projects
 
 import (
+	"deva/src/config"
 	"deva/src/functions"
+	"deva/src/lib/dto"
+	"deva/src/lib/interfaces"
+	deployments "deva/src/modules/deployments/services"
+	plans "deva/src/modules/plans/services"
+	projects "deva/src/modules/projects/models"
+	templates "deva/src/modules/templates/services"
 	"deva/src/utils"
+	"deva/store"
+	"errors"
 	"fmt"
 	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,47 +24,161 @@ import (
 	"time"
 )
 
-// CreateFiberProject creates a new Fiber project with optional remote build configuration
-func CreateFiberProject(conn *websocket.Conn, projectName string, env map[string]string) (string, *utils.ServiceError) {
+// CreateFiberProject validates a new Fiber project with optional remote build configuration and
+// reserves it within the plan quota, then generates and builds it in the background. The workflow
+// output goes to the event stream of jobID and to the websocket, when the user has one open.
+func CreateFiberProject(conn *websocket.Conn, jobID uuid.UUID, request dto.CreateFiberRequest) (*projects.Project, *utils.ServiceError) {
 
 	//return "", &utils.ServiceError{
 	//	StatusCode: http.StatusServiceUnavailable,
 	//	Message:    fmt.Sprintf("Service is unavailable. Please try again later."),
 	//}
 	// Validate and sanitize inputs
-	framework := env["LANGUAGE"] + "-" + env["FRAMEWORK"]
-
-	if projectName == "" || framework == "" {
-		return "", &utils.ServiceError{
+	projectName := request.ProjectName
+	if projectName == "" {
+		return nil, &utils.ServiceError{
 			StatusCode: http.StatusBadRequest,
-			Message:    "project name and framework cannot be empty",
-			Err:        nil,
+			Message:    "project name cannot be empty",
+			Err:        errors.New("project name is empty"),
 		}
 	}
 	if !isValidProjectName(projectName) {
-		return "", &utils.ServiceError{
+		return nil, &utils.ServiceError{
 			StatusCode: http.StatusBadRequest,
 			Message:    "invalid project name (only alphanumeric and hyphens allowed)",
-			Err:        nil,
+			Err:        fmt.Errorf("invalid project name %q", projectName),
+		}
+	}
+
+	if request.CITool != "" && !IsSupportedCITool(request.CITool) {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("unsupported CI tool (supported: %s)", strings.Join(SupportedCITools, ", ")),
+			Err:        fmt.Errorf("unsupported CI tool %q", request.CITool),
+		}
+	}
+
+	if request.HealthCheck != nil {
+		healthCheck, err := deployments.NormalizeHealthCheck(*request.HealthCheck)
+		if err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusBadRequest,
+				Message:    err.Error(),
+				Err:        err,
+			}
 		}
+		request.HealthCheck = &healthCheck
 	}
+
+	// Resolve the template and validate env against its parameters
+	env := request.Env
+	template, serviceErr := templates.ResolveTemplateForEnv(request.TemplateID, env)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	env, serviceErr = templates.ValidateEnv(template.ID, env)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	framework := template.Name
 	finalProjectName := generateProjectName(projectName)
 
-	// 1. Modify Makefile
-	if err := updateFrameworkInMakefile("./Makefile", framework); err != nil {
-		return "", err
+	// 1. Prepare the remote Docker host the project is built on
+	remote, cleanup, serviceErr := deployments.PrepareRemoteBuild(request.UserID, request.DeployTargetID, finalProjectName)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	// 2. Reserve a project slot within the plan quota
+	project, projectConfig, serviceErr := createProjectRecord(request, finalProjectName, template.Name, env)
+	if serviceErr != nil {
+		cleanup()
+		return nil, serviceErr
 	}
 
-	// 2. Run installation with proper terminal handling
-	if err := functions.RunProjectWorkflow(conn, finalProjectName, env); err != nil {
+	// The rest of the job runs in the background; its output is followed through jobID
+	jobStream := jobStreamKey(jobID)
+	store.OpenEventStream(jobStream, request.UserID)
+	sc := &interfaces.SafeConn{Conn: conn, Stream: jobStream}
+	sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("🧾 Job %s (GET /api/v1/projects/jobs/%s/logs/stream)", jobID, jobID)))
+	go func() {
+		defer cleanup()
+		jobStatus := JobFailed
+		defer func() { store.CloseEventStream(jobStream, jobStatus) }()
+
+		zipPath, err := generateFiberProject(sc, project, projectConfig, request, env, framework, *remote)
+		if err != nil {
+			markProjectStatus(project, "failed")
+			log.Printf("⚠️ Project %s failed: %v", project.Name, err)
+			sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("❌ %s: %v", err.Message, err.Err)))
+			return
+		}
+
+		markProjectStatus(project, "active")
+		if err := plans.RecordUsage(request.UserID, project.ID, plans.MetricProject, 1); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+		sc.SafeWrite(websocket.TextMessage, []byte("📦 "+zipPath))
+		jobStatus = JobSucceeded
+	}()
+	return project, nil
+}
+
+// generateFiberProject runs the workflow of a reserved project and returns the path of its zip
+func generateFiberProject(sc *interfaces.SafeConn, project *projects.Project, projectConfig *projects.ProjectConfig, request dto.CreateFiberRequest, env map[string]string, framework string, remote interfaces.RemoteBuildConfig) (string, *utils.ServiceError) {
+	// 3. Run installation with proper terminal handling, generating deployment files before export
+	beforeExport := []interfaces.WorkflowStep{{
+		Name:   "project files",
+		Action: "saving",
+		Run:    workspaceFilesStep(project, request.UserID),
+	}, {
+		Name:   "dependencies",
+		Action: "scanning",
+		Run:    vulnerabilityScanStep(project, request.UserID),
+	}, {
+		Name:   "SBOM",
+		Action: "generating",
+		Run:    sbomStep(project, projectConfig, request.UserID),
+	}}
+	if request.Kubernetes != nil {
+		beforeExport = append(beforeExport, interfaces.WorkflowStep{
+			Name:   "Kubernetes manifests",
+			Action: "generating",
+			Run:    kubernetesManifestsStep(project, projectConfig, request.UserID, *request.Kubernetes),
+		})
+	}
+	if request.Helm != nil {
+		beforeExport = append(beforeExport, interfaces.WorkflowStep{
+			Name:   "Helm chart",
+			Action: "generating",
+			Run:    helmChartStep(project, projectConfig, request.UserID, request.Kubernetes, request.Helm.Environments),
+		})
+	}
+	if request.CITool != "" {
+		pipelineOpts := PipelineOptions{DeployWith: DeployWithDocker}
+		if request.Helm != nil {
+			pipelineOpts.DeployWith = DeployWithHelm
+			if environments := request.Helm.Environments; len(environments) > 0 && !contains(environments, "prod") {
+				pipelineOpts.Environment = environments[len(environments)-1]
+			}
+		} else if request.Kubernetes != nil {
+			pipelineOpts.DeployWith = DeployWithKubernetes
+		}
+		beforeExport = append(beforeExport, interfaces.WorkflowStep{
+			Name:   "CI pipeline",
+			Action: "generating",
+			Run:    ciPipelineStep(project, projectConfig, request.UserID, pipelineOpts),
+		})
+	}
+	if err := functions.RunProjectWorkflow(sc, project.Name, framework, env, remote, beforeExport); err != nil {
 		return "", &utils.ServiceError{
 			StatusCode: http.StatusInternalServerError,
 			Message:    "project creation failed",
 			Err:        err,
 		}
 	}
-	// 3. Return a zip file path
-	zipPath, err := findProjectZip(finalProjectName)
+	// 5. Return a zip file path
+	zipPath, err := findProjectZip(project.Name)
 	if err != nil {
 		return "", &utils.ServiceError{
 			StatusCode: http.StatusInternalServerError,
@@ -65,51 +190,153 @@ func CreateFiberProject(conn *websocket.Conn, projectName string, env map[string
 	return zipPath, nil
 }
 
-// Helper Functions
-func isValidProjectName(name string) bool {
-	return regexp.MustCompile(`^[a-zA-Z0-9-]+$`).MatchString(name)
-}
+// createProjectRecord checks the plan quota and stores the project with its configuration in a single transaction
+func createProjectRecord(request dto.CreateFiberRequest, name, framework string, env map[string]string) (*projects.Project, *projects.ProjectConfig, *utils.ServiceError) {
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to begin transaction",
+			Err:        tx.Error,
+		}
+	}
 
-func generateProjectName(baseName string) string {
-	return fmt.Sprintf("%s-%d", strings.ToLower(baseName), time.Now().Unix())
-}
+	if serviceErr := plans.CheckProjectQuota(tx, request.UserID, request.TeamID); serviceErr != nil {
+		tx.Rollback()
+		return nil, nil, serviceErr
+	}
 
-func updateFrameworkInMakefile(path, framework string) *utils.ServiceError {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return &utils.ServiceError{
+	project := projects.Project{
+		TeamID:     request.TeamID,
+		Name:       name,
+		SourceType: "template",
+		Status:     "creating",
+		CreatedBy:  request.UserID,
+		UpdatedBy:  request.UserID,
+	}
+	if err := tx.Create(&project).Error; err != nil {
+		tx.Rollback()
+		return nil, nil, &utils.ServiceError{
 			StatusCode: http.StatusInternalServerError,
-			Message:    fmt.Sprintf("failed to read Makefile at %s", path),
+			Message:    "failed to create project",
 			Err:        err,
 		}
 	}
 
-	modifiedData, err := replaceFrameworkVariable(string(data), framework)
-	if err != nil {
-		return &utils.ServiceError{
+	projectConfig, serviceErr := createProjectConfig(tx, &project, request, env["LANGUAGE"], framework, env)
+	if serviceErr != nil {
+		tx.Rollback()
+		return nil, nil, serviceErr
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return nil, nil, &utils.ServiceError{
 			StatusCode: http.StatusInternalServerError,
-			Message:    fmt.Sprintf("failed to modify Makefile for framework %s", framework),
+			Message:    "failed to commit transaction",
 			Err:        err,
 		}
 	}
+	return &project, projectConfig, nil
+}
 
-	if err := os.WriteFile(path, []byte(modifiedData), 0644); err != nil {
-		return &utils.ServiceError{
-			StatusCode: http.StatusInternalServerError,
-			Message:    fmt.Sprintf("failed to write Makefile at %s", path),
-			Err:        err,
+// kubernetesManifestsStep generates the Kubernetes manifests of a project into its workspace
+func kubernetesManifestsStep(project *projects.Project, projectConfig *projects.ProjectConfig, userID uuid.UUID, opts dto.KubernetesOptions) func(sc *interfaces.SafeConn) error {
+	return func(sc *interfaces.SafeConn) error {
+		secretKeys, err := GetProjectSecretKeys(project.ID)
+		if err != nil {
+			return err
+		}
+		files, err := GenerateKubernetesManifests(project, projectConfig, secretKeys, opts)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			sc.SafeWrite(websocket.TextMessage, []byte("📄 "+file.Path))
+		}
+		return saveGeneratedFiles(project, userID, files)
+	}
+}
+
+// sbomStep generates the CycloneDX and SPDX documents of a project into its workspace
+func sbomStep(project *projects.Project, projectConfig *projects.ProjectConfig, userID uuid.UUID) func(sc *interfaces.SafeConn) error {
+	return func(sc *interfaces.SafeConn) error {
+		workspace := filepath.Join("public", project.Name)
+		entries, err := os.ReadDir(workspace)
+		if err != nil {
+			return err
+		}
+		sources := map[string]string{}
+		for _, entry := range entries {
+			if entry.IsDir() || !isSBOMSource(entry.Name()) {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(workspace, entry.Name()))
+			if err != nil {
+				return err
+			}
+			sources[entry.Name()] = string(content)
+		}
+		files, err := GenerateSBOMFiles(project, projectConfig, sources)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			sc.SafeWrite(websocket.TextMessage, []byte("📄 "+file.Path))
+		}
+		return saveGeneratedFiles(project, userID, files)
+	}
+}
+
+// ciPipelineStep generates the CI definition selected by ProjectConfig.CITool into the project workspace
+func ciPipelineStep(project *projects.Project, projectConfig *projects.ProjectConfig, userID uuid.UUID, opts PipelineOptions) func(sc *interfaces.SafeConn) error {
+	return func(sc *interfaces.SafeConn) error {
+		files, err := GenerateCIPipeline(project, projectConfig, opts)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			sc.SafeWrite(websocket.TextMessage, []byte("📄 "+file.Path))
 		}
+		return saveGeneratedFiles(project, userID, files)
 	}
+}
 
-	return nil
+// helmChartStep generates a Helm chart for a project into its workspace, using the Kubernetes options when given
+func helmChartStep(project *projects.Project, projectConfig *projects.ProjectConfig, userID uuid.UUID, opts *dto.KubernetesOptions, environments []string) func(sc *interfaces.SafeConn) error {
+	return func(sc *interfaces.SafeConn) error {
+		var chartOpts dto.KubernetesOptions
+		if opts != nil {
+			chartOpts = *opts
+		}
+		secretKeys, err := GetProjectSecretKeys(project.ID)
+		if err != nil {
+			return err
+		}
+		files, err := GenerateHelmChart(project, projectConfig, secretKeys, chartOpts, environments)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			sc.SafeWrite(websocket.TextMessage, []byte("📄 "+file.Path))
+		}
+		return saveGeneratedFiles(project, userID, files)
+	}
 }
 
-func replaceFrameworkVariable(data, framework string) (string, error) {
-	pattern := regexp.MustCompile(`(?m)^FRAMEWORK\s*:=\s*.*$`)
-	if !pattern.MatchString(data) {
-		return "", fmt.Errorf("FRAMEWORK variable not found in Makefile")
+func markProjectStatus(project *projects.Project, status string) {
+	if err := config.DB.Model(project).Update("status", status).Error; err != nil {
+		log.Printf("⚠️ Failed to mark project %s as %s: %v", project.ID, status, err)
 	}
-	return pattern.ReplaceAllString(data, fmt.Sprintf("FRAMEWORK := %s", framework)), nil
+}
+
+// Helper Functions
+func isValidProjectName(name string) bool {
+	return regexp.MustCompile(`^[a-zA-Z0-9-]+$`).MatchString(name)
+}
+
+func generateProjectName(baseName string) string {
+	return fmt.Sprintf("%s-%d", strings.ToLower(baseName), time.Now().Unix())
 }
 
 func findProjectZip(projectName string) (string, error) {
@@ -0,0 +1,279 @@
+package projects
+
+import (
+	"context"
+	"deva/src/config"
+	"deva/src/lib/dto"
+	"deva/src/lib/gomod"
+	deployments "deva/src/modules/deployments/services"
+	projects "deva/src/modules/projects/models"
+	vulnerabilities "deva/src/modules/vulnerabilities/services"
+	"deva/src/utils"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	maxGoModSize        = 512 * 1024
+	maxGoSumSize        = 4 * 1024 * 1024
+	moduleProxyDeadline = 30 * time.Second
+)
+
+// AnalyzeGoModules reports the requirements of a go.mod sent by the user
+func AnalyzeGoModules(request dto.AnalyzeGoModulesRequest) (map[string]interface{}, *utils.ServiceError) {
+	if strings.TrimSpace(request.GoMod) == "" {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "go_mod is required",
+			Err:        errors.New("empty go.mod"),
+		}
+	}
+	if len(request.GoMod) > maxGoModSize || len(request.GoSum) > maxGoSumSize {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Message:    fmt.Sprintf("go.mod is limited to %d KiB and go.sum to %d MiB", maxGoModSize/1024, maxGoSumSize/1024/1024),
+			Err:        fmt.Errorf("go.mod has %d bytes, go.sum %d", len(request.GoMod), len(request.GoSum)),
+		}
+	}
+
+	manifest, serviceErr := parseGoModules([]byte(request.GoMod), []byte(request.GoSum))
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	return goModulesReport(manifest, request.CheckUpgrades, request.IncludeIndirect)
+}
+
+// AnalyzeProjectGoModules reports the requirements of the stored go.mod and go.sum of a project
+func AnalyzeProjectGoModules(userID, projectID uuid.UUID, checkUpgrades, includeIndirect bool) (map[string]interface{}, *utils.ServiceError) {
+	project, manifest, serviceErr := projectGoModules(userID, projectID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	report, serviceErr := goModulesReport(manifest, checkUpgrades, includeIndirect)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	report["project_id"] = project.ID
+	return report, nil
+}
+
+// UpgradeProjectGoModules builds the project go.mod with the available upgrades up to the requested
+// level, and stores it when asked to. go.sum is left alone: go mod tidy has to refresh it.
+func UpgradeProjectGoModules(userID, projectID uuid.UUID, request dto.UpgradeGoModulesRequest) (map[string]interface{}, *utils.ServiceError) {
+	level := strings.ToLower(strings.TrimSpace(request.Level))
+	if level == "" {
+		level = gomod.UpgradeMinor
+	}
+	if level != gomod.UpgradePatch && level != gomod.UpgradeMinor && level != gomod.UpgradeMajor {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "level must be patch, minor or major",
+			Err:        fmt.Errorf("invalid upgrade level %q", request.Level),
+		}
+	}
+
+	project, manifest, serviceErr := projectGoModules(userID, projectID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	proxy, serviceErr := moduleProxy()
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), moduleProxyDeadline)
+	defer cancel()
+	upgrades, failures := proxy.CheckUpgrades(ctx, manifest, request.IncludeIndirect || len(request.Modules) > 0)
+
+	wanted := map[string]bool{}
+	for _, path := range request.Modules {
+		wanted[strings.TrimSpace(path)] = true
+	}
+	applied, skipped := []gomod.Upgrade{}, []gomod.Upgrade{}
+	for _, upgrade := range upgrades {
+		if len(wanted) > 0 && !wanted[upgrade.Path] {
+			continue
+		}
+		if upgradeRank(upgrade.Kind) > upgradeRank(level) {
+			skipped = append(skipped, upgrade)
+			continue
+		}
+		applied = append(applied, upgrade)
+	}
+
+	content, err := manifest.WithUpgrades(applied)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to update go.mod",
+			Err:        err,
+		}
+	}
+
+	saved := false
+	if request.Save && len(applied) > 0 {
+		if err := saveEditedFile(project, userID, "go.mod", string(content)); err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "failed to store go.mod",
+				Err:        err,
+			}
+		}
+		saved = true
+		if _, err := vulnerabilities.ScanProject(project.ID, userID, vulnerabilities.TriggerUpdate); err != nil {
+			log.Printf("⚠️ Failed to scan project %s after the go.mod upgrade: %v", project.ID, err)
+		}
+	}
+
+	return map[string]interface{}{
+		"project_id": project.ID,
+		"level":      level,
+		"applied":    applied,
+		"skipped":    skipped,
+		"errors":     failures,
+		"go_mod":     string(content),
+		"saved":      saved,
+		"proxy":      proxy.String(),
+		"next_step":  "run go mod tidy to refresh go.sum",
+	}, nil
+}
+
+// Helper Functions
+func projectGoModules(userID, projectID uuid.UUID) (*projects.Project, *gomod.Manifest, *utils.ServiceError) {
+	project, serviceErr := deployments.GetAccessibleProject(userID, projectID)
+	if serviceErr != nil {
+		return nil, nil, serviceErr
+	}
+
+	var stored []projects.ProjectFile
+	if err := config.DB.Where("project_id = ? AND path IN ?", project.ID, []string{"go.mod", "go.sum"}).
+		Order("updated_at DESC").Find(&stored).Error; err != nil {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	// The latest version of each file wins, whether generated or edited
+	files := map[string][]byte{}
+	for _, file := range stored {
+		if _, seen := files[file.Path]; !seen {
+			files[file.Path] = []byte(file.Content)
+		}
+	}
+	if _, ok := files["go.mod"]; !ok {
+		return nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "project has no go.mod",
+			Err:        errors.New("no stored go.mod"),
+		}
+	}
+
+	manifest, serviceErr := parseGoModules(files["go.mod"], files["go.sum"])
+	if serviceErr != nil {
+		return nil, nil, serviceErr
+	}
+	return project, manifest, nil
+}
+
+func parseGoModules(goMod, goSum []byte) (*gomod.Manifest, *utils.ServiceError) {
+	manifest, err := gomod.Parse(goMod, goSum)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusUnprocessableEntity,
+			Message:    "invalid go.mod",
+			Err:        err,
+		}
+	}
+	return manifest, nil
+}
+
+// moduleProxy is configured by GOPROXY only, so requests cannot point the server at arbitrary URLs
+func moduleProxy() (*gomod.Proxy, *utils.ServiceError) {
+	proxy, err := gomod.ProxyFromEnv()
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "module proxy is not configured correctly",
+			Err:        err,
+		}
+	}
+	return proxy, nil
+}
+
+func goModulesReport(manifest *gomod.Manifest, checkUpgrades, includeIndirect bool) (map[string]interface{}, *utils.ServiceError) {
+	report := map[string]interface{}{
+		"module":    manifest.Module,
+		"go":        manifest.GoVersion,
+		"toolchain": manifest.Toolchain,
+		"require": map[string]interface{}{
+			"direct":   manifest.Direct(),
+			"indirect": manifest.Indirect(),
+		},
+		"replace": nonNil(manifest.Replaces),
+		"exclude": nonNil(manifest.Excludes),
+		"retract": nonNil(manifest.Retracts),
+		"go_sum": map[string]interface{}{
+			"present": manifest.HasGoSum,
+			"entries": manifest.SumEntries,
+			"missing": manifest.MissingSums(),
+		},
+	}
+	if !checkUpgrades {
+		return report, nil
+	}
+
+	proxy, serviceErr := moduleProxy()
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), moduleProxyDeadline)
+	defer cancel()
+	upgrades, failures := proxy.CheckUpgrades(ctx, manifest, includeIndirect)
+	report["upgrades"] = upgrades
+	report["errors"] = failures
+	report["proxy"] = proxy.String()
+	return report, nil
+}
+
+// saveEditedFile stores a file edited on behalf of the user. Earlier edits of the path are replaced;
+// generated versions are kept but this one is newer, so it wins.
+func saveEditedFile(project *projects.Project, userID uuid.UUID, path, content string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ? AND path = ? AND is_generated = ?", project.ID, path, false).
+			Delete(&projects.ProjectFile{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&projects.ProjectFile{
+			ProjectID:   project.ID,
+			Path:        path,
+			Content:     content,
+			IsGenerated: false,
+			UpdatedBy:   userID,
+		}).Error
+	})
+}
+
+func upgradeRank(kind string) int {
+	switch kind {
+	case gomod.UpgradeMajor:
+		return 3
+	case gomod.UpgradeMinor:
+		return 2
+	}
+	return 1
+}
+
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
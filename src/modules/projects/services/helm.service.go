@@ -0,0 +1,449 @@
+package projects
+
+import (
+	"bytes"
+	"deva/src/lib/dto"
+	projects "deva/src/modules/projects/models"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const HelmChartDir = "helm"
+
+// DefaultHelmEnvironments get a values-<env>.yaml when no environments are requested
+var DefaultHelmEnvironments = []string{"dev", "staging", "prod"}
+
+var helmEnvironmentName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+type helmValues struct {
+	ReplicaCount int32 `yaml:"replicaCount"`
+	Image        struct {
+		Repository string `yaml:"repository"`
+		Tag        string `yaml:"tag"`
+		PullPolicy string `yaml:"pullPolicy"`
+	} `yaml:"image"`
+	Service struct {
+		Type string `yaml:"type"`
+		Port int    `yaml:"port"`
+	} `yaml:"service"`
+	Ingress struct {
+		Enabled   bool   `yaml:"enabled"`
+		ClassName string `yaml:"className"`
+		Host      string `yaml:"host"`
+		TLSSecret string `yaml:"tlsSecret"`
+	} `yaml:"ingress"`
+	Resources map[string]map[string]string `yaml:"resources"`
+	Probes    struct {
+		Enabled             bool   `yaml:"enabled"`
+		Path                string `yaml:"path"`
+		InitialDelaySeconds int32  `yaml:"initialDelaySeconds"`
+		PeriodSeconds       int32  `yaml:"periodSeconds"`
+	} `yaml:"probes"`
+	Autoscaling struct {
+		Enabled                        bool  `yaml:"enabled"`
+		MinReplicas                    int32 `yaml:"minReplicas"`
+		MaxReplicas                    int32 `yaml:"maxReplicas"`
+		TargetCPUUtilizationPercentage int32 `yaml:"targetCPUUtilizationPercentage"`
+	} `yaml:"autoscaling"`
+	Config     map[string]string `yaml:"config"`
+	SecretName string            `yaml:"secretName"`
+	SecretKeys []string          `yaml:"secretKeys"`
+}
+
+type helmEnvironmentValues struct {
+	ReplicaCount int32             `yaml:"replicaCount"`
+	Config       map[string]string `yaml:"config"`
+}
+
+// GenerateHelmChart emits a chart for the project: Chart.yaml, values.yaml derived from the
+// project configuration, templated Deployment, Service, Ingress, ConfigMap and HPA, and a
+// values-<env>.yaml per environment. The templates are rendered against the default values
+// before being returned so a broken chart is never exported.
+func GenerateHelmChart(project *projects.Project, cfg *projects.ProjectConfig, secretKeys []string, opts dto.KubernetesOptions, environments []string) ([]GeneratedFile, error) {
+	app, err := resolveKubernetesApp(project, cfg, secretKeys, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(environments) == 0 {
+		environments = DefaultHelmEnvironments
+	}
+	for _, env := range environments {
+		if !helmEnvironmentName.MatchString(env) {
+			return nil, fmt.Errorf("invalid environment name %q", env)
+		}
+	}
+
+	values := app.helmValues()
+	appVersion := values.Image.Tag
+	chartDir := HelmChartDir + "/" + app.Name
+
+	chart := map[string]interface{}{
+		"apiVersion":  "v2",
+		"name":        app.Name,
+		"description": fmt.Sprintf("Helm chart for %s generated by Deva", project.Name),
+		"type":        "application",
+		"version":     "0.1.0",
+		"appVersion":  appVersion,
+	}
+	chartYAML, err := marshalYAML(chart)
+	if err != nil {
+		return nil, err
+	}
+	valuesYAML, err := marshalYAML(values)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []GeneratedFile{
+		{Path: chartDir + "/Chart.yaml", Content: chartYAML},
+		{Path: chartDir + "/values.yaml", Content: valuesYAML},
+	}
+	for _, env := range environments {
+		envValues := helmEnvironmentValues{
+			ReplicaCount: values.ReplicaCount,
+			Config:       map[string]string{"ENV": env},
+		}
+		if env == "prod" && envValues.ReplicaCount < 2 {
+			envValues.ReplicaCount = 2
+		}
+		content, err := marshalYAML(envValues)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, GeneratedFile{Path: fmt.Sprintf("%s/values-%s.yaml", chartDir, env), Content: content})
+	}
+
+	var templates []GeneratedFile
+	for _, name := range []string{"_helpers.tpl", "deployment.yaml", "service.yaml", "ingress.yaml", "configmap.yaml", "hpa.yaml"} {
+		content := strings.ReplaceAll(helmTemplates[name], "__CHART__", app.Name)
+		templates = append(templates, GeneratedFile{Path: chartDir + "/templates/" + name, Content: content})
+	}
+
+	if err := validateHelmTemplates(templates, valuesYAML, chart); err != nil {
+		return nil, err
+	}
+	return append(files, templates...), nil
+}
+
+func (a *kubernetesApp) helmValues() helmValues {
+	var v helmValues
+	v.ReplicaCount = a.Options.Replicas
+	v.Image.Repository, v.Image.Tag = splitImage(a.Image)
+	v.Image.PullPolicy = "IfNotPresent"
+	v.Service.Type = "ClusterIP"
+	v.Service.Port = a.Port
+
+	if i := a.Options.Ingress; i != nil {
+		v.Ingress.Enabled = true
+		v.Ingress.ClassName = i.ClassName
+		v.Ingress.Host = i.Host
+		v.Ingress.TLSSecret = i.TLSSecret
+	}
+
+	res := a.Options.Resources
+	v.Resources = map[string]map[string]string{}
+	if requests := nonEmpty(map[string]string{"cpu": res.CPURequest, "memory": res.MemoryRequest}); requests != nil {
+		v.Resources["requests"] = requests
+	}
+	if limits := nonEmpty(map[string]string{"cpu": res.CPULimit, "memory": res.MemoryLimit}); limits != nil {
+		v.Resources["limits"] = limits
+	}
+
+	v.Probes.Enabled = !a.Options.Probes.Disabled
+	v.Probes.Path = a.Options.Probes.Path
+	v.Probes.InitialDelaySeconds = a.Options.Probes.InitialDelaySeconds
+	v.Probes.PeriodSeconds = a.Options.Probes.PeriodSeconds
+
+	v.Autoscaling.MinReplicas = a.Options.Replicas
+	v.Autoscaling.MaxReplicas = a.Options.Replicas
+	v.Autoscaling.TargetCPUUtilizationPercentage = 80
+	if as := a.Options.Autoscaling; as != nil {
+		v.Autoscaling.Enabled = true
+		v.Autoscaling.MinReplicas = as.MinReplicas
+		v.Autoscaling.MaxReplicas = as.MaxReplicas
+		v.Autoscaling.TargetCPUUtilizationPercentage = as.TargetCPUUtilization
+	}
+
+	v.Config = a.Config
+	v.SecretName = a.Name + "-secrets"
+	v.SecretKeys = a.SecretKeys
+	if v.SecretKeys == nil {
+		v.SecretKeys = []string{}
+	}
+	return v
+}
+
+// validateHelmTemplates renders the chart templates with the default values using the subset of
+// Helm's template functions the generated templates rely on, and checks that every rendered
+// document is valid YAML describing a Kubernetes object.
+func validateHelmTemplates(templates []GeneratedFile, valuesYAML string, chart map[string]interface{}) error {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(valuesYAML), &values); err != nil {
+		return fmt.Errorf("invalid values.yaml: %w", err)
+	}
+
+	root := template.New("chart").Option("missingkey=zero")
+	root.Funcs(template.FuncMap{
+		"include": func(name string, data interface{}) (string, error) {
+			var buf bytes.Buffer
+			err := root.ExecuteTemplate(&buf, name, data)
+			return buf.String(), err
+		},
+		"toYaml": func(v interface{}) (string, error) {
+			out, err := marshalYAML(v)
+			return strings.TrimSuffix(out, "\n"), err
+		},
+		"nindent": func(n int, s string) string {
+			pad := strings.Repeat(" ", n)
+			return "\n" + pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+		},
+		"quote": func(v interface{}) string {
+			return fmt.Sprintf("%q", fmt.Sprint(v))
+		},
+		"default": func(def, v interface{}) interface{} {
+			if v == nil || v == "" {
+				return def
+			}
+			return v
+		},
+		"trunc": func(n int, s string) string {
+			if len(s) > n {
+				return s[:n]
+			}
+			return s
+		},
+		"trimSuffix": func(suffix, s string) string {
+			return strings.TrimSuffix(s, suffix)
+		},
+		"contains": func(substr, s string) bool {
+			return strings.Contains(s, substr)
+		},
+	})
+
+	for _, file := range templates {
+		if _, err := root.New(file.Path).Parse(file.Content); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", file.Path, err)
+		}
+	}
+
+	ctx := map[string]interface{}{
+		"Values":  values,
+		"Release": map[string]interface{}{"Name": chart["name"], "Namespace": "default", "Service": "Helm"},
+		"Chart": map[string]interface{}{
+			"Name":       chart["name"],
+			"Version":    chart["version"],
+			"AppVersion": chart["appVersion"],
+		},
+	}
+
+	for _, file := range templates {
+		if strings.HasSuffix(file.Path, ".tpl") {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := root.ExecuteTemplate(&buf, file.Path, ctx); err != nil {
+			return fmt.Errorf("failed to render %s: %w", file.Path, err)
+		}
+
+		decoder := yaml.NewDecoder(&buf)
+		for {
+			var doc map[string]interface{}
+			err := decoder.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("%s does not render to valid YAML: %w", file.Path, err)
+			}
+			if doc == nil {
+				continue
+			}
+			if doc["apiVersion"] == nil || doc["kind"] == nil {
+				return fmt.Errorf("%s renders a document without apiVersion or kind", file.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// splitImage splits "registry/repo:tag" into repository and tag
+func splitImage(image string) (string, string) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
+
+var helmTemplates = map[string]string{
+	"_helpers.tpl": `{{- define "__CHART__.fullname" -}}
+{{- if contains .Chart.Name .Release.Name -}}
+{{- .Release.Name | trunc 63 | trimSuffix "-" -}}
+{{- else -}}
+{{- printf "%s-%s" .Release.Name .Chart.Name | trunc 63 | trimSuffix "-" -}}
+{{- end -}}
+{{- end -}}
+
+{{- define "__CHART__.selectorLabels" -}}
+app.kubernetes.io/name: {{ .Chart.Name }}
+app.kubernetes.io/instance: {{ .Release.Name }}
+{{- end -}}
+
+{{- define "__CHART__.labels" -}}
+helm.sh/chart: {{ printf "%s-%s" .Chart.Name .Chart.Version | trunc 63 | trimSuffix "-" }}
+{{ include "__CHART__.selectorLabels" . }}
+app.kubernetes.io/version: {{ .Chart.AppVersion | quote }}
+app.kubernetes.io/managed-by: {{ .Release.Service }}
+{{- end -}}
+`,
+	"deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ include "__CHART__.fullname" . }}
+  labels:
+    {{- include "__CHART__.labels" . | nindent 4 }}
+spec:
+  {{- if not .Values.autoscaling.enabled }}
+  replicas: {{ .Values.replicaCount }}
+  {{- end }}
+  selector:
+    matchLabels:
+      {{- include "__CHART__.selectorLabels" . | nindent 6 }}
+  template:
+    metadata:
+      labels:
+        {{- include "__CHART__.selectorLabels" . | nindent 8 }}
+    spec:
+      containers:
+        - name: {{ .Chart.Name }}
+          image: "{{ .Values.image.repository }}:{{ .Values.image.tag | default .Chart.AppVersion }}"
+          imagePullPolicy: {{ .Values.image.pullPolicy }}
+          ports:
+            - name: http
+              containerPort: {{ .Values.service.port }}
+              protocol: TCP
+          envFrom:
+            - configMapRef:
+                name: {{ include "__CHART__.fullname" . }}-config
+          {{- if .Values.secretKeys }}
+          env:
+            {{- range .Values.secretKeys }}
+            - name: {{ . }}
+              valueFrom:
+                secretKeyRef:
+                  name: {{ $.Values.secretName }}
+                  key: {{ . }}
+            {{- end }}
+          {{- end }}
+          {{- if .Values.probes.enabled }}
+          readinessProbe:
+            httpGet:
+              path: {{ .Values.probes.path }}
+              port: http
+            {{- if .Values.probes.initialDelaySeconds }}
+            initialDelaySeconds: {{ .Values.probes.initialDelaySeconds }}
+            {{- end }}
+            {{- if .Values.probes.periodSeconds }}
+            periodSeconds: {{ .Values.probes.periodSeconds }}
+            {{- end }}
+          livenessProbe:
+            httpGet:
+              path: {{ .Values.probes.path }}
+              port: http
+            {{- if .Values.probes.initialDelaySeconds }}
+            initialDelaySeconds: {{ .Values.probes.initialDelaySeconds }}
+            {{- end }}
+            {{- if .Values.probes.periodSeconds }}
+            periodSeconds: {{ .Values.probes.periodSeconds }}
+            {{- end }}
+          {{- end }}
+          resources:
+            {{- toYaml .Values.resources | nindent 12 }}
+`,
+	"service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ include "__CHART__.fullname" . }}
+  labels:
+    {{- include "__CHART__.labels" . | nindent 4 }}
+spec:
+  type: {{ .Values.service.type }}
+  ports:
+    - name: http
+      port: {{ .Values.service.port }}
+      targetPort: http
+      protocol: TCP
+  selector:
+    {{- include "__CHART__.selectorLabels" . | nindent 4 }}
+`,
+	"ingress.yaml": `{{- if .Values.ingress.enabled -}}
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: {{ include "__CHART__.fullname" . }}
+  labels:
+    {{- include "__CHART__.labels" . | nindent 4 }}
+spec:
+  {{- if .Values.ingress.className }}
+  ingressClassName: {{ .Values.ingress.className }}
+  {{- end }}
+  {{- if .Values.ingress.tlsSecret }}
+  tls:
+    - hosts:
+        - {{ .Values.ingress.host | quote }}
+      secretName: {{ .Values.ingress.tlsSecret }}
+  {{- end }}
+  rules:
+    - host: {{ .Values.ingress.host | quote }}
+      http:
+        paths:
+          - path: /
+            pathType: Prefix
+            backend:
+              service:
+                name: {{ include "__CHART__.fullname" . }}
+                port:
+                  name: http
+{{- end }}
+`,
+	"configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "__CHART__.fullname" . }}-config
+  labels:
+    {{- include "__CHART__.labels" . | nindent 4 }}
+data:
+  {{- range $key, $value := .Values.config }}
+  {{ $key }}: {{ $value | quote }}
+  {{- end }}
+`,
+	"hpa.yaml": `{{- if .Values.autoscaling.enabled -}}
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: {{ include "__CHART__.fullname" . }}
+  labels:
+    {{- include "__CHART__.labels" . | nindent 4 }}
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: {{ include "__CHART__.fullname" . }}
+  minReplicas: {{ .Values.autoscaling.minReplicas }}
+  maxReplicas: {{ .Values.autoscaling.maxReplicas }}
+  metrics:
+    - type: Resource
+      resource:
+        name: cpu
+        target:
+          type: Utilization
+          averageUtilization: {{ .Values.autoscaling.targetCPUUtilizationPercentage }}
+{{- end }}
+`,
+}
@@ -0,0 +1,142 @@
+package projects
+
+import (
+	"deva/src/lib/dto"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestGenerateHelmChart(t *testing.T) {
+	env := `{"APP_PORT":"8080","APP_VERSION":"1.2.0","DB_PASSWORD":"hunter2"}`
+
+	tests := []struct {
+		name         string
+		opts         dto.KubernetesOptions
+		environments []string
+		wantValues   []string
+	}{
+		{
+			name:       "default environments",
+			wantValues: []string{"values-dev.yaml", "values-staging.yaml", "values-prod.yaml"},
+		},
+		{
+			name: "ingress and autoscaling",
+			opts: dto.KubernetesOptions{
+				Image:       "registry.example.com:5000/shop:2.0",
+				Ingress:     &dto.KubernetesIngress{Host: "shop.example.com", ClassName: "nginx"},
+				Autoscaling: &dto.KubernetesAutoscaling{MinReplicas: 2, MaxReplicas: 4},
+			},
+			environments: []string{"qa"},
+			wantValues:   []string{"values-qa.yaml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project, cfg := testProject(env)
+			files, err := GenerateHelmChart(project, cfg, []string{"DB_PASSWORD"}, tt.opts, tt.environments)
+			if err != nil {
+				t.Fatalf("GenerateHelmChart() error = %v", err)
+			}
+
+			paths := map[string]string{}
+			for _, file := range files {
+				if !strings.HasPrefix(file.Path, "helm/my-shop/") {
+					t.Errorf("%s is outside the chart directory", file.Path)
+				}
+				if strings.Contains(file.Content, "hunter2") {
+					t.Errorf("%s contains the value of a secret", file.Path)
+				}
+				paths[strings.TrimPrefix(file.Path, "helm/my-shop/")] = file.Content
+			}
+			for _, name := range append([]string{"Chart.yaml", "values.yaml", "templates/_helpers.tpl", "templates/deployment.yaml", "templates/hpa.yaml"}, tt.wantValues...) {
+				if _, ok := paths[name]; !ok {
+					t.Errorf("chart has no %s", name)
+				}
+			}
+			for name, content := range paths {
+				if strings.HasPrefix(name, "templates/") {
+					continue
+				}
+				var doc map[string]interface{}
+				if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+					t.Errorf("%s does not parse: %v", name, err)
+				}
+			}
+
+			var values helmValues
+			if err := yaml.Unmarshal([]byte(paths["values.yaml"]), &values); err != nil {
+				t.Fatal(err)
+			}
+			if values.Service.Port != 8080 || values.SecretName != "my-shop-secrets" {
+				t.Errorf("values = %+v", values)
+			}
+			if tt.opts.Image != "" && (values.Image.Repository != "registry.example.com:5000/shop" || values.Image.Tag != "2.0") {
+				t.Errorf("image = %+v", values.Image)
+			}
+			if values.Ingress.Enabled != (tt.opts.Ingress != nil) || values.Autoscaling.Enabled != (tt.opts.Autoscaling != nil) {
+				t.Errorf("ingress = %+v, autoscaling = %+v", values.Ingress, values.Autoscaling)
+			}
+		})
+	}
+}
+
+func TestGenerateHelmChartRejects(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          string
+		environments []string
+		wantErr      string
+	}{
+		{"missing port", `{}`, nil, "invalid APP_PORT"},
+		{"environment with a path", `{"APP_PORT":"8080"}`, []string{"../prod"}, "invalid environment name"},
+		{"uppercase environment", `{"APP_PORT":"8080"}`, []string{"Prod"}, "invalid environment name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project, cfg := testProject(tt.env)
+			_, err := GenerateHelmChart(project, cfg, nil, dto.KubernetesOptions{}, tt.environments)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("GenerateHelmChart() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateHelmTemplatesRejectsBrokenTemplates(t *testing.T) {
+	chart := map[string]interface{}{"name": "shop", "version": "0.1.0", "appVersion": "1.0"}
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unparsable", `{{ .Values.name `},
+		{"invalid YAML", "apiVersion: v1\nkind: [Service\n"},
+		{"no kind", "apiVersion: v1\nmetadata:\n  name: shop\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates := []GeneratedFile{{Path: "templates/broken.yaml", Content: tt.content}}
+			if err := validateHelmTemplates(templates, "name: shop\n", chart); err == nil {
+				t.Error("validateHelmTemplates() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image, repository, tag string
+	}{
+		{"shop:1.0", "shop", "1.0"},
+		{"shop", "shop", "latest"},
+		{"registry.example.com:5000/shop", "registry.example.com:5000/shop", "latest"},
+		{"registry.example.com:5000/shop:2.0", "registry.example.com:5000/shop", "2.0"},
+	}
+	for _, tt := range tests {
+		repository, tag := splitImage(tt.image)
+		if repository != tt.repository || tag != tt.tag {
+			t.Errorf("splitImage(%q) = %q, %q, want %q, %q", tt.image, repository, tag, tt.repository, tt.tag)
+		}
+	}
+}
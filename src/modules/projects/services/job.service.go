@@ -0,0 +1,44 @@
+package projects
+
+import (
+	"deva/src/utils"
+	"deva/store"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// Job statuses, sent as the terminal event of a job stream
+const (
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// StreamJobEvents returns the workflow output of a project creation job after lastEventID and a
+// channel of the output that follows. Job output is kept in memory for a while after the job ends.
+func StreamJobEvents(userID, jobID uuid.UUID, lastEventID int64) ([]store.Event, <-chan store.Event, func(), *utils.ServiceError) {
+	key := jobStreamKey(jobID)
+	if owner, ok := store.EventStreamOwner(key); !ok || owner != userID {
+		// Do not reveal jobs of other users
+		return nil, nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "job not found",
+			Err:        fmt.Errorf("no job %s for user %s", jobID, userID),
+		}
+	}
+
+	backlog, live, cancel, ok := store.SubscribeEvents(key, lastEventID)
+	if !ok {
+		return nil, nil, nil, &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "job not found",
+			Err:        fmt.Errorf("job %s expired", jobID),
+		}
+	}
+	return backlog, live, cancel, nil
+}
+
+// Helper Functions
+func jobStreamKey(jobID uuid.UUID) string {
+	return "job:" + jobID.String()
+}
@@ -0,0 +1,393 @@
+package projects
+
+import (
+	"bytes"
+	"deva/src/lib/dto"
+	projects "deva/src/modules/projects/models"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const KubernetesManifestDir = "k8s"
+
+// GeneratedFile is a file produced by a generator, relative to the project root
+type GeneratedFile struct {
+	Path    string
+	Content string
+}
+
+// Kubernetes manifest shapes, limited to the fields Deva generates
+type k8sMetadata struct {
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+}
+
+type k8sObject struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMetadata       `yaml:"metadata"`
+	Data       map[string]string `yaml:"data,omitempty"`
+	Spec       interface{}       `yaml:"spec,omitempty"`
+}
+
+type k8sEnvVar struct {
+	Name      string        `yaml:"name"`
+	ValueFrom *k8sEnvSource `yaml:"valueFrom,omitempty"`
+}
+
+type k8sEnvSource struct {
+	SecretKeyRef *k8sKeyRef `yaml:"secretKeyRef,omitempty"`
+}
+
+type k8sKeyRef struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+type k8sProbe struct {
+	HTTPGet struct {
+		Path string `yaml:"path"`
+		Port int    `yaml:"port"`
+	} `yaml:"httpGet"`
+	InitialDelaySeconds int32 `yaml:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int32 `yaml:"periodSeconds,omitempty"`
+}
+
+type k8sContainer struct {
+	Name            string      `yaml:"name"`
+	Image           string      `yaml:"image"`
+	ImagePullPolicy string      `yaml:"imagePullPolicy"`
+	Ports           []k8sPort   `yaml:"ports"`
+	EnvFrom         []k8sEnvRef `yaml:"envFrom,omitempty"`
+	Env             []k8sEnvVar `yaml:"env,omitempty"`
+	Resources       struct {
+		Requests map[string]string `yaml:"requests,omitempty"`
+		Limits   map[string]string `yaml:"limits,omitempty"`
+	} `yaml:"resources"`
+	ReadinessProbe *k8sProbe `yaml:"readinessProbe,omitempty"`
+	LivenessProbe  *k8sProbe `yaml:"livenessProbe,omitempty"`
+}
+
+type k8sPort struct {
+	Name          string `yaml:"name,omitempty"`
+	ContainerPort int    `yaml:"containerPort,omitempty"`
+	Port          int    `yaml:"port,omitempty"`
+	TargetPort    string `yaml:"targetPort,omitempty"`
+	Protocol      string `yaml:"protocol,omitempty"`
+}
+
+type k8sEnvRef struct {
+	ConfigMapRef struct {
+		Name string `yaml:"name"`
+	} `yaml:"configMapRef"`
+}
+
+// kubernetesApp is the resolved input of the manifest generator
+type kubernetesApp struct {
+	Name       string
+	Namespace  string
+	Image      string
+	Port       int
+	Config     map[string]string
+	SecretKeys []string
+	Options    dto.KubernetesOptions
+}
+
+var dnsLabelInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// GenerateKubernetesManifests turns a project configuration into Deployment, Service, ConfigMap,
+// Ingress and HorizontalPodAutoscaler manifests. Values of secretKeys are never written: the
+// Deployment references them from the "<name>-secrets" Secret, which must exist in the cluster.
+func GenerateKubernetesManifests(project *projects.Project, cfg *projects.ProjectConfig, secretKeys []string, opts dto.KubernetesOptions) ([]GeneratedFile, error) {
+	app, err := resolveKubernetesApp(project, cfg, secretKeys, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []struct {
+		file string
+		obj  *k8sObject
+	}{
+		{"configmap.yaml", app.configMap()},
+		{"deployment.yaml", app.deployment()},
+		{"service.yaml", app.service()},
+		{"ingress.yaml", app.ingress()},
+		{"hpa.yaml", app.autoscaler()},
+	}
+
+	var files []GeneratedFile
+	for _, o := range objects {
+		if o.obj == nil {
+			continue
+		}
+		content, err := marshalYAML(o.obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", o.file, err)
+		}
+		files = append(files, GeneratedFile{Path: KubernetesManifestDir + "/" + o.file, Content: content})
+	}
+	return files, nil
+}
+
+func resolveKubernetesApp(project *projects.Project, cfg *projects.ProjectConfig, secretKeys []string, opts dto.KubernetesOptions) (*kubernetesApp, error) {
+	env := map[string]string{}
+	if cfg.EnvVars != "" {
+		if err := json.Unmarshal([]byte(cfg.EnvVars), &env); err != nil {
+			return nil, fmt.Errorf("invalid project env vars: %w", err)
+		}
+	}
+
+	port, err := strconv.Atoi(env["APP_PORT"])
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid APP_PORT %q", env["APP_PORT"])
+	}
+
+	app := &kubernetesApp{
+		Name:       dnsLabel(project.Name),
+		Namespace:  opts.Namespace,
+		Image:      opts.Image,
+		Port:       port,
+		Config:     map[string]string{},
+		SecretKeys: append([]string(nil), secretKeys...),
+		Options:    opts,
+	}
+	if app.Image == "" {
+		app.Image = fmt.Sprintf("%s-%s:%s", project.Name, cfg.Framework, env["APP_VERSION"])
+	}
+	if app.Options.Replicas <= 0 {
+		app.Options.Replicas = 1
+	}
+	if app.Options.Probes.Path == "" {
+		app.Options.Probes.Path = "/"
+	}
+
+	secrets := map[string]bool{}
+	for _, key := range secretKeys {
+		secrets[key] = true
+	}
+	for k, v := range env {
+		if !secrets[k] {
+			app.Config[k] = v
+		}
+	}
+	sort.Strings(app.SecretKeys)
+
+	if opts.Autoscaling != nil {
+		a := *opts.Autoscaling
+		app.Options.Autoscaling = &a
+		if a.MinReplicas <= 0 {
+			a.MinReplicas = app.Options.Replicas
+		}
+		if a.MaxReplicas < a.MinReplicas {
+			return nil, fmt.Errorf("autoscaling max_replicas (%d) must be at least min_replicas (%d)", a.MaxReplicas, a.MinReplicas)
+		}
+		if a.TargetCPUUtilization <= 0 {
+			a.TargetCPUUtilization = 80
+		}
+	}
+	if i := app.Options.Ingress; i != nil && i.Host == "" {
+		return nil, fmt.Errorf("ingress host is required")
+	}
+
+	return app, nil
+}
+
+func (a *kubernetesApp) metadata(name string) k8sMetadata {
+	return k8sMetadata{
+		Name:      name,
+		Namespace: a.Namespace,
+		Labels: map[string]string{
+			"app.kubernetes.io/name":       a.Name,
+			"app.kubernetes.io/managed-by": "deva",
+		},
+	}
+}
+
+func (a *kubernetesApp) selector() map[string]string {
+	return map[string]string{"app.kubernetes.io/name": a.Name}
+}
+
+func (a *kubernetesApp) configMap() *k8sObject {
+	return &k8sObject{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata:   a.metadata(a.Name + "-config"),
+		Data:       a.Config,
+	}
+}
+
+func (a *kubernetesApp) deployment() *k8sObject {
+	container := k8sContainer{
+		Name:            a.Name,
+		Image:           a.Image,
+		ImagePullPolicy: "IfNotPresent",
+		Ports:           []k8sPort{{Name: "http", ContainerPort: a.Port, Protocol: "TCP"}},
+	}
+
+	envRef := k8sEnvRef{}
+	envRef.ConfigMapRef.Name = a.Name + "-config"
+	container.EnvFrom = []k8sEnvRef{envRef}
+	for _, key := range a.SecretKeys {
+		container.Env = append(container.Env, k8sEnvVar{
+			Name:      key,
+			ValueFrom: &k8sEnvSource{SecretKeyRef: &k8sKeyRef{Name: a.Name + "-secrets", Key: key}},
+		})
+	}
+
+	res := a.Options.Resources
+	container.Resources.Requests = nonEmpty(map[string]string{"cpu": res.CPURequest, "memory": res.MemoryRequest})
+	container.Resources.Limits = nonEmpty(map[string]string{"cpu": res.CPULimit, "memory": res.MemoryLimit})
+
+	if !a.Options.Probes.Disabled {
+		probe := &k8sProbe{
+			InitialDelaySeconds: a.Options.Probes.InitialDelaySeconds,
+			PeriodSeconds:       a.Options.Probes.PeriodSeconds,
+		}
+		probe.HTTPGet.Path = a.Options.Probes.Path
+		probe.HTTPGet.Port = a.Port
+		container.ReadinessProbe = probe
+		container.LivenessProbe = probe
+	}
+
+	return &k8sObject{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata:   a.metadata(a.Name),
+		Spec: map[string]interface{}{
+			"replicas": a.Options.Replicas,
+			"selector": map[string]interface{}{"matchLabels": a.selector()},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": a.metadata(a.Name).Labels},
+				"spec":     map[string]interface{}{"containers": []k8sContainer{container}},
+			},
+		},
+	}
+}
+
+func (a *kubernetesApp) service() *k8sObject {
+	return &k8sObject{
+		APIVersion: "v1",
+		Kind:       "Service",
+		Metadata:   a.metadata(a.Name),
+		Spec: map[string]interface{}{
+			"type":     "ClusterIP",
+			"selector": a.selector(),
+			"ports":    []k8sPort{{Name: "http", Port: a.Port, TargetPort: "http", Protocol: "TCP"}},
+		},
+	}
+}
+
+func (a *kubernetesApp) ingress() *k8sObject {
+	i := a.Options.Ingress
+	if i == nil {
+		return nil
+	}
+
+	spec := map[string]interface{}{
+		"rules": []interface{}{map[string]interface{}{
+			"host": i.Host,
+			"http": map[string]interface{}{
+				"paths": []interface{}{map[string]interface{}{
+					"path":     "/",
+					"pathType": "Prefix",
+					"backend": map[string]interface{}{
+						"service": map[string]interface{}{
+							"name": a.Name,
+							"port": map[string]interface{}{"name": "http"},
+						},
+					},
+				}},
+			},
+		}},
+	}
+	if i.ClassName != "" {
+		spec["ingressClassName"] = i.ClassName
+	}
+	if i.TLSSecret != "" {
+		spec["tls"] = []interface{}{map[string]interface{}{
+			"hosts":      []string{i.Host},
+			"secretName": i.TLSSecret,
+		}}
+	}
+
+	return &k8sObject{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "Ingress",
+		Metadata:   a.metadata(a.Name),
+		Spec:       spec,
+	}
+}
+
+func (a *kubernetesApp) autoscaler() *k8sObject {
+	as := a.Options.Autoscaling
+	if as == nil {
+		return nil
+	}
+
+	return &k8sObject{
+		APIVersion: "autoscaling/v2",
+		Kind:       "HorizontalPodAutoscaler",
+		Metadata:   a.metadata(a.Name),
+		Spec: map[string]interface{}{
+			"scaleTargetRef": map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"name":       a.Name,
+			},
+			"minReplicas": as.MinReplicas,
+			"maxReplicas": as.MaxReplicas,
+			"metrics": []interface{}{map[string]interface{}{
+				"type": "Resource",
+				"resource": map[string]interface{}{
+					"name": "cpu",
+					"target": map[string]interface{}{
+						"type":               "Utilization",
+						"averageUtilization": as.TargetCPUUtilization,
+					},
+				},
+			}},
+		},
+	}
+}
+
+// Helper Functions
+func marshalYAML(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// dnsLabel converts a name into a valid RFC 1123 label (lowercase, max 63 characters)
+func dnsLabel(name string) string {
+	label := dnsLabelInvalid.ReplaceAllString(strings.ToLower(name), "-")
+	if len(label) > 63 {
+		label = label[:63]
+	}
+	return strings.Trim(label, "-")
+}
+
+func nonEmpty(m map[string]string) map[string]string {
+	for k, v := range m {
+		if v == "" {
+			delete(m, k)
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,124 @@
+package projects
+
+import (
+	"deva/src/lib/dto"
+	projects "deva/src/modules/projects/models"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func testProject(envVars string) (*projects.Project, *projects.ProjectConfig) {
+	return &projects.Project{Name: "My_Shop"}, &projects.ProjectConfig{Framework: "fiber", EnvVars: envVars}
+}
+
+func TestGenerateKubernetesManifests(t *testing.T) {
+	env := `{"APP_PORT":"8080","APP_VERSION":"1.2.0","DB_PASSWORD":"hunter2","LOG_LEVEL":"info"}`
+
+	tests := []struct {
+		name      string
+		opts      dto.KubernetesOptions
+		wantFiles []string
+	}{
+		{
+			name:      "defaults",
+			wantFiles: []string{"k8s/configmap.yaml", "k8s/deployment.yaml", "k8s/service.yaml"},
+		},
+		{
+			name: "ingress and autoscaling",
+			opts: dto.KubernetesOptions{
+				Namespace:   "shop",
+				Replicas:    2,
+				Ingress:     &dto.KubernetesIngress{Host: "shop.example.com", TLSSecret: "shop-tls"},
+				Autoscaling: &dto.KubernetesAutoscaling{MaxReplicas: 5},
+			},
+			wantFiles: []string{"k8s/configmap.yaml", "k8s/deployment.yaml", "k8s/service.yaml", "k8s/ingress.yaml", "k8s/hpa.yaml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project, cfg := testProject(env)
+			files, err := GenerateKubernetesManifests(project, cfg, []string{"DB_PASSWORD"}, tt.opts)
+			if err != nil {
+				t.Fatalf("GenerateKubernetesManifests() error = %v", err)
+			}
+			if len(files) != len(tt.wantFiles) {
+				t.Fatalf("got %d files, want %v", len(files), tt.wantFiles)
+			}
+			for i, file := range files {
+				if file.Path != tt.wantFiles[i] {
+					t.Errorf("file %d = %s, want %s", i, file.Path, tt.wantFiles[i])
+				}
+				if strings.Contains(file.Content, "hunter2") {
+					t.Errorf("%s contains the value of a secret", file.Path)
+				}
+				var doc map[string]interface{}
+				if err := yaml.Unmarshal([]byte(file.Content), &doc); err != nil {
+					t.Fatalf("%s does not parse: %v", file.Path, err)
+				}
+				if doc["apiVersion"] == nil || doc["kind"] == nil {
+					t.Errorf("%s has no apiVersion or kind", file.Path)
+				}
+				metadata, _ := doc["metadata"].(map[string]interface{})
+				if !strings.HasPrefix(metadata["name"].(string), "my-shop") || metadata["namespace"] != nilIfEmpty(tt.opts.Namespace) {
+					t.Errorf("%s metadata = %v", file.Path, metadata)
+				}
+			}
+			if !strings.Contains(files[1].Content, "image: My_Shop-fiber:1.2.0") {
+				t.Errorf("deployment does not use the default image:\n%s", files[1].Content)
+			}
+			if !strings.Contains(files[1].Content, "name: my-shop-secrets") {
+				t.Errorf("deployment does not reference the secret:\n%s", files[1].Content)
+			}
+		})
+	}
+}
+
+func TestGenerateKubernetesManifestsRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		opts    dto.KubernetesOptions
+		wantErr string
+	}{
+		{"malformed env", `{`, dto.KubernetesOptions{}, "invalid project env vars"},
+		{"missing port", `{}`, dto.KubernetesOptions{}, "invalid APP_PORT"},
+		{"port out of range", `{"APP_PORT":"70000"}`, dto.KubernetesOptions{}, "invalid APP_PORT"},
+		{"ingress without host", `{"APP_PORT":"8080"}`, dto.KubernetesOptions{Ingress: &dto.KubernetesIngress{}}, "ingress host is required"},
+		{"autoscaling bounds", `{"APP_PORT":"8080"}`, dto.KubernetesOptions{Autoscaling: &dto.KubernetesAutoscaling{MinReplicas: 3, MaxReplicas: 2}}, "max_replicas"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project, cfg := testProject(tt.env)
+			_, err := GenerateKubernetesManifests(project, cfg, nil, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("GenerateKubernetesManifests() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDNSLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"api", "api"},
+		{"My_Shop", "my-shop"},
+		{"--shop api--", "shop-api"},
+		{strings.Repeat("a", 70), strings.Repeat("a", 63)},
+	}
+	for _, tt := range tests {
+		if got := dnsLabel(tt.name); got != tt.want {
+			t.Errorf("dnsLabel(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func nilIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,128 @@
+package projects
+
+import (
+	"deva/src/config"
+	"deva/src/lib/dto"
+	"deva/src/lib/lint"
+	deployments "deva/src/modules/deployments/services"
+	projects "deva/src/modules/projects/models"
+	"deva/src/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"sort"
+)
+
+const (
+	maxLintFiles    = 20
+	maxLintFileSize = 512 * 1024
+)
+
+// LintDockerFiles lints Dockerfiles and compose files sent by the user
+func LintDockerFiles(request dto.LintDockerFilesRequest) (map[string]interface{}, *utils.ServiceError) {
+	if len(request.Files) == 0 || len(request.Files) > maxLintFiles {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("send between 1 and %d files", maxLintFiles),
+			Err:        fmt.Errorf("%d files to lint", len(request.Files)),
+		}
+	}
+
+	files := make([]GeneratedFile, 0, len(request.Files))
+	for _, file := range request.Files {
+		if !lint.Supports(file.Path) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusBadRequest,
+				Message:    fmt.Sprintf("%q is neither a Dockerfile nor a compose file", file.Path),
+				Err:        fmt.Errorf("unsupported lint file %q", file.Path),
+			}
+		}
+		if len(file.Content) > maxLintFileSize {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusRequestEntityTooLarge,
+				Message:    fmt.Sprintf("%s is larger than %d KiB", file.Path, maxLintFileSize/1024),
+				Err:        fmt.Errorf("lint file %q has %d bytes", file.Path, len(file.Content)),
+			}
+		}
+		files = append(files, GeneratedFile{Path: file.Path, Content: file.Content})
+	}
+
+	opts := lint.OptionsFromEnv(request.Env)
+	if request.AppPort != "" {
+		opts.AppPort = request.AppPort
+	}
+	return lintReport(files, opts), nil
+}
+
+// LintProjectFiles lints the stored Dockerfiles and compose file of a project against its env
+func LintProjectFiles(userID, projectID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	project, serviceErr := deployments.GetAccessibleProject(userID, projectID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	var stored []projects.ProjectFile
+	if err := config.DB.Where("project_id = ?", project.ID).Order("updated_at DESC").Find(&stored).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	// The latest version of each path wins, whether generated or edited
+	seen := map[string]bool{}
+	var files []GeneratedFile
+	for _, file := range stored {
+		if seen[file.Path] || !lint.Supports(file.Path) {
+			continue
+		}
+		seen[file.Path] = true
+		files = append(files, GeneratedFile{Path: file.Path, Content: file.Content})
+	}
+	if len(files) == 0 {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "project has no Dockerfile or compose file",
+			Err:        errors.New("no lintable project files"),
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	env := map[string]string{}
+	var projectConfig projects.ProjectConfig
+	if err := config.DB.First(&projectConfig, "project_id = ?", project.ID).Error; err == nil && projectConfig.EnvVars != "" {
+		if err := json.Unmarshal([]byte(projectConfig.EnvVars), &env); err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "failed to decode project env vars",
+				Err:        err,
+			}
+		}
+	}
+
+	report := lintReport(files, lint.OptionsFromEnv(env))
+	report["project_id"] = project.ID
+	return report, nil
+}
+
+// Helper Functions
+func lintReport(files []GeneratedFile, opts lint.Options) map[string]interface{} {
+	var all []lint.Finding
+	results := make([]map[string]interface{}, 0, len(files))
+	for _, file := range files {
+		findings := lint.File(file.Path, file.Content, opts)
+		all = append(all, findings...)
+		results = append(results, map[string]interface{}{
+			"path":     file.Path,
+			"findings": findings,
+			"summary":  lint.Summarize(findings),
+		})
+	}
+	return map[string]interface{}{
+		"ok":      !lint.HasErrors(all),
+		"summary": lint.Summarize(all),
+		"files":   results,
+	}
+}
@@ -0,0 +1,410 @@
+package projects
+
+import (
+	"bytes"
+	projects "deva/src/modules/projects/models"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	CIToolGitHubActions = "github-actions"
+	CIToolGitLabCI      = "gitlab-ci"
+	CIToolJenkins       = "jenkins"
+)
+
+const (
+	DeployWithDocker     = "docker"
+	DeployWithKubernetes = "kubernetes"
+	DeployWithHelm       = "helm"
+)
+
+// SupportedCITools lists the CI systems pipeline definitions can be generated for
+var SupportedCITools = []string{CIToolGitHubActions, CIToolGitLabCI, CIToolJenkins}
+
+// PipelineOptions selects how the generated pipeline deploys the pushed image
+type PipelineOptions struct {
+	DeployWith  string
+	Environment string
+}
+
+// pipelineSpec is the tool independent description of the generated pipeline. Commands expect
+// IMAGE and TAG in the environment; each CI tool template sets them from its own variables.
+type pipelineSpec struct {
+	AppName       string
+	GoVersion     string
+	Lint          []string
+	Test          []string
+	Build         []string
+	Push          []string
+	Deploy        []string
+	DeploySecrets []string
+	DeployImage   string
+}
+
+// IsSupportedCITool reports whether pipeline generation supports tool
+func IsSupportedCITool(tool string) bool {
+	return contains(SupportedCITools, tool)
+}
+
+// GenerateCIPipeline generates the CI definition for ProjectConfig.CITool. The pipeline lints,
+// tests, builds and pushes the image through the docker-bake.hcl "app" target and deploys it.
+func GenerateCIPipeline(project *projects.Project, cfg *projects.ProjectConfig, opts PipelineOptions) ([]GeneratedFile, error) {
+	env := map[string]string{}
+	if cfg.EnvVars != "" {
+		if err := json.Unmarshal([]byte(cfg.EnvVars), &env); err != nil {
+			return nil, fmt.Errorf("invalid project env vars: %w", err)
+		}
+	}
+	if env["GO_VERSION"] == "" {
+		return nil, fmt.Errorf("GO_VERSION is not set for project %s", project.Name)
+	}
+
+	spec := newPipelineSpec(dnsLabel(project.Name), env, cfg.Framework, opts)
+
+	var path, tpl string
+	switch cfg.CITool {
+	case CIToolGitHubActions:
+		path, tpl = ".github/workflows/ci.yml", githubActionsTemplate
+	case CIToolGitLabCI:
+		path, tpl = ".gitlab-ci.yml", gitlabCITemplate
+	case CIToolJenkins:
+		path, tpl = "Jenkinsfile", jenkinsTemplate
+	default:
+		return nil, fmt.Errorf("unsupported CI tool %q", cfg.CITool)
+	}
+
+	content, err := renderPipeline(tpl, spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", path, err)
+	}
+	if strings.HasSuffix(path, ".yml") {
+		var doc interface{}
+		if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+			return nil, fmt.Errorf("%s is not valid YAML: %w", path, err)
+		}
+	}
+	return []GeneratedFile{{Path: path, Content: content}}, nil
+}
+
+func newPipelineSpec(appName string, env map[string]string, framework string, opts PipelineOptions) pipelineSpec {
+	spec := pipelineSpec{
+		AppName:   appName,
+		GoVersion: env["GO_VERSION"],
+		Lint: []string{
+			`test -z "$(gofmt -l .)" || (gofmt -l . && exit 1)`,
+			`go vet ./...`,
+		},
+		Test: []string{
+			`go test ./...`,
+		},
+		Build: []string{
+			`docker buildx bake app --set "app.tags=${IMAGE}:${TAG}"`,
+		},
+		Push: []string{
+			`docker buildx bake app --set "app.tags=${IMAGE}:${TAG}" --push`,
+		},
+	}
+
+	environment := opts.Environment
+	if environment == "" {
+		environment = "prod"
+	}
+
+	switch opts.DeployWith {
+	case DeployWithKubernetes:
+		spec.DeploySecrets = []string{"KUBECONFIG_DATA"}
+		spec.DeployImage = "alpine/k8s:1.30.4"
+		spec.Deploy = []string{
+			`printf '%s' "$KUBECONFIG_DATA" > kubeconfig && export KUBECONFIG="$PWD/kubeconfig"`,
+			`kubectl apply -f k8s/`,
+			fmt.Sprintf(`kubectl set image deployment/%[1]s %[1]s="${IMAGE}:${TAG}"`, appName),
+			fmt.Sprintf(`kubectl rollout status deployment/%s --timeout=300s`, appName),
+		}
+	case DeployWithHelm:
+		spec.DeploySecrets = []string{"KUBECONFIG_DATA"}
+		spec.DeployImage = "alpine/k8s:1.30.4"
+		spec.Deploy = []string{
+			`printf '%s' "$KUBECONFIG_DATA" > kubeconfig && export KUBECONFIG="$PWD/kubeconfig"`,
+			fmt.Sprintf(`helm upgrade --install %[1]s helm/%[1]s -f helm/%[1]s/values-%[2]s.yaml --set image.repository="${IMAGE}" --set image.tag="${TAG}" --wait`, appName, environment),
+		}
+	default:
+		container := fmt.Sprintf("%s-%s", appName, framework)
+		port := env["APP_PORT"]
+		spec.DeployImage = "docker:27"
+		spec.DeploySecrets = []string{"DEPLOY_DOCKER_HOST", "DEPLOY_DOCKER_CA", "DEPLOY_DOCKER_CERT", "DEPLOY_DOCKER_KEY"}
+		spec.Deploy = []string{
+			`mkdir -p .deploy-certs && printf '%s' "$DEPLOY_DOCKER_CA" > .deploy-certs/ca.pem && printf '%s' "$DEPLOY_DOCKER_CERT" > .deploy-certs/cert.pem && printf '%s' "$DEPLOY_DOCKER_KEY" > .deploy-certs/key.pem`,
+			`export DOCKER_HOST="$DEPLOY_DOCKER_HOST" DOCKER_TLS_VERIFY=1 DOCKER_CERT_PATH="$PWD/.deploy-certs"`,
+			`docker pull "${IMAGE}:${TAG}"`,
+			fmt.Sprintf(`docker rm -f %s || true`, container),
+			fmt.Sprintf(`docker run -d --name %s --restart unless-stopped -p %s:%s "${IMAGE}:${TAG}"`, container, port, port),
+		}
+	}
+	return spec
+}
+
+func renderPipeline(tpl string, spec pipelineSpec) (string, error) {
+	t, err := template.New("pipeline").Delims("[[", "]]").Funcs(template.FuncMap{
+		"yamlQuote": func(s string) string {
+			return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+		},
+	}).Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, spec); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Helper Functions
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+const githubActionsTemplate = `name: CI
+
+on:
+  push:
+    branches: [main]
+  pull_request:
+
+jobs:
+  lint:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version: "[[ .GoVersion ]]"
+      - name: Lint
+        run: |
+[[- range .Lint ]]
+          [[ . ]]
+[[- end ]]
+
+  test:
+    needs: lint
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version: "[[ .GoVersion ]]"
+      - name: Test
+        run: |
+[[- range .Test ]]
+          [[ . ]]
+[[- end ]]
+
+  build:
+    needs: test
+    runs-on: ubuntu-latest
+    permissions:
+      contents: read
+      packages: write
+    steps:
+      - uses: actions/checkout@v4
+      - uses: docker/setup-buildx-action@v3
+      - name: Set image name
+        run: |
+          echo "IMAGE=ghcr.io/${GITHUB_REPOSITORY,,}" >> "$GITHUB_ENV"
+          echo "TAG=${GITHUB_SHA}" >> "$GITHUB_ENV"
+      - name: Build
+        run: |
+[[- range .Build ]]
+          [[ . ]]
+[[- end ]]
+      - uses: docker/login-action@v3
+        if: github.event_name == 'push'
+        with:
+          registry: ghcr.io
+          username: ${{ github.actor }}
+          password: ${{ secrets.GITHUB_TOKEN }}
+      - name: Push
+        if: github.event_name == 'push'
+        run: |
+[[- range .Push ]]
+          [[ . ]]
+[[- end ]]
+
+  deploy:
+    needs: build
+    if: github.event_name == 'push'
+    runs-on: ubuntu-latest
+    environment: production
+    steps:
+      - uses: actions/checkout@v4
+      - name: Set image name
+        run: |
+          echo "IMAGE=ghcr.io/${GITHUB_REPOSITORY,,}" >> "$GITHUB_ENV"
+          echo "TAG=${GITHUB_SHA}" >> "$GITHUB_ENV"
+      - name: Deploy
+        env:
+[[- range .DeploySecrets ]]
+          [[ . ]]: ${{ secrets.[[ . ]] }}
+[[- end ]]
+        run: |
+[[- range .Deploy ]]
+          [[ . ]]
+[[- end ]]
+`
+
+const gitlabCITemplate = `stages:
+  - lint
+  - test
+  - build
+  - push
+  - deploy
+
+variables:
+  IMAGE: $CI_REGISTRY_IMAGE
+  TAG: $CI_COMMIT_SHORT_SHA
+
+.go:
+  image: golang:[[ .GoVersion ]]
+
+.docker:
+  image: docker:27
+  services:
+    - docker:27-dind
+  variables:
+    DOCKER_TLS_CERTDIR: "/certs"
+
+lint:
+  extends: .go
+  stage: lint
+  script:
+[[- range .Lint ]]
+    - [[ yamlQuote . ]]
+[[- end ]]
+
+test:
+  extends: .go
+  stage: test
+  script:
+[[- range .Test ]]
+    - [[ yamlQuote . ]]
+[[- end ]]
+
+build:
+  extends: .docker
+  stage: build
+  script:
+[[- range .Build ]]
+    - [[ yamlQuote . ]]
+[[- end ]]
+
+push:
+  extends: .docker
+  stage: push
+  rules:
+    - if: $CI_COMMIT_BRANCH == $CI_DEFAULT_BRANCH
+  before_script:
+    - 'docker login -u "$CI_REGISTRY_USER" -p "$CI_REGISTRY_PASSWORD" "$CI_REGISTRY"'
+  script:
+[[- range .Push ]]
+    - [[ yamlQuote . ]]
+[[- end ]]
+
+# Requires the CI/CD variables: [[ range $i, $s := .DeploySecrets ]][[ if $i ]], [[ end ]][[ $s ]][[ end ]]
+deploy:
+  stage: deploy
+  image: [[ .DeployImage ]]
+  environment: production
+  rules:
+    - if: $CI_COMMIT_BRANCH == $CI_DEFAULT_BRANCH
+  script:
+[[- range .Deploy ]]
+    - [[ yamlQuote . ]]
+[[- end ]]
+`
+
+const jenkinsTemplate = `// Requires the credentials: registry-credentials (username/password)[[ range .DeploySecrets ]], [[ . ]] (secret text)[[ end ]]
+pipeline {
+    agent any
+
+    environment {
+        IMAGE = "${params.REGISTRY_IMAGE}"
+        TAG = "${env.GIT_COMMIT}"
+    }
+
+    parameters {
+        string(name: 'REGISTRY_IMAGE', defaultValue: 'registry.example.com/[[ .AppName ]]', description: 'Image repository to push to')
+    }
+
+    stages {
+        stage('Lint') {
+            agent { docker { image 'golang:[[ .GoVersion ]]'; reuseNode true } }
+            steps {
+                sh '''
+[[- range .Lint ]]
+                    [[ . ]]
+[[- end ]]
+                '''
+            }
+        }
+
+        stage('Test') {
+            agent { docker { image 'golang:[[ .GoVersion ]]'; reuseNode true } }
+            steps {
+                sh '''
+[[- range .Test ]]
+                    [[ . ]]
+[[- end ]]
+                '''
+            }
+        }
+
+        stage('Build') {
+            steps {
+                sh '''
+[[- range .Build ]]
+                    [[ . ]]
+[[- end ]]
+                '''
+            }
+        }
+
+        stage('Push') {
+            when { branch 'main' }
+            steps {
+                withCredentials([usernamePassword(credentialsId: 'registry-credentials', usernameVariable: 'REGISTRY_USER', passwordVariable: 'REGISTRY_PASSWORD')]) {
+                    sh '''
+                        echo "$REGISTRY_PASSWORD" | docker login -u "$REGISTRY_USER" --password-stdin "${IMAGE%%/*}"
+[[- range .Push ]]
+                        [[ . ]]
+[[- end ]]
+                    '''
+                }
+            }
+        }
+
+        stage('Deploy') {
+            when { branch 'main' }
+            steps {
+                withCredentials([ [[- range $i, $s := .DeploySecrets ]][[ if $i ]],[[ end ]] string(credentialsId: '[[ $s ]]', variable: '[[ $s ]]')[[ end ]] ]) {
+                    sh '''
+[[- range .Deploy ]]
+                        [[ . ]]
+[[- end ]]
+                    '''
+                }
+            }
+        }
+    }
+}
+`
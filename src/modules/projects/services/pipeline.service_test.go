@@ -0,0 +1,83 @@
+package projects
+
+import (
+	projects "deva/src/modules/projects/models"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestGenerateCIPipeline(t *testing.T) {
+	env := `{"APP_PORT":"8080","GO_VERSION":"1.24"}`
+
+	tests := []struct {
+		name     string
+		tool     string
+		opts     PipelineOptions
+		wantPath string
+		want     []string
+	}{
+		{"github actions with docker", CIToolGitHubActions, PipelineOptions{}, ".github/workflows/ci.yml",
+			[]string{"DEPLOY_DOCKER_HOST", "docker run -d --name my-shop-fiber", "-p 8080:8080"}},
+		{"gitlab with kubernetes", CIToolGitLabCI, PipelineOptions{DeployWith: DeployWithKubernetes}, ".gitlab-ci.yml",
+			[]string{"KUBECONFIG_DATA", "kubectl rollout status deployment/my-shop"}},
+		{"github actions with helm", CIToolGitHubActions, PipelineOptions{DeployWith: DeployWithHelm, Environment: "staging"}, ".github/workflows/ci.yml",
+			[]string{"helm upgrade --install my-shop helm/my-shop -f helm/my-shop/values-staging.yaml"}},
+		{"jenkins", CIToolJenkins, PipelineOptions{DeployWith: DeployWithHelm}, "Jenkinsfile",
+			[]string{"pipeline {", "values-prod.yaml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project, cfg := testProject(env)
+			cfg.CITool = tt.tool
+			files, err := GenerateCIPipeline(project, cfg, tt.opts)
+			if err != nil {
+				t.Fatalf("GenerateCIPipeline() error = %v", err)
+			}
+			if len(files) != 1 || files[0].Path != tt.wantPath {
+				t.Fatalf("GenerateCIPipeline() = %v, want %s", files, tt.wantPath)
+			}
+			content := files[0].Content
+			if strings.HasSuffix(tt.wantPath, ".yml") {
+				var doc map[string]interface{}
+				if err := yaml.Unmarshal([]byte(content), &doc); err != nil || len(doc) == 0 {
+					t.Fatalf("%s does not parse: %v", tt.wantPath, err)
+				}
+			}
+			for _, want := range append([]string{"1.24", "go vet ./...", "go test ./...", "docker buildx bake app"}, tt.want...) {
+				if !strings.Contains(content, want) {
+					t.Errorf("%s does not contain %q", tt.wantPath, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateCIPipelineRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     projects.ProjectConfig
+		wantErr string
+	}{
+		{"unsupported tool", projects.ProjectConfig{CITool: "travis", EnvVars: `{"GO_VERSION":"1.24"}`}, "unsupported CI tool"},
+		{"no Go version", projects.ProjectConfig{CITool: CIToolGitLabCI, EnvVars: `{}`}, "GO_VERSION is not set"},
+		{"malformed env", projects.ProjectConfig{CITool: CIToolGitLabCI, EnvVars: `[`}, "invalid project env vars"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GenerateCIPipeline(&projects.Project{Name: "shop"}, &tt.cfg, PipelineOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("GenerateCIPipeline() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsSupportedCITool(t *testing.T) {
+	for tool, want := range map[string]bool{CIToolGitHubActions: true, CIToolGitLabCI: true, CIToolJenkins: true, "travis": false, "": false} {
+		if got := IsSupportedCITool(tool); got != want {
+			t.Errorf("IsSupportedCITool(%q) = %v, want %v", tool, got, want)
+		}
+	}
+}
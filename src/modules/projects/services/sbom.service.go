@@ -0,0 +1,147 @@
+package projects
+
+import (
+	"deva/src/config"
+	"deva/src/lib/lint"
+	"deva/src/lib/sbom"
+	deployments "deva/src/modules/deployments/services"
+	projects "deva/src/modules/projects/models"
+	"deva/src/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SBOM files added to the project archive, by format
+var sbomFiles = map[string]string{
+	sbom.FormatCycloneDX: "sbom.cdx.json",
+	sbom.FormatSPDX:      "sbom.spdx.json",
+}
+
+// GenerateSBOMFiles builds the CycloneDX and SPDX documents of a project from its go.mod, go.sum
+// and Dockerfiles, given by path
+func GenerateSBOMFiles(project *projects.Project, cfg *projects.ProjectConfig, files map[string]string) ([]GeneratedFile, error) {
+	bom, err := projectBOM(project, cfg, files)
+	if err != nil {
+		return nil, err
+	}
+
+	generated := make([]GeneratedFile, 0, len(sbomFiles))
+	for _, format := range []string{sbom.FormatCycloneDX, sbom.FormatSPDX} {
+		content, err := bom.Render(format)
+		if err != nil {
+			return nil, err
+		}
+		generated = append(generated, GeneratedFile{Path: sbomFiles[format], Content: string(content) + "\n"})
+	}
+	return generated, nil
+}
+
+// GetProjectSBOM builds the SBOM of a project from its stored files, so later edits of go.mod are
+// reflected. It returns the document and its file name.
+func GetProjectSBOM(userID, projectID uuid.UUID, format string) ([]byte, string, *utils.ServiceError) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = sbom.FormatCycloneDX
+	}
+	if _, ok := sbomFiles[format]; !ok {
+		return nil, "", &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("format must be %s or %s", sbom.FormatCycloneDX, sbom.FormatSPDX),
+			Err:        fmt.Errorf("invalid SBOM format %q", format),
+		}
+	}
+
+	project, serviceErr := deployments.GetAccessibleProject(userID, projectID)
+	if serviceErr != nil {
+		return nil, "", serviceErr
+	}
+	var cfg projects.ProjectConfig
+	if err := config.DB.First(&cfg, "project_id = ?", project.ID).Error; err != nil {
+		return nil, "", &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	var stored []projects.ProjectFile
+	if err := config.DB.Where("project_id = ?", project.ID).Order("updated_at DESC").Find(&stored).Error; err != nil {
+		return nil, "", &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	// The latest version of each path wins, whether generated or edited
+	files := map[string]string{}
+	for _, file := range stored {
+		if _, seen := files[file.Path]; !seen && isSBOMSource(file.Path) {
+			files[file.Path] = file.Content
+		}
+	}
+	if len(files) == 0 {
+		return nil, "", &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "project has no go.mod or Dockerfile",
+			Err:        errors.New("no SBOM sources"),
+		}
+	}
+
+	bom, err := projectBOM(project, &cfg, files)
+	if err != nil {
+		return nil, "", &utils.ServiceError{
+			StatusCode: http.StatusUnprocessableEntity,
+			Message:    "failed to read the project dependencies",
+			Err:        err,
+		}
+	}
+	content, err := bom.Render(format)
+	if err != nil {
+		return nil, "", &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to encode the SBOM",
+			Err:        err,
+		}
+	}
+	return content, project.Name + "." + sbomFiles[format], nil
+}
+
+// Helper Functions
+func projectBOM(project *projects.Project, cfg *projects.ProjectConfig, files map[string]string) (*sbom.BOM, error) {
+	env := map[string]string{}
+	if cfg.EnvVars != "" {
+		if err := json.Unmarshal([]byte(cfg.EnvVars), &env); err != nil {
+			return nil, fmt.Errorf("invalid project env vars: %w", err)
+		}
+	}
+
+	sources := sbom.Sources{
+		GoMod:       []byte(files["go.mod"]),
+		GoSum:       []byte(files["go.sum"]),
+		Dockerfiles: map[string]string{},
+		Env:         env,
+	}
+	for path, content := range files {
+		if lint.IsDockerfile(path) {
+			sources.Dockerfiles[path] = content
+		}
+	}
+
+	bom, err := sbom.Build(project.Name, env["APP_VERSION"], sources)
+	if err != nil {
+		return nil, err
+	}
+	bom.Timestamp = time.Now()
+	bom.SerialNumber = uuid.NewString()
+	bom.Namespace = "https://spdx.org/spdxdocs/" + project.Name
+	return bom, nil
+}
+
+func isSBOMSource(path string) bool {
+	return path == "go.mod" || path == "go.sum" || lint.IsDockerfile(path)
+}
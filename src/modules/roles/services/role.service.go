@@ -31,6 +31,17 @@ func GetRoleByUserID(userID uuid.UUID) (*roles.Role, error) {
 	return &role, nil
 }
 
+// GetUserIDsByRoleName returns the users holding a role
+func GetUserIDsByRoleName(roleName string) ([]uuid.UUID, error) {
+	var userIDs []uuid.UUID
+	err := config.DB.
+		Table("user_roles").
+		Joins("inner join roles on roles.id = user_roles.role_id").
+		Where("roles.name = ? AND user_roles.deleted_at IS NULL", roleName).
+		Pluck("user_roles.user_id", &userIDs).Error
+	return userIDs, err
+}
+
 // CreateRoleByAdmin creates a new role with the given name
 func CreateRoleByAdmin(roleName string) (fiber.Map, error) {
 	db := config.DB
@@ -0,0 +1,100 @@
+package teams
+
+import (
+	teams "deva/src/modules/teams/models"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// IsTeamMember reports whether the user owns or belongs to the team
+func IsTeamMember(db *gorm.DB, teamID, userID uuid.UUID) (bool, error) {
+	if teamID == uuid.Nil {
+		return false, nil
+	}
+
+	var team teams.Team
+	if err := db.Select("id", "owner_id").First(&team, "id = ?", teamID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if team.OwnerID == userID {
+		return true, nil
+	}
+
+	var count int64
+	if err := db.Model(&teams.TeamMember{}).Where("team_id = ? AND user_id = ?", teamID, userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// IsTeamOwner reports whether the user owns the team
+func IsTeamOwner(db *gorm.DB, teamID, userID uuid.UUID) (bool, error) {
+	if teamID == uuid.Nil {
+		return false, nil
+	}
+
+	var count int64
+	if err := db.Model(&teams.Team{}).Where("id = ? AND owner_id = ?", teamID, userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// UserTeamIDs returns the teams the user owns or belongs to
+func UserTeamIDs(db *gorm.DB, userID uuid.UUID) ([]uuid.UUID, error) {
+	var owned []uuid.UUID
+	if err := db.Model(&teams.Team{}).Where("owner_id = ?", userID).Pluck("id", &owned).Error; err != nil {
+		return nil, err
+	}
+	var joined []uuid.UUID
+	if err := db.Model(&teams.TeamMember{}).Where("user_id = ?", userID).Pluck("team_id", &joined).Error; err != nil {
+		return nil, err
+	}
+	return append(owned, joined...), nil
+}
+
+// TeamRole returns the role of the user in the team: "owner" for its owner, the member role
+// otherwise, and "" for users outside the team
+func TeamRole(db *gorm.DB, teamID, userID uuid.UUID) (string, error) {
+	if teamID == uuid.Nil {
+		return "", nil
+	}
+
+	var team teams.Team
+	if err := db.Select("id", "owner_id").First(&team, "id = ?", teamID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	if team.OwnerID == userID {
+		return "owner", nil
+	}
+
+	var member teams.TeamMember
+	if err := db.Select("role").Where("team_id = ? AND user_id = ?", teamID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// TeamUserIDs returns the owner and the members of the team
+func TeamUserIDs(db *gorm.DB, teamID uuid.UUID) ([]uuid.UUID, error) {
+	var team teams.Team
+	if err := db.Select("id", "owner_id").First(&team, "id = ?", teamID).Error; err != nil {
+		return nil, err
+	}
+	var members []uuid.UUID
+	if err := db.Model(&teams.TeamMember{}).Where("team_id = ? AND user_id <> ?", teamID, team.OwnerID).
+		Pluck("user_id", &members).Error; err != nil {
+		return nil, err
+	}
+	return append([]uuid.UUID{team.OwnerID}, members...), nil
+}
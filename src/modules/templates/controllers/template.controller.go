@@ -0,0 +1,75 @@
+package templates
+
+import (
+	"deva/src/lib/interfaces"
+	service "deva/src/modules/templates/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// ListTemplates is a controller function to list all project templates
+func ListTemplates(c *fiber.Ctx) error {
+	response, serviceErr := service.ListTemplates()
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Retrieved templates successfully",
+		},
+		Error: nil,
+	})
+}
+
+// GetTemplateSchema is a controller function to describe the parameters of a template
+func GetTemplateSchema(c *fiber.Ctx) error {
+	templateID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		s := err.Error()
+		errStr := &s
+		return c.Status(http.StatusBadRequest).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid template ID",
+			},
+			Error: errStr,
+		})
+	}
+
+	schema, serviceErr := service.GetTemplateSchema(templateID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(interfaces.Response{
+		Data: schema,
+		Status: interfaces.Status{
+			Code:    http.StatusOK,
+			Message: "Retrieved template schema successfully",
+		},
+		Error: nil,
+	})
+}
@@ -0,0 +1,31 @@
+package templates
+
+import (
+	users "deva/src/modules/users/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type TemplateParameter struct {
+	ID            uuid.UUID       `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	TemplateID    uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_template_parameter_name"`
+	Template      ProjectTemplate `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:TemplateID;references:ID"`
+	Name          string          `gorm:"not null;uniqueIndex:idx_template_parameter_name"` // Env key, e.g. "DB_VERSION"
+	Label         string          `gorm:"not null"`
+	Type          string          `gorm:"not null"`                         // "string", "number", "boolean", "enum"
+	EnumChoices   string          `gorm:"type:jsonb;not null;default:'[]'"` // e.g. ["mysql", "postgres"]
+	Default       string
+	Required      bool           `gorm:"not null;default:false"`
+	VisibleWhen   string         `gorm:"type:jsonb;not null;default:'{}'"` // e.g. {"WITH_DB": "true"}
+	Position      int            `gorm:"not null;default:0"`
+	UpdatedBy     uuid.UUID      `gorm:"type:uuid;not null"`
+	UpdatedByUser users.User     `gorm:"foreignKey:UpdatedBy;references:ID"`
+	CreatedAt     time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time      `gorm:"autoUpdateTime"`
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+}
+
+func MigrateTemplateParameters(db *gorm.DB) error {
+	return db.AutoMigrate(&TemplateParameter{})
+}
@@ -0,0 +1,366 @@
+package templates
+
+import (
+	"deva/src/config"
+	templates "deva/src/modules/templates/models"
+	"deva/src/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Supported parameter types
+const (
+	ParamTypeString  = "string"
+	ParamTypeNumber  = "number"
+	ParamTypeBoolean = "boolean"
+	ParamTypeEnum    = "enum"
+)
+
+// numberPattern is the shape of number parameters, shared by the schema and the validation
+var numberPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// ListTemplates returns all available project templates
+func ListTemplates() ([]map[string]interface{}, *utils.ServiceError) {
+	db := config.DB
+
+	var list []templates.ProjectTemplate
+	if err := db.Order("name asc").Find(&list).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to list templates",
+			Err:        err,
+		}
+	}
+
+	result := make([]map[string]interface{}, 0, len(list))
+	for _, t := range list {
+		result = append(result, map[string]interface{}{
+			"id":          t.ID,
+			"name":        t.Name,
+			"description": t.Description,
+			"language":    t.Language,
+			"is_official": t.IsOfficial,
+		})
+	}
+	return result, nil
+}
+
+// ResolveTemplate finds a template by its ID, or by name when no ID is given
+func ResolveTemplate(templateID uuid.UUID, name string) (*templates.ProjectTemplate, *utils.ServiceError) {
+	db := config.DB
+
+	query := db.Where("name = ?", name)
+	if templateID != uuid.Nil {
+		query = db.Where("id = ?", templateID)
+	}
+
+	var template templates.ProjectTemplate
+	if err := query.First(&template).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "Template not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return &template, nil
+}
+
+// ResolveTemplateForEnv finds the template of a project: by ID when one is given, else by the
+// name LANGUAGE-FRAMEWORK, where a missing LANGUAGE or FRAMEWORK takes the default the template
+// declares for it
+func ResolveTemplateForEnv(templateID uuid.UUID, env map[string]string) (*templates.ProjectTemplate, *utils.ServiceError) {
+	if templateID != uuid.Nil {
+		return ResolveTemplate(templateID, "")
+	}
+	language, framework := strings.TrimSpace(env["LANGUAGE"]), strings.TrimSpace(env["FRAMEWORK"])
+	if language != "" && framework != "" {
+		return ResolveTemplate(uuid.Nil, language+"-"+framework)
+	}
+
+	db := config.DB
+	var list []templates.ProjectTemplate
+	if err := db.Order("name asc").Find(&list).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to list templates",
+			Err:        err,
+		}
+	}
+	var defaults []templates.TemplateParameter
+	if err := db.Where("name IN ?", []string{"LANGUAGE", "FRAMEWORK"}).Find(&defaults).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to load template parameters",
+			Err:        err,
+		}
+	}
+
+	var matches []templates.ProjectTemplate
+	for _, t := range list {
+		values := map[string]string{"LANGUAGE": language, "FRAMEWORK": framework}
+		for _, p := range defaults {
+			if p.TemplateID == t.ID && values[p.Name] == "" {
+				values[p.Name] = p.Default
+			}
+		}
+		if values["LANGUAGE"]+"-"+values["FRAMEWORK"] == t.Name {
+			matches = append(matches, t)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusNotFound,
+			Message:    "Template not found",
+			Err:        fmt.Errorf("no template matches LANGUAGE %q and FRAMEWORK %q", language, framework),
+		}
+	case 1:
+		return &matches[0], nil
+	}
+	return nil, &utils.ServiceError{
+		StatusCode: http.StatusBadRequest,
+		Message:    "Several templates match, set template_id or LANGUAGE and FRAMEWORK",
+		Err:        fmt.Errorf("%d templates match LANGUAGE %q and FRAMEWORK %q", len(matches), language, framework),
+	}
+}
+
+// GetTemplateParameters returns the parameters of a template in display order
+func GetTemplateParameters(templateID uuid.UUID) ([]templates.TemplateParameter, *utils.ServiceError) {
+	db := config.DB
+
+	var params []templates.TemplateParameter
+	if err := db.Where("template_id = ?", templateID).Order("position asc").Find(&params).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to load template parameters",
+			Err:        err,
+		}
+	}
+	return params, nil
+}
+
+// GetTemplateSchema builds a JSON-Schema-style description of the parameters of a template
+func GetTemplateSchema(templateID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	template, serviceErr := ResolveTemplate(templateID, "")
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	params, serviceErr := GetTemplateParameters(template.ID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	properties := make(map[string]interface{}, len(params))
+	required := make([]string, 0)
+	conditions := make([]map[string]interface{}, 0)
+
+	for _, p := range params {
+		choices, visibleWhen, err := decodeParameter(p)
+		if err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    fmt.Sprintf("Template parameter %s is malformed", p.Name),
+				Err:        err,
+			}
+		}
+
+		// Values travel in env, a map of strings: numbers and booleans are strings of a given shape
+		property := map[string]interface{}{
+			"title":   p.Label,
+			"type":    "string",
+			"x-type":  p.Type,
+			"x-order": p.Position,
+		}
+		switch p.Type {
+		case ParamTypeNumber:
+			property["pattern"] = numberPattern.String()
+		case ParamTypeBoolean:
+			property["enum"] = []string{"true", "false"}
+		}
+		if len(choices) > 0 {
+			property["enum"] = choices
+		}
+		if p.Default != "" {
+			property["default"] = p.Default
+		}
+		if len(visibleWhen) > 0 {
+			property["x-visible-when"] = visibleWhen
+		}
+		properties[p.Name] = property
+
+		if !p.Required {
+			continue
+		}
+		if len(visibleWhen) == 0 {
+			required = append(required, p.Name)
+			continue
+		}
+
+		// Conditionally visible parameters are only required when they are shown
+		ifProperties := make(map[string]interface{}, len(visibleWhen))
+		ifRequired := make([]string, 0, len(visibleWhen))
+		for key, value := range visibleWhen {
+			ifProperties[key] = map[string]interface{}{"const": value}
+			ifRequired = append(ifRequired, key)
+		}
+		conditions = append(conditions, map[string]interface{}{
+			"if":   map[string]interface{}{"properties": ifProperties, "required": ifRequired},
+			"then": map[string]interface{}{"required": []string{p.Name}},
+		})
+	}
+
+	schema := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         fmt.Sprintf("/api/v1/templates/%s/schema", template.ID),
+		"title":       template.Name,
+		"description": template.Description,
+		"type":        "object",
+		"properties":  properties,
+		"required":    required,
+	}
+	if len(conditions) > 0 {
+		schema["allOf"] = conditions
+	}
+	return schema, nil
+}
+
+// ValidateEnv checks env against the parameters of a template. Hidden parameters are
+// filled with their defaults so the generation scripts always receive a value.
+func ValidateEnv(templateID uuid.UUID, env map[string]string) (map[string]string, *utils.ServiceError) {
+	params, serviceErr := GetTemplateParameters(templateID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	resolved, err := validateEnvAgainstParameters(params, env)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid project parameters",
+			Err:        err,
+		}
+	}
+	return resolved, nil
+}
+
+// validateEnvAgainstParameters only lets declared parameters through: env ends up in the process
+// environment of the generation scripts, where keys like PATH or BASH_ENV would take them over.
+func validateEnvAgainstParameters(params []templates.TemplateParameter, env map[string]string) (map[string]string, error) {
+	declared := make(map[string]bool, len(params))
+	for _, p := range params {
+		declared[p.Name] = true
+	}
+	var undeclared []string
+	for k := range env {
+		if !declared[k] {
+			undeclared = append(undeclared, k)
+		}
+	}
+	if len(undeclared) > 0 {
+		sort.Strings(undeclared)
+		return nil, fmt.Errorf("unknown parameters: %s", strings.Join(undeclared, ", "))
+	}
+
+	resolved := make(map[string]string, len(params))
+	for k, v := range env {
+		resolved[k] = strings.TrimSpace(v)
+	}
+
+	// Apply defaults first so visibility conditions can rely on them
+	for _, p := range params {
+		if resolved[p.Name] == "" && p.Default != "" {
+			resolved[p.Name] = p.Default
+		}
+	}
+
+	var problems []string
+	for _, p := range params {
+		choices, visibleWhen, err := decodeParameter(p)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s is malformed: %w", p.Name, err)
+		}
+
+		if !isVisible(visibleWhen, resolved) {
+			continue
+		}
+
+		value := resolved[p.Name]
+		if value == "" {
+			if p.Required {
+				problems = append(problems, fmt.Sprintf("%s is required", p.Name))
+			}
+			continue
+		}
+
+		switch p.Type {
+		case ParamTypeNumber:
+			if !numberPattern.MatchString(value) {
+				problems = append(problems, fmt.Sprintf("%s must be a number", p.Name))
+			}
+		case ParamTypeBoolean:
+			if value != "true" && value != "false" {
+				problems = append(problems, fmt.Sprintf("%s must be 'true' or 'false'", p.Name))
+			}
+		case ParamTypeEnum:
+			if !contains(choices, value) {
+				problems = append(problems, fmt.Sprintf("%s must be one of [%s]", p.Name, strings.Join(choices, ", ")))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return resolved, nil
+}
+
+// Helper Functions
+func decodeParameter(p templates.TemplateParameter) ([]string, map[string]string, error) {
+	var choices []string
+	if p.EnumChoices != "" {
+		if err := json.Unmarshal([]byte(p.EnumChoices), &choices); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var visibleWhen map[string]string
+	if p.VisibleWhen != "" {
+		if err := json.Unmarshal([]byte(p.VisibleWhen), &visibleWhen); err != nil {
+			return nil, nil, err
+		}
+	}
+	return choices, visibleWhen, nil
+}
+
+func isVisible(visibleWhen map[string]string, env map[string]string) bool {
+	for key, expected := range visibleWhen {
+		if env[key] != expected {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
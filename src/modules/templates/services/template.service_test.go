@@ -0,0 +1,115 @@
+package templates
+
+import (
+	templates "deva/src/modules/templates/models"
+	"strings"
+	"testing"
+)
+
+func TestValidateEnvAgainstParameters(t *testing.T) {
+	params := []templates.TemplateParameter{
+		{Name: "LANGUAGE", Type: ParamTypeString, Default: "go", Required: true},
+		{Name: "PORT", Type: ParamTypeNumber, Default: "8080"},
+		{Name: "WITH_DB", Type: ParamTypeBoolean, Default: "false"},
+		{Name: "DB_TYPE", Type: ParamTypeEnum, EnumChoices: `["mysql","postgres"]`, Required: true, VisibleWhen: `{"WITH_DB":"true"}`},
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			env:  map[string]string{},
+			want: map[string]string{"LANGUAGE": "go", "PORT": "8080", "WITH_DB": "false"},
+		},
+		{
+			name: "visible enum",
+			env:  map[string]string{"WITH_DB": "true", "DB_TYPE": " postgres ", "PORT": "3000"},
+			want: map[string]string{"LANGUAGE": "go", "PORT": "3000", "WITH_DB": "true", "DB_TYPE": "postgres"},
+		},
+		{
+			name: "hidden parameter is not required",
+			env:  map[string]string{"WITH_DB": "false"},
+			want: map[string]string{"LANGUAGE": "go", "PORT": "8080", "WITH_DB": "false"},
+		},
+		{
+			name:    "visible parameter is required",
+			env:     map[string]string{"WITH_DB": "true"},
+			wantErr: "DB_TYPE is required",
+		},
+		{
+			name:    "enum choice",
+			env:     map[string]string{"WITH_DB": "true", "DB_TYPE": "oracle"},
+			wantErr: "DB_TYPE must be one of [mysql, postgres]",
+		},
+		{
+			name:    "number",
+			env:     map[string]string{"PORT": "80a"},
+			wantErr: "PORT must be a number",
+		},
+		{
+			name:    "boolean",
+			env:     map[string]string{"WITH_DB": "yes"},
+			wantErr: "WITH_DB must be 'true' or 'false'",
+		},
+		{
+			name:    "undeclared keys",
+			env:     map[string]string{"PATH": "/tmp", "BASH_ENV": "/tmp/x", "PORT": "80"},
+			wantErr: "unknown parameters: BASH_ENV, PATH",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateEnvAgainstParameters(params, tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("validateEnvAgainstParameters() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateEnvAgainstParameters() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("validateEnvAgainstParameters() = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateEnvAgainstParametersMalformed(t *testing.T) {
+	params := []templates.TemplateParameter{{Name: "DB_TYPE", Type: ParamTypeEnum, EnumChoices: `mysql`}}
+	if _, err := validateEnvAgainstParameters(params, map[string]string{"DB_TYPE": "mysql"}); err == nil {
+		t.Error("validateEnvAgainstParameters() error = nil, want an error for malformed choices")
+	}
+}
+
+func TestIsVisible(t *testing.T) {
+	tests := []struct {
+		name        string
+		visibleWhen map[string]string
+		env         map[string]string
+		want        bool
+	}{
+		{"no condition", nil, map[string]string{}, true},
+		{"condition met", map[string]string{"WITH_DB": "true"}, map[string]string{"WITH_DB": "true"}, true},
+		{"condition not met", map[string]string{"WITH_DB": "true"}, map[string]string{"WITH_DB": "false"}, false},
+		{"key missing", map[string]string{"WITH_DB": "true"}, map[string]string{}, false},
+		{"all conditions", map[string]string{"WITH_DB": "true", "DB_TYPE": "mysql"}, map[string]string{"WITH_DB": "true", "DB_TYPE": "postgres"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isVisible(tt.visibleWhen, tt.env); got != tt.want {
+				t.Errorf("isVisible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
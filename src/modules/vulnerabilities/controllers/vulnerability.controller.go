@@ -0,0 +1,301 @@
+package vulnerabilities
+
+import (
+	"deva/src/lib/interfaces"
+	users "deva/src/modules/users/models"
+	service "deva/src/modules/vulnerabilities/services"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ScanProject is a controller function to scan the dependencies of a project now
+func ScanProject(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		s := err.Error()
+		return c.Status(fiber.StatusBadRequest).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusBadRequest,
+				Message: "Invalid project ID",
+			},
+			Error: &s,
+		})
+	}
+
+	response, serviceErr := service.RunProjectScan(currentUser.ID, projectID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    fiber.StatusCreated,
+			Message: "Project scanned",
+		},
+		Error: nil,
+	})
+}
+
+// ListProjectScans is a controller function to list the vulnerability scans of a project
+func ListProjectScans(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	projectID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		s := err.Error()
+		return c.Status(fiber.StatusBadRequest).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusBadRequest,
+				Message: "Invalid project ID",
+			},
+			Error: &s,
+		})
+	}
+
+	response, serviceErr := service.ListProjectScans(currentUser.ID, projectID, c.QueryInt("limit", 20), c.QueryInt("offset", 0))
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    fiber.StatusOK,
+			Message: "Vulnerability scans retrieved",
+		},
+		Error: nil,
+	})
+}
+
+// GetScan is a controller function to get a vulnerability scan with its findings
+func GetScan(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	scanID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		s := err.Error()
+		return c.Status(fiber.StatusBadRequest).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusBadRequest,
+				Message: "Invalid scan ID",
+			},
+			Error: &s,
+		})
+	}
+
+	response, serviceErr := service.GetScan(currentUser.ID, scanID)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    fiber.StatusOK,
+			Message: "Vulnerability scan retrieved",
+		},
+		Error: nil,
+	})
+}
+
+// GetDatabase is a controller function to describe the vulnerability database snapshot
+func GetDatabase(c *fiber.Ctx) error {
+	if _, ok := c.Locals("user").(*users.User); !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	response, serviceErr := service.GetDatabaseStatus()
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    fiber.StatusOK,
+			Message: "Vulnerability database retrieved",
+		},
+		Error: nil,
+	})
+}
+
+// ImportDatabase is a controller function to replace the vulnerability database with an uploaded
+// OSV archive (multipart field "archive", optional "ecosystem")
+func ImportDatabase(c *fiber.Ctx) error {
+	currentUser, ok := c.Locals("user").(*users.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusUnauthorized,
+				Message: "Unauthorized",
+			},
+			Error: nil,
+		})
+	}
+
+	if serviceErr := service.AuthorizeDatabaseImport(currentUser.ID); serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	// The body is streamed past the global limit; its declared length bounds what is read
+	length := c.Request().Header.ContentLength()
+	if length < 0 {
+		return c.Status(fiber.StatusLengthRequired).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusLengthRequired,
+				Message: "the upload needs a Content-Length",
+			},
+			Error: nil,
+		})
+	}
+	if length > service.MaxArchiveBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusRequestEntityTooLarge,
+				Message: fmt.Sprintf("the archive must not exceed %d MiB", service.MaxArchiveBytes/(1024*1024)),
+			},
+			Error: nil,
+		})
+	}
+
+	header, err := c.FormFile("archive")
+	if err != nil {
+		s := err.Error()
+		return c.Status(fiber.StatusBadRequest).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusBadRequest,
+				Message: "an OSV archive is required in the archive field",
+			},
+			Error: &s,
+		})
+	}
+	archive, err := header.Open()
+	if err != nil {
+		s := err.Error()
+		return c.Status(fiber.StatusInternalServerError).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    fiber.StatusInternalServerError,
+				Message: "failed to read the archive",
+			},
+			Error: &s,
+		})
+	}
+	defer archive.Close()
+
+	response, serviceErr := service.ImportDatabase(currentUser.ID, c.FormValue("ecosystem"), header.Filename, archive, header.Size)
+	if serviceErr != nil {
+		s := serviceErr.Err.Error()
+		errStr := &s
+		return c.Status(serviceErr.StatusCode).JSON(interfaces.Response{
+			Data: nil,
+			Status: interfaces.Status{
+				Code:    serviceErr.StatusCode,
+				Message: serviceErr.Message,
+			},
+			Error: errStr,
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(interfaces.Response{
+		Data: response,
+		Status: interfaces.Status{
+			Code:    fiber.StatusCreated,
+			Message: "Vulnerability database imported",
+		},
+		Error: nil,
+	})
+}
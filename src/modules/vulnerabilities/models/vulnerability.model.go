@@ -0,0 +1,51 @@
+package vulnerabilities
+
+import (
+	projects "deva/src/modules/projects/models"
+	users "deva/src/modules/users/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// VulnerabilityScan is a check of the dependencies of a project against the OSV snapshot
+type VulnerabilityScan struct {
+	ID              uuid.UUID        `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ProjectID       uuid.UUID        `gorm:"type:uuid;not null;index"`
+	Project         projects.Project `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:ProjectID;references:ID"`
+	Trigger         string           `gorm:"not null"`            // "generation", "update" or "manual"
+	Status          string           `gorm:"not null"`            // "completed", "skipped" or "failed"
+	Ecosystems      string           `gorm:"not null;default:''"` // Comma separated, e.g. "Go,npm"
+	PackagesScanned int              `gorm:"not null;default:0"`
+	Critical        int              `gorm:"not null;default:0"`
+	High            int              `gorm:"not null;default:0"`
+	Medium          int              `gorm:"not null;default:0"`
+	Low             int              `gorm:"not null;default:0"`
+	Unknown         int              `gorm:"not null;default:0"`
+	Findings        string           `gorm:"type:jsonb;not null;default:'[]'"` // A list of osv.Finding
+	Error           string
+	// DatabaseRecords is the size of the OSV snapshot the scan ran against
+	DatabaseRecords int       `gorm:"not null;default:0"`
+	CreatedBy       uuid.UUID `gorm:"type:uuid;not null"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+}
+
+// VulnerabilityDatabaseImport is the audit record of an OSV snapshot upload
+type VulnerabilityDatabaseImport struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	Ecosystem      string     `gorm:"not null;index"` // "Go", "npm" or "all"
+	Filename       string     `gorm:"not null"`
+	SHA256         string     `gorm:"column:sha256;not null"`
+	Records        int        `gorm:"not null"`
+	UploadedBy     uuid.UUID  `gorm:"type:uuid;not null"`
+	UploadedByUser users.User `gorm:"foreignKey:UploadedBy;references:ID"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime"`
+}
+
+func MigrateVulnerabilityScans(db *gorm.DB) error {
+	return db.AutoMigrate(&VulnerabilityScan{})
+}
+
+func MigrateVulnerabilityDatabaseImports(db *gorm.DB) error {
+	return db.AutoMigrate(&VulnerabilityDatabaseImport{})
+}
@@ -0,0 +1,225 @@
+package vulnerabilities
+
+import (
+	"crypto/sha256"
+	"deva/src/config"
+	"deva/src/lib/osv"
+	roles "deva/src/modules/roles/services"
+	vulnerabilities "deva/src/modules/vulnerabilities/models"
+	"deva/src/utils"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultDatabaseDir holds the OSV snapshot when OSV_DB_DIR is not set
+const DefaultDatabaseDir = "data/osv"
+
+// MaxArchiveBytes bounds an uploaded OSV archive
+const MaxArchiveBytes = 256 * 1024 * 1024
+
+// DatabaseAll is the snapshot of an archive covering several ecosystems
+const DatabaseAll = "all"
+
+var databaseEcosystems = []string{osv.EcosystemGo, osv.EcosystemNpm, DatabaseAll}
+
+var (
+	databaseMutex sync.Mutex
+	database      *osv.Database
+)
+
+// AuthorizeDatabaseImport checks that the user may refresh the database, before the archive is read
+func AuthorizeDatabaseImport(userID uuid.UUID) *utils.ServiceError {
+	if role, err := roles.GetRoleByUserID(userID); err != nil || role.Name != "admin" {
+		return &utils.ServiceError{
+			StatusCode: http.StatusForbidden,
+			Message:    "only admins can refresh the vulnerability database",
+			Err:        errors.New("vulnerability database import by a non-admin"),
+		}
+	}
+	return nil
+}
+
+// ImportDatabase replaces the OSV snapshot of an ecosystem with the records of an archive. Only
+// admins may refresh the database.
+func ImportDatabase(userID uuid.UUID, ecosystem, filename string, archive io.ReaderAt, size int64) (map[string]interface{}, *utils.ServiceError) {
+	if serviceErr := AuthorizeDatabaseImport(userID); serviceErr != nil {
+		return nil, serviceErr
+	}
+	if ecosystem == "" {
+		ecosystem = DatabaseAll
+	}
+	if !contains(databaseEcosystems, ecosystem) {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("ecosystem must be one of %v", databaseEcosystems),
+			Err:        fmt.Errorf("invalid ecosystem %q", ecosystem),
+		}
+	}
+
+	checksum := sha256.New()
+	if _, err := io.Copy(checksum, io.NewSectionReader(archive, 0, size)); err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "failed to read the archive",
+			Err:        err,
+		}
+	}
+
+	// Extract next to the live snapshot and swap directories, so scans never see half an import
+	target := filepath.Join(databaseDir(), ecosystem)
+	if err := os.MkdirAll(databaseDir(), 0755); err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to prepare the vulnerability database",
+			Err:        err,
+		}
+	}
+	staging, err := os.MkdirTemp(databaseDir(), ecosystem+".import-")
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to prepare the vulnerability database",
+			Err:        err,
+		}
+	}
+	records, err := osv.Extract(archive, size, staging)
+	if err == nil && records == 0 {
+		err = errors.New("the archive contains no OSV records")
+	}
+	if err != nil {
+		os.RemoveAll(staging)
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusUnprocessableEntity,
+			Message:    "invalid OSV archive",
+			Err:        err,
+		}
+	}
+
+	databaseMutex.Lock()
+	defer databaseMutex.Unlock()
+	previous := staging + ".previous"
+	if err := os.Rename(target, previous); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(staging)
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to replace the vulnerability database",
+			Err:        err,
+		}
+	}
+	if err := os.Rename(staging, target); err != nil {
+		os.Rename(previous, target)
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to replace the vulnerability database",
+			Err:        err,
+		}
+	}
+	os.RemoveAll(previous)
+	database = nil
+
+	record := vulnerabilities.VulnerabilityDatabaseImport{
+		Ecosystem:  ecosystem,
+		Filename:   filepath.Base(filename),
+		SHA256:     hex.EncodeToString(checksum.Sum(nil)),
+		Records:    records,
+		UploadedBy: userID,
+	}
+	if err := config.DB.Create(&record).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return toDatabaseImportResponse(record), nil
+}
+
+// GetDatabaseStatus returns the loaded snapshot size and the latest import of each ecosystem
+func GetDatabaseStatus() (map[string]interface{}, *utils.ServiceError) {
+	db, err := loadDatabase()
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to load the vulnerability database",
+			Err:        err,
+		}
+	}
+
+	imports := []map[string]interface{}{}
+	for _, ecosystem := range databaseEcosystems {
+		var record vulnerabilities.VulnerabilityDatabaseImport
+		err := config.DB.Where("ecosystem = ?", ecosystem).Order("created_at DESC").First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "DB error",
+				Err:        err,
+			}
+		}
+		imports = append(imports, toDatabaseImportResponse(record))
+	}
+	return map[string]interface{}{
+		"records": db.Records,
+		"imports": imports,
+	}, nil
+}
+
+// Helper Functions
+func databaseDir() string {
+	if dir := os.Getenv("OSV_DB_DIR"); dir != "" {
+		return dir
+	}
+	return DefaultDatabaseDir
+}
+
+// loadDatabase reads the snapshot once and keeps it until the next import
+func loadDatabase() (*osv.Database, error) {
+	databaseMutex.Lock()
+	defer databaseMutex.Unlock()
+	if database != nil {
+		return database, nil
+	}
+
+	dirs := make([]string, 0, len(databaseEcosystems))
+	for _, ecosystem := range databaseEcosystems {
+		dirs = append(dirs, filepath.Join(databaseDir(), ecosystem))
+	}
+	db, err := osv.Load(dirs...)
+	if err != nil {
+		return nil, err
+	}
+	database = db
+	return database, nil
+}
+
+func toDatabaseImportResponse(record vulnerabilities.VulnerabilityDatabaseImport) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          record.ID,
+		"ecosystem":   record.Ecosystem,
+		"filename":    record.Filename,
+		"sha256":      record.SHA256,
+		"records":     record.Records,
+		"uploaded_by": record.UploadedBy,
+		"created_at":  record.CreatedAt,
+	}
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package vulnerabilities
+
+import (
+	"deva/src/config"
+	"deva/src/lib/gomod"
+	"deva/src/lib/osv"
+	deployments "deva/src/modules/deployments/services"
+	projects "deva/src/modules/projects/models"
+	vulnerabilities "deva/src/modules/vulnerabilities/models"
+	"deva/src/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+)
+
+// Scan triggers
+const (
+	TriggerGeneration = "generation"
+	TriggerUpdate     = "update"
+	TriggerManual     = "manual"
+)
+
+// Scan statuses
+const (
+	ScanCompleted = "completed"
+	ScanSkipped   = "skipped"
+	ScanFailed    = "failed"
+)
+
+// ScanProject checks the stored go.mod and package-lock.json of a project against the OSV
+// snapshot and stores the result. Problems with the project files or the database are recorded
+// on the scan; the error is only set when the scan could not be stored.
+func ScanProject(projectID, userID uuid.UUID, trigger string) (*vulnerabilities.VulnerabilityScan, error) {
+	scan := vulnerabilities.VulnerabilityScan{
+		ProjectID: projectID,
+		Trigger:   trigger,
+		Status:    ScanCompleted,
+		Findings:  "[]",
+		CreatedBy: userID,
+	}
+
+	packages, ecosystems, err := projectPackages(projectID)
+	db, dbErr := loadDatabase()
+	switch {
+	case err != nil:
+		scan.Status, scan.Error = ScanFailed, err.Error()
+	case dbErr != nil:
+		scan.Status, scan.Error = ScanFailed, "failed to load the vulnerability database: "+dbErr.Error()
+	case len(ecosystems) == 0:
+		scan.Status, scan.Error = ScanSkipped, "the project has no go.mod or package-lock.json"
+	case db.Records == 0:
+		scan.Status, scan.Error = ScanSkipped, "the vulnerability database is empty; an admin has to upload an OSV archive"
+	default:
+		findings := osv.Scan(db, packages)
+		encoded, err := json.Marshal(findings)
+		if err != nil {
+			return nil, err
+		}
+		summary := osv.Summarize(findings)
+		scan.Findings = string(encoded)
+		scan.Critical = summary[osv.SeverityCritical]
+		scan.High = summary[osv.SeverityHigh]
+		scan.Medium = summary[osv.SeverityMedium]
+		scan.Low = summary[osv.SeverityLow]
+		scan.Unknown = summary[osv.SeverityUnknown]
+	}
+	scan.Ecosystems = strings.Join(ecosystems, ",")
+	scan.PackagesScanned = len(packages)
+	if db != nil {
+		scan.DatabaseRecords = db.Records
+	}
+
+	if err := config.DB.Create(&scan).Error; err != nil {
+		return nil, err
+	}
+	return &scan, nil
+}
+
+// RunProjectScan scans a project on behalf of the user
+func RunProjectScan(userID, projectID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	project, serviceErr := deployments.GetAccessibleProject(userID, projectID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	scan, err := ScanProject(project.ID, userID, TriggerManual)
+	if err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to store the scan",
+			Err:        err,
+		}
+	}
+	return toScanResponse(*scan, true), nil
+}
+
+// ListProjectScans returns the scans of a project, newest first, without their findings
+func ListProjectScans(userID, projectID uuid.UUID, limit, offset int) ([]map[string]interface{}, *utils.ServiceError) {
+	if _, serviceErr := deployments.GetAccessibleProject(userID, projectID); serviceErr != nil {
+		return nil, serviceErr
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var scans []vulnerabilities.VulnerabilityScan
+	if err := config.DB.Omit("findings").
+		Where("project_id = ?", projectID).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&scans).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	response := make([]map[string]interface{}, 0, len(scans))
+	for _, scan := range scans {
+		response = append(response, toScanResponse(scan, false))
+	}
+	return response, nil
+}
+
+// GetScan returns a scan with its findings
+func GetScan(userID, scanID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	var scan vulnerabilities.VulnerabilityScan
+	if err := config.DB.First(&scan, "id = ?", scanID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "scan not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	if _, serviceErr := deployments.GetAccessibleProject(userID, scan.ProjectID); serviceErr != nil {
+		return nil, serviceErr
+	}
+	return toScanResponse(scan, true), nil
+}
+
+// Helper Functions
+
+// projectPackages reads the dependencies of the latest stored go.mod and package-lock.json
+func projectPackages(projectID uuid.UUID) ([]osv.Package, []string, error) {
+	var stored []projects.ProjectFile
+	if err := config.DB.Where("project_id = ? AND path IN ?", projectID, []string{"go.mod", "package-lock.json"}).
+		Order("updated_at DESC").Find(&stored).Error; err != nil {
+		return nil, nil, err
+	}
+	files := map[string][]byte{}
+	for _, file := range stored {
+		if _, seen := files[file.Path]; !seen {
+			files[file.Path] = []byte(file.Content)
+		}
+	}
+
+	var packages []osv.Package
+	var ecosystems []string
+	if content, ok := files["go.mod"]; ok {
+		manifest, err := gomod.Parse(content, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid go.mod: %w", err)
+		}
+		packages = append(packages, osv.GoPackages(manifest)...)
+		ecosystems = append(ecosystems, osv.EcosystemGo)
+	}
+	if content, ok := files["package-lock.json"]; ok {
+		npmPackages, err := osv.NpmPackages(content)
+		if err != nil {
+			return nil, nil, err
+		}
+		packages = append(packages, npmPackages...)
+		ecosystems = append(ecosystems, osv.EcosystemNpm)
+	}
+	return packages, ecosystems, nil
+}
+
+func toScanResponse(scan vulnerabilities.VulnerabilityScan, withFindings bool) map[string]interface{} {
+	ecosystems := []string{}
+	if scan.Ecosystems != "" {
+		ecosystems = strings.Split(scan.Ecosystems, ",")
+	}
+	response := map[string]interface{}{
+		"id":               scan.ID,
+		"project_id":       scan.ProjectID,
+		"trigger":          scan.Trigger,
+		"status":           scan.Status,
+		"error":            scan.Error,
+		"ecosystems":       ecosystems,
+		"packages_scanned": scan.PackagesScanned,
+		"database_records": scan.DatabaseRecords,
+		"summary": map[string]int{
+			osv.SeverityCritical: scan.Critical,
+			osv.SeverityHigh:     scan.High,
+			osv.SeverityMedium:   scan.Medium,
+			osv.SeverityLow:      scan.Low,
+			osv.SeverityUnknown:  scan.Unknown,
+		},
+		"created_by": scan.CreatedBy,
+		"created_at": scan.CreatedAt,
+	}
+	if withFindings {
+		findings := []osv.Finding{}
+		if err := json.Unmarshal([]byte(scan.Findings), &findings); err != nil {
+			findings = []osv.Finding{}
+		}
+		response["findings"] = findings
+	}
+	return response
+}
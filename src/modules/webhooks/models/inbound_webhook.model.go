@@ -0,0 +1,53 @@
+package webhooks
+
+import (
+	projects "deva/src/modules/projects/models"
+	users "deva/src/modules/users/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// InboundWebhook receives Git push deliveries for a project and maps them to actions through
+// its rules. A project has at most one.
+type InboundWebhook struct {
+	ID              uuid.UUID        `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ProjectID       uuid.UUID        `gorm:"type:uuid;not null;uniqueIndex"`
+	Project         projects.Project `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:ProjectID;references:ID;"`
+	SecretEncrypted string           `gorm:"not null"`                         // HMAC secret, or the GitLab token
+	Rules           string           `gorm:"type:jsonb;not null;default:'[]'"` // Event filters and the actions they run
+	IsActive        bool             `gorm:"not null;default:true"`
+	CreatedBy       uuid.UUID        `gorm:"type:uuid;not null"`
+	UpdatedBy       uuid.UUID        `gorm:"type:uuid;not null"` // Actions run on behalf of this user
+	UpdatedByUser   users.User       `gorm:"foreignKey:UpdatedBy;references:ID"`
+	CreatedAt       time.Time        `gorm:"autoCreateTime"`
+	UpdatedAt       time.Time        `gorm:"autoUpdateTime"`
+}
+
+// WebhookDelivery records one request to an inbound webhook and what it triggered
+type WebhookDelivery struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	WebhookID  uuid.UUID      `gorm:"type:uuid;not null;index"`
+	Webhook    InboundWebhook `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:WebhookID;references:ID;"`
+	ProjectID  uuid.UUID      `gorm:"type:uuid;not null;index"`
+	Provider   string         // "github", "gitlab" or "gitea"
+	Event      string         // Event name sent by the provider
+	DeliveryID string         `gorm:"index"` // Delivery ID sent by the provider
+	Ref        string
+	CommitSHA  string
+	Status     string `gorm:"not null"` // "processed", "ignored", "rejected", "failed"
+	StatusCode int    `gorm:"not null"` // Response code returned to the provider
+	Message    string
+	Actions    string    `gorm:"type:jsonb;not null;default:'[]'"`
+	Headers    string    `gorm:"type:jsonb;not null;default:'{}'"`
+	Payload    string    `gorm:"type:text"` // Empty for deliveries that failed verification
+	CreatedAt  time.Time `gorm:"autoCreateTime;index"`
+}
+
+func MigrateInboundWebhooks(db *gorm.DB) error {
+	return db.AutoMigrate(&InboundWebhook{})
+}
+
+func MigrateWebhookDeliveries(db *gorm.DB) error {
+	return db.AutoMigrate(&WebhookDelivery{})
+}
@@ -0,0 +1,337 @@
+package webhooks
+
+import (
+	"deva/src/config"
+	"deva/src/lib/dto"
+	"deva/src/lib/githooks"
+	ci "deva/src/modules/ci/services"
+	deployments "deva/src/modules/deployments/services"
+	webhooks "deva/src/modules/webhooks/models"
+	"deva/src/services"
+	"deva/src/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Delivery statuses
+const (
+	DeliveryProcessed = "processed"
+	DeliveryIgnored   = "ignored"
+	DeliveryRejected  = "rejected"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	// maxPayloadBytes bounds the deliveries accepted; providers send far smaller push payloads
+	maxPayloadBytes = 5 * 1024 * 1024
+	// maxStoredPayloadBytes bounds the payload kept on a delivery record
+	maxStoredPayloadBytes = 256 * 1024
+	// maxDeliveries is the number of verified deliveries kept per webhook
+	maxDeliveries = 200
+	// maxRejectedDeliveries is the number of rejected deliveries kept per webhook. They are capped
+	// apart, so unverified requests cannot push verified deliveries out of the history.
+	maxRejectedDeliveries = 20
+)
+
+// recordedHeaders are kept on delivery records; signatures and tokens never are
+var recordedHeaders = []string{
+	"Content-Type", "User-Agent",
+	"X-GitHub-Event", "X-GitHub-Delivery", "X-GitHub-Hook-ID",
+	"X-Gitlab-Event", "X-Gitlab-Event-UUID", "X-Gitlab-Webhook-UUID", "X-Gitlab-Instance",
+	"X-Gitea-Event", "X-Gitea-Delivery", "X-Forgejo-Event", "X-Forgejo-Delivery",
+}
+
+// actionResult is what one matched rule did
+type actionResult struct {
+	Rule         int        `json:"rule"`
+	Action       string     `json:"action"`
+	Status       string     `json:"status"` // "triggered" or "failed"
+	PipelineID   *uuid.UUID `json:"pipeline_id,omitempty"`
+	DeploymentID *uuid.UUID `json:"deployment_id,omitempty"`
+	Environment  string     `json:"environment,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// ReceiveGitWebhook handles a delivery to the inbound Git webhook of a project. The delivery is
+// verified against the webhook secret, matched against the rules and recorded with the actions it
+// triggered. Deliveries that fail verification are recorded without their payload.
+func ReceiveGitWebhook(projectID uuid.UUID, header func(string) string, body []byte) (map[string]interface{}, *utils.ServiceError) {
+	webhook, serviceErr := findGitWebhook(projectID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	delivery := webhooks.WebhookDelivery{
+		WebhookID: webhook.ID,
+		ProjectID: webhook.ProjectID,
+		Actions:   "[]",
+		Headers:   recordHeaders(header),
+	}
+	reject := func(statusCode int, message string, err error) (map[string]interface{}, *utils.ServiceError) {
+		delivery.Status, delivery.StatusCode, delivery.Message = DeliveryRejected, statusCode, message
+		saveDelivery(&delivery)
+		return nil, &utils.ServiceError{StatusCode: statusCode, Message: message, Err: err}
+	}
+
+	if len(body) > maxPayloadBytes {
+		return reject(http.StatusRequestEntityTooLarge, "payload too large",
+			fmt.Errorf("payload of %d bytes exceeds %d", len(body), maxPayloadBytes))
+	}
+	detected, err := githooks.Detect(header)
+	if err != nil {
+		return reject(http.StatusBadRequest, err.Error(), err)
+	}
+	delivery.Provider, delivery.Event, delivery.DeliveryID = detected.Provider, detected.Event, detected.ID
+
+	secret, err := services.Decrypt(webhook.SecretEncrypted)
+	if err != nil {
+		log.Printf("⚠️ Failed to decrypt the secret of git webhook %s: %v", webhook.ID, err)
+		return reject(http.StatusInternalServerError, "webhook secret unavailable", err)
+	}
+	if err := githooks.Verify(detected, header, body, string(secret)); err != nil {
+		return reject(http.StatusUnauthorized, err.Error(), err)
+	}
+
+	// Only verified payloads are kept
+	stored := body
+	if len(stored) > maxStoredPayloadBytes {
+		stored = stored[:maxStoredPayloadBytes]
+	}
+	delivery.Payload = strings.ToValidUTF8(strings.ReplaceAll(string(stored), "\x00", ""), "")
+	finish := func(status string, statusCode int, message string) map[string]interface{} {
+		delivery.Status, delivery.StatusCode, delivery.Message = status, statusCode, message
+		saveDelivery(&delivery)
+		return toDeliveryResponse(delivery, false)
+	}
+
+	if !webhook.IsActive {
+		return finish(DeliveryIgnored, http.StatusOK, "webhook is disabled"), nil
+	}
+	if detected.ID != "" {
+		var previous webhooks.WebhookDelivery
+		err := config.DB.Select("id").
+			Where("webhook_id = ? AND delivery_id = ? AND status = ?", webhook.ID, detected.ID, DeliveryProcessed).
+			First(&previous).Error
+		if err == nil {
+			return finish(DeliveryIgnored, http.StatusOK, fmt.Sprintf("duplicate of delivery %s", previous.ID)), nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("⚠️ Failed to look up delivery %s of git webhook %s: %v", detected.ID, webhook.ID, err)
+		}
+	}
+	if detected.IsPing() {
+		return finish(DeliveryIgnored, http.StatusOK, "ping received"), nil
+	}
+	if !detected.IsPush() {
+		return finish(DeliveryIgnored, http.StatusOK, fmt.Sprintf("%s events are not handled", detected.Event)), nil
+	}
+
+	push, err := githooks.ParsePush(detected, body)
+	if err != nil {
+		finish(DeliveryFailed, http.StatusBadRequest, err.Error())
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "invalid push payload",
+			Err:        err,
+		}
+	}
+	delivery.Ref, delivery.CommitSHA = push.Ref, push.CommitSHA
+	if push.Deleted {
+		return finish(DeliveryIgnored, http.StatusOK, fmt.Sprintf("%s was deleted", push.Ref)), nil
+	}
+
+	results := runRules(webhook, push)
+	if encoded, err := json.Marshal(results); err == nil {
+		delivery.Actions = string(encoded)
+	}
+	if len(results) == 0 {
+		return finish(DeliveryIgnored, http.StatusOK, fmt.Sprintf("no rule matches %s", push.Ref)), nil
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Status == DeliveryFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return finish(DeliveryFailed, http.StatusOK, fmt.Sprintf("%d of %d actions failed", failed, len(results))), nil
+	}
+	return finish(DeliveryProcessed, http.StatusOK, fmt.Sprintf("%d actions triggered", len(results))), nil
+}
+
+// ListGitWebhookDeliveries returns the recorded deliveries of the inbound Git webhook of a
+// project, newest first and without payloads
+func ListGitWebhookDeliveries(userID, projectID uuid.UUID, limit, offset int) ([]map[string]interface{}, *utils.ServiceError) {
+	if _, serviceErr := deployments.GetAccessibleProject(userID, projectID); serviceErr != nil {
+		return nil, serviceErr
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var deliveries []webhooks.WebhookDelivery
+	if err := config.DB.Omit("payload").
+		Where("project_id = ?", projectID).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&deliveries).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+
+	response := make([]map[string]interface{}, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response = append(response, toDeliveryResponse(delivery, false))
+	}
+	return response, nil
+}
+
+// GetGitWebhookDelivery returns a recorded delivery with its headers and payload
+func GetGitWebhookDelivery(userID, projectID, deliveryID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	if _, serviceErr := deployments.GetAccessibleProject(userID, projectID); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	var delivery webhooks.WebhookDelivery
+	if err := config.DB.First(&delivery, "id = ? AND project_id = ?", deliveryID, projectID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "delivery not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return toDeliveryResponse(delivery, true), nil
+}
+
+// Helper Functions
+// runRules runs the action of every rule the push matches, as the user who last configured the
+// webhook
+func runRules(webhook *webhooks.InboundWebhook, push *githooks.Push) []actionResult {
+	results := []actionResult{}
+	for i, rule := range parseRules(webhook.Rules) {
+		if !matchesRule(rule, push) {
+			continue
+		}
+		result := actionResult{Rule: i + 1, Action: rule.Action, Status: "triggered"}
+
+		var serviceErr *utils.ServiceError
+		switch rule.Action {
+		case ActionPipeline:
+			trigger := ci.TriggerPush
+			if push.Event == githooks.EventTag {
+				trigger = ci.TriggerTag
+			}
+			var pipeline map[string]interface{}
+			pipeline, serviceErr = ci.TriggerPushPipeline(webhook.UpdatedBy, webhook.ProjectID, trigger, push.Name, push.CommitSHA)
+			if serviceErr == nil {
+				if id, ok := pipeline["id"].(uuid.UUID); ok {
+					result.PipelineID = &id
+				}
+			}
+		case ActionDeploy:
+			result.Environment = rule.Environment
+			var deployment map[string]interface{}
+			deployment, _, serviceErr = deployments.CreateDeployment(webhook.UpdatedBy, webhook.ProjectID, dto.CreateDeploymentRequest{
+				TargetID:    rule.TargetID,
+				Environment: rule.Environment,
+				Ref:         push.Name,
+			})
+			if serviceErr == nil {
+				if id, ok := deployment["id"].(uuid.UUID); ok {
+					result.DeploymentID = &id
+				}
+			}
+		}
+		if serviceErr != nil {
+			result.Status = DeliveryFailed
+			result.Error = serviceErr.Message
+			log.Printf("⚠️ Rule %d (%s) of git webhook %s failed: %v", i+1, rule.Action, webhook.ID, serviceErr.Err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func recordHeaders(header func(string) string) string {
+	recorded := map[string]string{}
+	for _, name := range recordedHeaders {
+		if value := header(name); value != "" {
+			recorded[name] = value
+		}
+	}
+	encoded, err := json.Marshal(recorded)
+	if err != nil {
+		return "{}"
+	}
+	return string(encoded)
+}
+
+// saveDelivery records a delivery and drops the oldest ones beyond maxDeliveries, or beyond
+// maxRejectedDeliveries among the rejected ones. Failing to record does not fail the delivery.
+func saveDelivery(delivery *webhooks.WebhookDelivery) {
+	if err := config.DB.Create(delivery).Error; err != nil {
+		log.Printf("⚠️ Failed to record delivery of git webhook %s: %v", delivery.WebhookID, err)
+		return
+	}
+	statusFilter, keep := "status <> ?", maxDeliveries
+	if delivery.Status == DeliveryRejected {
+		statusFilter, keep = "status = ?", maxRejectedDeliveries
+	}
+	err := config.DB.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ? AND `+statusFilter+` AND id NOT IN (
+		SELECT id FROM webhook_deliveries WHERE webhook_id = ? AND `+statusFilter+` ORDER BY created_at DESC LIMIT ?)`,
+		delivery.WebhookID, DeliveryRejected, delivery.WebhookID, DeliveryRejected, keep).Error
+	if err != nil {
+		log.Printf("⚠️ Failed to prune deliveries of git webhook %s: %v", delivery.WebhookID, err)
+	}
+}
+
+func toDeliveryResponse(d webhooks.WebhookDelivery, detailed bool) map[string]interface{} {
+	actions := []actionResult{}
+	if err := json.Unmarshal([]byte(d.Actions), &actions); err != nil {
+		actions = []actionResult{}
+	}
+	response := map[string]interface{}{
+		"id":          d.ID,
+		"webhook_id":  d.WebhookID,
+		"project_id":  d.ProjectID,
+		"provider":    d.Provider,
+		"event":       d.Event,
+		"delivery_id": d.DeliveryID,
+		"ref":         d.Ref,
+		"commit_sha":  d.CommitSHA,
+		"status":      d.Status,
+		"status_code": d.StatusCode,
+		"message":     d.Message,
+		"actions":     actions,
+		"created_at":  d.CreatedAt,
+	}
+	if detailed {
+		headers := map[string]string{}
+		if err := json.Unmarshal([]byte(d.Headers), &headers); err != nil {
+			headers = map[string]string{}
+		}
+		response["headers"] = headers
+		response["payload"] = d.Payload
+	}
+	return response
+}
@@ -0,0 +1,259 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"deva/src/config"
+	"deva/src/lib/dto"
+	"deva/src/lib/githooks"
+	deployments "deva/src/modules/deployments/services"
+	webhooks "deva/src/modules/webhooks/models"
+	"deva/src/services"
+	"deva/src/utils"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Rule actions
+const (
+	ActionPipeline = "pipeline"
+	ActionDeploy   = "deploy"
+)
+
+const (
+	maxRules          = 20
+	maxRuleFilters    = 20
+	defaultDeployEnv  = "staging"
+	webhookSecretSize = 32
+)
+
+var environmentPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ConfigureGitWebhook creates the inbound Git webhook of a project, or updates its rules and state.
+// The secret is only returned when it is issued: on creation and on rotation.
+func ConfigureGitWebhook(userID, projectID uuid.UUID, request dto.ConfigureGitWebhookRequest) (map[string]interface{}, *utils.ServiceError) {
+	if _, serviceErr := deployments.GetAccessibleProject(userID, projectID); serviceErr != nil {
+		return nil, serviceErr
+	}
+
+	webhook, serviceErr := findGitWebhook(projectID)
+	if serviceErr != nil && serviceErr.StatusCode != http.StatusNotFound {
+		return nil, serviceErr
+	}
+	created := webhook == nil
+	if created {
+		webhook = &webhooks.InboundWebhook{ProjectID: projectID, Rules: "[]", IsActive: true, CreatedBy: userID}
+	}
+
+	if request.Rules != nil {
+		rules, err := normalizeRules(*request.Rules)
+		if err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusBadRequest,
+				Message:    err.Error(),
+				Err:        err,
+			}
+		}
+		encoded, err := json.Marshal(rules)
+		if err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "failed to encode webhook rules",
+				Err:        err,
+			}
+		}
+		webhook.Rules = string(encoded)
+	}
+	if request.IsActive != nil {
+		webhook.IsActive = *request.IsActive
+	}
+
+	var secret string
+	if created || request.RotateSecret {
+		var err error
+		if secret, err = generateWebhookSecret(); err == nil {
+			webhook.SecretEncrypted, err = services.Encrypt([]byte(secret))
+		}
+		if err != nil {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "failed to generate webhook secret",
+				Err:        err,
+			}
+		}
+	}
+	webhook.UpdatedBy = userID
+
+	if err := config.DB.Save(webhook).Error; err != nil {
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to save webhook",
+			Err:        err,
+		}
+	}
+
+	response := toGitWebhookResponse(*webhook)
+	if secret != "" {
+		response["secret"] = secret
+	}
+	return response, nil
+}
+
+// GetGitWebhook returns the inbound Git webhook of a project, without its secret
+func GetGitWebhook(userID, projectID uuid.UUID) (map[string]interface{}, *utils.ServiceError) {
+	if _, serviceErr := deployments.GetAccessibleProject(userID, projectID); serviceErr != nil {
+		return nil, serviceErr
+	}
+	webhook, serviceErr := findGitWebhook(projectID)
+	if serviceErr != nil {
+		return nil, serviceErr
+	}
+	return toGitWebhookResponse(*webhook), nil
+}
+
+// DeleteGitWebhook removes the inbound Git webhook of a project with its recorded deliveries
+func DeleteGitWebhook(userID, projectID uuid.UUID) *utils.ServiceError {
+	if _, serviceErr := deployments.GetAccessibleProject(userID, projectID); serviceErr != nil {
+		return serviceErr
+	}
+	webhook, serviceErr := findGitWebhook(projectID)
+	if serviceErr != nil {
+		return serviceErr
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&webhooks.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(webhook).Error
+	})
+	if err != nil {
+		return &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "failed to delete webhook",
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// Helper Functions
+func findGitWebhook(projectID uuid.UUID) (*webhooks.InboundWebhook, *utils.ServiceError) {
+	var webhook webhooks.InboundWebhook
+	if err := config.DB.First(&webhook, "project_id = ?", projectID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ServiceError{
+				StatusCode: http.StatusNotFound,
+				Message:    "webhook not found",
+				Err:        err,
+			}
+		}
+		return nil, &utils.ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "DB error",
+			Err:        err,
+		}
+	}
+	return &webhook, nil
+}
+
+func normalizeRules(rules []dto.GitWebhookRule) ([]dto.GitWebhookRule, error) {
+	if len(rules) > maxRules {
+		return nil, fmt.Errorf("at most %d rules are allowed", maxRules)
+	}
+	normalized := make([]dto.GitWebhookRule, 0, len(rules))
+	for i, rule := range rules {
+		rule.Event = strings.ToLower(strings.TrimSpace(rule.Event))
+		if rule.Event != githooks.EventPush && rule.Event != githooks.EventTag {
+			return nil, fmt.Errorf("rule %d: event must be %q or %q", i+1, githooks.EventPush, githooks.EventTag)
+		}
+
+		if len(rule.Filters) > maxRuleFilters {
+			return nil, fmt.Errorf("rule %d: at most %d filters are allowed", i+1, maxRuleFilters)
+		}
+		filters := []string{}
+		for _, filter := range rule.Filters {
+			filter = strings.TrimSpace(filter)
+			if filter == "" {
+				continue
+			}
+			if _, err := path.Match(filter, ""); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid filter %q", i+1, filter)
+			}
+			filters = append(filters, filter)
+		}
+		rule.Filters = filters
+
+		rule.Action = strings.ToLower(strings.TrimSpace(rule.Action))
+		switch rule.Action {
+		case ActionPipeline:
+			rule.Environment, rule.TargetID = "", uuid.Nil
+		case ActionDeploy:
+			rule.Environment = strings.ToLower(strings.TrimSpace(rule.Environment))
+			if rule.Environment == "" {
+				rule.Environment = defaultDeployEnv
+			}
+			if !environmentPattern.MatchString(rule.Environment) {
+				return nil, fmt.Errorf("rule %d: invalid environment %q", i+1, rule.Environment)
+			}
+		default:
+			return nil, fmt.Errorf("rule %d: action must be %q or %q", i+1, ActionPipeline, ActionDeploy)
+		}
+		normalized = append(normalized, rule)
+	}
+	return normalized, nil
+}
+
+func parseRules(raw string) []dto.GitWebhookRule {
+	rules := []dto.GitWebhookRule{}
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return []dto.GitWebhookRule{}
+	}
+	return rules
+}
+
+// matchesRule reports whether a push selects a rule; rules without filters select every push of
+// their event
+func matchesRule(rule dto.GitWebhookRule, push *githooks.Push) bool {
+	if rule.Event != push.Event {
+		return false
+	}
+	if len(rule.Filters) == 0 {
+		return true
+	}
+	for _, filter := range rule.Filters {
+		if ok, _ := path.Match(filter, push.Name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func generateWebhookSecret() (string, error) {
+	secretBytes := make([]byte, webhookSecretSize)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secretBytes), nil
+}
+
+func toGitWebhookResponse(w webhooks.InboundWebhook) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         w.ID,
+		"project_id": w.ProjectID,
+		"url":        fmt.Sprintf("/api/v1/hooks/git/%s", w.ProjectID),
+		"rules":      parseRules(w.Rules),
+		"is_active":  w.IsActive,
+		"created_by": w.CreatedBy,
+		"updated_by": w.UpdatedBy,
+		"created_at": w.CreatedAt,
+		"updated_at": w.UpdatedAt,
+	}
+}
@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"deva/src/lib/dto"
+	"deva/src/lib/githooks"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []dto.GitWebhookRule
+		want    []dto.GitWebhookRule
+		wantErr string
+	}{
+		{
+			name: "pipeline and deploy rules",
+			rules: []dto.GitWebhookRule{
+				{Event: " Push ", Filters: []string{"main", " ", "release/*"}, Action: "PIPELINE", Environment: "prod"},
+				{Event: "tag", Filters: []string{"v*"}, Action: "deploy"},
+				{Event: "push", Action: "deploy", Environment: " Production "},
+			},
+			want: []dto.GitWebhookRule{
+				{Event: githooks.EventPush, Filters: []string{"main", "release/*"}, Action: ActionPipeline},
+				{Event: githooks.EventTag, Filters: []string{"v*"}, Action: ActionDeploy, Environment: defaultDeployEnv},
+				{Event: githooks.EventPush, Filters: []string{}, Action: ActionDeploy, Environment: "production"},
+			},
+		},
+		{"unknown event", []dto.GitWebhookRule{{Event: "merge", Action: ActionPipeline}}, nil, "rule 1: event"},
+		{"unknown action", []dto.GitWebhookRule{{Event: "push", Action: "notify"}}, nil, "rule 1: action"},
+		{"invalid filter", []dto.GitWebhookRule{{Event: "push", Filters: []string{"release/["}, Action: ActionPipeline}}, nil, "invalid filter"},
+		{"invalid environment", []dto.GitWebhookRule{{Event: "push", Action: ActionDeploy, Environment: "prod env"}}, nil, "invalid environment"},
+		{"too many filters", []dto.GitWebhookRule{{Event: "push", Filters: make([]string, maxRuleFilters+1), Action: ActionPipeline}}, nil, "filters"},
+		{"too many rules", make([]dto.GitWebhookRule, maxRules+1), nil, "rules are allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeRules(tt.rules)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("normalizeRules() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeRules() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("normalizeRules() = %+v", got)
+			}
+			for i := range got {
+				if got[i].Event != tt.want[i].Event || got[i].Action != tt.want[i].Action || got[i].Environment != tt.want[i].Environment ||
+					strings.Join(got[i].Filters, ",") != strings.Join(tt.want[i].Filters, ",") {
+					t.Errorf("rule %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMatchesRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule dto.GitWebhookRule
+		push githooks.Push
+		want bool
+	}{
+		{"no filters", dto.GitWebhookRule{Event: githooks.EventPush}, githooks.Push{Event: githooks.EventPush, Name: "anything"}, true},
+		{"other event", dto.GitWebhookRule{Event: githooks.EventTag}, githooks.Push{Event: githooks.EventPush, Name: "main"}, false},
+		{"exact branch", dto.GitWebhookRule{Event: githooks.EventPush, Filters: []string{"main"}}, githooks.Push{Event: githooks.EventPush, Name: "main"}, true},
+		{"other branch", dto.GitWebhookRule{Event: githooks.EventPush, Filters: []string{"main"}}, githooks.Push{Event: githooks.EventPush, Name: "mainline"}, false},
+		{"glob", dto.GitWebhookRule{Event: githooks.EventPush, Filters: []string{"main", "release/*"}}, githooks.Push{Event: githooks.EventPush, Name: "release/1.2"}, true},
+		{"glob stays in a segment", dto.GitWebhookRule{Event: githooks.EventPush, Filters: []string{"release/*"}}, githooks.Push{Event: githooks.EventPush, Name: "release/1.2/hotfix"}, false},
+		{"tag glob", dto.GitWebhookRule{Event: githooks.EventTag, Filters: []string{"v[0-9]*"}}, githooks.Push{Event: githooks.EventTag, Name: "v1.0.0"}, true},
+		{"tag glob mismatch", dto.GitWebhookRule{Event: githooks.EventTag, Filters: []string{"v[0-9]*"}}, githooks.Push{Event: githooks.EventTag, Name: "nightly"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesRule(tt.rule, &tt.push); got != tt.want {
+				t.Errorf("matchesRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
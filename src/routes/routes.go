@@ -2,12 +2,18 @@ package routes
 
 import (
 	"deva/src/middlewares"
+	badges "deva/src/modules/badges/controllers"
 	captcha "deva/src/modules/captcha/controllers"
+	ci "deva/src/modules/ci/controllers"
+	deployments "deva/src/modules/deployments/controllers"
 	key_token "deva/src/modules/key_token/controllers"
 	"deva/src/modules/projects/controllers"
+	templates "deva/src/modules/templates/controllers"
 	users "deva/src/modules/users/controllers"
 	verifications "deva/src/modules/verifications/controllers"
 	VideoControllers "deva/src/modules/videos/controllers"
+	vulnerabilities "deva/src/modules/vulnerabilities/controllers"
+	webhooks "deva/src/modules/webhooks/controllers"
 	"deva/src/utils"
 	"github.com/gofiber/fiber/v2"
 )
@@ -51,7 +57,105 @@ func RegisterRoutes(app *fiber.App) {
 	}
 	projectsRoutes := api.Group("projects")
 	{
-		projectsRoutes.Post("create", projects.CreateNewFiberProject)
+		projectsRoutes.Post("create", authMiddleware(), projects.CreateNewFiberProject)
+		projectsRoutes.Get("jobs/:id/logs/stream", authMiddleware(), projects.StreamJobLogs)
+		projectsRoutes.Post("lint", authMiddleware(), projects.LintDockerFiles)
+		projectsRoutes.Get(":id/lint", authMiddleware(), projects.LintProjectFiles)
+		projectsRoutes.Post("go-modules", authMiddleware(), projects.AnalyzeGoModules)
+		projectsRoutes.Get(":id/go-modules", authMiddleware(), projects.AnalyzeProjectGoModules)
+		projectsRoutes.Post(":id/go-modules/upgrade", authMiddleware(), projects.UpgradeProjectGoModules)
+		projectsRoutes.Get(":id/sbom", authMiddleware(), projects.GetProjectSBOM)
+		projectsRoutes.Get(":id/vulnerability-scans", authMiddleware(), vulnerabilities.ListProjectScans)
+		projectsRoutes.Post(":id/vulnerability-scans", authMiddleware(), vulnerabilities.ScanProject)
+		projectsRoutes.Get(":id/pipelines", authMiddleware(), ci.ListProjectPipelines)
+		projectsRoutes.Post(":id/pipelines", authMiddleware(), ci.TriggerProjectPipeline)
+		projectsRoutes.Put(":id/repository", authMiddleware(), ci.SetProjectRepository)
+		projectsRoutes.Get(":id/git-webhook", authMiddleware(), webhooks.GetGitWebhook)
+		projectsRoutes.Put(":id/git-webhook", authMiddleware(), webhooks.ConfigureGitWebhook)
+		projectsRoutes.Delete(":id/git-webhook", authMiddleware(), webhooks.DeleteGitWebhook)
+		projectsRoutes.Get(":id/git-webhook/deliveries", authMiddleware(), webhooks.ListGitWebhookDeliveries)
+		projectsRoutes.Get(":id/git-webhook/deliveries/:delivery_id", authMiddleware(), webhooks.GetGitWebhookDelivery)
+		projectsRoutes.Get(":id/badge-token", authMiddleware(), badges.GetBadgeToken)
+		projectsRoutes.Post(":id/badge-token", authMiddleware(), badges.IssueBadgeToken)
+		projectsRoutes.Delete(":id/badge-token", authMiddleware(), badges.RevokeBadgeToken)
+		projectsRoutes.Get(":id/deployments", authMiddleware(), deployments.ListProjectDeployments)
+		projectsRoutes.Post(":id/deployments", authMiddleware(), authzMiddleware(needPermission["DEPLOYMENT_CREATE"]), deployments.CreateProjectDeployment)
+	}
+
+	pipelinesRoutes := api.Group("pipelines", authMiddleware())
+	{
+		pipelinesRoutes.Get(":id", ci.GetPipeline)
+		pipelinesRoutes.Post(":id/cancel", ci.CancelPipeline)
+		pipelinesRoutes.Post(":id/rerun", ci.RerunPipeline)
+		pipelinesRoutes.Get(":id/steps/:step_id/logs/stream", ci.StreamStepLogs)
+		pipelinesRoutes.Get(":id/artifacts", ci.ListPipelineArtifacts)
+		pipelinesRoutes.Get(":id/artifacts/:name", ci.DownloadPipelineArtifact)
+		pipelinesRoutes.Get(":id/artifacts/:name/*", ci.DownloadPipelineArtifactFile)
+	}
+
+	// Git provider deliveries carry no session; they are verified with the webhook secret
+	hooksRoutes := api.Group("hooks")
+	{
+		hooksRoutes.Post("git/:id", webhooks.ReceiveGitWebhook)
+	}
+
+	// Badges are embedded in READMEs without a session; the project badge token opens them
+	badgesRoutes := api.Group("badges")
+	{
+		badgesRoutes.Get(":token/pipeline.svg", badges.GetPipelineBadge)
+		badgesRoutes.Get(":token/deployment.svg", badges.GetDeploymentBadge)
+	}
+
+	deploymentsRoutes := api.Group("deployments", authMiddleware())
+	{
+		deploymentsRoutes.Get(":id", deployments.GetDeployment)
+		deploymentsRoutes.Get(":id/logs/stream", deployments.StreamDeploymentLogs)
+		deploymentsRoutes.Post(":id/cancel", deployments.CancelDeployment)
+		deploymentsRoutes.Post(":id/rollback", authzMiddleware(needPermission["DEPLOYMENT_CREATE"]), deployments.RollbackDeployment)
+		deploymentsRoutes.Get(":id/approvals", deployments.ListDeploymentApprovals)
+		deploymentsRoutes.Post(":id/approve", authzMiddleware(needPermission["DEPLOYMENT_UPDATE"]), deployments.ApproveDeployment)
+		deploymentsRoutes.Post(":id/reject", authzMiddleware(needPermission["DEPLOYMENT_UPDATE"]), deployments.RejectDeployment)
+	}
+
+	freezeWindowsRoutes := api.Group("freeze-windows", authMiddleware())
+	{
+		freezeWindowsRoutes.Get("", deployments.ListFreezeWindows)
+		freezeWindowsRoutes.Post("", deployments.CreateFreezeWindow)
+		freezeWindowsRoutes.Delete(":id", deployments.DeleteFreezeWindow)
+	}
+
+	approvalPoliciesRoutes := api.Group("approval-policies", authMiddleware())
+	{
+		approvalPoliciesRoutes.Get("", deployments.ListApprovalPolicies)
+		approvalPoliciesRoutes.Post("", deployments.CreateApprovalPolicy)
+		approvalPoliciesRoutes.Delete(":id", deployments.DeleteApprovalPolicy)
+	}
+
+	deploymentTargetsRoutes := api.Group("deployment-targets", authMiddleware())
+	{
+		deploymentTargetsRoutes.Get("", deployments.ListDeploymentTargets)
+		deploymentTargetsRoutes.Post("", deployments.CreateDeploymentTarget)
+		deploymentTargetsRoutes.Get(":id", deployments.GetDeploymentTarget)
+		deploymentTargetsRoutes.Patch(":id", deployments.UpdateDeploymentTarget)
+		deploymentTargetsRoutes.Delete(":id", deployments.DeleteDeploymentTarget)
+		deploymentTargetsRoutes.Post(":id/test", deployments.TestDeploymentTarget)
+	}
+
+	vulnerabilityScansRoutes := api.Group("vulnerability-scans", authMiddleware())
+	{
+		vulnerabilityScansRoutes.Get(":id", vulnerabilities.GetScan)
+	}
+
+	vulnerabilityDatabaseRoutes := api.Group("vulnerability-database", authMiddleware())
+	{
+		vulnerabilityDatabaseRoutes.Get("", vulnerabilities.GetDatabase)
+		vulnerabilityDatabaseRoutes.Post("", vulnerabilities.ImportDatabase)
+	}
+
+	templatesRoutes := api.Group("templates")
+	{
+		templatesRoutes.Get("", templates.ListTemplates)
+		templatesRoutes.Get(":id/schema", templates.GetTemplateSchema)
 	}
 
 	// Testing Routes
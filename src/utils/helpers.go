@@ -205,6 +205,23 @@ loop:
 	return execErr
 }
 
+// RunWithStatus runs an in-process workflow step and reports its result like ExecWithAnimation
+func RunWithStatus(sc *interfaces.SafeConn, msg, action string, run func(sc *interfaces.SafeConn) error) error {
+	startTime := time.Now()
+	err := run(sc)
+	elapsed := time.Since(startTime).Seconds()
+
+	if err != nil {
+		sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("✗ Failed to %s %s (after %.2fs)", action, msg, elapsed)))
+		sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("Error details: %v", err)))
+		return fmt.Errorf("step failed: %w", err)
+	}
+
+	sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("✔ Successfully %s %s", transformAction(action), msg)))
+	sc.SafeWrite(websocket.TextMessage, []byte(fmt.Sprintf("\n⏱️ Step Completed in %.2fs\n", elapsed)))
+	return nil
+}
+
 func transformAction(action string) string {
 	if strings.HasSuffix(action, "ing") {
 		return strings.TrimSuffix(action, "ing") + "ed"
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"bufio"
+	"deva/store"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"time"
+)
+
+const sseHeartbeatInterval = 15 * time.Second
+
+// LastEventID reads the resume position of an SSE client from the Last-Event-ID header, or from
+// the last_event_id query parameter for clients that cannot set headers
+func LastEventID(c *fiber.Ctx) int64 {
+	value := c.Get("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
+
+// StreamEvents writes events as text/event-stream: the backlog first, then live events until the
+// channel closes or the client goes away. A nil channel ends the response after the backlog.
+func StreamEvents(c *fiber.Ctx, backlog []store.Event, live <-chan store.Event, cancel func()) error {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		for _, event := range backlog {
+			writeEvent(w, event)
+		}
+		if err := w.Flush(); err != nil || live == nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case event, ok := <-live:
+				if !ok {
+					return
+				}
+				writeEvent(w, event)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				// The client disconnected
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Helper Functions
+func writeEvent(w *bufio.Writer, event store.Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
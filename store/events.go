@@ -0,0 +1,180 @@
+package store
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+// Event types of an event stream
+const (
+	EventLog    = "log"
+	EventStatus = "status"
+)
+
+const (
+	maxStreamEvents = 5000
+	// Finished streams stay available for late subscribers and Last-Event-ID resumes
+	streamRetention = 10 * time.Minute
+)
+
+// Event is one entry of an event stream. IDs increase by one per stream, starting at 1, and
+// Data is a JSON document: {"message": ...} for log events, {"status": ...} for status events.
+type Event struct {
+	ID   int64
+	Type string
+	Data string
+}
+
+type eventStream struct {
+	owner       uuid.UUID
+	events      []Event
+	nextID      int64
+	closed      bool
+	subscribers map[chan Event]struct{}
+}
+
+var (
+	eventStreams = make(map[string]*eventStream)
+	eventsMutex  sync.Mutex
+)
+
+// OpenEventStream starts a stream for a job or deployment unless it is already open.
+// Publishing to a stream that was never opened is a no-op.
+func OpenEventStream(key string, owner uuid.UUID) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	if stream, ok := eventStreams[key]; ok && !stream.closed {
+		return
+	}
+	eventStreams[key] = &eventStream{owner: owner, nextID: 1, subscribers: map[chan Event]struct{}{}}
+}
+
+// PublishLog appends a log line to an open stream and fans it out to its subscribers
+func PublishLog(key, message string) {
+	publishEvent(key, LogEvent(0, message))
+}
+
+// PublishStatus appends a status change to an open stream
+func PublishStatus(key, status string) {
+	publishEvent(key, StatusEvent(0, status))
+}
+
+// CloseEventStream publishes the terminal status of a stream and ends it for all subscribers
+func CloseEventStream(key, status string) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	stream, ok := eventStreams[key]
+	if !ok || stream.closed {
+		return
+	}
+	publish(stream, StatusEvent(0, status))
+	stream.closed = true
+	for ch := range stream.subscribers {
+		close(ch)
+	}
+	stream.subscribers = nil
+
+	time.AfterFunc(streamRetention, func() {
+		eventsMutex.Lock()
+		defer eventsMutex.Unlock()
+		if eventStreams[key] == stream {
+			delete(eventStreams, key)
+		}
+	})
+}
+
+// EventStreamOwner returns the user a stream belongs to
+func EventStreamOwner(key string) (uuid.UUID, bool) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	stream, ok := eventStreams[key]
+	if !ok {
+		return uuid.Nil, false
+	}
+	return stream.owner, true
+}
+
+// SubscribeEvents returns the buffered events after afterID and a channel of the events that
+// follow. The channel is nil when the stream already ended and closed when it ends; a client
+// resuming an ended stream past its last event gets the terminal status again. ok is false
+// when the stream does not exist.
+func SubscribeEvents(key string, afterID int64) (backlog []Event, live <-chan Event, cancel func(), ok bool) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	stream, ok := eventStreams[key]
+	if !ok {
+		return nil, nil, func() {}, false
+	}
+
+	for _, event := range stream.events {
+		if event.ID > afterID {
+			backlog = append(backlog, event)
+		}
+	}
+	if stream.closed {
+		if len(backlog) == 0 && len(stream.events) > 0 {
+			backlog = stream.events[len(stream.events)-1:]
+		}
+		return backlog, nil, func() {}, true
+	}
+
+	ch := make(chan Event, 256)
+	stream.subscribers[ch] = struct{}{}
+	cancel = func() {
+		eventsMutex.Lock()
+		defer eventsMutex.Unlock()
+		if _, subscribed := stream.subscribers[ch]; subscribed {
+			delete(stream.subscribers, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel, true
+}
+
+// LogEvent builds a log event, e.g. to replay a stored log in the shape of a live stream
+func LogEvent(id int64, message string) Event {
+	return newEvent(id, EventLog, map[string]string{"message": message})
+}
+
+// StatusEvent builds a status event
+func StatusEvent(id int64, status string) Event {
+	return newEvent(id, EventStatus, map[string]string{"status": status})
+}
+
+// Helper Functions
+func newEvent(id int64, eventType string, payload map[string]string) Event {
+	data, _ := json.Marshal(payload)
+	return Event{ID: id, Type: eventType, Data: string(data)}
+}
+
+func publishEvent(key string, event Event) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	stream, ok := eventStreams[key]
+	if !ok || stream.closed {
+		return
+	}
+	publish(stream, event)
+}
+
+// publish numbers an event and delivers it; it must be called with eventsMutex held
+func publish(stream *eventStream, event Event) {
+	event.ID = stream.nextID
+	stream.nextID++
+	stream.events = append(stream.events, event)
+	if len(stream.events) > maxStreamEvents {
+		stream.events = stream.events[len(stream.events)-maxStreamEvents:]
+	}
+
+	for ch := range stream.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// A subscriber that cannot keep up is dropped; it can resume with Last-Event-ID
+			delete(stream.subscribers, ch)
+			close(ch)
+		}
+	}
+}